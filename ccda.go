@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/ccda"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// exportCcda renders the note, or the notes of the visit, named in req as a C-CDA document created at now. It is shared by the ExportCcda RPC and the ccda command.
+// RETURNS: *ExportCcdaResponse, error (a gRPC status)
+func exportCcda(db RDBMSAccessor, req *clerkpb.ExportCcdaRequest, now time.Time) (*clerkpb.ExportCcdaResponse, error) {
+	var notes []*ehrpb.Note
+	if req.NoteGuid != "" {
+		note, err := db.GetNoteByGuid(req.NoteGuid)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, NoteClerkErrWrap(err, ErrExportCcdaFailsGetNote,
+				req.NoteGuid).Error())
+		}
+		notes = append(notes, note)
+	} else {
+		var err error
+		notes, err = db.FindNotes(NoteFindFilter{VisitGuid: req.VisitGuid})
+		if err != nil || len(notes) == 0 {
+			return nil, status.Error(codes.NotFound, NoteClerkErrWrap(err, ErrExportCcdaFailsFindNotes,
+				req.VisitGuid).Error())
+		}
+		sort.SliceStable(notes, func(i, j int) bool {
+			return notes[i].GetDateCreated().GetSeconds() < notes[j].GetDateCreated().GetSeconds()
+		})
+	}
+
+	doc, err := ccda.NewDocument(notes, ccda.Options{
+		Type: ccda.DocumentType(req.DocumentType),
+		Id:   uuid.New().String(),
+		Time: now,
+	})
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, NoteClerkErrWrap(err, ErrExportCcdaFailsRender).Error())
+	}
+	data, err := ccda.Marshal(doc)
+	if err != nil {
+		return nil, status.Error(codes.Internal, NoteClerkErrWrap(err, ErrExportCcdaFailsMarshal).Error())
+	}
+
+	res := &clerkpb.ExportCcdaResponse{Document: string(data)}
+	for _, note := range notes {
+		if note.GetStatus() != ehrpb.RecordStatus_DELETED {
+			res.NoteGuids = append(res.NoteGuids, note.GetNoteGuid())
+		}
+	}
+	return res, nil
+}
+
+// ccdaCommand exports a note, or every note of a visit, from the database configured for the current
+// NOTECLERK_ENVIRONMENT as a C-CDA document, written to out or to a file.
+//
+//	noteclerk ccda export -note guid [-type progress|consultation] [-o file]
+//	noteclerk ccda export -visit guid [-type progress|consultation] [-o file]
+func ccdaCommand(args []string, out io.Writer) error {
+	action := ""
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	if action != "export" {
+		return NoteClerkErrNew(ErrCcdaCommandFailsUnknownAction, action)
+	}
+
+	req := &clerkpb.ExportCcdaRequest{}
+	flags := flag.NewFlagSet("ccda", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.StringVar(&req.NoteGuid, "note", "", "GUID of the note to export")
+	flags.StringVar(&req.VisitGuid, "visit", "", "GUID of the visit whose notes are exported")
+	flags.StringVar(&req.DocumentType, "type", string(ccda.ProgressNote), "document type: progress or consultation")
+	path := flags.String("o", "", "file to write the document to, instead of the standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := validateRequest(req, ContentLimits{}, nil); err != nil {
+		return NoteClerkErrNew(ErrCcdaCommandFailsExport, status.Convert(err).Message())
+	}
+
+	config, err := LoadConfiguration(configPath)
+	if err != nil {
+		return err
+	}
+	db := &DbPostgres{}
+	if err := db.Initialize(config); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return writeCcda(db, req, *path, out)
+}
+
+// writeCcda exports a document as the ccda command does, from db.
+// RETURNS: error
+func writeCcda(db RDBMSAccessor, req *clerkpb.ExportCcdaRequest, path string, out io.Writer) error {
+	res, err := exportCcda(db, req, time.Now())
+	if err != nil {
+		return NoteClerkErrNew(ErrCcdaCommandFailsExport, status.Convert(err).Message())
+	}
+	if path == "" {
+		_, err = io.WriteString(out, res.Document)
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(res.Document), 0644); err != nil {
+		return NoteClerkErrWrap(err, ErrCcdaCommandFailsWriteFile, path)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package ccda
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+)
+
+// cdaSchemaEnv names the official HL7 CDA R2 schema with the SDTC extensions, CDA_SDTC.xsd from
+// https://github.com/HL7/CDA-core-2.0, against which exported documents are validated by xmllint.
+const cdaSchemaEnv = "NOTECLERK_CDA_SCHEMA"
+
+// TestMarshal_ConformsToTheHl7CdaSchema is skipped where the schema is not set, except in CI, which sets CI and
+// must run it.
+func TestMarshal_ConformsToTheHl7CdaSchema(t *testing.T) {
+	schema := os.Getenv(cdaSchemaEnv)
+	if schema == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("%v must name the HL7 CDA_SDTC.xsd in CI", cdaSchemaEnv)
+		}
+		t.Skipf("%v is not set to the HL7 CDA_SDTC.xsd", cdaSchemaEnv)
+	}
+	if _, err := os.Stat(schema); err != nil {
+		t.Fatalf("%v names a schema which cannot be read: %v", cdaSchemaEnv, err)
+	}
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Fatalf("xmllint is needed to validate against %v: %v", schema, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "document.xml")
+	for _, notes := range [][]*ehrpb.Note{testNotes(), testNotes()[1:]} {
+		doc, err := NewDocument(notes, Options{Id: "2c9e6a7b-3d4f-4e5a-8b6c-7d8e9f0a1b2c", Time: time.Now()})
+		if err != nil {
+			t.Fatalf("NewDocument() error = %v", err)
+		}
+		data, err := Marshal(doc)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("Failed to write the document: %v", err)
+		}
+		if out, err := exec.Command(xmllint, "--noout", "--nonet", "--schema", schema, path).CombinedOutput(); err != nil {
+			t.Fatalf("The document does not conform to %v: %v\n%s", schema, err, out)
+		}
+	}
+}
@@ -0,0 +1,613 @@
+// Package ccda renders notes as C-CDA R2.1 documents, for sending to other organizations when a patient's care is
+// transferred.
+package ccda
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// ContentType is the media type of a C-CDA document.
+const ContentType = "application/xml"
+
+// Namespace is the CDA R2 namespace of every element in a document.
+const Namespace = "urn:hl7-org:v3"
+
+// Code system OIDs.
+const (
+	LoincOid           = "2.16.840.1.113883.6.1"
+	SnomedCtOid        = "2.16.840.1.113883.6.96"
+	Icd10CmOid         = "2.16.840.1.113883.6.90"
+	ConfidentialityOid = "2.16.840.1.113883.5.25"
+	ActCodeOid         = "2.16.840.1.113883.5.6"
+)
+
+// C-CDA R2.1 template ids, with their versions.
+var (
+	cdaTypeId                  = Id{Root: "2.16.840.1.113883.1.3", Extension: "POCD_HD000040"}
+	usRealmHeaderTemplate      = Id{Root: "2.16.840.1.113883.10.20.22.1.1", Extension: "2015-08-01"}
+	progressNoteTemplate       = Id{Root: "2.16.840.1.113883.10.20.22.1.9", Extension: "2015-08-01"}
+	consultationNoteTemplate   = Id{Root: "2.16.840.1.113883.10.20.22.1.4", Extension: "2015-08-01"}
+	problemSectionTemplate     = Id{Root: "2.16.840.1.113883.10.20.22.2.5.1", Extension: "2015-08-01"}
+	problemConcernActTemplate  = Id{Root: "2.16.840.1.113883.10.20.22.4.3", Extension: "2015-08-01"}
+	problemObservationTemplate = Id{Root: "2.16.840.1.113883.10.20.22.4.4", Extension: "2015-08-01"}
+)
+
+var (
+	problemSectionCode = Code{Code: "11450-4", CodeSystem: LoincOid, CodeSystemName: "LOINC",
+		DisplayName: "Problem list - Reported"}
+	problemConcernCode     = Code{Code: "CONC", CodeSystem: ActCodeOid, DisplayName: "Concern"}
+	problemObservationCode = Code{Code: "55607006", CodeSystem: SnomedCtOid, CodeSystemName: "SNOMED CT",
+		DisplayName: "Problem", Translations: []Code{
+			{Code: "75326-9", CodeSystem: LoincOid, CodeSystemName: "LOINC", DisplayName: "Problem"},
+		}}
+)
+
+// DocumentType is the kind of C-CDA document rendered.
+type DocumentType string
+
+const (
+	ProgressNote     DocumentType = "progress"
+	ConsultationNote DocumentType = "consultation"
+)
+
+var documentTypes = map[DocumentType]struct {
+	template Id
+	code     Code
+	title    string
+}{
+	ProgressNote: {progressNoteTemplate,
+		Code{Code: "11506-3", CodeSystem: LoincOid, CodeSystemName: "LOINC", DisplayName: "Progress note"},
+		"Progress Note"},
+	ConsultationNote: {consultationNoteTemplate,
+		Code{Code: "11488-4", CodeSystem: LoincOid, CodeSystemName: "LOINC", DisplayName: "Consult note"},
+		"Consultation Note"},
+}
+
+// sectionTemplate describes the C-CDA section a fragment type is rendered into.
+type sectionTemplate struct {
+	templates []Id
+	code      string
+	display   string
+	title     string
+}
+
+// sections gives the C-CDA section for each fragment type, keyed by enum name, in the order they appear in a
+// document. Fragments of other types are rendered into uncoded sections after these, titled by their type.
+var sections = []struct {
+	fragmentType string
+	sectionTemplate
+}{
+	{"CHIEF_COMPLAINT", sectionTemplate{[]Id{{Root: "1.3.6.1.4.1.19376.1.5.3.1.1.13.2.1"}}, "10154-3",
+		"Chief complaint", "Chief Complaint"}},
+	{"HISTORY_OF_PRESENT_ILLNESS", sectionTemplate{[]Id{{Root: "1.3.6.1.4.1.19376.1.5.3.1.3.4"}}, "10164-2",
+		"History of present illness", "History of Present Illness"}},
+	{"SUBJECTIVE", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.21.2.2"}}, "61150-9",
+		"Subjective", "Subjective"}},
+	{"REVIEW_OF_SYSTEMS", sectionTemplate{[]Id{{Root: "1.3.6.1.4.1.19376.1.5.3.1.3.18"}}, "10187-3",
+		"Review of systems", "Review of Systems"}},
+	{"MEDICAL_HISTORY", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.22.2.20", Extension: "2015-08-01"}},
+		"11348-0", "History of past illness", "Past Medical History"}},
+	{"SURGICAL_HISTORY", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.22.2.7", Extension: "2014-06-09"}},
+		"47519-4", "History of procedures", "Procedures"}},
+	{"FAMILY_HISTORY", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.22.2.15", Extension: "2015-08-01"}},
+		"10157-6", "History of family member diseases", "Family History"}},
+	{"SOCIAL_HISTORY", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.22.2.17", Extension: "2015-08-01"}},
+		"29762-2", "Social history", "Social History"}},
+	{"ALLERGIES", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.22.2.6", Extension: "2015-08-01"}},
+		"48765-2", "Allergies and adverse reactions", "Allergies"}},
+	{"MEDICATIONS", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.22.2.1", Extension: "2014-06-09"}},
+		"10160-0", "History of medication use", "Medications"}},
+	{"OBJECTIVE", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.21.2.1"}}, "61149-1",
+		"Objective", "Objective"}},
+	{"PHYSICAL_EXAM", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.2.10", Extension: "2015-08-01"}},
+		"29545-1", "Physical findings", "Physical Exam"}},
+	{"ASSESSMENT", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.22.2.8"}}, "51848-0",
+		"Assessment", "Assessment"}},
+	{"PLAN", sectionTemplate{[]Id{{Root: "2.16.840.1.113883.10.20.22.2.10", Extension: "2014-06-09"}}, "18776-5",
+		"Plan of treatment", "Plan of Treatment"}},
+}
+
+// Options are the parts of a document which do not come from its notes.
+type Options struct {
+	// Type is the kind of document, ProgressNote when empty.
+	Type DocumentType
+	// Id is the document's unique id, a UUID or OID.
+	Id string
+	// Time is when the document was created.
+	Time time.Time
+	// Custodian is the name of the organization responsible for the document.
+	Custodian string
+}
+
+// ClinicalDocument is the root of a CDA document. Only the parts written by NewDocument are modelled.
+type ClinicalDocument struct {
+	XMLName             xml.Name      `xml:"urn:hl7-org:v3 ClinicalDocument"`
+	XsiNamespace        string        `xml:"xmlns:xsi,attr"`
+	RealmCode           Code          `xml:"realmCode"`
+	TypeId              Id            `xml:"typeId"`
+	TemplateIds         []Id          `xml:"templateId"`
+	Id                  Id            `xml:"id"`
+	Code                Code          `xml:"code"`
+	Title               string        `xml:"title"`
+	EffectiveTime       Time          `xml:"effectiveTime"`
+	ConfidentialityCode Code          `xml:"confidentialityCode"`
+	LanguageCode        Code          `xml:"languageCode"`
+	RecordTarget        RecordTarget  `xml:"recordTarget"`
+	Authors             []Author      `xml:"author"`
+	Custodian           Custodian     `xml:"custodian"`
+	ComponentOf         *ComponentOf  `xml:"componentOf"`
+	Component           BodyComponent `xml:"component"`
+}
+
+// Id is an instance identifier (II).
+type Id struct {
+	Root       string `xml:"root,attr,omitempty"`
+	Extension  string `xml:"extension,attr,omitempty"`
+	NullFlavor string `xml:"nullFlavor,attr,omitempty"`
+}
+
+// Code is a coded value (CS, CE or CD). Type is set to 'CD' where the element's type is not fixed by CDA.
+type Code struct {
+	Type           string `xml:"xsi:type,attr,omitempty"`
+	Code           string `xml:"code,attr,omitempty"`
+	CodeSystem     string `xml:"codeSystem,attr,omitempty"`
+	CodeSystemName string `xml:"codeSystemName,attr,omitempty"`
+	DisplayName    string `xml:"displayName,attr,omitempty"`
+	NullFlavor     string `xml:"nullFlavor,attr,omitempty"`
+	Translations   []Code `xml:"translation"`
+}
+
+// Time is a point in time (TS).
+type Time struct {
+	Value      string `xml:"value,attr,omitempty"`
+	NullFlavor string `xml:"nullFlavor,attr,omitempty"`
+}
+
+// Interval is an interval of time (IVL_TS), of which only the beginning is written.
+type Interval struct {
+	Low Time `xml:"low"`
+}
+
+// Null is an address, telecom or name which is not known.
+type Null struct {
+	NullFlavor string `xml:"nullFlavor,attr"`
+}
+
+type RecordTarget struct {
+	PatientRole PatientRole `xml:"patientRole"`
+}
+
+type PatientRole struct {
+	Id      Id      `xml:"id"`
+	Addr    Null    `xml:"addr"`
+	Telecom Null    `xml:"telecom"`
+	Patient Patient `xml:"patient"`
+}
+
+type Patient struct {
+	Name                     Null `xml:"name"`
+	AdministrativeGenderCode Code `xml:"administrativeGenderCode"`
+	BirthTime                Time `xml:"birthTime"`
+}
+
+type Author struct {
+	Time           Time           `xml:"time"`
+	AssignedAuthor AssignedAuthor `xml:"assignedAuthor"`
+}
+
+type AssignedAuthor struct {
+	Id             Id     `xml:"id"`
+	Addr           Null   `xml:"addr"`
+	Telecom        Null   `xml:"telecom"`
+	AssignedPerson Person `xml:"assignedPerson"`
+}
+
+type Person struct {
+	Name Null `xml:"name"`
+}
+
+type Custodian struct {
+	Organization Organization `xml:"assignedCustodian>representedCustodianOrganization"`
+}
+
+type Organization struct {
+	Id      Id     `xml:"id"`
+	Name    string `xml:"name"`
+	Telecom Null   `xml:"telecom"`
+	Addr    Null   `xml:"addr"`
+}
+
+type ComponentOf struct {
+	Encounter Encounter `xml:"encompassingEncounter"`
+}
+
+type Encounter struct {
+	Id            Id       `xml:"id"`
+	EffectiveTime Interval `xml:"effectiveTime"`
+}
+
+type BodyComponent struct {
+	StructuredBody StructuredBody `xml:"structuredBody"`
+}
+
+type StructuredBody struct {
+	Components []SectionComponent `xml:"component"`
+}
+
+type SectionComponent struct {
+	Section Section `xml:"section"`
+}
+
+// Section is a section of the document body. Its text is narrative markup, written as it is.
+type Section struct {
+	TemplateIds []Id      `xml:"templateId"`
+	Code        Code      `xml:"code"`
+	Title       string    `xml:"title"`
+	Text        Narrative `xml:"text"`
+	Entries     []Entry   `xml:"entry"`
+}
+
+type Narrative struct {
+	Markup string `xml:",innerxml"`
+}
+
+type Entry struct {
+	TypeCode string `xml:"typeCode,attr"`
+	Act      Act    `xml:"act"`
+}
+
+type Act struct {
+	ClassCode         string            `xml:"classCode,attr"`
+	MoodCode          string            `xml:"moodCode,attr"`
+	TemplateIds       []Id              `xml:"templateId"`
+	Id                Id                `xml:"id"`
+	Code              Code              `xml:"code"`
+	StatusCode        Code              `xml:"statusCode"`
+	EffectiveTime     Interval          `xml:"effectiveTime"`
+	EntryRelationship EntryRelationship `xml:"entryRelationship"`
+}
+
+type EntryRelationship struct {
+	TypeCode    string      `xml:"typeCode,attr"`
+	Observation Observation `xml:"observation"`
+}
+
+type Observation struct {
+	ClassCode     string   `xml:"classCode,attr"`
+	MoodCode      string   `xml:"moodCode,attr"`
+	TemplateIds   []Id     `xml:"templateId"`
+	Id            Id       `xml:"id"`
+	Code          Code     `xml:"code"`
+	Text          *TextRef `xml:"text"`
+	StatusCode    Code     `xml:"statusCode"`
+	EffectiveTime Interval `xml:"effectiveTime"`
+	Value         Code     `xml:"value"`
+}
+
+// TextRef points from an entry to the narrative it was rendered as.
+type TextRef struct {
+	Reference struct {
+		Value string `xml:"value,attr"`
+	} `xml:"reference"`
+}
+
+// NewDocument renders notes as a single C-CDA document. The notes must be for the same patient, and are usually
+// one note or every note of a visit. Fragments are rendered into the section for their type, in the order of
+// the notes and then of their fragments, and every fragment coded with ICD-10-CM also becomes an entry in the
+// Problem Section. Deleted notes and fragments are left out.
+// RETURNS: *ClinicalDocument, error
+func NewDocument(notes []*ehrpb.Note, opts Options) (*ClinicalDocument, error) {
+	if opts.Type == "" {
+		opts.Type = ProgressNote
+	}
+	docType, ok := documentTypes[opts.Type]
+	if !ok {
+		return nil, fmt.Errorf("%q is not a document type; use %v or %v", opts.Type, ProgressNote, ConsultationNote)
+	}
+
+	var active []*ehrpb.Note
+	for _, note := range notes {
+		if note.GetStatus() != ehrpb.RecordStatus_DELETED {
+			active = append(active, note)
+		}
+	}
+	if len(active) == 0 {
+		return nil, errors.New("there are no notes to render, as every note is deleted")
+	}
+	patient := active[0].GetPatientGuid()
+	for _, note := range active {
+		if note.GetPatientGuid() != patient {
+			return nil, fmt.Errorf("the notes are for more than one patient, %v and %v", patient, note.GetPatientGuid())
+		}
+	}
+
+	doc := &ClinicalDocument{
+		XsiNamespace:        "http://www.w3.org/2001/XMLSchema-instance",
+		RealmCode:           Code{Code: "US"},
+		TypeId:              cdaTypeId,
+		TemplateIds:         []Id{usRealmHeaderTemplate, docType.template},
+		Id:                  Id{Root: opts.Id},
+		Code:                docType.code,
+		Title:               docType.title,
+		EffectiveTime:       Time{Value: formatTime(opts.Time)},
+		ConfidentialityCode: Code{Code: "N", CodeSystem: ConfidentialityOid, DisplayName: "normal"},
+		LanguageCode:        Code{Code: "en-US"},
+		RecordTarget: RecordTarget{PatientRole: PatientRole{
+			Id:      guidId(patient),
+			Addr:    Null{NullFlavor: "UNK"},
+			Telecom: Null{NullFlavor: "UNK"},
+			Patient: Patient{
+				Name:                     Null{NullFlavor: "UNK"},
+				AdministrativeGenderCode: Code{NullFlavor: "UNK"},
+				BirthTime:                Time{NullFlavor: "UNK"},
+			},
+		}},
+		Custodian: Custodian{Organization: Organization{
+			Id:      Id{NullFlavor: "NI"},
+			Name:    opts.Custodian,
+			Telecom: Null{NullFlavor: "UNK"},
+			Addr:    Null{NullFlavor: "UNK"},
+		}},
+	}
+	if doc.Custodian.Organization.Name == "" {
+		doc.Custodian.Organization.Name = "NoteClerk"
+	}
+
+	authors := map[string]bool{}
+	for _, note := range active {
+		if authors[note.GetAuthorGuid()] {
+			continue
+		}
+		authors[note.GetAuthorGuid()] = true
+		doc.Authors = append(doc.Authors, Author{
+			Time: timestampTime(note.GetDateCreated()),
+			AssignedAuthor: AssignedAuthor{
+				Id:             guidId(note.GetAuthorGuid()),
+				Addr:           Null{NullFlavor: "UNK"},
+				Telecom:        Null{NullFlavor: "UNK"},
+				AssignedPerson: Person{Name: Null{NullFlavor: "UNK"}},
+			},
+		})
+	}
+
+	if visit := active[0].GetVisitGuid(); visit != "" && sameVisit(active, visit) {
+		doc.ComponentOf = &ComponentOf{Encounter: Encounter{
+			Id:            guidId(visit),
+			EffectiveTime: Interval{Low: timestampTime(earliest(active))},
+		}}
+	}
+
+	for _, section := range bodySections(active) {
+		doc.Component.StructuredBody.Components = append(doc.Component.StructuredBody.Components,
+			SectionComponent{Section: section})
+	}
+	return doc, nil
+}
+
+// bodySections groups the fragments of notes into sections, and adds the Problem Section for those coded with
+// ICD-10-CM.
+func bodySections(notes []*ehrpb.Note) []Section {
+	grouped := map[string][]*ehrpb.NoteFragment{}
+	var unmapped []string
+	var problems []*ehrpb.NoteFragment
+	problemCodes := map[string]bool{}
+	for _, note := range notes {
+		for _, frag := range note.GetFragments() {
+			if frag.GetStatus() == ehrpb.RecordStatus_DELETED {
+				continue
+			}
+			name := ehrpb.FragmentType_name[int32(frag.GetTopic())]
+			if _, ok := grouped[name]; !ok && !mapped(name) {
+				unmapped = append(unmapped, name)
+			}
+			grouped[name] = append(grouped[name], frag)
+
+			if code := frag.GetIcd_10Code(); code != "" && !problemCodes[code] {
+				problemCodes[code] = true
+				if frag.GetDateCreated() == nil {
+					frag = withDateCreated(frag, note.GetDateCreated())
+				}
+				problems = append(problems, frag)
+			}
+		}
+	}
+
+	var result []Section
+	for _, s := range sections {
+		if frags, ok := grouped[s.fragmentType]; ok {
+			result = append(result, Section{
+				TemplateIds: s.templates,
+				Code:        Code{Code: s.code, CodeSystem: LoincOid, CodeSystemName: "LOINC", DisplayName: s.display},
+				Title:       s.title,
+				Text:        fragmentNarrative(frags),
+			})
+		}
+	}
+	for _, name := range unmapped {
+		result = append(result, Section{
+			Code:  Code{NullFlavor: "OTH"},
+			Title: enumDisplay(name),
+			Text:  fragmentNarrative(grouped[name]),
+		})
+	}
+	if len(problems) > 0 {
+		result = append(result, problemSection(problems))
+	}
+	return result
+}
+
+func mapped(fragmentType string) bool {
+	for _, s := range sections {
+		if s.fragmentType == fragmentType {
+			return true
+		}
+	}
+	return false
+}
+
+// fragmentNarrative renders each fragment as a paragraph captioned by its description.
+func fragmentNarrative(frags []*ehrpb.NoteFragment) Narrative {
+	var b strings.Builder
+	for _, frag := range frags {
+		b.WriteString("<paragraph>")
+		if frag.GetDescription() != "" {
+			b.WriteString("<caption>" + escape(frag.GetDescription()) + "</caption>")
+		}
+		for k, line := range strings.Split(frag.GetContent(), "\n") {
+			if k > 0 {
+				b.WriteString("<br/>")
+			}
+			b.WriteString(escape(line))
+		}
+		b.WriteString("</paragraph>")
+	}
+	return Narrative{Markup: b.String()}
+}
+
+// problemSection renders a Problem Concern Act, holding a Problem Observation, for each ICD-10-CM coded fragment.
+// Each observation refers to its item in the section's narrative list.
+func problemSection(frags []*ehrpb.NoteFragment) Section {
+	section := Section{
+		TemplateIds: []Id{problemSectionTemplate},
+		Code:        problemSectionCode,
+		Title:       "Problems",
+	}
+
+	var b strings.Builder
+	b.WriteString("<list>")
+	for k, frag := range frags {
+		ref := fmt.Sprintf("problem-%v", k+1)
+		display := frag.GetIcd_10Long()
+		if display == "" {
+			display = frag.GetDescription()
+		}
+		fmt.Fprintf(&b, `<item><content ID="%v">%v (ICD-10-CM %v)</content></item>`, ref, escape(display),
+			escape(frag.GetIcd_10Code()))
+
+		onset := Interval{Low: timestampTime(frag.GetDateCreated())}
+		observation := Observation{
+			ClassCode:     "OBS",
+			MoodCode:      "EVN",
+			TemplateIds:   []Id{problemObservationTemplate},
+			Id:            fragmentId(frag, "problem"),
+			Code:          problemObservationCode,
+			Text:          &TextRef{},
+			StatusCode:    Code{Code: "completed"},
+			EffectiveTime: onset,
+			Value: Code{Type: "CD", Code: frag.GetIcd_10Code(), CodeSystem: Icd10CmOid, CodeSystemName: "ICD-10-CM",
+				DisplayName: frag.GetIcd_10Long()},
+		}
+		observation.Text.Reference.Value = "#" + ref
+		section.Entries = append(section.Entries, Entry{
+			TypeCode: "DRIV",
+			Act: Act{
+				ClassCode:         "ACT",
+				MoodCode:          "EVN",
+				TemplateIds:       []Id{problemConcernActTemplate},
+				Id:                fragmentId(frag, "concern"),
+				Code:              problemConcernCode,
+				StatusCode:        Code{Code: "active"},
+				EffectiveTime:     onset,
+				EntryRelationship: EntryRelationship{TypeCode: "SUBJ", Observation: observation},
+			},
+		})
+	}
+	b.WriteString("</list>")
+	section.Text = Narrative{Markup: b.String()}
+	return section
+}
+
+// Marshal writes a document as indented XML with an XML declaration.
+// RETURNS: []byte, error
+func Marshal(doc *ClinicalDocument) ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// guidId identifies a patient, author or visit by its GUID, or as not known when there is none.
+func guidId(guid string) Id {
+	if guid == "" {
+		return Id{NullFlavor: "NI"}
+	}
+	return Id{Root: guid}
+}
+
+// fragmentId identifies an entry made from a fragment. A fragment gives rise to more than one entry, so each is
+// told apart by kind.
+func fragmentId(frag *ehrpb.NoteFragment, kind string) Id {
+	if frag.GetNoteFragmentGuid() == "" {
+		return Id{NullFlavor: "NI"}
+	}
+	return Id{Root: frag.GetNoteFragmentGuid(), Extension: kind}
+}
+
+func withDateCreated(frag *ehrpb.NoteFragment, ts *timestamp.Timestamp) *ehrpb.NoteFragment {
+	copied := *frag
+	copied.DateCreated = ts
+	return &copied
+}
+
+func sameVisit(notes []*ehrpb.Note, visit string) bool {
+	for _, note := range notes {
+		if note.GetVisitGuid() != visit {
+			return false
+		}
+	}
+	return true
+}
+
+// earliest returns the creation time of the first of notes to be created.
+func earliest(notes []*ehrpb.Note) *timestamp.Timestamp {
+	var times []*timestamp.Timestamp
+	for _, note := range notes {
+		if note.GetDateCreated() != nil {
+			times = append(times, note.GetDateCreated())
+		}
+	}
+	if len(times) == 0 {
+		return nil
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].GetSeconds() < times[j].GetSeconds() ||
+			(times[i].GetSeconds() == times[j].GetSeconds() && times[i].GetNanos() < times[j].GetNanos())
+	})
+	return times[0]
+}
+
+func timestampTime(ts *timestamp.Timestamp) Time {
+	if ts == nil {
+		return Time{NullFlavor: "UNK"}
+	}
+	return Time{Value: formatTime(time.Unix(ts.GetSeconds(), int64(ts.GetNanos())))}
+}
+
+// formatTime formats t as a CDA timestamp, to the second, in UTC.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102150405") + "+0000"
+}
+
+func escape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// enumDisplay turns an enum name such as HISTORY_AND_PHYSICAL into 'History and physical'.
+func enumDisplay(name string) string {
+	if name == "" {
+		return ""
+	}
+	words := strings.ToLower(strings.Replace(name, "_", " ", -1))
+	return strings.ToUpper(words[:1]) + words[1:]
+}
@@ -0,0 +1,170 @@
+package ccda
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+const (
+	testPatient = "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c6d"
+	testVisit   = "0f1e2d3c-4b5a-4978-8695-a4b3c2d1e0f9"
+	testAuthor  = "9e8d7c6b-5a49-4382-9170-6f5e4d3c2b1a"
+)
+
+func testNotes() []*ehrpb.Note {
+	return []*ehrpb.Note{
+		{
+			DateCreated: &timestamp.Timestamp{Seconds: 1552555800},
+			NoteGuid:    "4a3f1a6c-4f5e-4a6e-9b8a-2f3c1d0e9b7a",
+			VisitGuid:   testVisit,
+			AuthorGuid:  testAuthor,
+			PatientGuid: testPatient,
+			Type:        ehrpb.NoteType_HISTORY_AND_PHYSICAL,
+			Status:      ehrpb.RecordStatus_ACTIVE,
+			Fragments: []*ehrpb.NoteFragment{
+				{
+					NoteFragmentGuid: "7d8e9f0a-1b2c-4d3e-8f4a-5b6c7d8e9f0a",
+					Description:      "Hypertension",
+					Content:          "Diagnosed in 2010.",
+					Topic:            ehrpb.FragmentType_MEDICAL_HISTORY,
+					Status:           ehrpb.RecordStatus_ACTIVE,
+					Icd_10Code:       "I10",
+					Icd_10Long:       "Essential (primary) hypertension",
+				},
+				{
+					NoteFragmentGuid: "5b6c7d8e-9f0a-4b1c-8d2e-3f4a5b6c7d8e",
+					Description:      "Chest pain",
+					Content:          "Pain began <2 hours ago.\nWorse on exertion.",
+					Topic:            ehrpb.FragmentType_SUBJECTIVE,
+					Status:           ehrpb.RecordStatus_ACTIVE,
+				},
+				{
+					Description: "Retracted",
+					Content:     "Entered in error.",
+					Topic:       ehrpb.FragmentType_SUBJECTIVE,
+					Status:      ehrpb.RecordStatus_DELETED,
+				},
+			},
+		},
+		{
+			DateCreated: &timestamp.Timestamp{Seconds: 1552559400},
+			NoteGuid:    "6c7d8e9f-0a1b-4c2d-9e3f-4a5b6c7d8e9f",
+			VisitGuid:   testVisit,
+			AuthorGuid:  testAuthor,
+			PatientGuid: testPatient,
+			Type:        ehrpb.NoteType_CONTINUED_CARE_DOCUMENTATION,
+			Status:      ehrpb.RecordStatus_ACTIVE,
+			Fragments: []*ehrpb.NoteFragment{
+				{
+					NoteFragmentGuid: "8e9f0a1b-2c3d-4e4f-9a5b-6c7d8e9f0a1b",
+					Description:      "Follow up",
+					Content:          "Pain has resolved.",
+					Topic:            ehrpb.FragmentType_SUBJECTIVE,
+					Status:           ehrpb.RecordStatus_ACTIVE,
+				},
+				{
+					Description: "Untyped",
+					Content:     "Seen with family.",
+					Status:      ehrpb.RecordStatus_ACTIVE,
+				},
+			},
+		},
+	}
+}
+
+func testOptions() Options {
+	return Options{
+		Type: ConsultationNote,
+		Id:   "2c9e6a7b-3d4f-4e5a-8b6c-7d8e9f0a1b2c",
+		Time: time.Date(2019, 3, 15, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestNewDocument(t *testing.T) {
+	doc, err := NewDocument(testNotes(), testOptions())
+	if err != nil {
+		t.Fatalf("NewDocument() error = %v", err)
+	}
+
+	if doc.Code.Code != "11488-4" || doc.TemplateIds[1] != consultationNoteTemplate {
+		t.Fatalf("NewDocument() did not make a consultation note: %v, %v", doc.Code, doc.TemplateIds)
+	}
+	if doc.EffectiveTime.Value != "20190315080000+0000" || doc.RecordTarget.PatientRole.Id.Root != testPatient {
+		t.Fatalf("NewDocument() header = %v, %v", doc.EffectiveTime, doc.RecordTarget.PatientRole.Id)
+	}
+	if len(doc.Authors) != 1 || doc.Authors[0].Time.Value != "20190314093000+0000" {
+		t.Fatalf("NewDocument() should name each author once: %v", doc.Authors)
+	}
+	if doc.ComponentOf == nil || doc.ComponentOf.Encounter.Id.Root != testVisit {
+		t.Fatalf("NewDocument() did not name the visit: %v", doc.ComponentOf)
+	}
+
+	var sections []Section
+	var titles []string
+	for _, c := range doc.Component.StructuredBody.Components {
+		sections = append(sections, c.Section)
+		titles = append(titles, c.Section.Title)
+	}
+	if got := strings.Join(titles, ", "); got != "Subjective, Past Medical History, No fragment type, Problems" {
+		t.Fatalf("NewDocument() sections = %v", got)
+	}
+
+	subjective := sections[0]
+	want := "<paragraph><caption>Chest pain</caption>Pain began &lt;2 hours ago.<br/>Worse on exertion.</paragraph>" +
+		"<paragraph><caption>Follow up</caption>Pain has resolved.</paragraph>"
+	if subjective.Code.Code != "61150-9" || subjective.Text.Markup != want {
+		t.Fatalf("NewDocument() Subjective section = %v, %q", subjective.Code, subjective.Text.Markup)
+	}
+
+	problems := sections[3]
+	if len(problems.Entries) != 1 {
+		t.Fatalf("NewDocument() made %v problem entries, want 1", len(problems.Entries))
+	}
+	observation := problems.Entries[0].Act.EntryRelationship.Observation
+	if observation.Value.Code != "I10" || observation.Value.CodeSystem != Icd10CmOid ||
+		observation.EffectiveTime.Low.Value != "20190314093000+0000" || observation.Text.Reference.Value != "#problem-1" {
+		t.Fatalf("NewDocument() problem observation = %+v", observation)
+	}
+}
+
+func TestNewDocument_Errors(t *testing.T) {
+	notes := testNotes()
+	notes[1].PatientGuid = "3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f"
+	if _, err := NewDocument(notes, testOptions()); err == nil {
+		t.Fatalf("NewDocument() should refuse notes for more than one patient")
+	}
+
+	notes = testNotes()
+	for _, note := range notes {
+		note.Status = ehrpb.RecordStatus_DELETED
+	}
+	if _, err := NewDocument(notes, testOptions()); err == nil {
+		t.Fatalf("NewDocument() should refuse to render only deleted notes")
+	}
+
+	opts := testOptions()
+	opts.Type = "discharge"
+	if _, err := NewDocument(testNotes(), opts); err == nil {
+		t.Fatalf("NewDocument() should refuse an unknown document type")
+	}
+}
+
+func TestMarshal_TypesProblemValues(t *testing.T) {
+	for _, notes := range [][]*ehrpb.Note{testNotes(), testNotes()[1:]} {
+		doc, err := NewDocument(notes, Options{Id: "2c9e6a7b-3d4f-4e5a-8b6c-7d8e9f0a1b2c", Time: time.Now()})
+		if err != nil {
+			t.Fatalf("NewDocument() error = %v", err)
+		}
+		data, err := Marshal(doc)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		if !strings.Contains(string(data), `<value xsi:type="CD" code="I10"`) && len(notes) > 1 {
+			t.Fatalf("Marshal() did not type the problem value:\n%s", data)
+		}
+	}
+}
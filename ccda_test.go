@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/ccda"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// addVisitNotes adds two notes for one visit to db, the second created first.
+func addVisitNotes(t *testing.T, db *MockDb) (visit string, guids []string) {
+	visit, patient := uuid.New().String(), uuid.New().String()
+	for _, seconds := range []int64{1552559400, 1552555800} {
+		note := &ehrpb.Note{
+			DateCreated: &timestamp.Timestamp{Seconds: seconds},
+			NoteGuid:    uuid.New().String(),
+			VisitGuid:   visit,
+			PatientGuid: patient,
+			AuthorGuid:  uuid.New().String(),
+			Status:      ehrpb.RecordStatus_ACTIVE,
+			Fragments: []*ehrpb.NoteFragment{
+				{NoteFragmentGuid: uuid.New().String(), Topic: ehrpb.FragmentType_MEDICAL_HISTORY,
+					Status: ehrpb.RecordStatus_ACTIVE, Description: "Asthma", Content: "Since childhood.",
+					Icd_10Code: "J45.909", Icd_10Long: "Unspecified asthma, uncomplicated"},
+			},
+		}
+		if _, _, err := db.AddNote(note); err != nil {
+			t.Fatalf("Failed to add a note: %v", err)
+		}
+		guids = append([]string{note.NoteGuid}, guids...)
+	}
+	return visit, guids
+}
+
+func TestServer_ExportCcda(t *testing.T) {
+	s, db := newMockDbServer(t)
+	visit, guids := addVisitNotes(t, db)
+
+	res, err := s.ExportCcda(context.Background(), &clerkpb.ExportCcdaRequest{VisitGuid: visit, DocumentType: "consultation"})
+	if err != nil {
+		t.Fatalf("ExportCcda should succeed, but returned %v", err)
+	}
+	if strings.Join(res.NoteGuids, ",") != strings.Join(guids, ",") {
+		t.Fatalf("Expected the notes of the visit in the order they were created, %v, but got %v", guids,
+			res.NoteGuids)
+	}
+	if err := xml.Unmarshal([]byte(res.Document), new(ccda.ClinicalDocument)); err != nil {
+		t.Fatalf("Expected a well-formed document, but got %v", err)
+	}
+	if !strings.Contains(res.Document, `<title>Consultation Note</title>`) ||
+		!strings.Contains(res.Document, `code="J45.909" codeSystem="2.16.840.1.113883.6.90"`) {
+		t.Fatalf("Expected a consultation note with a problem entry, but got %v", res.Document)
+	}
+
+	res, err = s.ExportCcda(context.Background(), &clerkpb.ExportCcdaRequest{NoteGuid: guids[1]})
+	if err != nil || len(res.NoteGuids) != 1 || !strings.Contains(res.Document, "<title>Progress Note</title>") {
+		t.Fatalf("Expected a progress note for a single note, but got %v, %v", res, err)
+	}
+
+	_, err = s.ExportCcda(context.Background(), &clerkpb.ExportCcdaRequest{NoteGuid: uuid.New().String()})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound for an unknown note, but got %v", err)
+	}
+}
+
+func TestValidateRequest_ExportCcda(t *testing.T) {
+	guid := uuid.New().String()
+	for _, req := range []*clerkpb.ExportCcdaRequest{
+		{},
+		{NoteGuid: guid, VisitGuid: guid},
+		{NoteGuid: "not a guid"},
+		{VisitGuid: guid, DocumentType: "discharge"},
+	} {
+		if err := validateRequest(req, ContentLimits{}, nil); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected %+v to be invalid, but got %v", req, err)
+		}
+	}
+	if err := validateRequest(&clerkpb.ExportCcdaRequest{VisitGuid: guid}, ContentLimits{}, nil); err != nil {
+		t.Fatalf("Expected a visit export to be valid, but got %v", err)
+	}
+}
+
+func TestWriteCcda(t *testing.T) {
+	db := &MockDb{}
+	db.Initialize(nil)
+	visit, _ := addVisitNotes(t, db)
+
+	var out bytes.Buffer
+	if err := writeCcda(db, &clerkpb.ExportCcdaRequest{VisitGuid: visit}, "", &out); err != nil {
+		t.Fatalf("writeCcda should succeed, but returned %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "<?xml") {
+		t.Fatalf("Expected the document on the output, but got %q", out.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "visit.xml")
+	if err := writeCcda(db, &clerkpb.ExportCcdaRequest{VisitGuid: visit}, path, &out); err != nil {
+		t.Fatalf("writeCcda should succeed, but returned %v", err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || xml.Unmarshal(data, new(ccda.ClinicalDocument)) != nil {
+		t.Fatalf("Expected a well-formed document in %v, but got %v", path, err)
+	}
+
+	if err := ccdaCommand([]string{"export", "-note", "not a guid"}, &out); err == nil {
+		t.Fatalf("ccda export should refuse an invalid note GUID")
+	}
+}
@@ -0,0 +1,1474 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: clerkpb/clerkservice.proto
+
+package clerkpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// LookupIcd10CodesRequest asks for ICD-10-CM codes matching a code prefix or words from the description.
+type LookupIcd10CodesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupIcd10CodesRequest) Reset() {
+	*x = LookupIcd10CodesRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupIcd10CodesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupIcd10CodesRequest) ProtoMessage() {}
+
+func (x *LookupIcd10CodesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupIcd10CodesRequest.ProtoReflect.Descriptor instead.
+func (*LookupIcd10CodesRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupIcd10CodesRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *LookupIcd10CodesRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+// LookupIcd10CodesResponse carries the matching codes, ordered by code.
+type LookupIcd10CodesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Codes         []*Icd10Code           `protobuf:"bytes,1,rep,name=codes,proto3" json:"codes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupIcd10CodesResponse) Reset() {
+	*x = LookupIcd10CodesResponse{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupIcd10CodesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupIcd10CodesResponse) ProtoMessage() {}
+
+func (x *LookupIcd10CodesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupIcd10CodesResponse.ProtoReflect.Descriptor instead.
+func (*LookupIcd10CodesResponse) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LookupIcd10CodesResponse) GetCodes() []*Icd10Code {
+	if x != nil {
+		return x.Codes
+	}
+	return nil
+}
+
+// Icd10Code is an ICD-10-CM code and its long description.
+type Icd10Code struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Icd10Code) Reset() {
+	*x = Icd10Code{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Icd10Code) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Icd10Code) ProtoMessage() {}
+
+func (x *Icd10Code) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Icd10Code.ProtoReflect.Descriptor instead.
+func (*Icd10Code) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Icd10Code) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Icd10Code) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+// ExportCcdaRequest asks for one note, or every note of a visit, as a C-CDA R2.1 document. Exactly one of note_guid
+// and visit_guid is given. document_type is 'progress', the default, or 'consultation'.
+type ExportCcdaRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NoteGuid      string                 `protobuf:"bytes,1,opt,name=note_guid,json=noteGuid,proto3" json:"note_guid,omitempty"`
+	VisitGuid     string                 `protobuf:"bytes,2,opt,name=visit_guid,json=visitGuid,proto3" json:"visit_guid,omitempty"`
+	DocumentType  string                 `protobuf:"bytes,3,opt,name=document_type,json=documentType,proto3" json:"document_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportCcdaRequest) Reset() {
+	*x = ExportCcdaRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportCcdaRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportCcdaRequest) ProtoMessage() {}
+
+func (x *ExportCcdaRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportCcdaRequest.ProtoReflect.Descriptor instead.
+func (*ExportCcdaRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ExportCcdaRequest) GetNoteGuid() string {
+	if x != nil {
+		return x.NoteGuid
+	}
+	return ""
+}
+
+func (x *ExportCcdaRequest) GetVisitGuid() string {
+	if x != nil {
+		return x.VisitGuid
+	}
+	return ""
+}
+
+func (x *ExportCcdaRequest) GetDocumentType() string {
+	if x != nil {
+		return x.DocumentType
+	}
+	return ""
+}
+
+// ExportCcdaResponse carries the C-CDA document as XML, and the GUIDs of the notes rendered into it.
+type ExportCcdaResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Document      string                 `protobuf:"bytes,1,opt,name=document,proto3" json:"document,omitempty"`
+	NoteGuids     []string               `protobuf:"bytes,2,rep,name=note_guids,json=noteGuids,proto3" json:"note_guids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportCcdaResponse) Reset() {
+	*x = ExportCcdaResponse{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportCcdaResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportCcdaResponse) ProtoMessage() {}
+
+func (x *ExportCcdaResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportCcdaResponse.ProtoReflect.Descriptor instead.
+func (*ExportCcdaResponse) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ExportCcdaResponse) GetDocument() string {
+	if x != nil {
+		return x.Document
+	}
+	return ""
+}
+
+func (x *ExportCcdaResponse) GetNoteGuids() []string {
+	if x != nil {
+		return x.NoteGuids
+	}
+	return nil
+}
+
+// RenderNoteRequest asks for a note as a document to read or print. format is 'markdown', 'html' or 'pdf'.
+type RenderNoteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NoteGuid      string                 `protobuf:"bytes,1,opt,name=note_guid,json=noteGuid,proto3" json:"note_guid,omitempty"`
+	Format        string                 `protobuf:"bytes,2,opt,name=format,proto3" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenderNoteRequest) Reset() {
+	*x = RenderNoteRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderNoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderNoteRequest) ProtoMessage() {}
+
+func (x *RenderNoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderNoteRequest.ProtoReflect.Descriptor instead.
+func (*RenderNoteRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RenderNoteRequest) GetNoteGuid() string {
+	if x != nil {
+		return x.NoteGuid
+	}
+	return ""
+}
+
+func (x *RenderNoteRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+// RenderNoteResponse carries the rendered note and its media type.
+type RenderNoteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Content       []byte                 `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
+	ContentType   string                 `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenderNoteResponse) Reset() {
+	*x = RenderNoteResponse{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderNoteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderNoteResponse) ProtoMessage() {}
+
+func (x *RenderNoteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderNoteResponse.ProtoReflect.Descriptor instead.
+func (*RenderNoteResponse) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RenderNoteResponse) GetContent() []byte {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+func (x *RenderNoteResponse) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+// WatchNotesRequest subscribes to note events after after_offset, which is zero to receive every event recorded.
+// Clients resume a stream which ended by subscribing again after the offset of the last event they received.
+// event_types, when given, limits the stream to events of those types.
+type WatchNotesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AfterOffset   int64                  `protobuf:"varint,1,opt,name=after_offset,json=afterOffset,proto3" json:"after_offset,omitempty"`
+	EventTypes    []string               `protobuf:"bytes,2,rep,name=event_types,json=eventTypes,proto3" json:"event_types,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchNotesRequest) Reset() {
+	*x = WatchNotesRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchNotesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchNotesRequest) ProtoMessage() {}
+
+func (x *WatchNotesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchNotesRequest.ProtoReflect.Descriptor instead.
+func (*WatchNotesRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WatchNotesRequest) GetAfterOffset() int64 {
+	if x != nil {
+		return x.AfterOffset
+	}
+	return 0
+}
+
+func (x *WatchNotesRequest) GetEventTypes() []string {
+	if x != nil {
+		return x.EventTypes
+	}
+	return nil
+}
+
+// NoteEvent records a change to a note: NoteCreated, NoteUpdated, NoteSigned, NoteDeleted or NoteFragmentSuperseded.
+// Offsets increase in the order events are committed.
+type NoteEvent struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	Offset                   int64                  `protobuf:"varint,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	Type                     string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	OccurredAt               *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"`
+	NoteGuid                 string                 `protobuf:"bytes,4,opt,name=note_guid,json=noteGuid,proto3" json:"note_guid,omitempty"`
+	PreviousNoteGuid         string                 `protobuf:"bytes,5,opt,name=previous_note_guid,json=previousNoteGuid,proto3" json:"previous_note_guid,omitempty"`
+	NoteFragmentGuid         string                 `protobuf:"bytes,6,opt,name=note_fragment_guid,json=noteFragmentGuid,proto3" json:"note_fragment_guid,omitempty"`
+	PreviousNoteFragmentGuid string                 `protobuf:"bytes,7,opt,name=previous_note_fragment_guid,json=previousNoteFragmentGuid,proto3" json:"previous_note_fragment_guid,omitempty"`
+	PatientGuid              string                 `protobuf:"bytes,8,opt,name=patient_guid,json=patientGuid,proto3" json:"patient_guid,omitempty"`
+	AuthorGuid               string                 `protobuf:"bytes,9,opt,name=author_guid,json=authorGuid,proto3" json:"author_guid,omitempty"`
+	VisitGuid                string                 `protobuf:"bytes,10,opt,name=visit_guid,json=visitGuid,proto3" json:"visit_guid,omitempty"`
+	NoteType                 string                 `protobuf:"bytes,11,opt,name=note_type,json=noteType,proto3" json:"note_type,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *NoteEvent) Reset() {
+	*x = NoteEvent{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NoteEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NoteEvent) ProtoMessage() {}
+
+func (x *NoteEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NoteEvent.ProtoReflect.Descriptor instead.
+func (*NoteEvent) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *NoteEvent) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *NoteEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *NoteEvent) GetOccurredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return nil
+}
+
+func (x *NoteEvent) GetNoteGuid() string {
+	if x != nil {
+		return x.NoteGuid
+	}
+	return ""
+}
+
+func (x *NoteEvent) GetPreviousNoteGuid() string {
+	if x != nil {
+		return x.PreviousNoteGuid
+	}
+	return ""
+}
+
+func (x *NoteEvent) GetNoteFragmentGuid() string {
+	if x != nil {
+		return x.NoteFragmentGuid
+	}
+	return ""
+}
+
+func (x *NoteEvent) GetPreviousNoteFragmentGuid() string {
+	if x != nil {
+		return x.PreviousNoteFragmentGuid
+	}
+	return ""
+}
+
+func (x *NoteEvent) GetPatientGuid() string {
+	if x != nil {
+		return x.PatientGuid
+	}
+	return ""
+}
+
+func (x *NoteEvent) GetAuthorGuid() string {
+	if x != nil {
+		return x.AuthorGuid
+	}
+	return ""
+}
+
+func (x *NoteEvent) GetVisitGuid() string {
+	if x != nil {
+		return x.VisitGuid
+	}
+	return ""
+}
+
+func (x *NoteEvent) GetNoteType() string {
+	if x != nil {
+		return x.NoteType
+	}
+	return ""
+}
+
+// WebhookSubscription delivers the note events matching its filters to url, signed with its secret.
+type WebhookSubscription struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Guid          string                 `protobuf:"bytes,1,opt,name=guid,proto3" json:"guid,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Secret        string                 `protobuf:"bytes,3,opt,name=secret,proto3" json:"secret,omitempty"`
+	PatientGuid   string                 `protobuf:"bytes,4,opt,name=patient_guid,json=patientGuid,proto3" json:"patient_guid,omitempty"`
+	NoteTypes     []string               `protobuf:"bytes,5,rep,name=note_types,json=noteTypes,proto3" json:"note_types,omitempty"`
+	EventTypes    []string               `protobuf:"bytes,6,rep,name=event_types,json=eventTypes,proto3" json:"event_types,omitempty"`
+	AfterOffset   int64                  `protobuf:"varint,7,opt,name=after_offset,json=afterOffset,proto3" json:"after_offset,omitempty"`
+	DateCreated   *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=date_created,json=dateCreated,proto3" json:"date_created,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WebhookSubscription) Reset() {
+	*x = WebhookSubscription{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WebhookSubscription) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WebhookSubscription) ProtoMessage() {}
+
+func (x *WebhookSubscription) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WebhookSubscription.ProtoReflect.Descriptor instead.
+func (*WebhookSubscription) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *WebhookSubscription) GetGuid() string {
+	if x != nil {
+		return x.Guid
+	}
+	return ""
+}
+
+func (x *WebhookSubscription) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *WebhookSubscription) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *WebhookSubscription) GetPatientGuid() string {
+	if x != nil {
+		return x.PatientGuid
+	}
+	return ""
+}
+
+func (x *WebhookSubscription) GetNoteTypes() []string {
+	if x != nil {
+		return x.NoteTypes
+	}
+	return nil
+}
+
+func (x *WebhookSubscription) GetEventTypes() []string {
+	if x != nil {
+		return x.EventTypes
+	}
+	return nil
+}
+
+func (x *WebhookSubscription) GetAfterOffset() int64 {
+	if x != nil {
+		return x.AfterOffset
+	}
+	return 0
+}
+
+func (x *WebhookSubscription) GetDateCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DateCreated
+	}
+	return nil
+}
+
+// CreateWebhookSubscriptionRequest asks for note events to be POSTed to url. patient_guid, note_types (NoteType
+// names, e.g. 'HISTORY_AND_PHYSICAL') and event_types, when given, limit the events delivered to those matching all of
+// them. Events after after_offset are delivered; when it is absent, only events recorded from now on are.
+type CreateWebhookSubscriptionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	PatientGuid   string                 `protobuf:"bytes,2,opt,name=patient_guid,json=patientGuid,proto3" json:"patient_guid,omitempty"`
+	NoteTypes     []string               `protobuf:"bytes,3,rep,name=note_types,json=noteTypes,proto3" json:"note_types,omitempty"`
+	EventTypes    []string               `protobuf:"bytes,4,rep,name=event_types,json=eventTypes,proto3" json:"event_types,omitempty"`
+	AfterOffset   *int64                 `protobuf:"varint,5,opt,name=after_offset,json=afterOffset,proto3,oneof" json:"after_offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateWebhookSubscriptionRequest) Reset() {
+	*x = CreateWebhookSubscriptionRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateWebhookSubscriptionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateWebhookSubscriptionRequest) ProtoMessage() {}
+
+func (x *CreateWebhookSubscriptionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateWebhookSubscriptionRequest.ProtoReflect.Descriptor instead.
+func (*CreateWebhookSubscriptionRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CreateWebhookSubscriptionRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CreateWebhookSubscriptionRequest) GetPatientGuid() string {
+	if x != nil {
+		return x.PatientGuid
+	}
+	return ""
+}
+
+func (x *CreateWebhookSubscriptionRequest) GetNoteTypes() []string {
+	if x != nil {
+		return x.NoteTypes
+	}
+	return nil
+}
+
+func (x *CreateWebhookSubscriptionRequest) GetEventTypes() []string {
+	if x != nil {
+		return x.EventTypes
+	}
+	return nil
+}
+
+func (x *CreateWebhookSubscriptionRequest) GetAfterOffset() int64 {
+	if x != nil && x.AfterOffset != nil {
+		return *x.AfterOffset
+	}
+	return 0
+}
+
+// CreateWebhookSubscriptionResponse carries the new subscription, including the secret its deliveries are signed
+// with. The secret is not returned again.
+type CreateWebhookSubscriptionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subscription  *WebhookSubscription   `protobuf:"bytes,1,opt,name=subscription,proto3" json:"subscription,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateWebhookSubscriptionResponse) Reset() {
+	*x = CreateWebhookSubscriptionResponse{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateWebhookSubscriptionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateWebhookSubscriptionResponse) ProtoMessage() {}
+
+func (x *CreateWebhookSubscriptionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateWebhookSubscriptionResponse.ProtoReflect.Descriptor instead.
+func (*CreateWebhookSubscriptionResponse) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CreateWebhookSubscriptionResponse) GetSubscription() *WebhookSubscription {
+	if x != nil {
+		return x.Subscription
+	}
+	return nil
+}
+
+// ListWebhookSubscriptionsRequest asks for every webhook subscription.
+type ListWebhookSubscriptionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWebhookSubscriptionsRequest) Reset() {
+	*x = ListWebhookSubscriptionsRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWebhookSubscriptionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWebhookSubscriptionsRequest) ProtoMessage() {}
+
+func (x *ListWebhookSubscriptionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWebhookSubscriptionsRequest.ProtoReflect.Descriptor instead.
+func (*ListWebhookSubscriptionsRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{12}
+}
+
+// ListWebhookSubscriptionsResponse carries the webhook subscriptions, in the order they were created, without their
+// secrets.
+type ListWebhookSubscriptionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subscriptions []*WebhookSubscription `protobuf:"bytes,1,rep,name=subscriptions,proto3" json:"subscriptions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWebhookSubscriptionsResponse) Reset() {
+	*x = ListWebhookSubscriptionsResponse{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWebhookSubscriptionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWebhookSubscriptionsResponse) ProtoMessage() {}
+
+func (x *ListWebhookSubscriptionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWebhookSubscriptionsResponse.ProtoReflect.Descriptor instead.
+func (*ListWebhookSubscriptionsResponse) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListWebhookSubscriptionsResponse) GetSubscriptions() []*WebhookSubscription {
+	if x != nil {
+		return x.Subscriptions
+	}
+	return nil
+}
+
+// DeleteWebhookSubscriptionRequest asks for a webhook subscription, and its dead letters, to be deleted.
+type DeleteWebhookSubscriptionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Guid          string                 `protobuf:"bytes,1,opt,name=guid,proto3" json:"guid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteWebhookSubscriptionRequest) Reset() {
+	*x = DeleteWebhookSubscriptionRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteWebhookSubscriptionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteWebhookSubscriptionRequest) ProtoMessage() {}
+
+func (x *DeleteWebhookSubscriptionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteWebhookSubscriptionRequest.ProtoReflect.Descriptor instead.
+func (*DeleteWebhookSubscriptionRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *DeleteWebhookSubscriptionRequest) GetGuid() string {
+	if x != nil {
+		return x.Guid
+	}
+	return ""
+}
+
+// DeleteWebhookSubscriptionResponse is empty; the subscription was deleted.
+type DeleteWebhookSubscriptionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteWebhookSubscriptionResponse) Reset() {
+	*x = DeleteWebhookSubscriptionResponse{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteWebhookSubscriptionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteWebhookSubscriptionResponse) ProtoMessage() {}
+
+func (x *DeleteWebhookSubscriptionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteWebhookSubscriptionResponse.ProtoReflect.Descriptor instead.
+func (*DeleteWebhookSubscriptionResponse) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{15}
+}
+
+// ImportNotesRequest carries notes to import as NDJSON: one ehrpb.Note per line in the protobuf JSON encoding. GUIDs
+// and creation dates are kept where the notes have them. batch_size, 500 when zero, is how many notes are added in
+// each transaction.
+type ImportNotesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Records       string                 `protobuf:"bytes,1,opt,name=records,proto3" json:"records,omitempty"`
+	BatchSize     int32                  `protobuf:"varint,2,opt,name=batch_size,json=batchSize,proto3" json:"batch_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportNotesRequest) Reset() {
+	*x = ImportNotesRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportNotesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportNotesRequest) ProtoMessage() {}
+
+func (x *ImportNotesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportNotesRequest.ProtoReflect.Descriptor instead.
+func (*ImportNotesRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ImportNotesRequest) GetRecords() string {
+	if x != nil {
+		return x.Records
+	}
+	return ""
+}
+
+func (x *ImportNotesRequest) GetBatchSize() int32 {
+	if x != nil {
+		return x.BatchSize
+	}
+	return 0
+}
+
+// ImportNotesResponse counts the notes imported, those skipped because they were already present and the records
+// which failed, which are listed by line. lines is the last line of the records committed.
+type ImportNotesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Lines         int32                  `protobuf:"varint,1,opt,name=lines,proto3" json:"lines,omitempty"`
+	Imported      int32                  `protobuf:"varint,2,opt,name=imported,proto3" json:"imported,omitempty"`
+	Skipped       int32                  `protobuf:"varint,3,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	Failed        int32                  `protobuf:"varint,4,opt,name=failed,proto3" json:"failed,omitempty"`
+	Failures      []*ImportFailure       `protobuf:"bytes,5,rep,name=failures,proto3" json:"failures,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportNotesResponse) Reset() {
+	*x = ImportNotesResponse{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportNotesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportNotesResponse) ProtoMessage() {}
+
+func (x *ImportNotesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportNotesResponse.ProtoReflect.Descriptor instead.
+func (*ImportNotesResponse) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ImportNotesResponse) GetLines() int32 {
+	if x != nil {
+		return x.Lines
+	}
+	return 0
+}
+
+func (x *ImportNotesResponse) GetImported() int32 {
+	if x != nil {
+		return x.Imported
+	}
+	return 0
+}
+
+func (x *ImportNotesResponse) GetSkipped() int32 {
+	if x != nil {
+		return x.Skipped
+	}
+	return 0
+}
+
+func (x *ImportNotesResponse) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *ImportNotesResponse) GetFailures() []*ImportFailure {
+	if x != nil {
+		return x.Failures
+	}
+	return nil
+}
+
+// ImportFailure is a record which could not be imported, identified by its line in the records.
+type ImportFailure struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Line          int32                  `protobuf:"varint,1,opt,name=line,proto3" json:"line,omitempty"`
+	NoteGuid      string                 `protobuf:"bytes,2,opt,name=note_guid,json=noteGuid,proto3" json:"note_guid,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Record        string                 `protobuf:"bytes,4,opt,name=record,proto3" json:"record,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportFailure) Reset() {
+	*x = ImportFailure{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportFailure) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportFailure) ProtoMessage() {}
+
+func (x *ImportFailure) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportFailure.ProtoReflect.Descriptor instead.
+func (*ImportFailure) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ImportFailure) GetLine() int32 {
+	if x != nil {
+		return x.Line
+	}
+	return 0
+}
+
+func (x *ImportFailure) GetNoteGuid() string {
+	if x != nil {
+		return x.NoteGuid
+	}
+	return ""
+}
+
+func (x *ImportFailure) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ImportFailure) GetRecord() string {
+	if x != nil {
+		return x.Record
+	}
+	return ""
+}
+
+// DeidentifyNotesRequest names stored notes to de-identify, and carries others as NDJSON: one ehrpb.Note per line in
+// the protobuf JSON encoding. At least one of them is given.
+type DeidentifyNotesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NoteGuids     []string               `protobuf:"bytes,1,rep,name=note_guids,json=noteGuids,proto3" json:"note_guids,omitempty"`
+	Records       string                 `protobuf:"bytes,2,opt,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeidentifyNotesRequest) Reset() {
+	*x = DeidentifyNotesRequest{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeidentifyNotesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeidentifyNotesRequest) ProtoMessage() {}
+
+func (x *DeidentifyNotesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeidentifyNotesRequest.ProtoReflect.Descriptor instead.
+func (*DeidentifyNotesRequest) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *DeidentifyNotesRequest) GetNoteGuids() []string {
+	if x != nil {
+		return x.NoteGuids
+	}
+	return nil
+}
+
+func (x *DeidentifyNotesRequest) GetRecords() string {
+	if x != nil {
+		return x.Records
+	}
+	return ""
+}
+
+// DeidentifyNotesResponse carries the de-identified notes as NDJSON, the stored notes first, in the order they were
+// given.
+type DeidentifyNotesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Records       string                 `protobuf:"bytes,1,opt,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeidentifyNotesResponse) Reset() {
+	*x = DeidentifyNotesResponse{}
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeidentifyNotesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeidentifyNotesResponse) ProtoMessage() {}
+
+func (x *DeidentifyNotesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clerkpb_clerkservice_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeidentifyNotesResponse.ProtoReflect.Descriptor instead.
+func (*DeidentifyNotesResponse) Descriptor() ([]byte, []int) {
+	return file_clerkpb_clerkservice_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *DeidentifyNotesResponse) GetRecords() string {
+	if x != nil {
+		return x.Records
+	}
+	return ""
+}
+
+var File_clerkpb_clerkservice_proto protoreflect.FileDescriptor
+
+const file_clerkpb_clerkservice_proto_rawDesc = "" +
+	"\n" +
+	"\x1aclerkpb/clerkservice.proto\x12\tnoteclerk\x1a\x1fgoogle/protobuf/timestamp.proto\"E\n" +
+	"\x17LookupIcd10CodesRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"F\n" +
+	"\x18LookupIcd10CodesResponse\x12*\n" +
+	"\x05codes\x18\x01 \x03(\v2\x14.noteclerk.Icd10CodeR\x05codes\"A\n" +
+	"\tIcd10Code\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\"t\n" +
+	"\x11ExportCcdaRequest\x12\x1b\n" +
+	"\tnote_guid\x18\x01 \x01(\tR\bnoteGuid\x12\x1d\n" +
+	"\n" +
+	"visit_guid\x18\x02 \x01(\tR\tvisitGuid\x12#\n" +
+	"\rdocument_type\x18\x03 \x01(\tR\fdocumentType\"O\n" +
+	"\x12ExportCcdaResponse\x12\x1a\n" +
+	"\bdocument\x18\x01 \x01(\tR\bdocument\x12\x1d\n" +
+	"\n" +
+	"note_guids\x18\x02 \x03(\tR\tnoteGuids\"H\n" +
+	"\x11RenderNoteRequest\x12\x1b\n" +
+	"\tnote_guid\x18\x01 \x01(\tR\bnoteGuid\x12\x16\n" +
+	"\x06format\x18\x02 \x01(\tR\x06format\"Q\n" +
+	"\x12RenderNoteResponse\x12\x18\n" +
+	"\acontent\x18\x01 \x01(\fR\acontent\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\"W\n" +
+	"\x11WatchNotesRequest\x12!\n" +
+	"\fafter_offset\x18\x01 \x01(\x03R\vafterOffset\x12\x1f\n" +
+	"\vevent_types\x18\x02 \x03(\tR\n" +
+	"eventTypes\"\xac\x03\n" +
+	"\tNoteEvent\x12\x16\n" +
+	"\x06offset\x18\x01 \x01(\x03R\x06offset\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12;\n" +
+	"\voccurred_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"occurredAt\x12\x1b\n" +
+	"\tnote_guid\x18\x04 \x01(\tR\bnoteGuid\x12,\n" +
+	"\x12previous_note_guid\x18\x05 \x01(\tR\x10previousNoteGuid\x12,\n" +
+	"\x12note_fragment_guid\x18\x06 \x01(\tR\x10noteFragmentGuid\x12=\n" +
+	"\x1bprevious_note_fragment_guid\x18\a \x01(\tR\x18previousNoteFragmentGuid\x12!\n" +
+	"\fpatient_guid\x18\b \x01(\tR\vpatientGuid\x12\x1f\n" +
+	"\vauthor_guid\x18\t \x01(\tR\n" +
+	"authorGuid\x12\x1d\n" +
+	"\n" +
+	"visit_guid\x18\n" +
+	" \x01(\tR\tvisitGuid\x12\x1b\n" +
+	"\tnote_type\x18\v \x01(\tR\bnoteType\"\x98\x02\n" +
+	"\x13WebhookSubscription\x12\x12\n" +
+	"\x04guid\x18\x01 \x01(\tR\x04guid\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x16\n" +
+	"\x06secret\x18\x03 \x01(\tR\x06secret\x12!\n" +
+	"\fpatient_guid\x18\x04 \x01(\tR\vpatientGuid\x12\x1d\n" +
+	"\n" +
+	"note_types\x18\x05 \x03(\tR\tnoteTypes\x12\x1f\n" +
+	"\vevent_types\x18\x06 \x03(\tR\n" +
+	"eventTypes\x12!\n" +
+	"\fafter_offset\x18\a \x01(\x03R\vafterOffset\x12=\n" +
+	"\fdate_created\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\vdateCreated\"\xd0\x01\n" +
+	" CreateWebhookSubscriptionRequest\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12!\n" +
+	"\fpatient_guid\x18\x02 \x01(\tR\vpatientGuid\x12\x1d\n" +
+	"\n" +
+	"note_types\x18\x03 \x03(\tR\tnoteTypes\x12\x1f\n" +
+	"\vevent_types\x18\x04 \x03(\tR\n" +
+	"eventTypes\x12&\n" +
+	"\fafter_offset\x18\x05 \x01(\x03H\x00R\vafterOffset\x88\x01\x01B\x0f\n" +
+	"\r_after_offset\"g\n" +
+	"!CreateWebhookSubscriptionResponse\x12B\n" +
+	"\fsubscription\x18\x01 \x01(\v2\x1e.noteclerk.WebhookSubscriptionR\fsubscription\"!\n" +
+	"\x1fListWebhookSubscriptionsRequest\"h\n" +
+	" ListWebhookSubscriptionsResponse\x12D\n" +
+	"\rsubscriptions\x18\x01 \x03(\v2\x1e.noteclerk.WebhookSubscriptionR\rsubscriptions\"6\n" +
+	" DeleteWebhookSubscriptionRequest\x12\x12\n" +
+	"\x04guid\x18\x01 \x01(\tR\x04guid\"#\n" +
+	"!DeleteWebhookSubscriptionResponse\"M\n" +
+	"\x12ImportNotesRequest\x12\x18\n" +
+	"\arecords\x18\x01 \x01(\tR\arecords\x12\x1d\n" +
+	"\n" +
+	"batch_size\x18\x02 \x01(\x05R\tbatchSize\"\xaf\x01\n" +
+	"\x13ImportNotesResponse\x12\x14\n" +
+	"\x05lines\x18\x01 \x01(\x05R\x05lines\x12\x1a\n" +
+	"\bimported\x18\x02 \x01(\x05R\bimported\x12\x18\n" +
+	"\askipped\x18\x03 \x01(\x05R\askipped\x12\x16\n" +
+	"\x06failed\x18\x04 \x01(\x05R\x06failed\x124\n" +
+	"\bfailures\x18\x05 \x03(\v2\x18.noteclerk.ImportFailureR\bfailures\"n\n" +
+	"\rImportFailure\x12\x12\n" +
+	"\x04line\x18\x01 \x01(\x05R\x04line\x12\x1b\n" +
+	"\tnote_guid\x18\x02 \x01(\tR\bnoteGuid\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x16\n" +
+	"\x06record\x18\x04 \x01(\tR\x06record\"Q\n" +
+	"\x16DeidentifyNotesRequest\x12\x1d\n" +
+	"\n" +
+	"note_guids\x18\x01 \x03(\tR\tnoteGuids\x12\x18\n" +
+	"\arecords\x18\x02 \x01(\tR\arecords\"3\n" +
+	"\x17DeidentifyNotesResponse\x12\x18\n" +
+	"\arecords\x18\x01 \x01(\tR\arecords2\xd2\x06\n" +
+	"\fClerkService\x12[\n" +
+	"\x10LookupIcd10Codes\x12\".noteclerk.LookupIcd10CodesRequest\x1a#.noteclerk.LookupIcd10CodesResponse\x12I\n" +
+	"\n" +
+	"ExportCcda\x12\x1c.noteclerk.ExportCcdaRequest\x1a\x1d.noteclerk.ExportCcdaResponse\x12I\n" +
+	"\n" +
+	"RenderNote\x12\x1c.noteclerk.RenderNoteRequest\x1a\x1d.noteclerk.RenderNoteResponse\x12B\n" +
+	"\n" +
+	"WatchNotes\x12\x1c.noteclerk.WatchNotesRequest\x1a\x14.noteclerk.NoteEvent0\x01\x12v\n" +
+	"\x19CreateWebhookSubscription\x12+.noteclerk.CreateWebhookSubscriptionRequest\x1a,.noteclerk.CreateWebhookSubscriptionResponse\x12s\n" +
+	"\x18ListWebhookSubscriptions\x12*.noteclerk.ListWebhookSubscriptionsRequest\x1a+.noteclerk.ListWebhookSubscriptionsResponse\x12v\n" +
+	"\x19DeleteWebhookSubscription\x12+.noteclerk.DeleteWebhookSubscriptionRequest\x1a,.noteclerk.DeleteWebhookSubscriptionResponse\x12L\n" +
+	"\vImportNotes\x12\x1d.noteclerk.ImportNotesRequest\x1a\x1e.noteclerk.ImportNotesResponse\x12X\n" +
+	"\x0fDeidentifyNotes\x12!.noteclerk.DeidentifyNotesRequest\x1a\".noteclerk.DeidentifyNotesResponseB'Z%github.com/geekmdio/noteclerk/clerkpbb\x06proto3"
+
+var (
+	file_clerkpb_clerkservice_proto_rawDescOnce sync.Once
+	file_clerkpb_clerkservice_proto_rawDescData []byte
+)
+
+func file_clerkpb_clerkservice_proto_rawDescGZIP() []byte {
+	file_clerkpb_clerkservice_proto_rawDescOnce.Do(func() {
+		file_clerkpb_clerkservice_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_clerkpb_clerkservice_proto_rawDesc), len(file_clerkpb_clerkservice_proto_rawDesc)))
+	})
+	return file_clerkpb_clerkservice_proto_rawDescData
+}
+
+var file_clerkpb_clerkservice_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
+var file_clerkpb_clerkservice_proto_goTypes = []any{
+	(*LookupIcd10CodesRequest)(nil),           // 0: noteclerk.LookupIcd10CodesRequest
+	(*LookupIcd10CodesResponse)(nil),          // 1: noteclerk.LookupIcd10CodesResponse
+	(*Icd10Code)(nil),                         // 2: noteclerk.Icd10Code
+	(*ExportCcdaRequest)(nil),                 // 3: noteclerk.ExportCcdaRequest
+	(*ExportCcdaResponse)(nil),                // 4: noteclerk.ExportCcdaResponse
+	(*RenderNoteRequest)(nil),                 // 5: noteclerk.RenderNoteRequest
+	(*RenderNoteResponse)(nil),                // 6: noteclerk.RenderNoteResponse
+	(*WatchNotesRequest)(nil),                 // 7: noteclerk.WatchNotesRequest
+	(*NoteEvent)(nil),                         // 8: noteclerk.NoteEvent
+	(*WebhookSubscription)(nil),               // 9: noteclerk.WebhookSubscription
+	(*CreateWebhookSubscriptionRequest)(nil),  // 10: noteclerk.CreateWebhookSubscriptionRequest
+	(*CreateWebhookSubscriptionResponse)(nil), // 11: noteclerk.CreateWebhookSubscriptionResponse
+	(*ListWebhookSubscriptionsRequest)(nil),   // 12: noteclerk.ListWebhookSubscriptionsRequest
+	(*ListWebhookSubscriptionsResponse)(nil),  // 13: noteclerk.ListWebhookSubscriptionsResponse
+	(*DeleteWebhookSubscriptionRequest)(nil),  // 14: noteclerk.DeleteWebhookSubscriptionRequest
+	(*DeleteWebhookSubscriptionResponse)(nil), // 15: noteclerk.DeleteWebhookSubscriptionResponse
+	(*ImportNotesRequest)(nil),                // 16: noteclerk.ImportNotesRequest
+	(*ImportNotesResponse)(nil),               // 17: noteclerk.ImportNotesResponse
+	(*ImportFailure)(nil),                     // 18: noteclerk.ImportFailure
+	(*DeidentifyNotesRequest)(nil),            // 19: noteclerk.DeidentifyNotesRequest
+	(*DeidentifyNotesResponse)(nil),           // 20: noteclerk.DeidentifyNotesResponse
+	(*timestamppb.Timestamp)(nil),             // 21: google.protobuf.Timestamp
+}
+var file_clerkpb_clerkservice_proto_depIdxs = []int32{
+	2,  // 0: noteclerk.LookupIcd10CodesResponse.codes:type_name -> noteclerk.Icd10Code
+	21, // 1: noteclerk.NoteEvent.occurred_at:type_name -> google.protobuf.Timestamp
+	21, // 2: noteclerk.WebhookSubscription.date_created:type_name -> google.protobuf.Timestamp
+	9,  // 3: noteclerk.CreateWebhookSubscriptionResponse.subscription:type_name -> noteclerk.WebhookSubscription
+	9,  // 4: noteclerk.ListWebhookSubscriptionsResponse.subscriptions:type_name -> noteclerk.WebhookSubscription
+	18, // 5: noteclerk.ImportNotesResponse.failures:type_name -> noteclerk.ImportFailure
+	0,  // 6: noteclerk.ClerkService.LookupIcd10Codes:input_type -> noteclerk.LookupIcd10CodesRequest
+	3,  // 7: noteclerk.ClerkService.ExportCcda:input_type -> noteclerk.ExportCcdaRequest
+	5,  // 8: noteclerk.ClerkService.RenderNote:input_type -> noteclerk.RenderNoteRequest
+	7,  // 9: noteclerk.ClerkService.WatchNotes:input_type -> noteclerk.WatchNotesRequest
+	10, // 10: noteclerk.ClerkService.CreateWebhookSubscription:input_type -> noteclerk.CreateWebhookSubscriptionRequest
+	12, // 11: noteclerk.ClerkService.ListWebhookSubscriptions:input_type -> noteclerk.ListWebhookSubscriptionsRequest
+	14, // 12: noteclerk.ClerkService.DeleteWebhookSubscription:input_type -> noteclerk.DeleteWebhookSubscriptionRequest
+	16, // 13: noteclerk.ClerkService.ImportNotes:input_type -> noteclerk.ImportNotesRequest
+	19, // 14: noteclerk.ClerkService.DeidentifyNotes:input_type -> noteclerk.DeidentifyNotesRequest
+	1,  // 15: noteclerk.ClerkService.LookupIcd10Codes:output_type -> noteclerk.LookupIcd10CodesResponse
+	4,  // 16: noteclerk.ClerkService.ExportCcda:output_type -> noteclerk.ExportCcdaResponse
+	6,  // 17: noteclerk.ClerkService.RenderNote:output_type -> noteclerk.RenderNoteResponse
+	8,  // 18: noteclerk.ClerkService.WatchNotes:output_type -> noteclerk.NoteEvent
+	11, // 19: noteclerk.ClerkService.CreateWebhookSubscription:output_type -> noteclerk.CreateWebhookSubscriptionResponse
+	13, // 20: noteclerk.ClerkService.ListWebhookSubscriptions:output_type -> noteclerk.ListWebhookSubscriptionsResponse
+	15, // 21: noteclerk.ClerkService.DeleteWebhookSubscription:output_type -> noteclerk.DeleteWebhookSubscriptionResponse
+	17, // 22: noteclerk.ClerkService.ImportNotes:output_type -> noteclerk.ImportNotesResponse
+	20, // 23: noteclerk.ClerkService.DeidentifyNotes:output_type -> noteclerk.DeidentifyNotesResponse
+	15, // [15:24] is the sub-list for method output_type
+	6,  // [6:15] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_clerkpb_clerkservice_proto_init() }
+func file_clerkpb_clerkservice_proto_init() {
+	if File_clerkpb_clerkservice_proto != nil {
+		return
+	}
+	file_clerkpb_clerkservice_proto_msgTypes[10].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_clerkpb_clerkservice_proto_rawDesc), len(file_clerkpb_clerkservice_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   21,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_clerkpb_clerkservice_proto_goTypes,
+		DependencyIndexes: file_clerkpb_clerkservice_proto_depIdxs,
+		MessageInfos:      file_clerkpb_clerkservice_proto_msgTypes,
+	}.Build()
+	File_clerkpb_clerkservice_proto = out.File
+	file_clerkpb_clerkservice_proto_goTypes = nil
+	file_clerkpb_clerkservice_proto_depIdxs = nil
+}
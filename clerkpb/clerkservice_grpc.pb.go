@@ -0,0 +1,451 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: clerkpb/clerkservice.proto
+
+package clerkpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ClerkService_LookupIcd10Codes_FullMethodName          = "/noteclerk.ClerkService/LookupIcd10Codes"
+	ClerkService_ExportCcda_FullMethodName                = "/noteclerk.ClerkService/ExportCcda"
+	ClerkService_RenderNote_FullMethodName                = "/noteclerk.ClerkService/RenderNote"
+	ClerkService_WatchNotes_FullMethodName                = "/noteclerk.ClerkService/WatchNotes"
+	ClerkService_CreateWebhookSubscription_FullMethodName = "/noteclerk.ClerkService/CreateWebhookSubscription"
+	ClerkService_ListWebhookSubscriptions_FullMethodName  = "/noteclerk.ClerkService/ListWebhookSubscriptions"
+	ClerkService_DeleteWebhookSubscription_FullMethodName = "/noteclerk.ClerkService/DeleteWebhookSubscription"
+	ClerkService_ImportNotes_FullMethodName               = "/noteclerk.ClerkService/ImportNotes"
+	ClerkService_DeidentifyNotes_FullMethodName           = "/noteclerk.ClerkService/DeidentifyNotes"
+)
+
+// ClerkServiceClient is the client API for ClerkService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ClerkService is the set of NoteClerk specific RPCs, served alongside ehrpb.NoteService on the same gRPC server.
+type ClerkServiceClient interface {
+	// LookupIcd10Codes finds ICD-10-CM codes by the beginning of a code, e.g. 'J45.9', or by words from a code's
+	// description, e.g. 'asthma exacerbation'.
+	LookupIcd10Codes(ctx context.Context, in *LookupIcd10CodesRequest, opts ...grpc.CallOption) (*LookupIcd10CodesResponse, error)
+	// ExportCcda returns one note, or every note of a visit, as a C-CDA R2.1 document.
+	ExportCcda(ctx context.Context, in *ExportCcdaRequest, opts ...grpc.CallOption) (*ExportCcdaResponse, error)
+	// RenderNote returns a note as a document to read or print.
+	RenderNote(ctx context.Context, in *RenderNoteRequest, opts ...grpc.CallOption) (*RenderNoteResponse, error)
+	// WatchNotes streams note events in offset order, and then each new event as it is committed.
+	WatchNotes(ctx context.Context, in *WatchNotesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[NoteEvent], error)
+	// CreateWebhookSubscription starts delivering note events to a URL.
+	CreateWebhookSubscription(ctx context.Context, in *CreateWebhookSubscriptionRequest, opts ...grpc.CallOption) (*CreateWebhookSubscriptionResponse, error)
+	// ListWebhookSubscriptions returns every webhook subscription, without its secret.
+	ListWebhookSubscriptions(ctx context.Context, in *ListWebhookSubscriptionsRequest, opts ...grpc.CallOption) (*ListWebhookSubscriptionsResponse, error)
+	// DeleteWebhookSubscription deletes a webhook subscription and its dead letters.
+	DeleteWebhookSubscription(ctx context.Context, in *DeleteWebhookSubscriptionRequest, opts ...grpc.CallOption) (*DeleteWebhookSubscriptionResponse, error)
+	// ImportNotes imports notes from NDJSON, skipping those already present.
+	ImportNotes(ctx context.Context, in *ImportNotesRequest, opts ...grpc.CallOption) (*ImportNotesResponse, error)
+	// DeidentifyNotes de-identifies stored notes, or notes sent as NDJSON.
+	DeidentifyNotes(ctx context.Context, in *DeidentifyNotesRequest, opts ...grpc.CallOption) (*DeidentifyNotesResponse, error)
+}
+
+type clerkServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClerkServiceClient(cc grpc.ClientConnInterface) ClerkServiceClient {
+	return &clerkServiceClient{cc}
+}
+
+func (c *clerkServiceClient) LookupIcd10Codes(ctx context.Context, in *LookupIcd10CodesRequest, opts ...grpc.CallOption) (*LookupIcd10CodesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LookupIcd10CodesResponse)
+	err := c.cc.Invoke(ctx, ClerkService_LookupIcd10Codes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clerkServiceClient) ExportCcda(ctx context.Context, in *ExportCcdaRequest, opts ...grpc.CallOption) (*ExportCcdaResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExportCcdaResponse)
+	err := c.cc.Invoke(ctx, ClerkService_ExportCcda_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clerkServiceClient) RenderNote(ctx context.Context, in *RenderNoteRequest, opts ...grpc.CallOption) (*RenderNoteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RenderNoteResponse)
+	err := c.cc.Invoke(ctx, ClerkService_RenderNote_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clerkServiceClient) WatchNotes(ctx context.Context, in *WatchNotesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[NoteEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ClerkService_ServiceDesc.Streams[0], ClerkService_WatchNotes_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchNotesRequest, NoteEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ClerkService_WatchNotesClient = grpc.ServerStreamingClient[NoteEvent]
+
+func (c *clerkServiceClient) CreateWebhookSubscription(ctx context.Context, in *CreateWebhookSubscriptionRequest, opts ...grpc.CallOption) (*CreateWebhookSubscriptionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateWebhookSubscriptionResponse)
+	err := c.cc.Invoke(ctx, ClerkService_CreateWebhookSubscription_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clerkServiceClient) ListWebhookSubscriptions(ctx context.Context, in *ListWebhookSubscriptionsRequest, opts ...grpc.CallOption) (*ListWebhookSubscriptionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWebhookSubscriptionsResponse)
+	err := c.cc.Invoke(ctx, ClerkService_ListWebhookSubscriptions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clerkServiceClient) DeleteWebhookSubscription(ctx context.Context, in *DeleteWebhookSubscriptionRequest, opts ...grpc.CallOption) (*DeleteWebhookSubscriptionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteWebhookSubscriptionResponse)
+	err := c.cc.Invoke(ctx, ClerkService_DeleteWebhookSubscription_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clerkServiceClient) ImportNotes(ctx context.Context, in *ImportNotesRequest, opts ...grpc.CallOption) (*ImportNotesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImportNotesResponse)
+	err := c.cc.Invoke(ctx, ClerkService_ImportNotes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clerkServiceClient) DeidentifyNotes(ctx context.Context, in *DeidentifyNotesRequest, opts ...grpc.CallOption) (*DeidentifyNotesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeidentifyNotesResponse)
+	err := c.cc.Invoke(ctx, ClerkService_DeidentifyNotes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClerkServiceServer is the server API for ClerkService service.
+// All implementations should embed UnimplementedClerkServiceServer
+// for forward compatibility.
+//
+// ClerkService is the set of NoteClerk specific RPCs, served alongside ehrpb.NoteService on the same gRPC server.
+type ClerkServiceServer interface {
+	// LookupIcd10Codes finds ICD-10-CM codes by the beginning of a code, e.g. 'J45.9', or by words from a code's
+	// description, e.g. 'asthma exacerbation'.
+	LookupIcd10Codes(context.Context, *LookupIcd10CodesRequest) (*LookupIcd10CodesResponse, error)
+	// ExportCcda returns one note, or every note of a visit, as a C-CDA R2.1 document.
+	ExportCcda(context.Context, *ExportCcdaRequest) (*ExportCcdaResponse, error)
+	// RenderNote returns a note as a document to read or print.
+	RenderNote(context.Context, *RenderNoteRequest) (*RenderNoteResponse, error)
+	// WatchNotes streams note events in offset order, and then each new event as it is committed.
+	WatchNotes(*WatchNotesRequest, grpc.ServerStreamingServer[NoteEvent]) error
+	// CreateWebhookSubscription starts delivering note events to a URL.
+	CreateWebhookSubscription(context.Context, *CreateWebhookSubscriptionRequest) (*CreateWebhookSubscriptionResponse, error)
+	// ListWebhookSubscriptions returns every webhook subscription, without its secret.
+	ListWebhookSubscriptions(context.Context, *ListWebhookSubscriptionsRequest) (*ListWebhookSubscriptionsResponse, error)
+	// DeleteWebhookSubscription deletes a webhook subscription and its dead letters.
+	DeleteWebhookSubscription(context.Context, *DeleteWebhookSubscriptionRequest) (*DeleteWebhookSubscriptionResponse, error)
+	// ImportNotes imports notes from NDJSON, skipping those already present.
+	ImportNotes(context.Context, *ImportNotesRequest) (*ImportNotesResponse, error)
+	// DeidentifyNotes de-identifies stored notes, or notes sent as NDJSON.
+	DeidentifyNotes(context.Context, *DeidentifyNotesRequest) (*DeidentifyNotesResponse, error)
+}
+
+// UnimplementedClerkServiceServer should be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedClerkServiceServer struct{}
+
+func (UnimplementedClerkServiceServer) LookupIcd10Codes(context.Context, *LookupIcd10CodesRequest) (*LookupIcd10CodesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LookupIcd10Codes not implemented")
+}
+func (UnimplementedClerkServiceServer) ExportCcda(context.Context, *ExportCcdaRequest) (*ExportCcdaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportCcda not implemented")
+}
+func (UnimplementedClerkServiceServer) RenderNote(context.Context, *RenderNoteRequest) (*RenderNoteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenderNote not implemented")
+}
+func (UnimplementedClerkServiceServer) WatchNotes(*WatchNotesRequest, grpc.ServerStreamingServer[NoteEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchNotes not implemented")
+}
+func (UnimplementedClerkServiceServer) CreateWebhookSubscription(context.Context, *CreateWebhookSubscriptionRequest) (*CreateWebhookSubscriptionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWebhookSubscription not implemented")
+}
+func (UnimplementedClerkServiceServer) ListWebhookSubscriptions(context.Context, *ListWebhookSubscriptionsRequest) (*ListWebhookSubscriptionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookSubscriptions not implemented")
+}
+func (UnimplementedClerkServiceServer) DeleteWebhookSubscription(context.Context, *DeleteWebhookSubscriptionRequest) (*DeleteWebhookSubscriptionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhookSubscription not implemented")
+}
+func (UnimplementedClerkServiceServer) ImportNotes(context.Context, *ImportNotesRequest) (*ImportNotesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportNotes not implemented")
+}
+func (UnimplementedClerkServiceServer) DeidentifyNotes(context.Context, *DeidentifyNotesRequest) (*DeidentifyNotesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeidentifyNotes not implemented")
+}
+func (UnimplementedClerkServiceServer) testEmbeddedByValue() {}
+
+// UnsafeClerkServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClerkServiceServer will
+// result in compilation errors.
+type UnsafeClerkServiceServer interface {
+	mustEmbedUnimplementedClerkServiceServer()
+}
+
+func RegisterClerkServiceServer(s grpc.ServiceRegistrar, srv ClerkServiceServer) {
+	// If the following call pancis, it indicates UnimplementedClerkServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ClerkService_ServiceDesc, srv)
+}
+
+func _ClerkService_LookupIcd10Codes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupIcd10CodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClerkServiceServer).LookupIcd10Codes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClerkService_LookupIcd10Codes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClerkServiceServer).LookupIcd10Codes(ctx, req.(*LookupIcd10CodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClerkService_ExportCcda_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportCcdaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClerkServiceServer).ExportCcda(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClerkService_ExportCcda_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClerkServiceServer).ExportCcda(ctx, req.(*ExportCcdaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClerkService_RenderNote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenderNoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClerkServiceServer).RenderNote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClerkService_RenderNote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClerkServiceServer).RenderNote(ctx, req.(*RenderNoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClerkService_WatchNotes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchNotesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ClerkServiceServer).WatchNotes(m, &grpc.GenericServerStream[WatchNotesRequest, NoteEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ClerkService_WatchNotesServer = grpc.ServerStreamingServer[NoteEvent]
+
+func _ClerkService_CreateWebhookSubscription_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWebhookSubscriptionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClerkServiceServer).CreateWebhookSubscription(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClerkService_CreateWebhookSubscription_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClerkServiceServer).CreateWebhookSubscription(ctx, req.(*CreateWebhookSubscriptionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClerkService_ListWebhookSubscriptions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookSubscriptionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClerkServiceServer).ListWebhookSubscriptions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClerkService_ListWebhookSubscriptions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClerkServiceServer).ListWebhookSubscriptions(ctx, req.(*ListWebhookSubscriptionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClerkService_DeleteWebhookSubscription_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWebhookSubscriptionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClerkServiceServer).DeleteWebhookSubscription(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClerkService_DeleteWebhookSubscription_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClerkServiceServer).DeleteWebhookSubscription(ctx, req.(*DeleteWebhookSubscriptionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClerkService_ImportNotes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportNotesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClerkServiceServer).ImportNotes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClerkService_ImportNotes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClerkServiceServer).ImportNotes(ctx, req.(*ImportNotesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClerkService_DeidentifyNotes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeidentifyNotesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClerkServiceServer).DeidentifyNotes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClerkService_DeidentifyNotes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClerkServiceServer).DeidentifyNotes(ctx, req.(*DeidentifyNotesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ClerkService_ServiceDesc is the grpc.ServiceDesc for ClerkService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ClerkService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "noteclerk.ClerkService",
+	HandlerType: (*ClerkServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "LookupIcd10Codes",
+			Handler:    _ClerkService_LookupIcd10Codes_Handler,
+		},
+		{
+			MethodName: "ExportCcda",
+			Handler:    _ClerkService_ExportCcda_Handler,
+		},
+		{
+			MethodName: "RenderNote",
+			Handler:    _ClerkService_RenderNote_Handler,
+		},
+		{
+			MethodName: "CreateWebhookSubscription",
+			Handler:    _ClerkService_CreateWebhookSubscription_Handler,
+		},
+		{
+			MethodName: "ListWebhookSubscriptions",
+			Handler:    _ClerkService_ListWebhookSubscriptions_Handler,
+		},
+		{
+			MethodName: "DeleteWebhookSubscription",
+			Handler:    _ClerkService_DeleteWebhookSubscription_Handler,
+		},
+		{
+			MethodName: "ImportNotes",
+			Handler:    _ClerkService_ImportNotes_Handler,
+		},
+		{
+			MethodName: "DeidentifyNotes",
+			Handler:    _ClerkService_DeidentifyNotes_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchNotes",
+			Handler:       _ClerkService_WatchNotes_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "clerkpb/clerkservice.proto",
+}
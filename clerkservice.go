@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The NoteService RPCs and their messages are owned by ehrproto. RPCs which are specific to NoteClerk are served by
+// the ClerkService defined in clerkpb/clerkservice.proto, alongside NoteService on the same gRPC server. Clients in
+// any language generate their stubs from that file; the Go code in clerkpb is generated from it with:
+//
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative,require_unimplemented_servers=false clerkpb/clerkservice.proto
+const clerkServiceName = "noteclerk.ClerkService"
+
+// noteEventMessage converts a note event to the message WatchNotes streams.
+func noteEventMessage(e *NoteEvent) *clerkpb.NoteEvent {
+	return &clerkpb.NoteEvent{
+		Offset:                   e.Offset,
+		Type:                     e.Type,
+		OccurredAt:               timestamppb.New(e.OccurredAt),
+		NoteGuid:                 e.NoteGuid,
+		PreviousNoteGuid:         e.PreviousNoteGuid,
+		NoteFragmentGuid:         e.NoteFragmentGuid,
+		PreviousNoteFragmentGuid: e.PreviousNoteFragmentGuid,
+		PatientGuid:              e.PatientGuid,
+		AuthorGuid:               e.AuthorGuid,
+		VisitGuid:                e.VisitGuid,
+		NoteType:                 e.NoteType,
+	}
+}
+
+// webhookSubscriptionMessage converts a webhook subscription to the message the webhook RPCs return.
+func webhookSubscriptionMessage(sub *WebhookSubscription) *clerkpb.WebhookSubscription {
+	return &clerkpb.WebhookSubscription{
+		Guid:        sub.Guid,
+		Url:         sub.Url,
+		Secret:      sub.Secret,
+		PatientGuid: sub.PatientGuid,
+		NoteTypes:   sub.NoteTypes,
+		EventTypes:  sub.EventTypes,
+		AfterOffset: sub.AfterOffset,
+		DateCreated: timestamppb.New(sub.DateCreated),
+	}
+}
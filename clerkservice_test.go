@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestClerkService_IsServedWithTheProtobufCodec(t *testing.T) {
+	s, _ := newMockDbServer(t)
+	lis := bufconn.Listen(1 << 20)
+	rpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(s.unaryInterceptors()...))
+	clerkpb.RegisterClerkServiceServer(rpcServer, s)
+	go rpcServer.Serve(lis)
+	defer rpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	res, err := clerkpb.NewClerkServiceClient(conn).ImportNotes(context.Background(),
+		&clerkpb.ImportNotesRequest{Records: importTestNote(uuid.New().String(), "")})
+	if err != nil || res.Imported != 1 || res.Lines != 1 {
+		t.Fatalf("Expected the note to be imported through a generated client, but got %+v: %v", res, err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A command is a subcommand of the noteclerk binary, e.g. 'noteclerk migrate status'. It receives the arguments
+// following its own name and writes any human readable output to out.
+type command func(args []string, out io.Writer) error
+
+// commands maps the name of each subcommand to its implementation. Running the binary without a subcommand starts
+// the server.
+var commands = map[string]command{
+	"migrate": migrateCommand,
+	"init":    initCommand,
+	"config":  configCommand,
+	"mllp":    mllpCommand,
+	"ccda":    ccdaCommand,
+	"import":  importCommand,
+	"export":  exportCommand,
+}
+
+// runCommand dispatches the command line arguments (excluding the program name) to the matching subcommand.
+// RETURNS: error
+func runCommand(args []string, out io.Writer) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return NoteClerkErrNew(ErrRunCommandFailsUnknownCommand, args[0], strings.Join(commandNames(), ", "))
+	}
+	return cmd(args[1:], out)
+}
+
+func commandNames() []string {
+	var names []string
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// migrateCommand applies, rolls back or reports on the embedded schema migrations using the database configured for
+// the current NOTECLERK_ENVIRONMENT.
+//
+//	noteclerk migrate up
+//	noteclerk migrate down [-steps n]
+//	noteclerk migrate status
+func migrateCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	steps := flags.Int("steps", 1, "number of migrations to roll back with 'down'")
+
+	action := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := LoadConfiguration(configPath)
+	if err != nil {
+		return err
+	}
+	db := openPostgres(config)
+	defer db.Close()
+
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		applied, err := m.Up()
+		for _, v := range applied {
+			fmt.Fprintf(out, "applied   %v\n", v)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "Schema is up to date.")
+		}
+		return err
+	case "down":
+		reverted, err := m.Down(*steps)
+		for _, v := range reverted {
+			fmt.Fprintf(out, "reverted  %v\n", v)
+		}
+		return err
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, v := range statuses {
+			appliedAt := "pending"
+			if v.Applied {
+				appliedAt = v.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(out, "%-45v %v\n", v.Migration, appliedAt)
+		}
+		return nil
+	default:
+		return NoteClerkErrNew(ErrMigrateCommandFailsUnknownAction, action)
+	}
+}
+
+// exitOnCommandError reports a failed subcommand on stderr and exits with a non-zero status.
+func exitOnCommandError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
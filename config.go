@@ -2,7 +2,20 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 // This is the environmental variable in the OS that should be se to your preferred
@@ -11,9 +24,10 @@ import (
 const Environment = "NOTECLERK_ENVIRONMENT"
 const DataRoot = "NOTECLERK_DATA"
 
-// This struct is the model for a JSON configuration file that should be located in
-// ./config/config.<environment>.json, where '.' indicates the server root, and where
-// <environment> can be any lowercase value so long as the NOTECLERK_ENVIRONMENT environmental variable matches.
+// This struct is the model for a JSON or YAML configuration file that should be located in
+// $NOTECLERK_DATA/config.<environment>.json (or .yaml), where <environment> can be any lowercase value so long as the
+// NOTECLERK_ENVIRONMENT environmental variable matches. Any field may instead be set by environmental variable or
+// command line flag; see LoadConfiguration.
 type Config struct {
 	Version        string
 	LogPath        string
@@ -26,31 +40,559 @@ type Config struct {
 	DbPassword     string
 	DbName         string
 	DbSslMode      string
+
+	// Optional limits, in characters, on free text in notes and note fragments. Zero or absent values fall back to
+	// the defaults in limits.go.
+	MaxFragmentContentLength     int
+	MaxFragmentDescriptionLength int
+	MaxTagLength                 int
+
+	// Optional path to a CMS ICD-10-CM flat file (icd10cm_codes_<year>.txt or icd10cm_order_<year>.txt). When set,
+	// fragment ICD-10-CM codes are validated against it and missing long descriptions are filled in.
+	Icd10CodeFilePath string
+
+	// Optional duration, e.g. '24h', for which CreateNote idempotency keys and their responses are kept.
+	IdempotencyKeyTtl string
+
+	// Optional directory of templates, note.md.tmpl and note.html.tmpl, which override the bundled templates used by
+	// RenderNote. Either may be left out to keep the bundled one.
+	RenderTemplateDir string
+
+	// Optional duration, e.g. '30s', that in-flight RPCs are given to finish when the server is asked to stop.
+	ShutdownTimeout string
+
+	// Optional duration, e.g. '10s', between checks that the database is reachable and fully migrated.
+	HealthCheckInterval string
+
+	// Optional port on ServerIp serving the HTTP liveness (/healthz) and readiness (/readyz) endpoints. The standard
+	// grpc.health.v1 service is always served on ServerPort.
+	HealthHttpPort string
+
+	// Optional port on ServerIp serving Prometheus metrics at /metrics. It may be the same as HealthHttpPort.
+	MetricsHttpPort string
+
+	// Optional port on ServerIp serving the FHIR R4 facade at /fhir, which reads, searches for and creates notes as
+	// Composition and DocumentReference resources. It may be the same as HealthHttpPort or MetricsHttpPort.
+	FhirHttpPort string
+
+	// Optional port on ServerIp serving the JSON/REST gateway to NoteService at /v1, described by the OpenAPI document
+	// at /v1/openapi.yaml. It may be the same as HealthHttpPort, MetricsHttpPort or FhirHttpPort.
+	GatewayHttpPort string
+
+	// Optional port on ServerIp receiving HL7 v2 MDM^T02 messages over MLLP, each of which creates a note. 2575 is the
+	// port registered for HL7 over MLLP.
+	MllpPort string
+
+	// Optional note event settings. EventPollInterval, e.g. '1s', the default, is how often the outbox is checked for
+	// events committed through other replicas. When EventWebhookUrl is set, every note event is POSTed to it as JSON.
+	EventPollInterval string
+	EventWebhookUrl   string
+
+	// Optional retry policy for deliveries to webhook subscriptions. A delivery is attempted up to WebhookMaxAttempts
+	// times, 8 when zero or absent, waiting WebhookRetryBackoff, e.g. '1s', the default, before the first retry and
+	// twice as long before each one after, up to 5 minutes. Events which are never delivered are kept as dead letters.
+	WebhookMaxAttempts  int
+	WebhookRetryBackoff string
+
+	// Optional relaxations of which URLs webhook subscriptions may deliver to: only https URLs of public addresses
+	// unless WebhookAllowHttp is set, which allows http, or WebhookAllowPrivateTargets, which allows loopback, private,
+	// link-local and cloud metadata addresses. They do not apply to EventWebhookUrl.
+	WebhookAllowHttp           bool
+	WebhookAllowPrivateTargets bool
+
+	// Optional OpenTelemetry tracing. TracingExporter is 'otlp', which sends spans over OTLP/gRPC to
+	// TracingOtlpEndpoint (host:port, plaintext when TracingOtlpInsecure is set), 'stdout', which writes them as JSON to
+	// TracingFilePath or, when that is empty, stdout, or 'none', the default. TracingSampleRatio is the fraction of
+	// new traces sampled, from 0 exclusive to 1; zero or absent samples every trace.
+	TracingExporter     string
+	TracingOtlpEndpoint string
+	TracingOtlpInsecure bool
+	TracingFilePath     string
+	TracingSampleRatio  float64
+
+	// Optional logging settings. LogLevel is one of panic, fatal, error, warn, info, debug or trace; it defaults to info
+	// in production and debug elsewhere. LogFormat is 'json', the default, or 'text'. LogOutputs lists any of 'stdout',
+	// 'file' (LogPath) and 'syslog'; it defaults to stdout, plus the file when LogPath is set. The log file is rotated
+	// once it reaches LogMaxSizeMb (default 100) or, when set, LogRotateInterval, e.g. '24h'. Rotated files older than
+	// LogMaxAgeDays, or beyond the newest LogMaxBackups, are removed; zero keeps them all. Syslog entries are sent to
+	// LogSyslogAddress over LogSyslogNetwork ('udp' or 'tcp'), or to the local daemon when both are empty.
+	LogLevel          string
+	LogFormat         string
+	LogOutputs        []string
+	LogMaxSizeMb      int
+	LogRotateInterval string
+	LogMaxAgeDays     int
+	LogMaxBackups     int
+	LogSyslogNetwork  string
+	LogSyslogAddress  string
+	LogSyslogTag      string
+
+	// Optional alternatives to DbPassword, which keep the password out of the configuration. DbPasswordFile is a file
+	// holding the password, such as a Docker or Kubernetes secret. DbPasswordSecret is a reference of the form
+	// '<scheme>:<name>' resolved by a SecretProvider, e.g. 'env:PGPASSWORD'. The password is read again for each new
+	// database connection.
+	DbPasswordFile   string
+	DbPasswordSecret string
+
+	// Optional client certificate authentication to Postgres: the PEM encoded certificate and its private key, which
+	// must not be readable by other users, and the root certificate used to verify the server when DbSslMode is
+	// verify-ca or verify-full.
+	DbSslCert     string
+	DbSslKey      string
+	DbSslRootCert string
+
+	// Optional database connection pool limits: the most connections open at once (zero for no limit), the most kept
+	// idle (default 2) and a duration, e.g. '30m', after which connections are replaced. These may be reloaded.
+	DbMaxOpenConns    int
+	DbMaxIdleConns    int
+	DbConnMaxLifetime string
+
+	// Optional de-identification settings, used by the DeidentifyNotes RPC and 'noteclerk export -deidentify'.
+	// DeidentificationKeySecret is a secret reference, e.g. 'file:/run/secrets/deid_key', to the key, at least 32 bytes
+	// long, from which pseudonyms and date shifts are derived; notes de-identified with the same key keep the same
+	// pseudonyms. Dates are shifted by up to DeidentificationMaxDateShiftDays, 365 when zero or absent, either way.
+	// DeidentificationRulesPath is a YAML or JSON file of patterns and dictionaries for scrubbing free text, in addition
+	// to the built-in ones.
+	DeidentificationKeySecret        string
+	DeidentificationMaxDateShiftDays int
+	DeidentificationRulesPath        string
+
+	// Optional duration, e.g. '30s', between checks of the configuration file for changes, which are then reloaded as
+	// on SIGHUP. When absent the file is only reloaded on SIGHUP.
+	ConfigWatchInterval string
+
+	// The configuration file that was read, if any. It is not a setting, so it has no environmental variable or flag.
+	filePath string
+}
+
+// Configuration is layered. Each of these sources overrides the one before it: the defaults below, the configuration
+// file, NOTECLERK_* environmental variables and finally command line flags. Every field can be set from any source;
+// the environmental variable and flag for a field are derived from its name, e.g. DbPassword is NOTECLERK_DB_PASSWORD
+// and -db-password. List fields such as LogOutputs take comma separated values.
+const ConfigEnvPrefix = "NOTECLERK_"
+
+// defaultConfig returns the settings used when no other source provides them.
+func defaultConfig() *Config {
+	return &Config{
+		ServerProtocol: "tcp",
+		ServerPort:     "50051",
+		DbPort:         "5432",
+		DbName:         "noteclerk",
+		DbSslMode:      "require",
+	}
 }
 
-// Load the configuration JSON and return the Config struct. See the Config struct to view the fields that the JSON
-// configuration file is responsible for persisting.
+// LoadConfiguration builds the Config from the defaults, the configuration file at path, NOTECLERK_* environmental
+// variables and the command line flags in args, in that order. The file may be JSON or, when its extension is .yaml
+// or .yml, YAML; a missing .json file is also looked for with those extensions. A missing file is not an error so
+// long as the environment and flags supply every required setting. The -config flag replaces path. Every missing or
+// invalid setting is reported in a single error.
 // RETURN: Config, error
-func LoadConfiguration(path string) (c *Config, err error) {
+func LoadConfiguration(path string, args ...string) (c *Config, err error) {
+	flags, flagValues := newConfigFlagSet()
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return &Config{}, err
+		}
+		return &Config{}, NoteClerkErrWrap(err, ErrLoadConfigurationFailsParseFlags)
+	}
+	return loadConfiguration(path, flagValues)
+}
 
-	file, err := ioutil.ReadFile(path)
-	if err != nil {
-		return &Config{}, NoteClerkErrWrap(err, ErrLoadConfigurationFailsReadFile)
+// loadConfiguration layers the configuration as LoadConfiguration does, with flags which have already been parsed.
+// RETURN: Config, error
+func loadConfiguration(path string, flagValues map[string]*configFlag) (*Config, error) {
+	if v, ok := flagValues[configFileFlag]; ok && v.set {
+		path = v.value
 	}
 
-	conf := &Config{}
-	err = json.Unmarshal(file, conf)
+	conf := defaultConfig()
+
+	found, err := readConfigFile(path, conf)
 	if err != nil {
-		return &Config{}, NoteClerkErrWrap(err, ErrLoadConfigurationFailsJsonMarshal)
+		return &Config{}, err
 	}
 
-	configIsEmpty := conf.DbSslMode == "" || conf.DbIp == "" || conf.DbPort == "" || conf.ServerPort == "" ||
-		conf.ServerProtocol == "" || conf.ServerIp == "" || conf.Version == "" || conf.LogPath == "" ||
-		conf.DbName == "" || conf.DbPassword == "" || conf.DbUsername == ""
+	var problems []string
+	for _, f := range configFields() {
+		if raw, ok := os.LookupEnv(f.env); ok {
+			if err := f.set(conf, raw); err != nil {
+				problems = append(problems, fmt.Sprintf("%v from %v %v", f.name, f.env, err))
+			}
+		}
+	}
+	problems = append(problems, applyConfigFlags(conf, flagValues)...)
 
-	if configIsEmpty {
-		return &Config{}, NoteClerkErrWrap(err, ErrLoadConfigurationAbortsAfterJsonMarshalDueToEmptyConfig)
+	problems = append(problems, validateConfig(conf)...)
+	if len(problems) > 0 {
+		err := NoteClerkErrNew(ErrLoadConfigurationFailsValidation, len(problems), strings.Join(problems, "; "))
+		if !found {
+			err = NoteClerkErrWrap(err, ErrLoadConfigurationFindsNoFile, path)
+		}
+		return &Config{}, err
 	}
 
 	return conf, nil
 }
+
+// applyConfigFlags sets each field whose flag was given on the command line.
+// RETURNS: []string describing each flag value which could not be parsed
+func applyConfigFlags(conf *Config, flagValues map[string]*configFlag) []string {
+	var problems []string
+	for _, f := range configFields() {
+		if v, ok := flagValues[f.flag]; ok && v.set {
+			if err := f.set(conf, v.value); err != nil {
+				problems = append(problems, fmt.Sprintf("%v from -%v %v", f.name, f.flag, err))
+			}
+		}
+	}
+	return problems
+}
+
+// readConfigFile unmarshals the JSON or YAML file at path over conf, and records which file was read.
+// RETURNS: bool (false when there is no file at path), error
+func readConfigFile(path string, conf *Config) (bool, error) {
+	for _, candidate := range configFileCandidates(path) {
+		file, err := ioutil.ReadFile(candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, NoteClerkErrWrap(err, ErrLoadConfigurationFailsReadFile)
+		}
+
+		switch strings.ToLower(filepath.Ext(candidate)) {
+		case ".yaml", ".yml":
+			// YAML is converted to JSON so that keys match field names in the same, case insensitive, way.
+			var values map[string]interface{}
+			if err := yaml.Unmarshal(file, &values); err != nil {
+				return false, NoteClerkErrWrap(err, ErrLoadConfigurationFailsYamlUnmarshal, candidate)
+			}
+			if file, err = json.Marshal(values); err != nil {
+				return false, NoteClerkErrWrap(err, ErrLoadConfigurationFailsYamlUnmarshal, candidate)
+			}
+		}
+		if err := json.Unmarshal(file, conf); err != nil {
+			return false, NoteClerkErrWrap(err, ErrLoadConfigurationFailsJsonMarshal)
+		}
+		conf.filePath = candidate
+		return true, nil
+	}
+	return false, nil
+}
+
+// configFileCandidates lists the files which may hold the configuration for path, in order of preference.
+func configFileCandidates(path string) []string {
+	if path == "" {
+		return nil
+	}
+	candidates := []string{path}
+	if ext := filepath.Ext(path); strings.ToLower(ext) == ".json" {
+		base := strings.TrimSuffix(path, ext)
+		candidates = append(candidates, base+".yaml", base+".yml")
+	}
+	return candidates
+}
+
+// validateConfig checks that the required settings are present and that the optional ones, when set, can be used.
+// RETURNS: []string describing each problem found
+func validateConfig(conf *Config) []string {
+	var problems []string
+	problem := func(field string, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%v %v", configFieldNames(field), fmt.Sprintf(format, args...)))
+	}
+
+	required := map[string]string{
+		"Version":        conf.Version,
+		"ServerProtocol": conf.ServerProtocol,
+		"ServerIp":       conf.ServerIp,
+		"ServerPort":     conf.ServerPort,
+		"DbIp":           conf.DbIp,
+		"DbPort":         conf.DbPort,
+		"DbUsername":     conf.DbUsername,
+		"DbName":         conf.DbName,
+		"DbSslMode":      conf.DbSslMode,
+	}
+	for _, f := range configFields() {
+		if v, ok := required[f.name]; ok && strings.TrimSpace(v) == "" {
+			problem(f.name, "is required")
+		}
+	}
+
+	passwordSources := 0
+	for _, v := range []string{conf.DbPassword, conf.DbPasswordFile, conf.DbPasswordSecret} {
+		if v != "" {
+			passwordSources++
+		}
+	}
+	if passwordSources == 0 && conf.DbSslCert == "" {
+		problem("DbPassword", "is required, unless DbPasswordFile, DbPasswordSecret or DbSslCert is set")
+	}
+	if passwordSources > 1 {
+		problem("DbPassword", "must not be set along with DbPasswordFile or DbPasswordSecret; use only one of them")
+	}
+	if conf.DbPasswordSecret != "" {
+		if _, _, err := parseSecretReference(conf.DbPasswordSecret); err != nil {
+			problem("DbPasswordSecret", "must be a secret reference such as 'env:PGPASSWORD', but was '%v'",
+				conf.DbPasswordSecret)
+		}
+	}
+	if conf.DeidentificationKeySecret != "" {
+		if _, _, err := parseSecretReference(conf.DeidentificationKeySecret); err != nil {
+			problem("DeidentificationKeySecret", "must be a secret reference such as 'env:DEID_KEY', but was '%v'",
+				conf.DeidentificationKeySecret)
+		}
+	}
+	if (conf.DbSslCert == "") != (conf.DbSslKey == "") {
+		problem("DbSslKey", "and DbSslCert must be set together")
+	}
+
+	ports := []struct {
+		field    string
+		value    string
+		optional bool
+	}{
+		{"ServerPort", conf.ServerPort, false},
+		{"DbPort", conf.DbPort, false},
+		{"HealthHttpPort", conf.HealthHttpPort, true},
+		{"MetricsHttpPort", conf.MetricsHttpPort, true},
+		{"FhirHttpPort", conf.FhirHttpPort, true},
+		{"GatewayHttpPort", conf.GatewayHttpPort, true},
+		{"MllpPort", conf.MllpPort, true},
+	}
+	for _, p := range ports {
+		if p.value == "" {
+			continue
+		}
+		if port, err := strconv.Atoi(p.value); err != nil || port < 1 || port > 65535 {
+			problem(p.field, "must be a port number from 1 to 65535, but was '%v'", p.value)
+		}
+	}
+
+	if conf.EventWebhookUrl != "" {
+		u, err := url.Parse(conf.EventWebhookUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("EventWebhookUrl", "must be an http or https URL, but was '%v'", conf.EventWebhookUrl)
+		}
+	}
+
+	switch conf.ServerProtocol {
+	case "", "tcp", "tcp4", "tcp6", "unix":
+	default:
+		problem("ServerProtocol", "must be one of tcp, tcp4, tcp6 or unix, but was '%v'", conf.ServerProtocol)
+	}
+	switch conf.DbSslMode {
+	case "", "disable", "require", "verify-ca", "verify-full":
+	default:
+		problem("DbSslMode", "must be one of disable, require, verify-ca or verify-full, but was '%v'", conf.DbSslMode)
+	}
+
+	durations := map[string]string{
+		"IdempotencyKeyTtl":   conf.IdempotencyKeyTtl,
+		"ShutdownTimeout":     conf.ShutdownTimeout,
+		"HealthCheckInterval": conf.HealthCheckInterval,
+		"LogRotateInterval":   conf.LogRotateInterval,
+		"DbConnMaxLifetime":   conf.DbConnMaxLifetime,
+		"ConfigWatchInterval": conf.ConfigWatchInterval,
+		"EventPollInterval":   conf.EventPollInterval,
+		"WebhookRetryBackoff": conf.WebhookRetryBackoff,
+	}
+	for _, f := range configFields() {
+		v, ok := durations[f.name]
+		if !ok || v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			problem(f.name, "must be a positive duration, e.g. '30s', but was '%v'", v)
+		}
+	}
+
+	nonNegative := map[string]int{
+		"MaxFragmentContentLength":         conf.MaxFragmentContentLength,
+		"MaxFragmentDescriptionLength":     conf.MaxFragmentDescriptionLength,
+		"MaxTagLength":                     conf.MaxTagLength,
+		"LogMaxSizeMb":                     conf.LogMaxSizeMb,
+		"LogMaxAgeDays":                    conf.LogMaxAgeDays,
+		"LogMaxBackups":                    conf.LogMaxBackups,
+		"DbMaxOpenConns":                   conf.DbMaxOpenConns,
+		"DbMaxIdleConns":                   conf.DbMaxIdleConns,
+		"WebhookMaxAttempts":               conf.WebhookMaxAttempts,
+		"DeidentificationMaxDateShiftDays": conf.DeidentificationMaxDateShiftDays,
+	}
+	for _, f := range configFields() {
+		if v, ok := nonNegative[f.name]; ok && v < 0 {
+			problem(f.name, "must not be negative, but was %v", v)
+		}
+	}
+
+	if conf.LogLevel != "" {
+		if _, err := logrus.ParseLevel(conf.LogLevel); err != nil {
+			problem("LogLevel", "must be one of trace, debug, info, warn, error, fatal or panic, but was '%v'", conf.LogLevel)
+		}
+	}
+	switch strings.ToLower(conf.LogFormat) {
+	case "", "json", "text":
+	default:
+		problem("LogFormat", "must be json or text, but was '%v'", conf.LogFormat)
+	}
+	for _, v := range conf.LogOutputs {
+		switch strings.ToLower(v) {
+		case "stdout", "syslog":
+		case "file":
+			if conf.LogPath == "" {
+				problem("LogPath", "is required when LogOutputs includes file")
+			}
+		default:
+			problem("LogOutputs", "must only list stdout, file or syslog, but included '%v'", v)
+		}
+	}
+
+	switch strings.ToLower(conf.TracingExporter) {
+	case "", TracingExporterNone, TracingExporterStdout:
+	case TracingExporterOtlp:
+		if conf.TracingOtlpEndpoint == "" {
+			problem("TracingOtlpEndpoint", "is required when TracingExporter is otlp")
+		}
+	default:
+		problem("TracingExporter", "must be one of otlp, stdout or none, but was '%v'", conf.TracingExporter)
+	}
+	if conf.TracingSampleRatio < 0 || conf.TracingSampleRatio > 1 {
+		problem("TracingSampleRatio", "must be from 0 to 1, but was %v", conf.TracingSampleRatio)
+	}
+
+	return problems
+}
+
+// configField describes how a single Config field is named in each configuration source.
+type configField struct {
+	name  string
+	index int
+	kind  reflect.Kind
+	env   string
+	flag  string
+}
+
+// configFields lists every Config field in declaration order.
+func configFields() []configField {
+	t := reflect.TypeOf(Config{})
+	fields := make([]configField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		words := splitFieldName(f.Name)
+		fields = append(fields, configField{
+			name:  f.Name,
+			index: i,
+			kind:  f.Type.Kind(),
+			env:   ConfigEnvPrefix + strings.ToUpper(strings.Join(words, "_")),
+			flag:  strings.ToLower(strings.Join(words, "-")),
+		})
+	}
+	return fields
+}
+
+// configFieldNames describes a field by its name in every source, for error messages.
+func configFieldNames(name string) string {
+	for _, f := range configFields() {
+		if f.name == name {
+			return fmt.Sprintf("%v (%v, -%v)", f.name, f.env, f.flag)
+		}
+	}
+	return name
+}
+
+// splitFieldName splits a field name such as 'Icd10CodeFilePath' into the words 'Icd10', 'Code', 'File' and 'Path'.
+func splitFieldName(name string) []string {
+	var words []string
+	start := 0
+	runes := []rune(name)
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1]) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+// set parses raw as the type of the field and assigns it in conf.
+func (f configField) set(conf *Config, raw string) error {
+	v := reflect.ValueOf(conf).Elem().Field(f.index)
+	raw = strings.TrimSpace(raw)
+	switch f.kind {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("must be a whole number, but was '%v'", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("must be true or false, but was '%v'", raw)
+		}
+		v.SetBool(b)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number, but was '%v'", raw)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
+
+// The flag naming the configuration file, which takes the place of the path given to LoadConfiguration.
+const configFileFlag = "config"
+
+// configFlag records the raw value of a command line flag so that flags can be applied after the file and
+// environment, whatever order they are given in.
+type configFlag struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *configFlag) Set(value string) error {
+	f.value, f.set = value, true
+	return nil
+}
+
+func (f *configFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// newConfigFlagSet defines a flag for every Config field, plus -config. Subcommands may add flags of their own before
+// parsing.
+// RETURNS: *flag.FlagSet, map[string]*configFlag keyed by flag name
+func newConfigFlagSet() (*flag.FlagSet, map[string]*configFlag) {
+	flags := flag.NewFlagSet("noteclerk", flag.ContinueOnError)
+	values := make(map[string]*configFlag)
+
+	values[configFileFlag] = &configFlag{}
+	flags.Var(values[configFileFlag], configFileFlag, "path to a JSON or YAML configuration file")
+	for _, f := range configFields() {
+		values[f.flag] = &configFlag{isBool: f.kind == reflect.Bool}
+		flags.Var(values[f.flag], f.flag, fmt.Sprintf("overrides %v and %v", f.name, f.env))
+	}
+	return flags, values
+}
@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestLoadConfiguration_WherePathDoesNotPointToConfig_ReturnsError(t *testing.T) {
 	_, err := LoadConfiguration("")
@@ -8,3 +13,153 @@ func TestLoadConfiguration_WherePathDoesNotPointToConfig_ReturnsError(t *testing
 		t.Fatalf("Should throw error when no config file present.")
 	}
 }
+
+const testConfigJson = `{
+  "Version": "0.5.2",
+  "LogPath": "/var/log/noteclerk/server.log",
+  "ServerProtocol": "tcp",
+  "ServerIp": "localhost",
+  "ServerPort": "50051",
+  "DbIp": "localhost",
+  "DbPort": "5433",
+  "DbUsername": "noteclerk",
+  "DbPassword": "from-file",
+  "DbName": "noteclerk",
+  "DbSslMode": "disable"
+}`
+
+func writeTestConfig(t *testing.T, name string, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("Failed to write the config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfiguration_LayersEnvironmentThenFlagsOverFile(t *testing.T) {
+	path := writeTestConfig(t, "config.test.json", testConfigJson)
+	t.Setenv("NOTECLERK_DB_PASSWORD", "from-env")
+	t.Setenv("NOTECLERK_DB_IP", "db.internal")
+	t.Setenv("NOTECLERK_LOG_OUTPUTS", "stdout, file")
+
+	conf, err := LoadConfiguration(path, "-db-ip", "10.0.0.5", "-tracing-otlp-insecure", "-log-max-size-mb=5")
+	if err != nil {
+		t.Fatalf("Failed to load the configuration: %v", err)
+	}
+	if conf.DbPort != "5433" {
+		t.Fatalf("Expected DbPort from the file, but got %v", conf.DbPort)
+	}
+	if conf.DbPassword != "from-env" {
+		t.Fatalf("Expected the environment to override the file, but DbPassword is %v", conf.DbPassword)
+	}
+	if conf.DbIp != "10.0.0.5" {
+		t.Fatalf("Expected the flag to override the environment, but DbIp is %v", conf.DbIp)
+	}
+	if !conf.TracingOtlpInsecure || conf.LogMaxSizeMb != 5 {
+		t.Fatalf("Expected bool and int flags to be applied, but got %v and %v", conf.TracingOtlpInsecure, conf.LogMaxSizeMb)
+	}
+	if len(conf.LogOutputs) != 2 || conf.LogOutputs[1] != "file" {
+		t.Fatalf("Expected a comma separated list from the environment, but got %q", conf.LogOutputs)
+	}
+}
+
+func TestLoadConfiguration_ReadsYamlInPlaceOfMissingJson(t *testing.T) {
+	path := writeTestConfig(t, "config.test.yaml", `
+version: 0.5.2
+serverIp: 0.0.0.0
+dbIp: postgres
+dbUsername: noteclerk
+dbPassword: secret
+dbSslMode: verify-full
+logOutputs: [stdout]
+maxTagLength: 64
+`)
+
+	conf, err := LoadConfiguration(strings.TrimSuffix(path, ".yaml") + ".json")
+	if err != nil {
+		t.Fatalf("Failed to load the YAML configuration: %v", err)
+	}
+	if conf.DbIp != "postgres" || conf.DbSslMode != "verify-full" || conf.MaxTagLength != 64 {
+		t.Fatalf("Expected the YAML settings, but got %+v", conf)
+	}
+	if conf.ServerPort != "50051" || conf.DbPort != "5432" {
+		t.Fatalf("Expected defaults for unset ports, but got %v and %v", conf.ServerPort, conf.DbPort)
+	}
+}
+
+func TestLoadConfiguration_WithoutFile_UsesEnvironmentAlone(t *testing.T) {
+	t.Setenv("NOTECLERK_VERSION", "0.5.2")
+	t.Setenv("NOTECLERK_SERVER_IP", "0.0.0.0")
+	t.Setenv("NOTECLERK_DB_IP", "postgres")
+	t.Setenv("NOTECLERK_DB_USERNAME", "noteclerk")
+	t.Setenv("NOTECLERK_DB_PASSWORD", "secret")
+
+	if _, err := LoadConfiguration(filepath.Join(t.TempDir(), "config.production.json")); err != nil {
+		t.Fatalf("Expected the environment to be enough without a file, but got %v", err)
+	}
+}
+
+func TestLoadConfiguration_ReportsEveryMissingAndInvalidSetting(t *testing.T) {
+	path := writeTestConfig(t, "config.test.json", `{"Version": "0.5.2", "ServerIp": "localhost", "DbIp": "localhost"}`)
+	t.Setenv("NOTECLERK_DB_PORT", "99999")
+
+	_, err := LoadConfiguration(path, "-shutdown-timeout", "soon", "-log-outputs", "file",
+		"-event-webhook-url", "ftp://events.example.org")
+	if err == nil {
+		t.Fatalf("Expected an error for an incomplete configuration, but got nil")
+	}
+	for _, expected := range []string{
+		"DbUsername (NOTECLERK_DB_USERNAME, -db-username) is required",
+		"DbPassword (NOTECLERK_DB_PASSWORD, -db-password) is required",
+		"DbPort (NOTECLERK_DB_PORT, -db-port) must be a port number",
+		"ShutdownTimeout (NOTECLERK_SHUTDOWN_TIMEOUT, -shutdown-timeout) must be a positive duration",
+		"LogPath (NOTECLERK_LOG_PATH, -log-path) is required when LogOutputs includes file",
+		"EventWebhookUrl (NOTECLERK_EVENT_WEBHOOK_URL, -event-webhook-url) must be an http or https URL",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected the error to include %q, but got %v", expected, err)
+		}
+	}
+}
+
+func TestLoadConfiguration_RejectsMalformedEnvironmentValue(t *testing.T) {
+	path := writeTestConfig(t, "config.test.json", testConfigJson)
+	t.Setenv("NOTECLERK_MAX_TAG_LENGTH", "lots")
+
+	_, err := LoadConfiguration(path)
+	if err == nil || !strings.Contains(err.Error(), "MaxTagLength from NOTECLERK_MAX_TAG_LENGTH must be a whole number") {
+		t.Fatalf("Expected the malformed variable to be reported, but got %v", err)
+	}
+}
+
+func TestConfigFields_DeriveEnvironmentAndFlagNames(t *testing.T) {
+	names := make(map[string]configField)
+	for _, f := range configFields() {
+		names[f.name] = f
+	}
+	if f := names["Icd10CodeFilePath"]; f.env != "NOTECLERK_ICD10_CODE_FILE_PATH" || f.flag != "icd10-code-file-path" {
+		t.Fatalf("Unexpected names for Icd10CodeFilePath: %v and %v", f.env, f.flag)
+	}
+	if f := names["DbSslMode"]; f.env != "NOTECLERK_DB_SSL_MODE" || f.flag != "db-ssl-mode" {
+		t.Fatalf("Unexpected names for DbSslMode: %v and %v", f.env, f.flag)
+	}
+}
+
+func TestLoadConfiguration_AcceptsPasswordFileInPlaceOfPassword(t *testing.T) {
+	path := writeTestConfig(t, "config.test.json", testConfigJson)
+	t.Setenv("NOTECLERK_DB_PASSWORD", "")
+	t.Setenv("NOTECLERK_DB_PASSWORD_FILE", "/run/secrets/db_password")
+
+	conf, err := LoadConfiguration(path)
+	if err != nil {
+		t.Fatalf("Expected DbPasswordFile to stand in for DbPassword, but got %v", err)
+	}
+	if conf.DbPassword != "" || conf.DbPasswordFile != "/run/secrets/db_password" {
+		t.Fatalf("Unexpected password settings %q and %q", conf.DbPassword, conf.DbPasswordFile)
+	}
+
+	t.Setenv("NOTECLERK_DB_PASSWORD", "plaintext")
+	if _, err := LoadConfiguration(path); err == nil || !strings.Contains(err.Error(), "use only one of them") {
+		t.Fatalf("Expected an error when both are set, but got %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// noteClerkVersion is written to the Version setting of new configuration files. Release builds set it with
+// -ldflags "-X main.noteClerkVersion=$(cat VERSION)".
+var noteClerkVersion = "0.5.2"
+
+// commandInput is where interactive subcommands read answers from.
+var commandInput io.Reader = os.Stdin
+
+// initPrompts are the settings asked for by an interactive 'noteclerk init', in order. The database password itself is
+// never asked for, so that it is not written to disk; a password file, or NOTECLERK_DB_PASSWORD, supplies it instead.
+var initPrompts = []struct {
+	field  string
+	prompt string
+}{
+	{"ServerProtocol", "Server protocol"},
+	{"ServerIp", "Server IP address"},
+	{"ServerPort", "Server port"},
+	{"LogPath", "Log file path, or empty to log to stdout only"},
+	{"DbIp", "Database IP address"},
+	{"DbPort", "Database port"},
+	{"DbName", "Database name"},
+	{"DbUsername", "Database username"},
+	{"DbPasswordFile", "Database password file, or empty to set NOTECLERK_DB_PASSWORD when starting the server"},
+	{"DbSslMode", "Database SSL mode"},
+}
+
+// initCommand writes a new configuration file for the current NOTECLERK_ENVIRONMENT, or the file named by -config.
+// Settings come from the defaults and any setting flags, e.g. -db-ip, and unless -no-prompt is given each of the
+// initPrompts is then asked for on stdin. A file ending in .yaml or .yml is written as YAML, any other as JSON. The
+// configuration is validated before anything is written, and an existing file is only replaced with -force or when
+// confirmed at the prompt.
+//
+//	noteclerk init [-no-prompt] [-force] [-config path] [-<setting> value ...]
+func initCommand(args []string, out io.Writer) error {
+	flags, flagValues := newConfigFlagSet()
+	flags.SetOutput(out)
+	noPrompt := flags.Bool("no-prompt", false, "take every setting from the defaults and flags without asking")
+	force := flags.Bool("force", false, "replace an existing configuration file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	path := configPath
+	if v := flagValues[configFileFlag]; v.set {
+		path = v.value
+	}
+
+	conf := defaultConfig()
+	conf.Version = noteClerkVersion
+	conf.ServerIp = "localhost"
+	conf.DbIp = "localhost"
+	if NoteClerkData != "" {
+		conf.LogPath = filepath.Join(NoteClerkData, "log", "server.log")
+	}
+	problems := applyConfigFlags(conf, flagValues)
+
+	input := bufio.NewReader(commandInput)
+	if !*noPrompt {
+		fmt.Fprintf(out, "NoteClerk v%v Setup\n===========================\n", noteClerkVersion)
+		for _, p := range initPrompts {
+			field := configFieldByName(p.field)
+			current := reflect.ValueOf(conf).Elem().Field(field.index).Interface()
+			answer, err := prompt(input, out, fmt.Sprintf("%v (default: %v): ", p.prompt, current))
+			if err != nil {
+				return err
+			}
+			if answer != "" {
+				if err := field.set(conf, answer); err != nil {
+					problems = append(problems, fmt.Sprintf("%v %v", p.field, err))
+				}
+			}
+		}
+	}
+
+	// The password may be left for the environment to supply when the server starts.
+	passwordNote := conf.DbPassword == "" && conf.DbPasswordFile == "" && conf.DbPasswordSecret == "" &&
+		conf.DbSslCert == ""
+	for _, v := range validateConfig(conf) {
+		if !(passwordNote && strings.HasPrefix(v, configFieldNames("DbPassword")+" is required")) {
+			problems = append(problems, v)
+		}
+	}
+	if len(problems) > 0 {
+		return NoteClerkErrNew(ErrInitCommandFailsValidation, path, len(problems), strings.Join(problems, "; "))
+	}
+
+	if _, err := os.Stat(path); err == nil && !*force {
+		confirmed := false
+		if !*noPrompt {
+			answer, err := prompt(input, out, fmt.Sprintf("%v already exists. Overwrite (default: no)? ", path))
+			if err != nil {
+				return err
+			}
+			confirmed = strings.HasPrefix(strings.ToLower(answer), "y")
+		}
+		if !confirmed {
+			return NoteClerkErrNew(ErrInitCommandRefusesOverwrite, path)
+		}
+	}
+
+	format := "json"
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		format = "yaml"
+	}
+	encoded, err := encodeConfig(conf, format, false)
+	if err != nil {
+		return err
+	}
+	if err := writeConfigFile(path, encoded); err != nil {
+		return NoteClerkErrWrap(err, ErrInitCommandFailsWriteFile, path)
+	}
+
+	fmt.Fprintf(out, "Wrote the configuration to %v.\n", path)
+	if passwordNote {
+		fmt.Fprintln(out, "NOTE: No database password is configured. Set NOTECLERK_DB_PASSWORD, or DbPasswordFile, "+
+			"before starting the server.")
+	}
+	return nil
+}
+
+// prompt writes question to out and reads a line of input, without its surrounding whitespace. At the end of the input
+// every remaining question is answered with an empty line, which accepts the default.
+func prompt(input *bufio.Reader, out io.Writer, question string) (string, error) {
+	fmt.Fprint(out, question)
+	answer, err := input.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", NoteClerkErrWrap(err, ErrInitCommandFailsReadInput)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// writeConfigFile replaces the file at path with contents, readable only by its owner because it may hold
+// credentials. The file is written beside its destination and renamed into place, so it is never left half written.
+func writeConfigFile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// configCommand checks or prints the configuration which the server would start with, layered from the file,
+// environment and flags exactly as LoadConfiguration does.
+//
+//	noteclerk config validate [-config path] [-<setting> value ...]
+//	noteclerk config show [-format json|yaml] [-config path] [-<setting> value ...]
+func configCommand(args []string, out io.Writer) error {
+	action := ""
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	flags, flagValues := newConfigFlagSet()
+	flags.SetOutput(out)
+	format := flags.String("format", "json", "output format for 'show', json or yaml")
+
+	switch action {
+	case "validate", "show":
+	default:
+		return NoteClerkErrNew(ErrConfigCommandFailsUnknownAction, action)
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	conf, err := loadConfiguration(configPath, flagValues)
+	if err != nil {
+		return err
+	}
+
+	if action == "validate" {
+		source := "the environment and flags alone"
+		if conf.filePath != "" {
+			source = conf.filePath + ", the environment and flags"
+		}
+		fmt.Fprintf(out, "The configuration from %v is valid.\n", source)
+		return nil
+	}
+
+	encoded, err := encodeConfig(conf, *format, true)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(encoded)
+	return err
+}
+
+// encodeConfig writes every setting which is not empty, in the order the Config fields are declared, as JSON or YAML.
+// With redact set, DbPassword is replaced with RedactedValue.
+// RETURNS: []byte, error
+func encodeConfig(conf *Config, format string, redact bool) ([]byte, error) {
+	type setting struct {
+		name  string
+		value interface{}
+	}
+	var settings []setting
+	for _, f := range configFields() {
+		v := reflect.ValueOf(conf).Elem().Field(f.index)
+		if v.IsZero() {
+			continue
+		}
+		value := v.Interface()
+		if redact && f.name == "DbPassword" {
+			value = RedactedValue
+		}
+		settings = append(settings, setting{f.name, value})
+	}
+
+	switch strings.ToLower(format) {
+	case "json":
+		var buf bytes.Buffer
+		buf.WriteString("{\n")
+		for i, s := range settings {
+			key, _ := json.Marshal(s.name)
+			value, err := json.Marshal(s.value)
+			if err != nil {
+				return nil, NoteClerkErrWrap(err, ErrEncodeConfigFailsMarshal, s.name)
+			}
+			buf.WriteString("  ")
+			buf.Write(key)
+			buf.WriteString(": ")
+			buf.Write(value)
+			if i < len(settings)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString("}\n")
+		return buf.Bytes(), nil
+	case "yaml":
+		doc := &yaml.Node{Kind: yaml.MappingNode}
+		for _, s := range settings {
+			value := &yaml.Node{}
+			if err := value.Encode(s.value); err != nil {
+				return nil, NoteClerkErrWrap(err, ErrEncodeConfigFailsMarshal, s.name)
+			}
+			doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.name}, value)
+		}
+		return yaml.Marshal(doc)
+	default:
+		return nil, NoteClerkErrNew(ErrEncodeConfigFailsUnknownFormat, format)
+	}
+}
+
+// configFieldByName finds the description of a Config field.
+func configFieldByName(name string) configField {
+	for _, f := range configFields() {
+		if f.name == name {
+			return f
+		}
+	}
+	panic("no Config field named " + name)
+}
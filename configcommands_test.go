@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInitCommand_WithFlags_WritesConfigWhichLoadsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "config.test.json")
+	out := &bytes.Buffer{}
+
+	err := runCommand([]string{"init", "-no-prompt", "-config", path, "-db-username", "noteclerk",
+		"-db-password-file", "/run/secrets/db password", "-db-ssl-mode", "verify-full", "-log-outputs", "stdout"}, out)
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the configuration file to be written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the configuration to be readable only by its owner, but its mode is %v", info.Mode())
+	}
+
+	loaded, err := LoadConfiguration(path)
+	if err != nil {
+		t.Fatalf("Failed to load the written configuration: %v", err)
+	}
+	if loaded.DbPasswordFile != "/run/secrets/db password" || loaded.DbSslMode != "verify-full" ||
+		loaded.Version != noteClerkVersion || !reflect.DeepEqual(loaded.LogOutputs, []string{"stdout"}) {
+		t.Fatalf("The written configuration did not load back as it was given: %+v", loaded)
+	}
+}
+
+func TestInitCommand_Interactive_UsesAnswersAndDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.test.yaml")
+	input := commandInput
+	defer func() { commandInput = input }()
+	// Answers follow the order of initPrompts; empty lines accept the defaults.
+	commandInput = strings.NewReader("\n0.0.0.0\n\n\ndb.internal\n\n\nclerk\n\n\n")
+
+	out := &bytes.Buffer{}
+	if err := runCommand([]string{"init", "-config", path}, out); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "No database password is configured") {
+		t.Fatalf("Expected a note about the missing password, but got %q", out.String())
+	}
+
+	t.Setenv("NOTECLERK_DB_PASSWORD", "from-env")
+	loaded, err := LoadConfiguration(path)
+	if err != nil {
+		t.Fatalf("Failed to load the written configuration: %v", err)
+	}
+	if loaded.ServerIp != "0.0.0.0" || loaded.DbIp != "db.internal" || loaded.DbUsername != "clerk" ||
+		loaded.ServerPort != "50051" {
+		t.Fatalf("Expected the answers and defaults, but got %+v", loaded)
+	}
+}
+
+func TestInitCommand_RefusesToOverwriteWithoutForce(t *testing.T) {
+	path := writeTestConfig(t, "config.test.json", testConfigJson)
+	args := []string{"init", "-no-prompt", "-config", path, "-db-username", "noteclerk", "-db-password", "new"}
+
+	if err := runCommand(args, &bytes.Buffer{}); err == nil {
+		t.Fatalf("Expected init to refuse to replace the existing file, but got nil")
+	}
+	if err := runCommand(append(args, "-force"), &bytes.Buffer{}); err != nil {
+		t.Fatalf("Expected -force to replace the file, but got %v", err)
+	}
+	if loaded, _ := LoadConfiguration(path); loaded.DbPassword != "new" {
+		t.Fatalf("Expected the replaced configuration, but got %+v", loaded)
+	}
+}
+
+func TestInitCommand_WithInvalidSettings_WritesNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.test.json")
+
+	err := runCommand([]string{"init", "-no-prompt", "-config", path, "-server-port", "http"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "DbUsername") || !strings.Contains(err.Error(), "ServerPort") {
+		t.Fatalf("Expected every problem to be reported, but got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected no file to be written, but got %v", err)
+	}
+}
+
+func TestConfigCommand_Show_RedactsPassword(t *testing.T) {
+	path := writeTestConfig(t, "config.test.json", testConfigJson)
+	out := &bytes.Buffer{}
+
+	if err := runCommand([]string{"config", "show", "-config", path, "-format", "yaml"}, out); err != nil {
+		t.Fatalf("config show failed: %v", err)
+	}
+	if strings.Contains(out.String(), "from-file") || !strings.Contains(out.String(), "DbPassword: '[REDACTED]'") {
+		t.Fatalf("Expected the password to be redacted, but got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "DbPort: \"5433\"") {
+		t.Fatalf("Expected the settings from the file, but got %q", out.String())
+	}
+}
+
+func TestConfigCommand_Validate_ReportsProblems(t *testing.T) {
+	path := writeTestConfig(t, "config.test.json", testConfigJson)
+
+	out := &bytes.Buffer{}
+	if err := runCommand([]string{"config", "validate", "-config", path}, out); err != nil {
+		t.Fatalf("Expected the configuration to be valid, but got %v", err)
+	}
+	if !strings.Contains(out.String(), "is valid") {
+		t.Fatalf("Expected confirmation, but got %q", out.String())
+	}
+
+	if err := runCommand([]string{"config", "validate", "-config", path, "-log-level", "chatty"}, out); err == nil {
+		t.Fatalf("Expected an invalid log level to be reported, but got nil")
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"time"
 )
 
-// NoteClerkServer interface implements the gRPC server NoteServiceServer interface and adds an initialize feature.
-// Any structures implementing this interface can be injected into the server global singleton variable in the
-// dependencies.
+// NoteClerkServer interface implements the gRPC server NoteServiceServer interface, the NoteClerk specific
+// ClerkServiceServer interface, and adds initialize and shutdown features. Any structures implementing this interface can be
+// injected into the server global singleton variable in the dependencies.
 type NoteClerkServer interface {
+	clerkpb.ClerkServiceServer
 	CreateNote(context.Context, *ehrpb.CreateNoteRequest) (*ehrpb.CreateNoteResponse, error)
 	RetrieveNote(context.Context, *ehrpb.RetrieveNoteRequest) (*ehrpb.RetrieveNoteResponse, error)
 	UpdateNote(context.Context, *ehrpb.UpdateNoteRequest) (*ehrpb.UpdateNoteResponse, error)
@@ -16,6 +19,8 @@ type NoteClerkServer interface {
 	SearchNotes(context.Context, *ehrpb.SearchNotesRequest) (*ehrpb.SearchNotesResponse, error)
 	SearchNoteFragments(context.Context, *ehrpb.SearchNoteFragmentRequest) (*ehrpb.SearchNoteFragmentResponse, error)
 	Initialize(config *Config, db RDBMSAccessor) error
+	Reload(config *Config) error
+	Shutdown(ctx context.Context) error
 }
 
 // RDBMSAccessor has all methods necessary for Note transactions and, as an interface, can easily be mocked.
@@ -23,6 +28,10 @@ type NoteClerkServer interface {
 // as the preferred database implementation, it should be assigned to 'db' in dependencies.go.
 type RDBMSAccessor interface {
 	Initialize(config *Config) error
+	Close() error
+	ConfigurePool(config *Config) error
+	CheckHealth(ctx context.Context) error
+	WithContext(ctx context.Context) RDBMSAccessor
 	AddNote(note *ehrpb.Note) (id int64, guid string, err error)
 	UpdateNote(note *ehrpb.Note) error
 	DeleteNote(guid string) error
@@ -40,7 +49,19 @@ type RDBMSAccessor interface {
 	FindNoteFragments(filter NoteFragmentFindFilter) ([]*ehrpb.NoteFragment, error)
 	AddNoteFragmentTag(noteGuid string, tag string) (id int64, err error)
 	GetNoteFragmentTagsByNoteFragmentGuid(noteFragGuid string) (tag []string, err error)
-	createSchema() error
+	AddNoteWithIdempotencyKey(note *ehrpb.Note, record *IdempotencyRecord) (id int64, existing *IdempotencyRecord, err error)
+	DeleteExpiredIdempotencyKeys(now time.Time) (deleted int64, err error)
+	SequenceNoteEvents() (latest int64, err error)
+	NoteEventsAfter(offset int64, limit int) ([]*NoteEvent, error)
+	ClaimNoteEventCursor(consumer string, owner string, lease time.Duration) (offset int64, claimed bool, err error)
+	AdvanceNoteEventCursor(consumer string, owner string, offset int64, lease time.Duration) error
+	AddWebhookSubscription(sub *WebhookSubscription) error
+	WebhookSubscriptions() ([]*WebhookSubscription, error)
+	DeleteWebhookSubscription(guid string) (deleted bool, err error)
+	AddWebhookDeadLetter(letter *WebhookDeadLetter) error
+	ImportNotes(notes []*ehrpb.Note) (skipped []string, err error)
+	ExportNotes(filter NoteExportFilter, after NoteExportMark, limit int) ([]*ehrpb.Note, NoteExportMark, error)
+	migrate() error
 }
 
 // Find Note's with several fields to narrow search.
@@ -59,3 +80,23 @@ type NoteFragmentFindFilter struct {
 	PatientGuid string
 	SearchTerms string
 }
+
+// Select Note's to export. Empty fields match every note; CreatedFrom is inclusive and CreatedTo exclusive. When
+// ChangedUntil is set, only notes named by note events with offsets after ChangedAfter, up to ChangedUntil, are
+// selected, whether as the note an event is about or as the prior version of an updated note.
+type NoteExportFilter struct {
+	PatientGuids []string
+	Types        []ehrpb.NoteType
+	CreatedFrom  time.Time
+	CreatedTo    time.Time
+	ChangedAfter int64
+	ChangedUntil int64
+}
+
+// A position in an export. Notes are exported in order of their creation date or, when exporting changes, of the
+// offset of the last note event naming them, and then of their id.
+type NoteExportMark struct {
+	DateCreated time.Time `json:"date_created"`
+	Offset      int64     `json:"offset"`
+	NoteId      int64     `json:"note_id"`
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// MinDeidentificationKeyLength is the shortest key NewDeidentifier accepts. Pseudonyms are only as hard to trace back
+// to the GUIDs they replace as the key is to guess.
+const MinDeidentificationKeyLength = 32
+
+// DefaultMaxDateShiftDays is how far, in days either way, the dates of a patient's notes are shifted when
+// DeidentificationMaxDateShiftDays is not set.
+const DefaultMaxDateShiftDays = 365
+
+// MaxDeidentifyNoteGuids bounds how many stored notes a DeidentifyNotesRequest may name.
+const MaxDeidentifyNoteGuids = 1000
+
+// Identifiers found in free text are replaced with the name of the rule which found them, in square brackets, e.g.
+// '[PHONE]'. The built-in rules find the identifiers below; names are only found after a title such as 'Mr' or 'Dr',
+// so dictionaries of the names of patients and staff should be added. Years on their own are not identifiers and are
+// kept.
+var builtinDeidentificationPatterns = []DeidentificationPattern{
+	{Name: "EMAIL", Pattern: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`},
+	{Name: "URL", Pattern: `(?i)\b(?:https?://|www\.)[^\s<>"]+`},
+	{Name: "SSN", Pattern: `\b\d{3}-\d{2}-\d{4}\b`},
+	{Name: "MRN", Pattern: `(?i)\b(?:MRN|MR#|medical record (?:number|no\.?|#))\s*[:#]?\s*[A-Z0-9][A-Z0-9-]{3,}\b`},
+	{Name: "PHONE", Pattern: `(?:\+?1[\s.-]?)?(?:\(\d{3}\)\s?|\b\d{3}[\s.-])\d{3}[\s.-]\d{4}\b`},
+	{Name: "IP", Pattern: `\b\d{1,3}(?:\.\d{1,3}){3}\b`},
+	{Name: "DATE", Pattern: `\b(?:\d{4}-\d{1,2}-\d{1,2}|\d{1,2}[/-]\d{1,2}[/-]\d{2,4})\b`},
+	{Name: "DATE", Pattern: `(?i)\b(?:` + months + `)\.?\s+\d{1,2}(?:st|nd|rd|th)?(?:,?\s+\d{4})?\b`},
+	{Name: "DATE", Pattern: `(?i)\b\d{1,2}(?:st|nd|rd|th)?\s+(?:` + months + `)\b\.?(?:,?\s+\d{4}\b)?`},
+	{Name: "DATE", Pattern: `(?i)\b(?:` + months + `)\.?,?\s+\d{4}\b`},
+	{Name: "ADDRESS", Pattern: `\b\d{1,6}\s+(?:[A-Z][A-Za-z]*\.?\s+){1,3}(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|` +
+		`Lane|Ln|Drive|Dr|Court|Ct|Place|Pl|Way|Terrace|Circle|Parkway|Pkwy|Highway|Hwy)\b\.?`},
+	{Name: "ADDRESS", Pattern: `(?i)\bP\.?\s?O\.?\s+Box\s+\d+\b`},
+	{Name: "ZIP", Pattern: `\b[A-Z]{2},?\s+\d{5}(?:-\d{4})?\b`},
+	{Name: "ZIP", Pattern: `\b\d{5}(?:-\d{4})?\b`},
+	{Name: "NAME", Pattern: `\b(?:Mr|Mrs|Ms|Miss|Mx|Dr|Prof)\.?\s+[A-Z][A-Za-z'-]+(?:\s+[A-Z][A-Za-z'-]+)?`},
+}
+
+// months matches the names of the months and their abbreviations.
+const months = `jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|` +
+	`oct(?:ober)?|nov(?:ember)?|dec(?:ember)?`
+
+// DeidentificationRules are the rules by which free text is scrubbed of identifiers, in addition to the built-in
+// ones unless DisableBuiltinPatterns is set. Patterns are RE2 regular expressions. Dictionaries list terms, such as
+// names, which are matched as whole words whatever their case. Rules are applied in the order patterns, the built-in
+// patterns, then dictionaries, so that a name is not taken out of the middle of an email address or a URL.
+type DeidentificationRules struct {
+	Patterns               []DeidentificationPattern    `json:"patterns" yaml:"patterns"`
+	Dictionaries           []DeidentificationDictionary `json:"dictionaries" yaml:"dictionaries"`
+	DisableBuiltinPatterns bool                         `json:"disable_builtin_patterns" yaml:"disable_builtin_patterns"`
+}
+
+// DeidentificationPattern replaces the text matching Pattern with '[Name]'.
+type DeidentificationPattern struct {
+	Name    string `json:"name" yaml:"name"`
+	Pattern string `json:"pattern" yaml:"pattern"`
+}
+
+// DeidentificationDictionary replaces its terms with '[Name]'. Terms are listed in the rules, or in the file at Path,
+// one per line, which is read when the rules are loaded.
+type DeidentificationDictionary struct {
+	Name  string   `json:"name" yaml:"name"`
+	Terms []string `json:"terms" yaml:"terms"`
+	Path  string   `json:"path" yaml:"path"`
+}
+
+// LoadDeidentificationRules reads rules from a YAML or JSON file, along with the dictionaries they name. Dictionary
+// paths are relative to the rules file.
+// RETURNS: *DeidentificationRules, error
+func LoadDeidentificationRules(path string) (*DeidentificationRules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrLoadDeidentificationRulesFailsRead, path)
+	}
+	rules := &DeidentificationRules{}
+	if err := yaml.Unmarshal(data, rules); err != nil {
+		return nil, NoteClerkErrWrap(err, ErrLoadDeidentificationRulesFailsParse, path)
+	}
+	for k, v := range rules.Dictionaries {
+		if v.Path == "" {
+			continue
+		}
+		if !filepath.IsAbs(v.Path) {
+			v.Path = filepath.Join(filepath.Dir(path), v.Path)
+		}
+		terms, err := ioutil.ReadFile(v.Path)
+		if err != nil {
+			return nil, NoteClerkErrWrap(err, ErrLoadDeidentificationRulesFailsReadDictionary, v.Path)
+		}
+		rules.Dictionaries[k].Terms = append(rules.Dictionaries[k].Terms, strings.Split(string(terms), "\n")...)
+	}
+	return rules, nil
+}
+
+// scrubRule replaces the text matching pattern with replacement.
+type scrubRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Deidentifier removes identifiers from notes before they leave the clinical environment:
+//
+//   - Every GUID is replaced with a pseudonym keyed with a secret, which is stable, so that the notes of a patient can
+//     still be linked across exports made with the same key, but which cannot be traced back to the GUID without it.
+//   - The dates of each patient's notes and fragments are shifted by the same number of days, derived from the key
+//     and the patient, so that the intervals between them are kept.
+//   - Fragment content and descriptions, and the tags of notes and fragments, are scrubbed of identifiers according
+//     to DeidentificationRules.
+type Deidentifier struct {
+	key          []byte
+	maxDateShift int
+	rules        []scrubRule
+}
+
+// NewDeidentifier returns a Deidentifier deriving pseudonyms and date shifts from key, which must be at least
+// MinDeidentificationKeyLength bytes long. Dates are shifted by up to maxDateShiftDays either way, or
+// DefaultMaxDateShiftDays when that is zero. rules may be nil for the built-in rules alone.
+// RETURNS: *Deidentifier, error
+func NewDeidentifier(key string, maxDateShiftDays int, rules *DeidentificationRules) (*Deidentifier, error) {
+	if len(key) < MinDeidentificationKeyLength {
+		return nil, NoteClerkErrNew(ErrNewDeidentifierFailsShortKey, MinDeidentificationKeyLength)
+	}
+	d := &Deidentifier{key: []byte(key), maxDateShift: maxDateShiftDays}
+	if d.maxDateShift == 0 {
+		d.maxDateShift = DefaultMaxDateShiftDays
+	}
+	if rules == nil {
+		rules = &DeidentificationRules{}
+	}
+
+	patterns := append([]DeidentificationPattern{}, rules.Patterns...)
+	if !rules.DisableBuiltinPatterns {
+		patterns = append(patterns, builtinDeidentificationPatterns...)
+	}
+	for _, v := range rules.Dictionaries {
+		pattern, err := dictionaryPattern(v)
+		if err != nil {
+			return nil, err
+		}
+		if pattern != "" {
+			patterns = append(patterns, DeidentificationPattern{Name: v.Name, Pattern: pattern})
+		}
+	}
+	for _, v := range patterns {
+		if strings.TrimSpace(v.Name) == "" {
+			return nil, NoteClerkErrNew(ErrNewDeidentifierFailsRule, v.Pattern, "it has no name")
+		}
+		pattern, err := regexp.Compile(v.Pattern)
+		if err != nil {
+			return nil, NoteClerkErrNew(ErrNewDeidentifierFailsRule, v.Name, err)
+		}
+		if pattern.MatchString("") {
+			return nil, NoteClerkErrNew(ErrNewDeidentifierFailsRule, v.Name, "it matches empty text")
+		}
+		d.rules = append(d.rules, scrubRule{pattern: pattern, replacement: "[" + v.Name + "]"})
+	}
+	return d, nil
+}
+
+// dictionaryPattern returns a regular expression matching any of the dictionary's terms as whole words, whatever
+// their case, trying longer terms first. A dictionary without terms has no pattern.
+// RETURNS: string, error
+func dictionaryPattern(dictionary DeidentificationDictionary) (string, error) {
+	if strings.TrimSpace(dictionary.Name) == "" {
+		return "", NoteClerkErrNew(ErrNewDeidentifierFailsRule, dictionary.Path, "the dictionary has no name")
+	}
+	var terms []string
+	for _, v := range dictionary.Terms {
+		if v = strings.TrimSpace(v); v != "" {
+			terms = append(terms, regexp.QuoteMeta(v))
+		}
+	}
+	if len(terms) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(terms, func(i, j int) bool {
+		return len(terms[i]) > len(terms[j])
+	})
+	return `(?i)\b(?:` + strings.Join(terms, "|") + `)\b`, nil
+}
+
+// newDeidentifierFromConfig returns the Deidentifier configured by DeidentificationKeySecret,
+// DeidentificationMaxDateShiftDays and DeidentificationRulesPath, or nil when there is no key.
+// RETURNS: *Deidentifier, error
+func newDeidentifierFromConfig(ctx context.Context, config *Config) (*Deidentifier, error) {
+	if config.DeidentificationKeySecret == "" {
+		return nil, nil
+	}
+	key, err := ResolveSecret(ctx, config.DeidentificationKeySecret)
+	if err != nil {
+		return nil, err
+	}
+	var rules *DeidentificationRules
+	if config.DeidentificationRulesPath != "" {
+		if rules, err = LoadDeidentificationRules(config.DeidentificationRulesPath); err != nil {
+			return nil, err
+		}
+	}
+	return NewDeidentifier(key, config.DeidentificationMaxDateShiftDays, rules)
+}
+
+// Pseudonym returns the pseudonym of guid: a UUID made from the HMAC-SHA256 of the GUID, keyed with the secret. It is
+// marked as a version 8 UUID, so it is still a valid GUID but cannot be mistaken for a real one. An empty GUID stays
+// empty.
+// RETURNS: string
+func (d *Deidentifier) Pseudonym(guid string) string {
+	if guid == "" {
+		return ""
+	}
+	var pseudonym uuid.UUID
+	copy(pseudonym[:], d.mac(strings.ToLower(guid)))
+	pseudonym[6] = pseudonym[6]&0x0f | 0x80
+	pseudonym[8] = pseudonym[8]&0x3f | 0x80
+	return pseudonym.String()
+}
+
+// DateShiftDays returns the number of days, between -maxDateShiftDays and maxDateShiftDays, by which the dates of the
+// patient's notes are shifted.
+// RETURNS: int
+func (d *Deidentifier) DateShiftDays(patientGuid string) int {
+	span := uint64(2*d.maxDateShift + 1)
+	return int(binary.BigEndian.Uint64(d.mac("date-shift:"+strings.ToLower(patientGuid)))%span) - d.maxDateShift
+}
+
+func (d *Deidentifier) mac(value string) []byte {
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// Scrub returns text with the identifiers found by the rules replaced.
+// RETURNS: string
+func (d *Deidentifier) Scrub(text string) string {
+	for _, v := range d.rules {
+		text = v.pattern.ReplaceAllLiteralString(text, v.replacement)
+	}
+	return text
+}
+
+// Note returns a de-identified copy of note. The database ids of the note and its fragments, which would lead back to
+// the stored note, are removed.
+// RETURNS: *ehrpb.Note
+func (d *Deidentifier) Note(note *ehrpb.Note) *ehrpb.Note {
+	n := proto.Clone(note).(*ehrpb.Note)
+	n.Id = 0
+	shift := int64(d.DateShiftDays(n.PatientGuid)) * 24 * 60 * 60
+	if n.DateCreated != nil {
+		n.DateCreated.Seconds += shift
+	}
+	n.NoteGuid = d.Pseudonym(n.NoteGuid)
+	n.PatientGuid = d.Pseudonym(n.PatientGuid)
+	n.AuthorGuid = d.Pseudonym(n.AuthorGuid)
+	n.VisitGuid = d.Pseudonym(n.VisitGuid)
+	n.Tags = d.scrubAll(n.Tags)
+	for _, f := range n.Fragments {
+		f.Id = 0
+		if f.DateCreated != nil {
+			f.DateCreated.Seconds += shift
+		}
+		f.NoteFragmentGuid = d.Pseudonym(f.NoteFragmentGuid)
+		f.NoteGuid = d.Pseudonym(f.NoteGuid)
+		f.IssueGuid = d.Pseudonym(f.IssueGuid)
+		f.Description = d.Scrub(f.Description)
+		f.Content = d.Scrub(f.Content)
+		f.Tags = d.scrubAll(f.Tags)
+	}
+	return n
+}
+
+func (d *Deidentifier) scrubAll(values []string) []string {
+	for k, v := range values {
+		values[k] = d.Scrub(v)
+	}
+	return values
+}
+
+// DeidentifyNotes is a method contracted by the ClerkServiceServer interface. It de-identifies the stored notes named
+// in the DeidentifyNotesRequest, and the NDJSON notes it carries, as 'noteclerk export -deidentify' does, with the
+// key and rules configured for the server. The request fails as a whole if any note cannot be found or read.
+// RETURNS: DeidentifyNotesResponse, error
+func (n *Server) DeidentifyNotes(ctx context.Context, req *clerkpb.DeidentifyNotesRequest) (*clerkpb.DeidentifyNotesResponse, error) {
+	logger := loggerFromContext(ctx)
+	deidentifier := n.settings().deidentifier
+	if deidentifier == nil {
+		err := NoteClerkErrNew(ErrDeidentifyNotesFailsNotConfigured)
+		logger.Warn(err)
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	var notes []*ehrpb.Note
+	db := n.reader(ctx)
+	for _, guid := range req.NoteGuids {
+		note, err := db.GetNoteByGuid(guid)
+		if err != nil {
+			err = NoteClerkErrWrap(err, ErrDeidentifyNotesFailsGetNote, guid)
+			logger.Warn(err)
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		notes = append(notes, note)
+	}
+	for k, v := range strings.Split(req.Records, "\n") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		note := &ehrpb.Note{}
+		if err := jsonpb.UnmarshalString(v, note); err != nil {
+			err = NoteClerkErrWrap(err, ErrDeidentifyNotesFailsParse, k+1)
+			logger.Warn(err)
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		notes = append(notes, note)
+	}
+
+	var records bytes.Buffer
+	for _, v := range notes {
+		if err := (&jsonpb.Marshaler{}).Marshal(&records, deidentifier.Note(v)); err != nil {
+			err = NoteClerkErrWrap(err, ErrDeidentifyNotesFailsEncode, v.GetNoteGuid())
+			logger.Warn(err)
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		records.WriteByte('\n')
+	}
+	logger.Infof("De-identified %v notes.", len(notes))
+	return &clerkpb.DeidentifyNotesResponse{Records: records.String()}, nil
+}
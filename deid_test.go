@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeidentifier_Pseudonym(t *testing.T) {
+	if _, err := NewDeidentifier("short", 0, nil); err == nil {
+		t.Fatalf("Expected a key shorter than %v bytes to be refused", MinDeidentificationKeyLength)
+	}
+	d, _ := NewDeidentifier("a key which is at least 32 bytes long", 0, nil)
+	other, _ := NewDeidentifier("another key at least 32 bytes long", 0, nil)
+
+	guid := uuid.New().String()
+	pseudonym := d.Pseudonym(guid)
+	parsed, err := uuid.Parse(pseudonym)
+	if err != nil || parsed.Version() != 8 || parsed.Variant() != uuid.RFC4122 {
+		t.Fatalf("Expected a version 8 UUID, but got %v: %v", pseudonym, err)
+	}
+	if pseudonym == guid || d.Pseudonym(guid) != pseudonym || d.Pseudonym(uuid.New().String()) == pseudonym {
+		t.Fatalf("Expected a pseudonym which is stable, and different from the GUID and others")
+	}
+	if other.Pseudonym(guid) == pseudonym {
+		t.Fatalf("Expected another key to give another pseudonym")
+	}
+	if d.Pseudonym("") != "" {
+		t.Fatalf("Expected an empty GUID to stay empty")
+	}
+}
+
+func TestDeidentifier_Scrub(t *testing.T) {
+	rules := &DeidentificationRules{
+		Patterns:     []DeidentificationPattern{{Name: "BED", Pattern: `\bbed \d+\b`}},
+		Dictionaries: []DeidentificationDictionary{{Name: "NAME", Terms: []string{"Jane", "Jane Doe", "Bob"}}},
+	}
+	d, err := NewDeidentifier("a key which is at least 32 bytes long", 0, rules)
+	if err != nil {
+		t.Fatalf("Failed to create a deidentifier: %v", err)
+	}
+	for text, expected := range map[string]string{
+		"Jane Doe, MRN: 00123456, seen in bed 4.":            "[NAME], [MRN], seen in [BED].",
+		"Call (555) 123-4567 or jane@example.com.":           "Call [PHONE] or [EMAIL].",
+		"Admitted 03/01/2015, discharged March 4th, 2015.":   "Admitted [DATE], discharged [DATE].",
+		"Lives at 42 Elm Street, Springfield, IL 62704.":     "Lives at [ADDRESS], Springfield, [ZIP].",
+		"Moved to 62704 in May, then 62711-1234.":            "Moved to [ZIP] in May, then [ZIP].",
+		"Referred by Dr. Hayes; BOB drove her in.":           "Referred by [NAME]; [NAME] drove her in.",
+		"Smoked since 1998, 20 pack years, BP 120/80 mm Hg.": "Smoked since 1998, 20 pack years, BP 120/80 mm Hg.",
+	} {
+		if scrubbed := d.Scrub(text); scrubbed != expected {
+			t.Errorf("Expected %q to be scrubbed to %q, but got %q", text, expected, scrubbed)
+		}
+	}
+
+	for _, rules := range []*DeidentificationRules{
+		{Patterns: []DeidentificationPattern{{Name: "BAD", Pattern: "("}}},
+		{Patterns: []DeidentificationPattern{{Name: "EMPTY", Pattern: "x*"}}},
+		{Patterns: []DeidentificationPattern{{Pattern: "x"}}},
+	} {
+		if _, err := NewDeidentifier("a key which is at least 32 bytes long", 0, rules); err == nil {
+			t.Errorf("Expected the rules %+v to be refused", rules.Patterns)
+		}
+	}
+}
+
+func TestDeidentifier_Note(t *testing.T) {
+	d, _ := NewDeidentifier("a key which is at least 32 bytes long", 30, nil)
+	patient := uuid.New().String()
+	notes := []*ehrpb.Note{
+		{Id: 41, NoteGuid: uuid.New().String(), PatientGuid: patient,
+			DateCreated: &timestamp.Timestamp{Seconds: 1425204000},
+			Fragments: []*ehrpb.NoteFragment{{Id: 97, DateCreated: &timestamp.Timestamp{Seconds: 1425207600},
+				Content: "Seen with Mrs Smith."}}},
+		{NoteGuid: uuid.New().String(), PatientGuid: patient, DateCreated: &timestamp.Timestamp{Seconds: 1425290400}},
+	}
+
+	first, second := d.Note(notes[0]), d.Note(notes[1])
+	shift := first.DateCreated.Seconds - notes[0].DateCreated.Seconds
+	if shift%86400 != 0 || shift < -30*86400 || shift > 30*86400 || shift != int64(d.DateShiftDays(patient))*86400 {
+		t.Fatalf("Expected the date to be shifted by whole days within the maximum, but it moved %v seconds", shift)
+	}
+	if second.DateCreated.Seconds-first.DateCreated.Seconds != 86400 ||
+		first.Fragments[0].DateCreated.Seconds-first.DateCreated.Seconds != 3600 {
+		t.Fatalf("Expected the patient's dates to be shifted together")
+	}
+	if first.PatientGuid != d.Pseudonym(patient) || first.Fragments[0].Content != "Seen with [NAME]." {
+		t.Fatalf("Expected the patient's pseudonym and scrubbed content, but got %+v", first)
+	}
+	if first.Id != 0 || first.Fragments[0].Id != 0 {
+		t.Fatalf("Expected the database ids to be removed, but got %v and %v", first.Id, first.Fragments[0].Id)
+	}
+	if notes[0].DateCreated.Seconds != 1425204000 || notes[0].Fragments[0].Content != "Seen with Mrs Smith." ||
+		notes[0].Id != 41 {
+		t.Fatalf("Expected the note to be left as it was")
+	}
+}
+
+func TestLoadDeidentificationRules(t *testing.T) {
+	dir := t.TempDir()
+	rules := "patterns:\n  - name: BED\n    pattern: 'bed \\d+'\ndictionaries:\n  - name: STAFF\n    path: staff.txt\n" +
+		"    terms: [Nurse Ratched]\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "rules.yaml"), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "staff.txt"), []byte("Hawkeye Pierce\nTrapper\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadDeidentificationRules(filepath.Join(dir, "rules.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load the rules: %v", err)
+	}
+	d, err := NewDeidentifier("a key which is at least 32 bytes long", 0, loaded)
+	if err != nil {
+		t.Fatalf("Failed to create a deidentifier: %v", err)
+	}
+	if scrubbed := d.Scrub("Trapper and nurse ratched moved him to bed 2."); scrubbed != "[STAFF] and [STAFF] moved him to [BED]." {
+		t.Fatalf("Expected the dictionary file and the rules to be used, but got %q", scrubbed)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "rules.yaml"), []byte(strings.Replace(rules, "staff", "missing", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDeidentificationRules(filepath.Join(dir, "rules.yaml")); err == nil {
+		t.Fatalf("Expected a missing dictionary to fail the rules")
+	}
+}
+
+func TestServer_DeidentifyNotes(t *testing.T) {
+	s, db := newMockDbServer(t)
+	note := addRenderNote(t, db)
+	req := &clerkpb.DeidentifyNotesRequest{NoteGuids: []string{note.NoteGuid}, Records: importTestNote(uuid.New().String(), "")}
+	if _, err := s.DeidentifyNotes(context.Background(), req); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition without a key, but got %v", err)
+	}
+
+	t.Setenv("NOTECLERK_TEST_DEIDENTIFICATION_KEY", "a key which is at least 32 bytes long")
+	next := localServerConfig()
+	next.DeidentificationKeySecret = "env:NOTECLERK_TEST_DEIDENTIFICATION_KEY"
+	if err := s.Reload(next); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	res, err := s.DeidentifyNotes(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Failed to de-identify notes: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(res.Records), "\n")
+	deidentified := &ehrpb.Note{}
+	if len(lines) != 2 || jsonpb.UnmarshalString(lines[0], deidentified) != nil ||
+		deidentified.NoteGuid != s.settings().deidentifier.Pseudonym(note.NoteGuid) ||
+		!strings.Contains(lines[1], `"content":"Began an hour ago."`) {
+		t.Fatalf("Expected the stored note, then the record, de-identified, but got %v", res.Records)
+	}
+
+	if _, err := s.DeidentifyNotes(context.Background(), &clerkpb.DeidentifyNotesRequest{NoteGuids: []string{uuid.New().String()}}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound for a missing note, but got %v", err)
+	}
+	if _, err := s.DeidentifyNotes(context.Background(), &clerkpb.DeidentifyNotesRequest{Records: "{not json"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument for a record which is not a note, but got %v", err)
+	}
+}
+
+func TestValidateRequest_DeidentifyNotes(t *testing.T) {
+	for _, req := range []*clerkpb.DeidentifyNotesRequest{
+		{},
+		{NoteGuids: []string{"not a guid"}},
+		{NoteGuids: make([]string, MaxDeidentifyNoteGuids+1)},
+	} {
+		if status.Code(validateRequest(req, ContentLimits{}, nil)) != codes.InvalidArgument {
+			t.Errorf("Expected %+v to be invalid", req)
+		}
+	}
+	if err := validateRequest(&clerkpb.DeidentifyNotesRequest{Records: "{}"}, ContentLimits{}, nil); err != nil {
+		t.Errorf("Expected records alone to be valid, but got %v", err)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Inject preferred logger into the log global variable singleton. NOTE: at the time of development, this log singleton
@@ -13,6 +16,17 @@ import (
 // custom loggers should be careful to implement these interfaces.
 var log = logrus.New()
 
+// Every log entry passes through the redacting formatter, so that protected health information is never written.
+func init() {
+	log.Formatter = &redactingFormatter{Formatter: log.Formatter}
+}
+
+// The log outputs opened by InitializeLogger, kept so that they can be flushed and closed on shutdown.
+var (
+	logClosersMu sync.Mutex
+	logClosers   []io.Closer
+)
+
 // The NOTECLERK_DATA environmental variable is retrieved fromm the OS and is used to determine what the root data
 // directory is for configuration and log files.
 var NoteClerkData = os.Getenv(DataRoot)
@@ -37,24 +51,187 @@ var mockDb = &MockDb{}
 // interfaces, which itself implements the NoteServiceServer interface, a gRPC service interface.
 var server NoteClerkServer = &Server{}
 
-// Initialize the logger with a set of default settings. Takes a path to a log file, which is set in the config above,
-// and opens the file pointed to by the log path.
+// Initialize the logger from the logging settings in the config: the level, the format and the outputs, which may be
+// any of stdout, a rotated log file and syslog. The level defaults to info in production and debug elsewhere; the
+// outputs default to stdout, plus the log file when LogPath is set. Log files and their directories are created as
+// needed.
 // RETURNS: error
-func InitializeLogger(logPath string) error {
-	log.Formatter = &logrus.JSONFormatter{}
-	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+func InitializeLogger(config *Config) error {
+	settings, err := newLoggerSettings(config)
 	if err != nil {
-		return NoteClerkErrWrap(err, ErrInitializeLoggerFailsOpenLogFile)
+		return err
 	}
+	settings.apply()
+	return nil
+}
 
-	log.SetLevel(logrus.InfoLevel)
-	var writer io.Writer = os.Stdout
-	if strings.ToLower(Environment) != "production" {
-		writer = io.MultiWriter(os.Stdout, logFile)
-		logrus.SetLevel(logrus.DebugLevel)
+// loggerSettings are a level, formatter and outputs built from the logging settings in a config, which are only used
+// once applied.
+type loggerSettings struct {
+	level     logrus.Level
+	formatter logrus.Formatter
+	out       io.Writer
+	hooks     logrus.LevelHooks
+	closers   []io.Closer
+}
+
+// newLoggerSettings validates the logging settings in config and opens their outputs, without changing the logger.
+// RETURNS: *loggerSettings, error
+func newLoggerSettings(config *Config) (*loggerSettings, error) {
+	level, err := logLevelFromConfig(config)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Out = writer
+	var formatter logrus.Formatter
+	switch strings.ToLower(config.LogFormat) {
+	case "", "json":
+		formatter = &logrus.JSONFormatter{}
+	case "text":
+		formatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}
+	default:
+		return nil, NoteClerkErrNew(ErrInitializeLoggerFailsInvalidFormat, config.LogFormat)
+	}
 
-	return nil
+	outputs := config.LogOutputs
+	if len(outputs) == 0 {
+		outputs = []string{"stdout"}
+		if config.LogPath != "" {
+			outputs = append(outputs, "file")
+		}
+	}
+
+	var writers []io.Writer
+	var hooks []logrus.Hook
+	var closers []io.Closer
+	closeAll := func() {
+		for _, v := range closers {
+			v.Close()
+		}
+	}
+	for _, v := range outputs {
+		switch strings.ToLower(v) {
+		case "stdout":
+			writers = append(writers, os.Stdout)
+		case "file":
+			file, err := openLogFileFromConfig(config)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			writers = append(writers, file)
+			closers = append(closers, file)
+		case "syslog":
+			tag := config.LogSyslogTag
+			if tag == "" {
+				tag = "noteclerk"
+			}
+			hook, conn, err := newSyslogHook(config.LogSyslogNetwork, config.LogSyslogAddress, tag)
+			if err != nil {
+				closeAll()
+				return nil, NoteClerkErrWrap(err, ErrInitializeLoggerFailsConnectSyslog)
+			}
+			hooks = append(hooks, hook)
+			closers = append(closers, conn)
+		default:
+			closeAll()
+			return nil, NoteClerkErrNew(ErrInitializeLoggerFailsUnknownOutput, v)
+		}
+	}
+
+	var out io.Writer
+	switch len(writers) {
+	case 0:
+		out = ioutil.Discard
+	case 1:
+		out = writers[0]
+	default:
+		out = io.MultiWriter(writers...)
+	}
+	levelHooks := make(logrus.LevelHooks)
+	for _, v := range hooks {
+		levelHooks.Add(v)
+	}
+
+	return &loggerSettings{level: level, formatter: formatter, out: out, hooks: levelHooks, closers: closers}, nil
+}
+
+// apply switches the logger over through its setters, which are safe while other goroutines are logging, and only then
+// releases the outputs of any previous initialization so that no entry is written to a closed file.
+func (l *loggerSettings) apply() {
+	logClosersMu.Lock()
+	previous := logClosers
+	logClosers = l.closers
+	log.SetFormatter(&redactingFormatter{Formatter: l.formatter})
+	log.SetLevel(l.level)
+	log.ReplaceHooks(l.hooks)
+	log.SetOutput(l.out)
+	logClosersMu.Unlock()
+
+	for _, v := range previous {
+		v.Close()
+	}
+}
+
+// discard releases the outputs of settings which will not be applied.
+func (l *loggerSettings) discard() {
+	for _, v := range l.closers {
+		v.Close()
+	}
+}
+
+// logLevelFromConfig parses LogLevel, defaulting to info in production and debug in every other environment.
+func logLevelFromConfig(config *Config) (logrus.Level, error) {
+	if config.LogLevel == "" {
+		if strings.ToLower(NoteClerkEnv) == "production" {
+			return logrus.InfoLevel, nil
+		}
+		return logrus.DebugLevel, nil
+	}
+	level, err := logrus.ParseLevel(config.LogLevel)
+	if err != nil {
+		return level, NoteClerkErrWrap(err, ErrInitializeLoggerFailsInvalidLevel, config.LogLevel)
+	}
+	return level, nil
+}
+
+// openLogFileFromConfig opens the rotated log file at LogPath with the configured rotation and retention settings.
+func openLogFileFromConfig(config *Config) (*rotatingFile, error) {
+	maxSizeMb := config.LogMaxSizeMb
+	if maxSizeMb <= 0 {
+		maxSizeMb = DefaultLogMaxSizeMb
+	}
+	var interval time.Duration
+	if config.LogRotateInterval != "" {
+		var err error
+		interval, err = time.ParseDuration(config.LogRotateInterval)
+		if err != nil || interval <= 0 {
+			return nil, NoteClerkErrWrap(err, ErrInitializeLoggerFailsInvalidRotateInterval, config.LogRotateInterval)
+		}
+	}
+	maxAge := time.Duration(config.LogMaxAgeDays) * 24 * time.Hour
+
+	file, err := openRotatingFile(config.LogPath, int64(maxSizeMb)*1024*1024, interval, maxAge, config.LogMaxBackups)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrInitializeLoggerFailsOpenLogFile)
+	}
+	return file, nil
+}
+
+// Flush the log outputs opened by InitializeLogger and close them. Later log entries go to stdout only.
+func CloseLogger() error {
+	logClosersMu.Lock()
+	log.SetOutput(os.Stdout)
+	log.ReplaceHooks(make(logrus.LevelHooks))
+	closers := logClosers
+	logClosers = nil
+	logClosersMu.Unlock()
+
+	var firstErr error
+	for _, v := range closers {
+		if err := v.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
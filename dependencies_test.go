@@ -1,11 +1,114 @@
 package main
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/sirupsen/logrus"
 )
 
+// restoreLogger puts the global logger back as it was once the test ends.
+func restoreLogger(t *testing.T) {
+	out, formatter, level := log.Out, log.Formatter, log.GetLevel()
+	t.Cleanup(func() {
+		CloseLogger()
+		log.Out = out
+		log.Formatter = formatter
+		log.SetLevel(level)
+	})
+}
+
 func TestInitializeLogger_WithInvalidPath_CallsFatalLog(t *testing.T) {
-	if err := InitializeLogger(""); err == nil {
+	restoreLogger(t)
+	if err := InitializeLogger(&Config{LogOutputs: []string{"file"}}); err == nil {
 		t.Fatalf("Expected an error, but got nil. Should not be able to open a file that does not have a valid path.")
 	}
 }
+
+func TestInitializeLogger_CreatesMissingLogFileAndDirectory(t *testing.T) {
+	restoreLogger(t)
+	logPath := filepath.Join(t.TempDir(), "logs", "server.log")
+
+	if err := InitializeLogger(&Config{LogPath: logPath, LogOutputs: []string{"file"}, LogLevel: "info"}); err != nil {
+		t.Fatalf("Expected the log file to be created, but got %v", err)
+	}
+	log.Info("written to the log file")
+	if err := CloseLogger(); err != nil {
+		t.Fatalf("Failed to close the logger: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read the log file: %v", err)
+	}
+	if !strings.Contains(string(b), "written to the log file") {
+		t.Fatalf("Expected the entry in the log file, but it contained %q", b)
+	}
+}
+
+func TestInitializeLogger_SetsLevelOnInjectedLogger(t *testing.T) {
+	restoreLogger(t)
+	if err := InitializeLogger(&Config{LogLevel: "warn"}); err != nil {
+		t.Fatalf("Failed to initialize the logger: %v", err)
+	}
+	if log.GetLevel() != logrus.WarnLevel {
+		t.Fatalf("Expected the injected logger at %v, but it is at %v", logrus.WarnLevel, log.GetLevel())
+	}
+}
+
+func TestInitializeLogger_DefaultsToDebugOutsideProduction(t *testing.T) {
+	restoreLogger(t)
+	env := NoteClerkEnv
+	defer func() { NoteClerkEnv = env }()
+
+	NoteClerkEnv = "development"
+	if err := InitializeLogger(&Config{}); err != nil {
+		t.Fatalf("Failed to initialize the logger: %v", err)
+	}
+	if log.GetLevel() != logrus.DebugLevel {
+		t.Fatalf("Expected %v outside production, but got %v", logrus.DebugLevel, log.GetLevel())
+	}
+
+	NoteClerkEnv = "Production"
+	if err := InitializeLogger(&Config{}); err != nil {
+		t.Fatalf("Failed to initialize the logger: %v", err)
+	}
+	if log.GetLevel() != logrus.InfoLevel {
+		t.Fatalf("Expected %v in production, but got %v", logrus.InfoLevel, log.GetLevel())
+	}
+}
+
+func TestInitializeLogger_UsesTextFormatWhenConfigured(t *testing.T) {
+	restoreLogger(t)
+	logPath := filepath.Join(t.TempDir(), "server.log")
+
+	if err := InitializeLogger(&Config{LogPath: logPath, LogOutputs: []string{"file"}, LogFormat: "text"}); err != nil {
+		t.Fatalf("Failed to initialize the logger: %v", err)
+	}
+	log.Warn("plain text entry")
+	CloseLogger()
+
+	b, _ := ioutil.ReadFile(logPath)
+	if !strings.Contains(string(b), `msg="plain text entry"`) || strings.HasPrefix(string(b), "{") {
+		t.Fatalf("Expected a text formatted entry, but got %q", b)
+	}
+}
+
+func TestInitializeLogger_RejectsInvalidSettings(t *testing.T) {
+	restoreLogger(t)
+	logPath := filepath.Join(t.TempDir(), "server.log")
+
+	configs := map[string]*Config{
+		"level":    {LogLevel: "loud"},
+		"format":   {LogFormat: "xml"},
+		"output":   {LogOutputs: []string{"stdout", "carrier-pigeon"}},
+		"interval": {LogPath: logPath, LogOutputs: []string{"file"}, LogRotateInterval: "daily"},
+	}
+	for name, config := range configs {
+		if err := InitializeLogger(config); err == nil {
+			t.Fatalf("Expected an error for an invalid %v, but got nil", name)
+		}
+	}
+}
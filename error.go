@@ -1,9 +1,13 @@
 package main
 
-import "github.com/pkg/errors"
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
 
 // A type created to provide enum-like functionality for errors.
-type NoteClerkError int8
+type NoteClerkError int16
 
 // Error types mapped to a constant number.
 const (
@@ -57,6 +61,170 @@ const (
 	ErrDbPostgresGetNoteByGuidFailsGetNoteFragments             = 47
 	ErrDbPostgresUpdateNoteFragmentFailsDeletePriorNoteFragment = 48
 	ErrDbPostgresUpdateNoteFragmentFailsAddNewNoteFragment      = 49
+	ErrMigratorUpFailsApplyMigration                            = 50
+	ErrMigratorDownFailsRevertMigration                         = 51
+	ErrMigratorFailsAcquireConnection                           = 52
+	ErrMigratorFailsAcquireAdvisoryLock                         = 53
+	ErrMigratorFailsCreateSchemaMigrationsTable                 = 54
+	ErrMigratorFailsReadSchemaMigrations                        = 55
+	ErrLoadMigrationsFailsReadDir                               = 56
+	ErrLoadMigrationsFailsInvalidFile                           = 57
+	ErrLoadMigrationsFailsDuplicateVersion                      = 58
+	ErrLoadMigrationsFailsMissingScript                         = 59
+	ErrRunCommandFailsUnknownCommand                            = 60
+	ErrMigrateCommandFailsUnknownAction                         = 61
+	ErrValidateRequestFailsInvalidFields                        = 62
+	ErrLoadIcd10CodeSetFailsOpenFile                            = 63
+	ErrParseIcd10CodeSetFailsRead                               = 64
+	ErrNoteClerkServerInitializeFailsLoadIcd10CodeSet           = 65
+	ErrNoteClerkServerLookupIcd10CodesFailsCodeSetNotLoaded     = 66
+	ErrNoteClerkServerCreateNoteRejectsIdempotencyKeyLength     = 67
+	ErrNoteClerkServerCreateNoteFailsReserveIdempotencyKey      = 68
+	ErrNoteClerkServerCreateNoteRejectsReusedIdempotencyKey     = 69
+	ErrNoteClerkServerCreateNoteRejectsIdempotencyKeyInProgress = 70
+	ErrNoteClerkServerCreateNoteFailsRecordIdempotencyKey       = 71
+	ErrNoteClerkServerConstructorFailsInvalidIdempotencyTtl     = 72
+	ErrPurgeExpiredIdempotencyKeysFailsDelete                   = 73
+	ErrDbPostgresAddNoteWithIdempotencyKeyFailsQuery            = 74
+	ErrDbPostgresAddNoteWithIdempotencyKeyFailsReadResponse     = 75
+	ErrDbPostgresAddNoteWithIdempotencyKeyFailsMarshalResponse  = 76
+	ErrNoteClerkServerShutdownFailsDrainBeforeDeadline          = 77
+	ErrNoteClerkServerShutdownFailsCloseDb                      = 78
+	ErrShutdownTimeoutFromConfigFailsParse                      = 79
+	ErrDbPostgresCloseFailsDbClose                              = 80
+	ErrDbPostgresCheckHealthFailsNotInitialized                 = 81
+	ErrDbPostgresCheckHealthFailsPing                           = 82
+	ErrDbPostgresCheckHealthFailsReadMigrations                 = 83
+	ErrDbPostgresCheckHealthFailsPendingMigrations              = 84
+	ErrNoteClerkServerConstructorFailsInvalidHealthInterval     = 85
+	ErrNoteClerkServerInitializeFailsCreateHttpListener         = 86
+	ErrNoteClerkServerFailsServeHttp                            = 87
+	ErrInitTracingFailsUnknownExporter                          = 88
+	ErrInitTracingFailsCreateExporter                           = 89
+	ErrInitTracingFailsOpenFile                                 = 90
+	ErrInitTracingFailsInvalidSampleRatio                       = 91
+	ErrInitializeLoggerFailsInvalidLevel                        = 92
+	ErrInitializeLoggerFailsInvalidFormat                       = 93
+	ErrInitializeLoggerFailsUnknownOutput                       = 94
+	ErrInitializeLoggerFailsConnectSyslog                       = 95
+	ErrInitializeLoggerFailsInvalidRotateInterval               = 96
+	ErrRotatingFileFailsRotate                                  = 97
+	ErrLoadConfigurationFailsParseFlags                         = 98
+	ErrLoadConfigurationFailsYamlUnmarshal                      = 99
+	ErrLoadConfigurationFailsValidation                         = 100
+	ErrLoadConfigurationFindsNoFile                             = 101
+	ErrResolveSecretFailsInvalidReference                       = 102
+	ErrResolveSecretFailsUnknownScheme                          = 103
+	ErrResolveSecretFailsUnsetEnv                               = 104
+	ErrResolveSecretFailsLookup                                 = 105
+	ErrDbPostgresConfigurePoolFailsInvalidLifetime              = 106
+	ErrNoteClerkServerReloadFailsConfigurePool                  = 107
+	ErrReloadConfigFailsLoad                                    = 108
+	ErrReloadConfigFailsReinitializeLogger                      = 109
+	ErrInitCommandFailsValidation                               = 110
+	ErrInitCommandRefusesOverwrite                              = 111
+	ErrInitCommandFailsWriteFile                                = 112
+	ErrInitCommandFailsReadInput                                = 113
+	ErrConfigCommandFailsUnknownAction                          = 114
+	ErrEncodeConfigFailsMarshal                                 = 115
+	ErrEncodeConfigFailsUnknownFormat                           = 116
+	ErrFhirReadFailsGetNote                                     = 117
+	ErrFhirSearchFailsFindNotes                                 = 118
+	ErrFhirCreateFailsCreateNote                                = 119
+	ErrFhirHttpFailsWriteResource                               = 120
+	ErrNoteClerkServerInitializeFailsCreateMllpListener         = 121
+	ErrNoteClerkServerFailsServeMllp                            = 122
+	ErrNoteClerkServerShutdownFailsDrainMllp                    = 123
+	ErrHandleMllpMessageFailsCreateNote                         = 124
+	ErrMllpCommandFailsUnknownAction                            = 125
+	ErrMllpCommandFailsReadFile                                 = 126
+	ErrMllpCommandFailsSend                                     = 127
+	ErrMllpCommandFindsUnacceptedMessages                       = 128
+	ErrExportCcdaFailsGetNote                                   = 129
+	ErrExportCcdaFailsFindNotes                                 = 130
+	ErrExportCcdaFailsRender                                    = 131
+	ErrExportCcdaFailsMarshal                                   = 132
+	ErrCcdaCommandFailsUnknownAction                            = 133
+	ErrCcdaCommandFailsExport                                   = 134
+	ErrCcdaCommandFailsWriteFile                                = 135
+	ErrNoteClerkServerRenderNoteFailsGetNote                    = 136
+	ErrNoteClerkServerRenderNoteFailsLookup                     = 137
+	ErrNoteClerkServerRenderNoteFailsRender                     = 138
+	ErrNoteClerkServerInitializeFailsLoadRenderTemplates        = 139
+	ErrGatewayHttpFailsWriteMessage                             = 140
+	ErrDbPostgresBeginTransactionFails                          = 141
+	ErrDbPostgresCommitTransactionFails                         = 142
+	ErrDbPostgresAddNoteEventsFailsExec                         = 143
+	ErrDbPostgresSequenceNoteEventsFailsQuery                   = 144
+	ErrDbPostgresNoteEventsAfterFailsQuery                      = 145
+	ErrDbPostgresNoteEventsAfterFailsScan                       = 146
+	ErrDbPostgresClaimNoteEventCursorFailsQuery                 = 147
+	ErrDbPostgresAdvanceNoteEventCursorFailsQuery               = 148
+	ErrDbPostgresAdvanceNoteEventCursorFailsNotClaimed          = 149
+	ErrDbPostgresUpdateNoteFragmentFailsGetNote                 = 150
+	ErrEventRelayFailsSequence                                  = 151
+	ErrEventRelayFailsClaimCursor                               = 152
+	ErrEventRelayFailsReadEvents                                = 153
+	ErrEventRelayFailsPublish                                   = 154
+	ErrEventRelayFailsAdvanceCursor                             = 155
+	ErrNoteClerkServerWatchNotesFailsReadEvents                 = 156
+	ErrNoteClerkServerConstructorFailsInvalidEventPollInterval  = 157
+	ErrWebhookPublisherFailsPost                                = 158
+	ErrWebhookPublisherFailsStatus                              = 159
+	ErrDbPostgresAddWebhookSubscriptionFailsExec                = 160
+	ErrDbPostgresWebhookSubscriptionsFailsQuery                 = 161
+	ErrDbPostgresWebhookSubscriptionsFailsScan                  = 162
+	ErrDbPostgresDeleteWebhookSubscriptionFailsExec             = 163
+	ErrNoteClerkServerDeleteWebhookSubscriptionFailsNotFound    = 164
+	ErrDbPostgresAddWebhookDeadLetterFailsExec                  = 165
+	ErrEventRelayFailsListWebhookSubscriptions                  = 166
+	ErrWebhookSubscriptionFailsDeliver                          = 167
+	ErrWebhookSubscriptionFailsRecordDeadLetter                 = 168
+	ErrNoteClerkServerCreateWebhookSubscriptionFailsSecret      = 169
+	ErrNoteClerkServerCreateWebhookSubscriptionFailsOffset      = 170
+	ErrNoteClerkServerCreateWebhookSubscriptionFailsAdd         = 171
+	ErrNoteClerkServerListWebhookSubscriptionsFailsQuery        = 172
+	ErrNoteClerkServerDeleteWebhookSubscriptionFailsDelete      = 173
+	ErrNoteClerkServerConstructorFailsInvalidWebhookBackoff     = 174
+	ErrVerifyWebhookSignatureFailsMalformed                     = 175
+	ErrVerifyWebhookSignatureFailsExpired                       = 176
+	ErrVerifyWebhookSignatureFailsMismatch                      = 177
+	ErrWebhookSubscriptionFailsLostCursor                       = 178
+	ErrDbPostgresImportNotesFailsQuery                          = 179
+	ErrDbPostgresImportNotesFailsCopy                           = 180
+	ErrImportNotesFailsRead                                     = 181
+	ErrImportNotesFailsParse                                    = 182
+	ErrImportNotesFailsDuplicate                                = 183
+	ErrImportNotesFailsBatch                                    = 184
+	ErrImportNotesFailsRecordProgress                           = 185
+	ErrImportCommandFailsArguments                              = 186
+	ErrImportCommandFailsOpenFile                               = 187
+	ErrImportCommandFailsReadCheckpoint                         = 188
+	ErrImportCommandFindsFailedRecords                          = 189
+	ErrDbPostgresExportNotesFailsQuery                          = 190
+	ErrDbPostgresExportNotesFailsScan                           = 191
+	ErrDbPostgresExportNotesFailsGetNote                        = 192
+	ErrExportNotesFailsSequenceEvents                           = 193
+	ErrExportNotesFailsRead                                     = 194
+	ErrExportNotesFailsWrite                                    = 195
+	ErrNewDeidentifierFailsShortKey                             = 196
+	ErrExportCommandFailsArguments                              = 197
+	ErrExportCommandFailsOpenFile                               = 198
+	ErrExportCommandFailsReadState                              = 199
+	ErrExportCommandFailsWriteState                             = 200
+	ErrExportCommandFailsDeidentificationKey                    = 201
+	ErrLoadDeidentificationRulesFailsRead                       = 202
+	ErrLoadDeidentificationRulesFailsParse                      = 203
+	ErrLoadDeidentificationRulesFailsReadDictionary             = 204
+	ErrNewDeidentifierFailsRule                                 = 205
+	ErrNoteClerkServerInitializeFailsLoadDeidentifier           = 206
+	ErrDeidentifyNotesFailsNotConfigured                        = 207
+	ErrDeidentifyNotesFailsGetNote                              = 208
+	ErrDeidentifyNotesFailsParse                                = 209
+	ErrDeidentifyNotesFailsEncode                               = 210
+	ErrNoteClerkServerSearchNoteFragmentsIsUnimplemented        = 211
+	ErrWebhookPublisherFailsPrivateAddress                      = 212
+	ErrImportCommandFailsCheckpointFile                         = 213
 )
 
 // Map NoteClerkError constants to a string messages, which can be used to produce precise error messages.
@@ -111,15 +279,189 @@ var errToMsg = map[NoteClerkError]string{
 	ErrDbPostgresGetNoteByGuidFailsGetNoteFragments:             "DbPostgres.GetNoteByGuid failed to fetch any note fragments for the note with the given guid.",
 	ErrDbPostgresUpdateNoteFragmentFailsDeletePriorNoteFragment: "DbPostgres.UpdateNoteFragment failed to delete the existing note fragment and therefore cannot update.",
 	ErrDbPostgresUpdateNoteFragmentFailsAddNewNoteFragment:      "DbPostgres.UpdateNoteFragment failed to add a new note fragment to the database.",
+	ErrMigratorUpFailsApplyMigration:                            "Migrator.Up failed to apply migration %04d_%v; the migration was rolled back.",
+	ErrMigratorDownFailsRevertMigration:                         "Migrator.Down failed to revert migration %04d_%v; the rollback was abandoned.",
+	ErrMigratorFailsAcquireConnection:                           "Migrator failed to acquire a dedicated database connection.",
+	ErrMigratorFailsAcquireAdvisoryLock:                         "Migrator failed to acquire the migration advisory lock.",
+	ErrMigratorFailsCreateSchemaMigrationsTable:                 "Migrator failed to create the schema_migrations table.",
+	ErrMigratorFailsReadSchemaMigrations:                        "Migrator failed to read the applied versions from the schema_migrations table.",
+	ErrLoadMigrationsFailsReadDir:                               "loadMigrations failed to read the migrations directory.",
+	ErrLoadMigrationsFailsInvalidFile:                           "loadMigrations failed to read migration file %v.",
+	ErrLoadMigrationsFailsDuplicateVersion:                      "loadMigrations found more than one migration with version %04d.",
+	ErrLoadMigrationsFailsMissingScript:                         "loadMigrations requires both an up and a down script for migration version %04d.",
+	ErrRunCommandFailsUnknownCommand:                            "'%v' is not a NoteClerk command. Available commands: %v.",
+	ErrMigrateCommandFailsUnknownAction:                         "'%v' is not a migrate action. Available actions: up, down, status.",
+	ErrValidateRequestFailsInvalidFields:                        "The request has %v invalid field(s): %v.",
+	ErrLoadIcd10CodeSetFailsOpenFile:                            "LoadIcd10CodeSet failed to open the ICD-10-CM code file %v.",
+	ErrParseIcd10CodeSetFailsRead:                               "ParseIcd10CodeSet failed while reading the ICD-10-CM code file.",
+	ErrNoteClerkServerInitializeFailsLoadIcd10CodeSet:           "Server.Initialize failed to load the configured ICD-10-CM code set.",
+	ErrNoteClerkServerLookupIcd10CodesFailsCodeSetNotLoaded:     "Server.LookupIcd10Codes cannot search because no ICD-10-CM code set is loaded.",
+	ErrNoteClerkServerCreateNoteRejectsIdempotencyKeyLength:     "Server.CreateNote rejects idempotency keys longer than %v characters.",
+	ErrNoteClerkServerCreateNoteFailsReserveIdempotencyKey:      "Server.CreateNote failed to reserve the idempotency key for this request.",
+	ErrNoteClerkServerCreateNoteRejectsReusedIdempotencyKey:     "Server.CreateNote rejects the request because its idempotency key was already used for a different note.",
+	ErrNoteClerkServerCreateNoteRejectsIdempotencyKeyInProgress: "Server.CreateNote is still processing an earlier request with this idempotency key; retry shortly.",
+	ErrNoteClerkServerCreateNoteFailsRecordIdempotencyKey:       "Server.CreateNote failed to add the note and record its response against the idempotency key.",
+	ErrNoteClerkServerConstructorFailsInvalidIdempotencyTtl:     "Server.constructor fails because IdempotencyKeyTtl '%v' is not a positive duration, e.g. '24h'.",
+	ErrPurgeExpiredIdempotencyKeysFailsDelete:                   "purgeExpiredIdempotencyKeys failed to delete expired idempotency keys.",
+	ErrDbPostgresAddNoteWithIdempotencyKeyFailsQuery:            "DbPostgres.AddNoteWithIdempotencyKey failed to reserve or read the idempotency key.",
+	ErrDbPostgresAddNoteWithIdempotencyKeyFailsReadResponse:     "DbPostgres.AddNoteWithIdempotencyKey failed to read the recorded response.",
+	ErrDbPostgresAddNoteWithIdempotencyKeyFailsMarshalResponse:  "DbPostgres.AddNoteWithIdempotencyKey failed to marshal the response.",
+	ErrNoteClerkServerShutdownFailsDrainBeforeDeadline:          "Server.Shutdown closed the remaining connections because in-flight RPCs did not finish before the deadline.",
+	ErrNoteClerkServerShutdownFailsCloseDb:                      "Server.Shutdown failed to close the database.",
+	ErrShutdownTimeoutFromConfigFailsParse:                      "shutdownTimeoutFromConfig fails because ShutdownTimeout '%v' is not a positive duration, e.g. '30s'.",
+	ErrDbPostgresCloseFailsDbClose:                              "DbPostgres.Close failed to close the connection pool.",
+	ErrDbPostgresCheckHealthFailsNotInitialized:                 "DbPostgres.CheckHealth fails because the database has not been initialized.",
+	ErrDbPostgresCheckHealthFailsPing:                           "DbPostgres.CheckHealth failed to ping the database.",
+	ErrDbPostgresCheckHealthFailsReadMigrations:                 "DbPostgres.CheckHealth failed to read the applied migrations.",
+	ErrDbPostgresCheckHealthFailsPendingMigrations:              "DbPostgres.CheckHealth found %v migration(s) not yet applied.",
+	ErrNoteClerkServerConstructorFailsInvalidHealthInterval:     "Server.constructor fails because HealthCheckInterval '%v' is not a positive duration, e.g. '10s'.",
+	ErrNoteClerkServerInitializeFailsCreateHttpListener:         "Server.Initialize failed to create a listener for the HTTP endpoints on port %v.",
+	ErrNoteClerkServerFailsServeHttp:                            "Server stopped serving the HTTP endpoints on %v unexpectedly.",
+	ErrInitTracingFailsUnknownExporter:                          "initTracing fails because TracingExporter '%v' is not one of otlp, stdout or none.",
+	ErrInitTracingFailsCreateExporter:                           "initTracing failed to create the %v span exporter.",
+	ErrInitTracingFailsOpenFile:                                 "initTracing failed to open the trace file %v.",
+	ErrInitTracingFailsInvalidSampleRatio:                       "initTracing fails because TracingSampleRatio %v is not between 0 and 1.",
+	ErrInitializeLoggerFailsInvalidLevel:                        "InitializeLogger fails because LogLevel '%v' is not a log level.",
+	ErrInitializeLoggerFailsInvalidFormat:                       "InitializeLogger fails because LogFormat '%v' is not one of json or text.",
+	ErrInitializeLoggerFailsUnknownOutput:                       "InitializeLogger fails because '%v' is not a log output; use stdout, file or syslog.",
+	ErrInitializeLoggerFailsConnectSyslog:                       "InitializeLogger failed to connect to syslog.",
+	ErrInitializeLoggerFailsInvalidRotateInterval:               "InitializeLogger fails because LogRotateInterval '%v' is not a positive duration, e.g. '24h'.",
+	ErrRotatingFileFailsRotate:                                  "rotatingFile failed to rotate the log file %v; logging continues to the current file.",
+	ErrLoadConfigurationFailsParseFlags:                         "LoadConfiguration failed to parse the command line flags.",
+	ErrLoadConfigurationFailsYamlUnmarshal:                      "LoadConfiguration failed to unmarshal the YAML configuration file %v.",
+	ErrLoadConfigurationFailsValidation:                         "LoadConfiguration found %v problem(s) with the configuration: %v.",
+	ErrLoadConfigurationFindsNoFile:                             "LoadConfiguration found no configuration file at %v, and the environment and flags do not complete the configuration",
+	ErrResolveSecretFailsInvalidReference:                       "ResolveSecret fails because '%v' is not a secret reference of the form '<scheme>:<name>'.",
+	ErrResolveSecretFailsUnknownScheme:                          "ResolveSecret has no SecretProvider registered for scheme '%v' in '%v'.",
+	ErrResolveSecretFailsUnsetEnv:                               "ResolveSecret fails because the environmental variable %v is not set.",
+	ErrResolveSecretFailsLookup:                                 "ResolveSecret failed to look up the secret '%v'.",
+	ErrDbPostgresConfigurePoolFailsInvalidLifetime:              "DbPostgres.ConfigurePool fails because DbConnMaxLifetime '%v' is not a positive duration, e.g. '30m'.",
+	ErrNoteClerkServerReloadFailsConfigurePool:                  "Server.Reload failed to apply the database connection pool settings.",
+	ErrReloadConfigFailsLoad:                                    "reloadConfig is keeping the running configuration because the new configuration could not be loaded.",
+	ErrReloadConfigFailsReinitializeLogger:                      "reloadConfig is keeping the running log settings because the new ones could not be applied.",
+	ErrInitCommandFailsValidation:                               "init did not write %v because of %v problem(s) with the configuration: %v.",
+	ErrInitCommandRefusesOverwrite:                              "init did not replace the existing configuration at %v; use -force to replace it.",
+	ErrInitCommandFailsWriteFile:                                "init failed to write the configuration to %v.",
+	ErrInitCommandFailsReadInput:                                "init failed to read an answer from the input.",
+	ErrConfigCommandFailsUnknownAction:                          "config does not support the action '%v'; use validate or show.",
+	ErrEncodeConfigFailsMarshal:                                 "encodeConfig failed to marshal the %v setting.",
+	ErrEncodeConfigFailsUnknownFormat:                           "encodeConfig fails because '%v' is not one of json or yaml.",
+	ErrFhirReadFailsGetNote:                                     "The FHIR %v read failed to get note %v from the database.",
+	ErrFhirSearchFailsFindNotes:                                 "The FHIR %v search failed to find notes in the database.",
+	ErrFhirCreateFailsCreateNote:                                "The FHIR %v create failed to add the note to the database.",
+	ErrFhirHttpFailsWriteResource:                               "The FHIR endpoint failed to write a %v response.",
+	ErrNoteClerkServerInitializeFailsCreateMllpListener:         "Server.Initialize failed to create the MLLP listener on port %v.",
+	ErrNoteClerkServerFailsServeMllp:                            "Server failed to serve MLLP on %v.",
+	ErrNoteClerkServerShutdownFailsDrainMllp:                    "Server.Shutdown closed MLLP connections before their messages were acknowledged.",
+	ErrHandleMllpMessageFailsCreateNote:                         "handleMllpMessage failed to create a note from message %v.",
+	ErrMllpCommandFailsUnknownAction:                            "mllp does not support the action '%v'; use send.",
+	ErrMllpCommandFailsReadFile:                                 "mllp send failed to read the messages in %v.",
+	ErrMllpCommandFailsSend:                                     "mllp send failed to send message %v to %v.",
+	ErrMllpCommandFindsUnacceptedMessages:                       "mllp send found %v of %v message(s) were not accepted.",
+	ErrExportCcdaFailsGetNote:                                   "exportCcda failed to get note %v from the database.",
+	ErrExportCcdaFailsFindNotes:                                 "exportCcda found no notes for visit %v in the database.",
+	ErrExportCcdaFailsRender:                                    "exportCcda could not render the notes as a C-CDA document.",
+	ErrExportCcdaFailsMarshal:                                   "exportCcda fails to write the C-CDA document as XML.",
+	ErrCcdaCommandFailsUnknownAction:                            "ccda does not support the action '%v'; use export.",
+	ErrCcdaCommandFailsExport:                                   "ccda export failed: %v",
+	ErrCcdaCommandFailsWriteFile:                                "ccda export failed to write the document to %v.",
+	ErrNoteClerkServerRenderNoteFailsGetNote:                    "Server.RenderNote fails to get note %v from the database.",
+	ErrNoteClerkServerRenderNoteFailsLookup:                     "Server.RenderNote fails to look up the patient, author or visit of note %v.",
+	ErrNoteClerkServerRenderNoteFailsRender:                     "Server.RenderNote fails to render note %v as %v.",
+	ErrNoteClerkServerInitializeFailsLoadRenderTemplates:        "Server.Initialize fails to load the rendering templates from '%v'.",
+	ErrGatewayHttpFailsWriteMessage:                             "The JSON/REST gateway fails to write a %v message.",
+	ErrDbPostgresBeginTransactionFails:                          "DbPostgres fails to begin a transaction.",
+	ErrDbPostgresCommitTransactionFails:                         "DbPostgres fails to commit a transaction.",
+	ErrDbPostgresAddNoteEventsFailsExec:                         "DbPostgres fails to record a %v event for note %v.",
+	ErrDbPostgresSequenceNoteEventsFailsQuery:                   "DbPostgres.SequenceNoteEvents fails to assign offsets to new note events.",
+	ErrDbPostgresNoteEventsAfterFailsQuery:                      "DbPostgres.NoteEventsAfter fails to query note events after offset %v.",
+	ErrDbPostgresNoteEventsAfterFailsScan:                       "DbPostgres.NoteEventsAfter fails to scan a note event.",
+	ErrDbPostgresClaimNoteEventCursorFailsQuery:                 "DbPostgres.ClaimNoteEventCursor fails to claim the event cursor of %v.",
+	ErrDbPostgresAdvanceNoteEventCursorFailsQuery:               "DbPostgres.AdvanceNoteEventCursor fails to move the event cursor of %v to %v.",
+	ErrDbPostgresAdvanceNoteEventCursorFailsNotClaimed:          "DbPostgres.AdvanceNoteEventCursor fails because the event cursor of %v is claimed by another server.",
+	ErrDbPostgresUpdateNoteFragmentFailsGetNote:                 "DbPostgres.UpdateNoteFragment fails to get the note of the fragment.",
+	ErrEventRelayFailsSequence:                                  "The event relay fails to assign offsets to new note events.",
+	ErrEventRelayFailsClaimCursor:                               "The event relay fails to claim the event cursor of publisher %v.",
+	ErrEventRelayFailsReadEvents:                                "The event relay fails to read note events after offset %v for publisher %v.",
+	ErrEventRelayFailsPublish:                                   "The event relay fails to publish event %v to publisher %v; it will be retried.",
+	ErrEventRelayFailsAdvanceCursor:                             "The event relay fails to record that publisher %v received event %v.",
+	ErrNoteClerkServerWatchNotesFailsReadEvents:                 "Server.WatchNotes fails to read note events after offset %v.",
+	ErrNoteClerkServerConstructorFailsInvalidEventPollInterval:  "Server.constructor fails because EventPollInterval '%v' is not a positive duration, e.g. '1s'.",
+	ErrWebhookPublisherFailsPost:                                "The webhook publisher fails to deliver event %v to %v.",
+	ErrWebhookPublisherFailsStatus:                              "The webhook publisher's delivery of event %v to %v was refused with %v.",
+	ErrDbPostgresAddWebhookSubscriptionFailsExec:                "DbPostgres.AddWebhookSubscription fails to add webhook subscription %v.",
+	ErrDbPostgresWebhookSubscriptionsFailsQuery:                 "DbPostgres.WebhookSubscriptions fails to query the webhook subscriptions.",
+	ErrDbPostgresWebhookSubscriptionsFailsScan:                  "DbPostgres.WebhookSubscriptions fails to scan a webhook subscription.",
+	ErrDbPostgresDeleteWebhookSubscriptionFailsExec:             "DbPostgres.DeleteWebhookSubscription fails to delete webhook subscription %v.",
+	ErrNoteClerkServerDeleteWebhookSubscriptionFailsNotFound:    "Server.DeleteWebhookSubscription fails because there is no webhook subscription %v.",
+	ErrDbPostgresAddWebhookDeadLetterFailsExec:                  "DbPostgres.AddWebhookDeadLetter fails to record event %v as a dead letter of webhook subscription %v.",
+	ErrEventRelayFailsListWebhookSubscriptions:                  "The event relay fails to list the webhook subscriptions.",
+	ErrWebhookSubscriptionFailsDeliver:                          "Webhook subscription %v gives up delivering event %v after %v attempts; it is recorded as a dead letter.",
+	ErrWebhookSubscriptionFailsRecordDeadLetter:                 "Webhook subscription %v fails to record event %v as a dead letter.",
+	ErrNoteClerkServerCreateWebhookSubscriptionFailsSecret:      "Server.CreateWebhookSubscription fails to generate a signing secret.",
+	ErrNoteClerkServerCreateWebhookSubscriptionFailsOffset:      "Server.CreateWebhookSubscription fails to read the latest event offset.",
+	ErrNoteClerkServerCreateWebhookSubscriptionFailsAdd:         "Server.CreateWebhookSubscription fails to add the subscription to the database.",
+	ErrNoteClerkServerListWebhookSubscriptionsFailsQuery:        "Server.ListWebhookSubscriptions fails to read the subscriptions from the database.",
+	ErrNoteClerkServerDeleteWebhookSubscriptionFailsDelete:      "Server.DeleteWebhookSubscription fails to delete subscription %v.",
+	ErrNoteClerkServerConstructorFailsInvalidWebhookBackoff:     "Server.constructor fails because WebhookRetryBackoff '%v' is not a positive duration, e.g. '1s'.",
+	ErrVerifyWebhookSignatureFailsMalformed:                     "The webhook signature '%v' is malformed.",
+	ErrVerifyWebhookSignatureFailsExpired:                       "The webhook signature was made at %v, which is more than %v ago.",
+	ErrVerifyWebhookSignatureFailsMismatch:                      "The webhook signature does not match the payload.",
+	ErrWebhookSubscriptionFailsLostCursor:                       "Webhook subscription %v stops retrying event %v because another server has claimed its event cursor.",
+	ErrDbPostgresImportNotesFailsQuery:                          "DbPostgres.ImportNotes fails to look up which notes already exist.",
+	ErrDbPostgresImportNotesFailsCopy:                           "DbPostgres.ImportNotes fails to copy %v notes into the database.",
+	ErrImportNotesFailsRead:                                     "The import fails to read line %v.",
+	ErrImportNotesFailsParse:                                    "The record is not an ehrpb.Note in the protobuf JSON encoding.",
+	ErrImportNotesFailsDuplicate:                                "Note %v appears earlier in the same batch.",
+	ErrImportNotesFailsBatch:                                    "The import fails to add the notes on lines %v to %v; it can be resumed after line %v.",
+	ErrImportNotesFailsRecordProgress:                           "The import fails to record its progress after line %v.",
+	ErrImportCommandFailsArguments:                              "The import command takes one NDJSON file, but was given %v.",
+	ErrImportCommandFailsOpenFile:                               "The import command fails to open %v.",
+	ErrImportCommandFailsReadCheckpoint:                         "The import command fails to read the checkpoint %v.",
+	ErrImportCommandFindsFailedRecords:                          "%v of the records could not be imported; they are listed in %v.",
+	ErrDbPostgresExportNotesFailsQuery:                          "The query for the notes to export fails.",
+	ErrDbPostgresExportNotesFailsScan:                           "The notes to export fail to be read from the query results.",
+	ErrDbPostgresExportNotesFailsGetNote:                        "The export fails to read the fragments and tags of note %v.",
+	ErrExportNotesFailsSequenceEvents:                           "The export fails to find the latest note event offset.",
+	ErrExportNotesFailsRead:                                     "The export fails to read the notes after note %v.",
+	ErrExportNotesFailsWrite:                                    "The export fails to write note %v.",
+	ErrNewDeidentifierFailsShortKey:                             "The de-identification key must be at least %v bytes long.",
+	ErrExportCommandFailsArguments:                              "The export command's arguments are invalid: %v",
+	ErrExportCommandFailsOpenFile:                               "The export command fails to write to %v.",
+	ErrExportCommandFailsReadState:                              "The state file %v cannot be read, or was written by an export with another -since.",
+	ErrExportCommandFailsWriteState:                             "The export command fails to record its high-water mark in %v; the next export will repeat this one.",
+	ErrExportCommandFailsDeidentificationKey:                    "De-identified exports need DeidentificationKeySecret to name a key of at least %v bytes, and any DeidentificationRulesPath to be valid.",
+	ErrLoadDeidentificationRulesFailsRead:                       "The de-identification rules %v cannot be read.",
+	ErrLoadDeidentificationRulesFailsParse:                      "The de-identification rules %v are neither valid YAML nor JSON.",
+	ErrLoadDeidentificationRulesFailsReadDictionary:             "The de-identification dictionary %v cannot be read.",
+	ErrNewDeidentifierFailsRule:                                 "The de-identification rule '%v' is invalid: %v",
+	ErrNoteClerkServerInitializeFailsLoadDeidentifier:           "The server fails to load the de-identification key or rules.",
+	ErrDeidentifyNotesFailsNotConfigured:                        "Notes cannot be de-identified because DeidentificationKeySecret is not set.",
+	ErrDeidentifyNotesFailsGetNote:                              "Note %v cannot be found to be de-identified.",
+	ErrDeidentifyNotesFailsParse:                                "Line %v of the records is not an ehrpb.Note in the protobuf JSON encoding.",
+	ErrDeidentifyNotesFailsEncode:                               "The de-identified note %v fails to be encoded.",
+	ErrNoteClerkServerSearchNoteFragmentsIsUnimplemented:        "Server.SearchNoteFragments is not implemented yet; use SearchNotes instead.",
+	ErrWebhookPublisherFailsPrivateAddress:                      "The webhook publisher refuses to connect to %v, which is not a public address.",
+	ErrImportCommandFailsCheckpointFile:                         "The checkpoint %v records the import of %v, not %v; remove it, or give another -checkpoint.",
 }
 
-func NoteClerkErrWrap(err error, nce NoteClerkError) error {
+// NoteClerkErrWrap annotates err with the message mapped to nce. Messages containing formatting verbs are formatted
+// with args. A nil err produces a new error, as NoteClerkErrNew would.
+func NoteClerkErrWrap(err error, nce NoteClerkError, args ...interface{}) error {
 	if err == nil {
-		return NoteClerkErrNew(nce)
+		return NoteClerkErrNew(nce, args...)
 	}
-	return errors.WithMessage(err, errToMsg[nce])
+	return errors.WithMessage(err, noteClerkErrMsg(nce, args...))
 }
 
-func NoteClerkErrNew(nce NoteClerkError) error {
-	return errors.New(errToMsg[nce])
+// NoteClerkErrNew creates an error with the message mapped to nce, formatted with args where the message requires it.
+func NoteClerkErrNew(nce NoteClerkError, args ...interface{}) error {
+	return errors.New(noteClerkErrMsg(nce, args...))
+}
+
+func noteClerkErrMsg(nce NoteClerkError, args ...interface{}) string {
+	if len(args) == 0 {
+		return errToMsg[nce]
+	}
+	return fmt.Sprintf(errToMsg[nce], args...)
 }
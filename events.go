@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/google/uuid"
+)
+
+// Note lifecycle events. Each is recorded in the note_event outbox table in the same transaction as the change it
+// describes, so an event is published if, and only if, its change was committed.
+const (
+	// EventNoteCreated is recorded when a note is created.
+	EventNoteCreated = "NoteCreated"
+	// EventNoteUpdated is recorded when a note is updated. Updates store the note under a new GUID, so the event
+	// carries both the GUID of the new version and that of the version it replaced.
+	EventNoteUpdated = "NoteUpdated"
+	// EventNoteDeleted is recorded when a note's status is changed to deleted.
+	EventNoteDeleted = "NoteDeleted"
+	// EventFragmentSuperseded is recorded for each note fragment replaced by a newer version.
+	EventFragmentSuperseded = "FragmentSuperseded"
+	// EventNoteSigned is recorded when a note becomes active, whether it is created active or updated from having no
+	// status. Notes which are still being dictated or edited have no status; authenticated notes are active.
+	EventNoteSigned = "NoteSigned"
+)
+
+// EventTypes lists every note event type.
+var EventTypes = []string{EventNoteCreated, EventNoteUpdated, EventNoteDeleted, EventFragmentSuperseded,
+	EventNoteSigned}
+
+// DefaultEventPollInterval is used when EventPollInterval is not set. Changes made through this server are published
+// straight away; the interval bounds the delay for changes made through other replicas.
+const DefaultEventPollInterval = time.Second
+
+// eventBatchSize is the most events read from the outbox at once.
+const eventBatchSize = 100
+
+// eventCursorLease is how long a server holds the event cursor of a publisher after last claiming or advancing it.
+// Only the holder publishes, so each event is delivered by one replica at a time.
+const eventCursorLease = 30 * time.Second
+
+// NoteEvent is a change to a note. Events are identified by their offset, which orders them as their changes were
+// committed; offsets start at 1 and have no gaps. Events carry the GUIDs of the note and the parties to it, but not
+// its content, which consumers retrieve as they need it.
+type NoteEvent struct {
+	Offset                   int64     `json:"offset"`
+	Type                     string    `json:"type"`
+	OccurredAt               time.Time `json:"occurred_at"`
+	NoteGuid                 string    `json:"note_guid"`
+	PreviousNoteGuid         string    `json:"previous_note_guid,omitempty"`
+	NoteFragmentGuid         string    `json:"note_fragment_guid,omitempty"`
+	PreviousNoteFragmentGuid string    `json:"previous_note_fragment_guid,omitempty"`
+	PatientGuid              string    `json:"patient_guid"`
+	AuthorGuid               string    `json:"author_guid"`
+	VisitGuid                string    `json:"visit_guid"`
+	NoteType                 string    `json:"note_type"`
+}
+
+// newNoteEvent returns an event of the given type about note. It is given an offset once it has been committed.
+func newNoteEvent(eventType string, note *ehrpb.Note) *NoteEvent {
+	return &NoteEvent{
+		Type:        eventType,
+		OccurredAt:  time.Now().UTC(),
+		NoteGuid:    note.GetNoteGuid(),
+		PatientGuid: note.GetPatientGuid(),
+		AuthorGuid:  note.GetAuthorGuid(),
+		VisitGuid:   note.GetVisitGuid(),
+		NoteType:    note.GetType().String(),
+	}
+}
+
+// fragmentSupersededEvent returns the event recorded when the fragment of note with the GUID prior is replaced by the
+// fragment with the GUID next.
+func fragmentSupersededEvent(note *ehrpb.Note, prior string, next string) *NoteEvent {
+	event := newNoteEvent(EventFragmentSuperseded, note)
+	event.NoteFragmentGuid = next
+	event.PreviousNoteFragmentGuid = prior
+	return event
+}
+
+// noteCreatedEvents returns the events recorded when note is created: NoteCreated and, when the note is created
+// active, NoteSigned.
+func noteCreatedEvents(note *ehrpb.Note) []*NoteEvent {
+	events := []*NoteEvent{newNoteEvent(EventNoteCreated, note)}
+	if note.GetStatus() == ehrpb.RecordStatus_ACTIVE {
+		events = append(events, newNoteEvent(EventNoteSigned, note))
+	}
+	return events
+}
+
+// noteUpdatedEvents returns the events recorded when prior is replaced by note: NoteUpdated, FragmentSuperseded for
+// each fragment of note found in supersedes, which maps the GUID of a new fragment to that of the fragment it
+// replaces, and NoteSigned when the note became active.
+func noteUpdatedEvents(prior *ehrpb.Note, note *ehrpb.Note, supersedes map[string]string) []*NoteEvent {
+	updated := newNoteEvent(EventNoteUpdated, note)
+	updated.PreviousNoteGuid = prior.GetNoteGuid()
+	events := []*NoteEvent{updated}
+
+	for _, v := range note.GetFragments() {
+		if previous, ok := supersedes[v.GetNoteFragmentGuid()]; ok {
+			events = append(events, fragmentSupersededEvent(note, previous, v.GetNoteFragmentGuid()))
+		}
+	}
+	if prior.GetStatus() != ehrpb.RecordStatus_ACTIVE && note.GetStatus() == ehrpb.RecordStatus_ACTIVE {
+		events = append(events, newNoteEvent(EventNoteSigned, note))
+	}
+	return events
+}
+
+// EventPublisher delivers note events to a downstream system, such as a message broker. Each publisher receives every
+// event in offset order. An event is delivered again, and later events held back, until Publish returns nil for it,
+// so publishers must tolerate receiving an event more than once.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *NoteEvent) error
+}
+
+// EventPublisherFunc adapts an ordinary function to the EventPublisher interface.
+type EventPublisherFunc func(ctx context.Context, event *NoteEvent) error
+
+// Publish is a method contracted by the EventPublisher interface.
+func (f EventPublisherFunc) Publish(ctx context.Context, event *NoteEvent) error {
+	return f(ctx, event)
+}
+
+var (
+	eventPublishersMu sync.RWMutex
+	eventPublishers   = map[string]EventPublisher{}
+)
+
+// RegisterEventPublisher adds publisher to those which receive note events, replacing any publisher already registered
+// with the name. The offset of the last event each publisher received is stored in the database under its name, so
+// that publishing resumes where it left off when the server restarts. It is intended to be called from an init
+// function.
+func RegisterEventPublisher(name string, publisher EventPublisher) {
+	eventPublishersMu.Lock()
+	defer eventPublishersMu.Unlock()
+	eventPublishers[name] = publisher
+}
+
+// registeredEventPublishers returns a copy of the registered publishers, by name.
+func registeredEventPublishers() map[string]EventPublisher {
+	eventPublishersMu.RLock()
+	defer eventPublishersMu.RUnlock()
+	publishers := make(map[string]EventPublisher, len(eventPublishers))
+	for k, v := range eventPublishers {
+		publishers[k] = v
+	}
+	return publishers
+}
+
+// eventRelay moves note events from the outbox to their consumers. It assigns offsets to newly committed events,
+// wakes the WatchNotes streams waiting for them and hands them to each publisher.
+type eventRelay struct {
+	db         RDBMSAccessor
+	interval   time.Duration
+	owner      string
+	publishers map[string]EventPublisher
+
+	// How deliveries to webhook subscriptions are retried, and which URLs they may be made to.
+	retry   webhookRetryPolicy
+	targets webhookTargetPolicy
+
+	// Receives a value whenever this server commits a change, so that its events are relayed without waiting for the
+	// next poll.
+	nudges chan struct{}
+
+	// Guards latest and changed. changed is closed, and replaced, whenever the latest offset advances.
+	mu      sync.Mutex
+	latest  int64
+	changed chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newEventRelay returns a relay for the events in db, which polls for events committed by other servers every
+// interval. Events are published to the registered publishers, to webhook when it is not nil and to each webhook
+// subscription in db.
+// RETURNS: *eventRelay
+func newEventRelay(db RDBMSAccessor, interval time.Duration, webhook EventPublisher) *eventRelay {
+	publishers := registeredEventPublishers()
+	if webhook != nil {
+		publishers[webhookPublisherName] = webhook
+	}
+	return &eventRelay{
+		db:         db,
+		interval:   interval,
+		owner:      uuid.New().String(),
+		publishers: publishers,
+		retry:      webhookRetryPolicy{maxAttempts: DefaultWebhookMaxAttempts, backoff: DefaultWebhookRetryBackoff},
+		nudges:     make(chan struct{}, 1),
+		changed:    make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+}
+
+// run relays events until stop is closed.
+func (r *eventRelay) run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	var wg sync.WaitGroup
+	for name, publisher := range r.publishers {
+		wg.Add(1)
+		go func(name string, publisher EventPublisher) {
+			defer wg.Done()
+			r.deliver(ctx, name, publisher, 0)
+		}(name, publisher)
+	}
+
+	// Cancels delivery to each webhook subscription, by GUID
+	subscriptions := make(map[string]context.CancelFunc)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.poll()
+		r.syncSubscriptions(ctx, subscriptions, &wg)
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		case <-r.nudges:
+		}
+	}
+}
+
+// nudge asks the relay to look for new events straight away. It never blocks.
+func (r *eventRelay) nudge() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.nudges <- struct{}{}:
+	default:
+	}
+}
+
+// poll assigns offsets to newly committed events and, when there are any, wakes those waiting for them.
+func (r *eventRelay) poll() {
+	latest, err := r.db.SequenceNoteEvents()
+	if err != nil {
+		log.Warn(NoteClerkErrWrap(err, ErrEventRelayFailsSequence))
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if latest > r.latest {
+		r.latest = latest
+		close(r.changed)
+		r.changed = make(chan struct{})
+	}
+}
+
+// changes returns a channel which is closed when the next events are relayed. It is taken before reading events, so
+// that events relayed while they are being read are not missed.
+func (r *eventRelay) changes() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed
+}
+
+// close ends every WatchNotes stream, so that the server can stop without waiting for them. Clients resume from the
+// last offset they received.
+func (r *eventRelay) close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+}
+
+// syncSubscriptions starts delivering events to the webhook subscriptions created since it was last called, and stops
+// delivering to those deleted. running holds the subscriptions being delivered to.
+func (r *eventRelay) syncSubscriptions(ctx context.Context, running map[string]context.CancelFunc, wg *sync.WaitGroup) {
+	subs, err := r.db.WebhookSubscriptions()
+	if err != nil {
+		log.Warn(NoteClerkErrWrap(err, ErrEventRelayFailsListWebhookSubscriptions))
+		return
+	}
+
+	current := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		current[sub.Guid] = true
+		if _, ok := running[sub.Guid]; ok {
+			continue
+		}
+		subCtx, cancel := context.WithCancel(ctx)
+		running[sub.Guid] = cancel
+		wg.Add(1)
+		go func(sub *WebhookSubscription) {
+			defer wg.Done()
+			r.deliver(subCtx, sub.consumer(), r.subscriptionPublisher(sub), sub.AfterOffset)
+		}(sub)
+	}
+	for guid, cancel := range running {
+		if !current[guid] {
+			cancel()
+			delete(running, guid)
+		}
+	}
+}
+
+// subscriptionPublisher returns the publisher delivering events to sub with the relay's retry policy. While it waits
+// to retry, it extends its lease on the subscription's event cursor to cover the wait.
+// RETURNS: *subscriptionPublisher
+func (r *eventRelay) subscriptionPublisher(sub *WebhookSubscription) *subscriptionPublisher {
+	webhook := newWebhookPublisher(sub.Url, r.targets)
+	webhook.secret = sub.Secret
+	webhook.subscription = sub.Guid
+	return &subscriptionPublisher{
+		subscription: sub,
+		webhook:      webhook,
+		retry:        r.retry,
+		db:           r.db,
+		renew: func(wait time.Duration) bool {
+			_, claimed, err := r.db.ClaimNoteEventCursor(sub.consumer(), r.owner, wait+eventCursorLease)
+			return err == nil && claimed
+		},
+	}
+}
+
+// deliver publishes events after from to publisher as they are relayed, until ctx is done. Deliveries which fail are
+// retried every interval.
+func (r *eventRelay) deliver(ctx context.Context, name string, publisher EventPublisher, from int64) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		changed := r.changes()
+		r.publish(ctx, name, publisher, from)
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish hands publisher every event after its cursor, or after from when that is later, in order, advancing the
+// cursor past each one it accepts. It does nothing while another server holds the cursor, and stops at the first event
+// the publisher fails to accept.
+func (r *eventRelay) publish(ctx context.Context, name string, publisher EventPublisher, from int64) {
+	after, claimed, err := r.db.ClaimNoteEventCursor(name, r.owner, eventCursorLease)
+	if err != nil {
+		log.Warn(NoteClerkErrWrap(err, ErrEventRelayFailsClaimCursor, name))
+		return
+	}
+	if !claimed {
+		return
+	}
+	if after < from {
+		after = from
+	}
+
+	for ctx.Err() == nil {
+		events, err := r.db.NoteEventsAfter(after, eventBatchSize)
+		if err != nil {
+			log.Warn(NoteClerkErrWrap(err, ErrEventRelayFailsReadEvents, after, name))
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+		for _, e := range events {
+			if err := publisher.Publish(ctx, e); err != nil {
+				eventPublishFailuresTotal.WithLabelValues(publisherMetricLabel(name)).Inc()
+				log.Warn(NoteClerkErrWrap(err, ErrEventRelayFailsPublish, e.Offset, name))
+				return
+			}
+			if err := r.db.AdvanceNoteEventCursor(name, r.owner, e.Offset, eventCursorLease); err != nil {
+				log.Warn(NoteClerkErrWrap(err, ErrEventRelayFailsAdvanceCursor, name, e.Offset))
+				return
+			}
+			eventsPublishedTotal.WithLabelValues(publisherMetricLabel(name)).Inc()
+			after = e.Offset
+		}
+	}
+}
+
+// publisherMetricLabel returns the publisher label of the metrics of the publisher whose event cursor is name. Every
+// webhook subscription shares one label.
+func publisherMetricLabel(name string) string {
+	if strings.HasPrefix(name, subscriptionConsumerPrefix) {
+		return subscriptionMetricLabel
+	}
+	return name
+}
+
+// matchesEventTypes reports whether event is of one of types; every event matches when types is empty.
+func matchesEventTypes(event *NoteEvent, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, v := range types {
+		if v == event.Type {
+			return true
+		}
+	}
+	return false
+}
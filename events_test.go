@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func eventTypesOf(events []*NoteEvent) []string {
+	var types []string
+	for _, v := range events {
+		types = append(types, v.Type)
+	}
+	return types
+}
+
+func TestNoteEvents_DescribeChanges(t *testing.T) {
+	draft := &ehrpb.Note{NoteGuid: uuid.New().String(), PatientGuid: uuid.New().String(),
+		Type: ehrpb.NoteType_HISTORY_AND_PHYSICAL}
+	if types := eventTypesOf(noteCreatedEvents(draft)); len(types) != 1 || types[0] != EventNoteCreated {
+		t.Fatalf("Expected only NoteCreated for a note without a status, but got %v", types)
+	}
+
+	signed := &ehrpb.Note{NoteGuid: uuid.New().String(), PatientGuid: draft.PatientGuid, Status: ehrpb.RecordStatus_ACTIVE,
+		Fragments: []*ehrpb.NoteFragment{{NoteFragmentGuid: uuid.New().String()}, {NoteFragmentGuid: uuid.New().String()}}}
+	prior := uuid.New().String()
+	events := noteUpdatedEvents(draft, signed, map[string]string{signed.Fragments[1].NoteFragmentGuid: prior})
+	types := eventTypesOf(events)
+	if len(types) != 3 || types[0] != EventNoteUpdated || types[1] != EventFragmentSuperseded || types[2] != EventNoteSigned {
+		t.Fatalf("Expected NoteUpdated, FragmentSuperseded and NoteSigned, but got %v", types)
+	}
+	if events[0].PreviousNoteGuid != draft.NoteGuid || events[0].NoteGuid != signed.NoteGuid {
+		t.Fatalf("Expected NoteUpdated to name both versions of the note, but got %+v", events[0])
+	}
+	if events[1].PreviousNoteFragmentGuid != prior || events[1].NoteFragmentGuid != signed.Fragments[1].NoteFragmentGuid {
+		t.Fatalf("Expected FragmentSuperseded to name both versions of the fragment, but got %+v", events[1])
+	}
+
+	if types := eventTypesOf(noteUpdatedEvents(signed, signed, nil)); len(types) != 1 {
+		t.Fatalf("Expected a note which was already active not to be signed again, but got %v", types)
+	}
+}
+
+// watchNotesTestStream is a WatchNotes stream which collects the events sent on it.
+type watchNotesTestStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *clerkpb.NoteEvent
+}
+
+func (s *watchNotesTestStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchNotesTestStream) Send(e *clerkpb.NoteEvent) error {
+	s.events <- e
+	return nil
+}
+
+func (s *watchNotesTestStream) next(t *testing.T) *clerkpb.NoteEvent {
+	select {
+	case e := <-s.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected an event on the stream, but none arrived")
+		return nil
+	}
+}
+
+func TestServer_WatchNotes_ResumesAfterOffset(t *testing.T) {
+	s, db := newMockDbServer(t)
+	first := addRenderNote(t, db)
+	addRenderNote(t, db)
+	s.events.poll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &watchNotesTestStream{ctx: ctx, events: make(chan *clerkpb.NoteEvent, 10)}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.WatchNotes(&clerkpb.WatchNotesRequest{AfterOffset: 2, EventTypes: []string{EventNoteCreated, EventNoteDeleted}},
+			stream)
+	}()
+
+	// The first note's NoteCreated and NoteSigned are at offsets 1 and 2
+	if e := stream.next(t); e.Offset != 3 || e.Type != EventNoteCreated {
+		t.Fatalf("Expected the stream to resume with the second note's NoteCreated, but got %+v", e)
+	}
+
+	if err := db.DeleteNote(first.NoteGuid); err != nil {
+		t.Fatalf("Failed to delete a note: %v", err)
+	}
+	s.events.poll()
+	if e := stream.next(t); e.Offset != 5 || e.Type != EventNoteDeleted || e.NoteGuid != first.NoteGuid {
+		t.Fatalf("Expected the new NoteDeleted event, skipping NoteSigned, but got %+v", e)
+	}
+
+	cancel()
+	if err := <-done; status.Code(err) != codes.Canceled {
+		t.Fatalf("Expected the stream to end when cancelled, but got %v", err)
+	}
+}
+
+func TestServer_WatchNotes_EndsWhenServerStops(t *testing.T) {
+	s, _ := newMockDbServer(t)
+	stream := &watchNotesTestStream{ctx: context.Background(), events: make(chan *clerkpb.NoteEvent, 10)}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.WatchNotes(&clerkpb.WatchNotesRequest{}, stream)
+	}()
+
+	s.events.close()
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("Expected Unavailable when the server stops, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the stream to end when the server stops")
+	}
+
+	err := s.WatchNotes(&clerkpb.WatchNotesRequest{EventTypes: []string{"NoteRead"}}, stream)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument for an unknown event type, but got %v", err)
+	}
+}
+
+func TestEventRelay_PublishesToWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var received []*NoteEvent
+	refuse := true
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if refuse {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		e := &NoteEvent{}
+		if err := json.NewDecoder(r.Body).Decode(e); err != nil || r.Header.Get(EventTypeHeader) != e.Type ||
+			r.Header.Get(EventOffsetHeader) != strconv.FormatInt(e.Offset, 10) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, e)
+	}))
+	defer receiver.Close()
+
+	_, db := newMockDbServer(t)
+	note := addRenderNote(t, db)
+	relay := newEventRelay(db, time.Hour, newWebhookPublisher(receiver.URL, anyWebhookTarget))
+	relay.poll()
+
+	// A refused delivery leaves the cursor where it was, so the event is delivered again
+	relay.publish(context.Background(), webhookPublisherName, relay.publishers[webhookPublisherName], 0)
+	mu.Lock()
+	refuse = false
+	mu.Unlock()
+	relay.publish(context.Background(), webhookPublisherName, relay.publishers[webhookPublisherName], 0)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if types := eventTypesOf(received); len(types) != 2 || types[0] != EventNoteCreated || types[1] != EventNoteSigned ||
+		received[0].NoteGuid != note.NoteGuid || received[0].PatientGuid != note.PatientGuid {
+		t.Fatalf("Expected NoteCreated and NoteSigned for the note, in order, but got %+v", received)
+	}
+
+	// Another server cannot publish while this one holds the cursor
+	if _, claimed, _ := db.ClaimNoteEventCursor(webhookPublisherName, uuid.New().String(), time.Minute); claimed {
+		t.Fatalf("Expected the cursor to be held by the relay which published")
+	}
+	if offset, _, _ := db.ClaimNoteEventCursor(webhookPublisherName, relay.owner, time.Minute); offset != 2 {
+		t.Fatalf("Expected the cursor to have advanced past both events, but it is at %v", offset)
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/google/uuid"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Exports are written as NDJSON, one note per line in the protobuf JSON encoding the import command reads, or as
+// Parquet, one row per note with its tags and fragments nested in it.
+const (
+	ExportFormatNdjson  = "ndjson"
+	ExportFormatParquet = "parquet"
+)
+
+// An incremental export continues from the high-water mark left by the one before it: the creation date of the last
+// note it exported, or the offset of the last note event it included. By event offset, notes which were changed,
+// deleted or imported with an earlier creation date since the last export are exported again.
+const (
+	ExportSinceCreated = "created"
+	ExportSinceOffset  = "offset"
+)
+
+// DefaultExportBatchSize is how many notes an export reads from the database at a time.
+const DefaultExportBatchSize = 500
+
+// noteWriter writes exported notes to a file in one of the export formats.
+type noteWriter interface {
+	Write(note *ehrpb.Note) error
+	Close() error
+}
+
+// newNoteWriter returns a noteWriter writing the format to w. Closing it does not close w.
+// RETURNS: noteWriter
+func newNoteWriter(format string, w io.Writer) noteWriter {
+	if format == ExportFormatParquet {
+		return &parquetNoteWriter{w: parquet.NewWriter(w, parquet.SchemaOf(&parquetNote{}))}
+	}
+	return &ndjsonNoteWriter{w: bufio.NewWriter(w)}
+}
+
+type ndjsonNoteWriter struct {
+	w *bufio.Writer
+}
+
+func (n *ndjsonNoteWriter) Write(note *ehrpb.Note) error {
+	if err := (&jsonpb.Marshaler{}).Marshal(n.w, note); err != nil {
+		return err
+	}
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonNoteWriter) Close() error {
+	return n.w.Flush()
+}
+
+type parquetNoteWriter struct {
+	w *parquet.Writer
+}
+
+func (p *parquetNoteWriter) Write(note *ehrpb.Note) error {
+	return p.w.Write(newParquetNote(note))
+}
+
+func (p *parquetNoteWriter) Close() error {
+	return p.w.Close()
+}
+
+// parquetNote is the Parquet schema of exported notes. Enumerations are written by name.
+type parquetNote struct {
+	NoteGuid    string                `parquet:"note_guid"`
+	DateCreated time.Time             `parquet:"date_created,timestamp(nanosecond)"`
+	PatientGuid string                `parquet:"patient_guid"`
+	AuthorGuid  string                `parquet:"author_guid"`
+	VisitGuid   string                `parquet:"visit_guid"`
+	Type        string                `parquet:"type,enum"`
+	Status      string                `parquet:"status,enum"`
+	Tags        []string              `parquet:"tags,list"`
+	Fragments   []parquetNoteFragment `parquet:"fragments,list"`
+}
+
+type parquetNoteFragment struct {
+	NoteFragmentGuid string    `parquet:"note_fragment_guid"`
+	DateCreated      time.Time `parquet:"date_created,timestamp(nanosecond)"`
+	IssueGuid        string    `parquet:"issue_guid"`
+	Icd10Code        string    `parquet:"icd_10_code"`
+	Icd10Long        string    `parquet:"icd_10_long"`
+	Description      string    `parquet:"description"`
+	Status           string    `parquet:"status,enum"`
+	Priority         string    `parquet:"priority,enum"`
+	Topic            string    `parquet:"topic,enum"`
+	Content          string    `parquet:"content"`
+	Tags             []string  `parquet:"tags,list"`
+}
+
+func newParquetNote(n *ehrpb.Note) *parquetNote {
+	row := &parquetNote{
+		NoteGuid:    n.GetNoteGuid(),
+		DateCreated: time.Unix(n.GetDateCreated().GetSeconds(), int64(n.GetDateCreated().GetNanos())).UTC(),
+		PatientGuid: n.GetPatientGuid(),
+		AuthorGuid:  n.GetAuthorGuid(),
+		VisitGuid:   n.GetVisitGuid(),
+		Type:        n.GetType().String(),
+		Status:      n.GetStatus().String(),
+		Tags:        n.GetTags(),
+	}
+	for _, f := range n.GetFragments() {
+		row.Fragments = append(row.Fragments, parquetNoteFragment{
+			NoteFragmentGuid: f.GetNoteFragmentGuid(),
+			DateCreated:      time.Unix(f.GetDateCreated().GetSeconds(), int64(f.GetDateCreated().GetNanos())).UTC(),
+			IssueGuid:        f.GetIssueGuid(),
+			Icd10Code:        f.GetIcd_10Code(),
+			Icd10Long:        f.GetIcd_10Long(),
+			Description:      f.GetDescription(),
+			Status:           f.GetStatus().String(),
+			Priority:         f.GetPriority().String(),
+			Topic:            f.GetTopic().String(),
+			Content:          f.GetContent(),
+			Tags:             f.GetTags(),
+		})
+	}
+	return row
+}
+
+// noteExporter streams the notes matching a filter from the database to a noteWriter, a batch at a time, optionally
+// de-identifying them on the way.
+type noteExporter struct {
+	db           RDBMSAccessor
+	filter       NoteExportFilter
+	since        string
+	batchSize    int
+	deidentifier *Deidentifier
+}
+
+// export writes the notes after the high-water mark to w. With since ExportSinceOffset, those are the notes named by
+// the note events after mark.Offset; otherwise they are the notes created after mark, or every note when there is
+// no mark.
+// RETURNS: NoteExportMark (the high-water mark to continue from next time), int (the number of notes written), error
+func (ex *noteExporter) export(w noteWriter, mark NoteExportMark) (NoteExportMark, int, error) {
+	filter := ex.filter
+	position := mark
+	if ex.since == ExportSinceOffset {
+		latest, err := ex.db.SequenceNoteEvents()
+		if err != nil {
+			return mark, 0, NoteClerkErrWrap(err, ErrExportNotesFailsSequenceEvents)
+		}
+		if latest <= mark.Offset {
+			return mark, 0, nil
+		}
+		filter.ChangedAfter, filter.ChangedUntil = mark.Offset, latest
+		position = NoteExportMark{}
+	}
+
+	exported := 0
+	for {
+		notes, next, err := ex.db.ExportNotes(filter, position, ex.batchSize)
+		if err != nil {
+			return mark, exported, NoteClerkErrWrap(err, ErrExportNotesFailsRead, position.NoteId)
+		}
+		for _, v := range notes {
+			guid := v.GetNoteGuid()
+			if ex.deidentifier != nil {
+				v = ex.deidentifier.Note(v)
+			}
+			if err := w.Write(v); err != nil {
+				return mark, exported, NoteClerkErrWrap(err, ErrExportNotesFailsWrite, guid)
+			}
+			exported++
+		}
+		position = next
+		if len(notes) < ex.batchSize {
+			break
+		}
+	}
+
+	if ex.since == ExportSinceOffset {
+		return NoteExportMark{Offset: filter.ChangedUntil}, exported, nil
+	}
+	return position, exported, nil
+}
+
+// exportState is the high-water mark of an incremental export, kept in its state file between runs.
+type exportState struct {
+	Since string `json:"since"`
+	NoteExportMark
+}
+
+// exportCommand exports the notes matching its filters from the database configured for the current
+// NOTECLERK_ENVIRONMENT, with their tags and fragments, to a file or, as NDJSON, to out. With -since, only the notes
+// added, or changed, since the export which last used the same state file are exported. Each incremental export
+// should have a state file of its own.
+//
+//	noteclerk export [-format ndjson|parquet] [-patients guid,...] [-patient-file file] [-types type,...]
+//	    [-from date] [-to date] [-since created|offset -state file] [-deidentify] [-batch n] [-o file]
+func exportCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(out)
+	format := flags.String("format", ExportFormatNdjson, "ndjson or parquet")
+	patients := flags.String("patients", "", "comma separated GUIDs of the patients whose notes are exported")
+	patientFile := flags.String("patient-file", "", "file listing the GUIDs of the patients whose notes are exported, one per line")
+	types := flags.String("types", "", "comma separated note types to export, e.g. HISTORY_AND_PHYSICAL")
+	from := flags.String("from", "", "export notes created at or after this date (2006-01-02) or time (RFC 3339)")
+	to := flags.String("to", "", "export notes created before this date (2006-01-02) or time (RFC 3339)")
+	since := flags.String("since", "", "export incrementally, after the high-water mark of the last created note or event offset")
+	statePath := flags.String("state", "", "file the high-water mark of an incremental export is kept in")
+	deidentify := flags.Bool("deidentify", false, "pseudonymize GUIDs, shift dates and scrub identifiers from free text")
+	batchSize := flags.Int("batch", DefaultExportBatchSize, "number of notes read from the database at a time")
+	path := flags.String("o", "", "file to write the notes to, instead of the standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ex := &noteExporter{since: *since, batchSize: *batchSize}
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if flags.NArg() > 0 {
+		problem("unexpected arguments %v", strings.Join(flags.Args(), " "))
+	}
+	if *format != ExportFormatNdjson && *format != ExportFormatParquet {
+		problem("-format must be ndjson or parquet")
+	} else if *format == ExportFormatParquet && *path == "" {
+		problem("-o is required for parquet")
+	}
+	if *since != "" && *since != ExportSinceCreated && *since != ExportSinceOffset {
+		problem("-since must be created or offset")
+	}
+	if (*since == "") != (*statePath == "") {
+		problem("-since and -state must be given together")
+	}
+	if *batchSize < 1 {
+		problem("-batch must be at least 1")
+	}
+
+	guids := splitExportList(*patients)
+	if *patientFile != "" {
+		data, err := ioutil.ReadFile(*patientFile)
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrExportCommandFailsArguments, "-patient-file cannot be read")
+		}
+		guids = append(guids, strings.Fields(string(data))...)
+	}
+	for _, v := range guids {
+		if _, err := uuid.Parse(v); err != nil {
+			problem("patient GUID %v is not a GUID", v)
+		}
+		ex.filter.PatientGuids = append(ex.filter.PatientGuids, strings.ToLower(v))
+	}
+	for _, v := range splitExportList(*types) {
+		t, ok := ehrpb.NoteType_value[strings.ToUpper(v)]
+		if !ok {
+			problem("%v is not a note type", v)
+		}
+		ex.filter.Types = append(ex.filter.Types, ehrpb.NoteType(t))
+	}
+	var err error
+	if ex.filter.CreatedFrom, err = parseExportTime(*from); err != nil {
+		problem("-from %v", err)
+	}
+	if ex.filter.CreatedTo, err = parseExportTime(*to); err != nil {
+		problem("-to %v", err)
+	}
+	if len(problems) > 0 {
+		return NoteClerkErrNew(ErrExportCommandFailsArguments, strings.Join(problems, "; "))
+	}
+
+	config, err := LoadConfiguration(configPath)
+	if err != nil {
+		return err
+	}
+	if *deidentify {
+		ex.deidentifier, err = newDeidentifierFromConfig(context.Background(), config)
+		if err != nil || ex.deidentifier == nil {
+			return NoteClerkErrWrap(err, ErrExportCommandFailsDeidentificationKey, MinDeidentificationKeyLength)
+		}
+	}
+	db := &DbPostgres{}
+	if err := db.Initialize(config); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ex.db = instrumentDb(db)
+	return runExport(ex, *format, *path, *statePath, out)
+}
+
+// runExport exports notes as the export command does. The file is written in full before it replaces path, and the
+// high-water mark is only recorded once it has, so an export which fails can simply be run again.
+// RETURNS: error
+func runExport(ex *noteExporter, format string, path string, statePath string, out io.Writer) error {
+	state := &exportState{Since: ex.since}
+	if statePath != "" {
+		if data, err := ioutil.ReadFile(statePath); err == nil {
+			if err := json.Unmarshal(data, state); err != nil || state.Since != ex.since {
+				return NoteClerkErrWrap(err, ErrExportCommandFailsReadState, statePath)
+			}
+		} else if !os.IsNotExist(err) {
+			return NoteClerkErrWrap(err, ErrExportCommandFailsReadState, statePath)
+		}
+	}
+
+	if path == "" {
+		w := newNoteWriter(format, out)
+		mark, _, err := ex.export(w, state.NoteExportMark)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return err
+		}
+		return writeExportState(statePath, state, mark)
+	}
+
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrExportCommandFailsOpenFile, path)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w := newNoteWriter(format, file)
+	mark, exported, err := ex.export(w, state.NoteExportMark)
+	if err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return NoteClerkErrWrap(err, ErrExportCommandFailsOpenFile, path)
+	}
+	if err := file.Sync(); err != nil {
+		return NoteClerkErrWrap(err, ErrExportCommandFailsOpenFile, path)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return NoteClerkErrWrap(err, ErrExportCommandFailsOpenFile, path)
+	}
+	fmt.Fprintf(out, "Exported %v notes to %v.\n", exported, path)
+	return writeExportState(statePath, state, mark)
+}
+
+// writeExportState records the high-water mark of an incremental export in its state file.
+// RETURNS: error
+func writeExportState(statePath string, state *exportState, mark NoteExportMark) error {
+	if statePath == "" {
+		return nil
+	}
+	state.NoteExportMark = mark
+	data, _ := json.Marshal(state)
+	if err := ioutil.WriteFile(statePath+".tmp", data, 0600); err != nil {
+		return NoteClerkErrWrap(err, ErrExportCommandFailsWriteState, statePath)
+	}
+	if err := os.Rename(statePath+".tmp", statePath); err != nil {
+		return NoteClerkErrWrap(err, ErrExportCommandFailsWriteState, statePath)
+	}
+	return nil
+}
+
+func splitExportList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseExportTime parses a date, taken as midnight UTC, or an RFC 3339 time. An empty value is the zero time.
+// RETURNS: time.Time, error
+func parseExportTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/google/uuid"
+	"github.com/parquet-go/parquet-go"
+)
+
+// readExportedNotes returns the GUIDs of the notes in an NDJSON export.
+func readExportedNotes(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open the export: %v", err)
+	}
+	defer file.Close()
+	var guids []string
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		note := &ehrpb.Note{}
+		if err := jsonpb.UnmarshalString(scanner.Text(), note); err != nil {
+			t.Fatalf("Expected a note on each line, but got %v: %v", scanner.Text(), err)
+		}
+		guids = append(guids, note.GetNoteGuid())
+	}
+	return guids
+}
+
+func TestRunExport_IsIncremental(t *testing.T) {
+	_, db := newMockDbServer(t)
+	dir, err := ioutil.TempDir("", "noteclerk-export")
+	if err != nil {
+		t.Fatalf("Failed to create a directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	older, newer := addRenderNote(t, db), addRenderNote(t, db)
+	older.DateCreated = &timestamp.Timestamp{Seconds: 1425204000}
+	newer.DateCreated = &timestamp.Timestamp{Seconds: 1425204000}
+	newer.PatientGuid = older.PatientGuid
+	filter := NoteExportFilter{PatientGuids: []string{older.PatientGuid}}
+	path, statePath := filepath.Join(dir, "notes.ndjson"), filepath.Join(dir, "notes.state")
+
+	ex := &noteExporter{db: db, filter: filter, since: ExportSinceCreated, batchSize: 1}
+	if err := runExport(ex, ExportFormatNdjson, path, statePath, ioutil.Discard); err != nil {
+		t.Fatalf("Failed to export notes: %v", err)
+	}
+	if guids := readExportedNotes(t, path); len(guids) != 2 || guids[0] != older.NoteGuid || guids[1] != newer.NoteGuid {
+		t.Fatalf("Expected both of the patient's notes, in the order they were created, but got %v", guids)
+	}
+
+	latest := addRenderNote(t, db)
+	latest.PatientGuid = older.PatientGuid
+	latest.DateCreated = &timestamp.Timestamp{Seconds: 1425290400}
+	if err := runExport(ex, ExportFormatNdjson, path, statePath, ioutil.Discard); err != nil {
+		t.Fatalf("Failed to export notes: %v", err)
+	}
+	if guids := readExportedNotes(t, path); len(guids) != 1 || guids[0] != latest.NoteGuid {
+		t.Fatalf("Expected only the note created since the last export, but got %v", guids)
+	}
+
+	// An export by event offset has the notes changed since, but may not use the state of one by creation date
+	ex = &noteExporter{db: db, filter: filter, since: ExportSinceOffset, batchSize: 1}
+	if err := runExport(ex, ExportFormatNdjson, path, statePath, ioutil.Discard); err == nil {
+		t.Fatalf("Expected the state of an export by creation date to be refused")
+	}
+	statePath += ".offset"
+	if err := runExport(ex, ExportFormatNdjson, path, statePath, ioutil.Discard); err != nil {
+		t.Fatalf("Failed to export notes: %v", err)
+	}
+	if guids := readExportedNotes(t, path); len(guids) != 3 {
+		t.Fatalf("Expected every note of the patient to have been changed, but got %v", guids)
+	}
+	updated := proto.Clone(newer).(*ehrpb.Note)
+	updated.NoteGuid = uuid.New().String()
+	if err := db.UpdateNote(updated); err != nil {
+		t.Fatalf("Failed to update a note: %v", err)
+	}
+	if err := runExport(ex, ExportFormatNdjson, path, statePath, ioutil.Discard); err != nil {
+		t.Fatalf("Failed to export notes: %v", err)
+	}
+	if guids := readExportedNotes(t, path); len(guids) != 1 || guids[0] != updated.NoteGuid {
+		t.Fatalf("Expected only the updated note, but got %v", guids)
+	}
+	state := &exportState{}
+	if data, err := ioutil.ReadFile(statePath); err != nil || json.Unmarshal(data, state) != nil || state.Offset != 7 {
+		t.Fatalf("Expected the state to have the offset of the last event, but got %+v: %v", state, err)
+	}
+}
+
+func TestRunExport_WritesDeidentifiedParquet(t *testing.T) {
+	_, db := newMockDbServer(t)
+	dir, err := ioutil.TempDir("", "noteclerk-export")
+	if err != nil {
+		t.Fatalf("Failed to create a directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	note := addRenderNote(t, db)
+	note.Tags = []string{"Mr Smith"}
+	note.Fragments[0].Content = "Called back on 555-123-4567."
+	deidentifier, err := NewDeidentifier("a key which is at least 32 bytes long", 0, nil)
+	if err != nil {
+		t.Fatalf("Failed to create a deidentifier: %v", err)
+	}
+	ex := &noteExporter{db: db, filter: NoteExportFilter{PatientGuids: []string{note.PatientGuid}}, batchSize: 10,
+		deidentifier: deidentifier}
+	path := filepath.Join(dir, "notes.parquet")
+	if err := runExport(ex, ExportFormatParquet, path, "", ioutil.Discard); err != nil {
+		t.Fatalf("Failed to export notes: %v", err)
+	}
+
+	rows, err := parquet.ReadFile[parquetNote](path)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("Expected one row, but got %+v: %v", rows, err)
+	}
+	row := rows[0]
+	if row.PatientGuid != deidentifier.Pseudonym(note.PatientGuid) || row.NoteGuid == note.NoteGuid ||
+		row.Type != "HISTORY_AND_PHYSICAL" || len(row.Tags) != 1 || row.Tags[0] != "[NAME]" {
+		t.Fatalf("Expected the note with pseudonyms in place of its GUIDs and scrubbed tags, but got %+v", row)
+	}
+	if len(row.Fragments) != 1 || row.Fragments[0].Content != "Called back on [PHONE]." ||
+		row.Fragments[0].Topic != "SUBJECTIVE" ||
+		row.Fragments[0].NoteFragmentGuid != deidentifier.Pseudonym(note.Fragments[0].NoteFragmentGuid) {
+		t.Fatalf("Expected the fragment with its content scrubbed, but got %+v", row.Fragments)
+	}
+	if note.Tags[0] != "Mr Smith" || note.Fragments[0].Content != "Called back on 555-123-4567." {
+		t.Fatalf("Expected the note in the database to be left as it was")
+	}
+}
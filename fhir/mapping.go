@@ -0,0 +1,482 @@
+package fhir
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// noteTypeLoinc gives the LOINC document type for each note type, keyed by enum name. Other note types are coded as
+// a generic note.
+var noteTypeLoinc = map[string]Coding{
+	"HISTORY_AND_PHYSICAL":         {System: LoincSystem, Code: "34117-2", Display: "History and physical note"},
+	"CONTINUED_CARE_DOCUMENTATION": {System: LoincSystem, Code: "11506-3", Display: "Progress note"},
+}
+
+var genericNoteLoinc = Coding{System: LoincSystem, Code: "34109-9", Display: "Note"}
+
+// fragmentTypeLoinc gives the LOINC section code for each fragment type, keyed by enum name. Fragment types without
+// one are coded only in FragmentTypeSystem.
+var fragmentTypeLoinc = map[string]Coding{
+	"SUBJECTIVE":                 {System: LoincSystem, Code: "61150-9", Display: "Subjective"},
+	"OBJECTIVE":                  {System: LoincSystem, Code: "61149-1", Display: "Objective"},
+	"ASSESSMENT":                 {System: LoincSystem, Code: "51848-0", Display: "Evaluation note"},
+	"PLAN":                       {System: LoincSystem, Code: "18776-5", Display: "Plan of care note"},
+	"CHIEF_COMPLAINT":            {System: LoincSystem, Code: "10154-3", Display: "Chief complaint"},
+	"HISTORY_OF_PRESENT_ILLNESS": {System: LoincSystem, Code: "10164-2", Display: "History of present illness"},
+	"MEDICAL_HISTORY":            {System: LoincSystem, Code: "11348-0", Display: "History of past illness"},
+	"SURGICAL_HISTORY":           {System: LoincSystem, Code: "47519-4", Display: "History of procedures"},
+	"FAMILY_HISTORY":             {System: LoincSystem, Code: "10157-6", Display: "History of family member diseases"},
+	"SOCIAL_HISTORY":             {System: LoincSystem, Code: "29762-2", Display: "Social history"},
+	"ALLERGIES":                  {System: LoincSystem, Code: "48765-2", Display: "Allergies and adverse reactions"},
+	"MEDICATIONS":                {System: LoincSystem, Code: "10160-0", Display: "History of medication use"},
+	"REVIEW_OF_SYSTEMS":          {System: LoincSystem, Code: "10187-3", Display: "Review of systems"},
+	"PHYSICAL_EXAM":              {System: LoincSystem, Code: "29545-1", Display: "Physical findings"},
+}
+
+const xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+
+// NoteToComposition maps a note to a Composition. Fragments are grouped into one section per fragment type, in the
+// order the types first appear, and each fragment becomes a subsection identified by its GUID. Deleted fragments are
+// left out.
+func NoteToComposition(note *ehrpb.Note) *Composition {
+	c := &Composition{
+		ResourceType: CompositionType,
+		Id:           note.GetNoteGuid(),
+		Meta:         noteMeta(note),
+		Status:       compositionStatus(note.GetStatus()),
+		Type:         noteTypeConcept(note.GetType()),
+		Subject:      reference(PatientType, note.GetPatientGuid()),
+		Encounter:    reference(EncounterType, note.GetVisitGuid()),
+		Date:         FormatInstant(note.GetDateCreated()),
+		Author:       []Reference{},
+		Title:        enumDisplay(ehrpb.NoteType_name[int32(note.GetType())]),
+	}
+	if note.GetNoteGuid() != "" {
+		c.Identifier = &Identifier{System: UriSystem, Value: "urn:uuid:" + note.GetNoteGuid()}
+	}
+	if author := reference(PractitionerType, note.GetAuthorGuid()); author != nil {
+		c.Author = append(c.Author, *author)
+	}
+
+	sections := map[ehrpb.FragmentType]int{}
+	for _, frag := range note.GetFragments() {
+		if frag.GetStatus() == ehrpb.RecordStatus_DELETED {
+			continue
+		}
+		k, ok := sections[frag.GetTopic()]
+		if !ok {
+			k = len(c.Section)
+			sections[frag.GetTopic()] = k
+			code := fragmentTypeConcept(frag.GetTopic())
+			c.Section = append(c.Section, CompositionSection{
+				Title: enumDisplay(ehrpb.FragmentType_name[int32(frag.GetTopic())]),
+				Code:  &code,
+			})
+		}
+		c.Section[k].Section = append(c.Section[k].Section, fragmentSection(frag))
+	}
+	return c
+}
+
+// NoteToDocumentReference maps a note to a DocumentReference with two attachments: the note as plain text, for
+// readers, and the note as a Composition, from which DocumentReferenceToNote recovers it exactly.
+// RETURNS: *DocumentReference, error
+func NoteToDocumentReference(note *ehrpb.Note) (*DocumentReference, error) {
+	c := NoteToComposition(note)
+	composition, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	docStatus := c.Status
+	status := "current"
+	if docStatus == "entered-in-error" {
+		status = docStatus
+	}
+
+	d := &DocumentReference{
+		ResourceType:     DocumentReferenceType,
+		Id:               c.Id,
+		Meta:             c.Meta,
+		MasterIdentifier: c.Identifier,
+		Status:           status,
+		DocStatus:        docStatus,
+		Type:             &c.Type,
+		Subject:          c.Subject,
+		Date:             c.Date,
+		Author:           c.Author,
+		Description:      c.Title,
+		Content: []DocumentReferenceContent{
+			{Attachment: Attachment{ContentType: "text/plain; charset=utf-8", Data: []byte(PlainText(c)),
+				Title: c.Title, Creation: c.Date}},
+			{Attachment: Attachment{ContentType: ContentType, Data: composition, Title: c.Title, Creation: c.Date}},
+		},
+	}
+	if c.Encounter != nil {
+		d.Context = &DocumentReferenceContext{Encounter: []Reference{*c.Encounter}}
+	}
+	return d, nil
+}
+
+// PlainText renders a Composition as text: each section title is followed by its subsections, each a title and its
+// narrative.
+func PlainText(c *Composition) string {
+	var b strings.Builder
+	for _, section := range c.Section {
+		fmt.Fprintf(&b, "%v\n", strings.ToUpper(section.Title))
+		for _, sub := range section.Section {
+			if sub.Title != "" {
+				fmt.Fprintf(&b, "%v\n", sub.Title)
+			}
+			if sub.Text != nil {
+				fmt.Fprintf(&b, "%v\n", NarrativeText(sub.Text.Div))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// CompositionToNote maps a Composition to a note, the reverse of NoteToComposition. Note and fragment types are read
+// from their NoteClerk codings, or else from their LOINC codes. A section without subsections becomes a single
+// fragment. The note's id and creation date are left for the server to assign.
+// RETURNS: *ehrpb.Note, error
+func CompositionToNote(c *Composition) (*ehrpb.Note, error) {
+	if c.ResourceType != CompositionType {
+		return nil, fmt.Errorf("resourceType must be %v, but was %q", CompositionType, c.ResourceType)
+	}
+
+	note := &ehrpb.Note{
+		NoteGuid: c.Id,
+		Type:     ehrpb.NoteType(enumFromConcept(&c.Type, NoteTypeSystem, ehrpb.NoteType_value, noteTypeLoinc)),
+		Status:   recordStatus(c.Status),
+		Tags:     metaTags(c.Meta),
+	}
+
+	var err error
+	if note.PatientGuid, err = referenceId(c.Subject, PatientType, "subject"); err != nil {
+		return nil, err
+	}
+	if note.VisitGuid, err = referenceId(c.Encounter, EncounterType, "encounter"); err != nil {
+		return nil, err
+	}
+	if len(c.Author) != 1 {
+		return nil, fmt.Errorf("author must name exactly one %v, but names %v", PractitionerType, len(c.Author))
+	}
+	if note.AuthorGuid, err = referenceId(&c.Author[0], PractitionerType, "author"); err != nil {
+		return nil, err
+	}
+
+	for _, section := range c.Section {
+		topic := ehrpb.FragmentType(enumFromConcept(section.Code, FragmentTypeSystem, ehrpb.FragmentType_value,
+			fragmentTypeLoinc))
+		subsections := section.Section
+		if len(subsections) == 0 {
+			subsections = []CompositionSection{section}
+		}
+		for _, sub := range subsections {
+			frag := sectionFragment(sub)
+			frag.Topic = topic
+			frag.Status = note.Status
+			note.Fragments = append(note.Fragments, frag)
+		}
+	}
+	return note, nil
+}
+
+// DocumentReferenceToNote maps a DocumentReference to a note. The note is read from a Composition attachment when
+// there is one; otherwise its plain text attachment becomes a single fragment. Either way the patient, author,
+// encounter, type and status are taken from the DocumentReference itself.
+// RETURNS: *ehrpb.Note, error
+func DocumentReferenceToNote(d *DocumentReference) (*ehrpb.Note, error) {
+	if d.ResourceType != DocumentReferenceType {
+		return nil, fmt.Errorf("resourceType must be %v, but was %q", DocumentReferenceType, d.ResourceType)
+	}
+
+	c := &Composition{ResourceType: CompositionType}
+	var text *Attachment
+	for k, content := range d.Content {
+		mediaType := strings.TrimSpace(strings.SplitN(content.Attachment.ContentType, ";", 2)[0])
+		switch mediaType {
+		case ContentType:
+			if err := json.Unmarshal(content.Attachment.Data, c); err != nil {
+				return nil, fmt.Errorf("content[%v] is not a valid Composition: %v", k, err)
+			}
+		case "text/plain":
+			if text == nil {
+				text = &d.Content[k].Attachment
+			}
+		}
+	}
+	if c.ResourceType != CompositionType {
+		return nil, fmt.Errorf("content[] holds a %q, not a %v", c.ResourceType, CompositionType)
+	}
+	if len(c.Section) == 0 {
+		if text == nil {
+			return nil, fmt.Errorf("content must include a %v Composition or a text/plain attachment", ContentType)
+		}
+		c.Section = []CompositionSection{{Text: NewNarrative(string(text.Data))}}
+	}
+
+	c.Id = d.Id
+	c.Meta = d.Meta
+	c.Subject = d.Subject
+	c.Author = d.Author
+	c.Encounter = nil
+	if d.Context != nil && len(d.Context.Encounter) > 0 {
+		c.Encounter = &d.Context.Encounter[0]
+	}
+	if d.Type != nil {
+		c.Type = *d.Type
+	}
+	c.Status = d.DocStatus
+	if d.Status == "entered-in-error" {
+		c.Status = d.Status
+	}
+	return CompositionToNote(c)
+}
+
+// NewNarrative wraps plain text as an XHTML narrative, keeping its line breaks.
+func NewNarrative(text string) *Narrative {
+	escaped := strings.Replace(html.EscapeString(text), "\n", "<br/>", -1)
+	return &Narrative{Status: "generated", Div: `<div xmlns="` + xhtmlNamespace + `">` + escaped + `</div>`}
+}
+
+// NarrativeText returns the text of an XHTML narrative, with br elements, and the ends of paragraphs, as line breaks.
+// Markup which cannot be parsed is returned as it is.
+func NarrativeText(div string) string {
+	var b strings.Builder
+	decoder := xml.NewDecoder(strings.NewReader(div))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return div
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.StartElement:
+			if t.Name.Local == "br" {
+				b.WriteString("\n")
+			}
+		case xml.EndElement:
+			if t.Name.Local == "p" && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString("\n")
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// FormatInstant formats a protobuf timestamp as a FHIR instant, or returns an empty string if it is not set.
+func FormatInstant(ts *timestamp.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC().Format(time.RFC3339Nano)
+}
+
+func noteMeta(note *ehrpb.Note) *Meta {
+	if len(note.GetTags()) == 0 {
+		return nil
+	}
+	meta := &Meta{}
+	for _, tag := range note.GetTags() {
+		meta.Tag = append(meta.Tag, Coding{System: TagSystem, Code: tag})
+	}
+	return meta
+}
+
+func metaTags(meta *Meta) []string {
+	if meta == nil {
+		return nil
+	}
+	var tags []string
+	for _, tag := range meta.Tag {
+		if tag.System == TagSystem || tag.System == "" {
+			tags = append(tags, tag.Code)
+		}
+	}
+	return tags
+}
+
+func fragmentSection(frag *ehrpb.NoteFragment) CompositionSection {
+	section := CompositionSection{
+		Id:    frag.GetNoteFragmentGuid(),
+		Title: frag.GetDescription(),
+		Text:  NewNarrative(frag.GetContent()),
+	}
+	if frag.GetIcd_10Code() != "" {
+		section.Code = &CodeableConcept{Coding: []Coding{
+			{System: Icd10CmSystem, Code: frag.GetIcd_10Code(), Display: frag.GetIcd_10Long()},
+		}}
+	}
+	if frag.GetPriority() != 0 {
+		section.Extension = append(section.Extension, Extension{Url: PriorityExtension,
+			ValueCode: ehrpb.RecordPriority_name[int32(frag.GetPriority())]})
+	}
+	if frag.GetIssueGuid() != "" {
+		section.Extension = append(section.Extension, Extension{Url: IssueExtension, ValueString: frag.GetIssueGuid()})
+	}
+	for _, tag := range frag.GetTags() {
+		section.Extension = append(section.Extension, Extension{Url: TagExtension, ValueString: tag})
+	}
+	return section
+}
+
+func sectionFragment(section CompositionSection) *ehrpb.NoteFragment {
+	frag := &ehrpb.NoteFragment{
+		NoteFragmentGuid: section.Id,
+		Description:      section.Title,
+	}
+	if section.Text != nil {
+		frag.Content = NarrativeText(section.Text.Div)
+	}
+	if section.Code != nil {
+		for _, coding := range section.Code.Coding {
+			if coding.System == Icd10CmSystem {
+				frag.Icd_10Code = coding.Code
+				frag.Icd_10Long = coding.Display
+				break
+			}
+		}
+	}
+	for _, ext := range section.Extension {
+		switch ext.Url {
+		case PriorityExtension:
+			frag.Priority = ehrpb.RecordPriority(ehrpb.RecordPriority_value[ext.ValueCode])
+		case IssueExtension:
+			frag.IssueGuid = ext.ValueString
+		case TagExtension:
+			frag.Tags = append(frag.Tags, ext.ValueString)
+		}
+	}
+	return frag
+}
+
+func noteTypeConcept(t ehrpb.NoteType) CodeableConcept {
+	name := ehrpb.NoteType_name[int32(t)]
+	loinc, ok := noteTypeLoinc[name]
+	if !ok {
+		loinc = genericNoteLoinc
+	}
+	return CodeableConcept{
+		Coding: []Coding{loinc, {System: NoteTypeSystem, Code: name, Display: enumDisplay(name)}},
+		Text:   enumDisplay(name),
+	}
+}
+
+func fragmentTypeConcept(t ehrpb.FragmentType) CodeableConcept {
+	name := ehrpb.FragmentType_name[int32(t)]
+	concept := CodeableConcept{Text: enumDisplay(name)}
+	if loinc, ok := fragmentTypeLoinc[name]; ok {
+		concept.Coding = append(concept.Coding, loinc)
+	}
+	concept.Coding = append(concept.Coding, Coding{System: FragmentTypeSystem, Code: name, Display: enumDisplay(name)})
+	return concept
+}
+
+// enumFromConcept finds the enum value coded in concept, first by its name in system, then by its LOINC code. A
+// concept coding neither is the zero value.
+func enumFromConcept(concept *CodeableConcept, system string, values map[string]int32, loinc map[string]Coding) int32 {
+	if concept == nil {
+		return 0
+	}
+	for _, coding := range concept.Coding {
+		if coding.System == system {
+			if v, ok := values[coding.Code]; ok {
+				return v
+			}
+		}
+	}
+	for _, coding := range concept.Coding {
+		if coding.System != LoincSystem {
+			continue
+		}
+		for name, c := range loinc {
+			if c.Code == coding.Code {
+				if v, ok := values[name]; ok {
+					return v
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// NoteTypeForLoinc returns the note type of a LOINC document type code, or the zero value when none matches.
+func NoteTypeForLoinc(code string) ehrpb.NoteType {
+	concept := &CodeableConcept{Coding: []Coding{{System: LoincSystem, Code: code}}}
+	return ehrpb.NoteType(enumFromConcept(concept, NoteTypeSystem, ehrpb.NoteType_value, noteTypeLoinc))
+}
+
+// FragmentTypeForLoinc returns the fragment type of a LOINC section code, or the zero value when none matches.
+func FragmentTypeForLoinc(code string) ehrpb.FragmentType {
+	concept := &CodeableConcept{Coding: []Coding{{System: LoincSystem, Code: code}}}
+	return ehrpb.FragmentType(enumFromConcept(concept, FragmentTypeSystem, ehrpb.FragmentType_value, fragmentTypeLoinc))
+}
+
+func compositionStatus(s ehrpb.RecordStatus) string {
+	switch s {
+	case ehrpb.RecordStatus_ACTIVE:
+		return "final"
+	case ehrpb.RecordStatus_DELETED:
+		return "entered-in-error"
+	default:
+		return "preliminary"
+	}
+}
+
+func recordStatus(s string) ehrpb.RecordStatus {
+	switch s {
+	case "final", "amended":
+		return ehrpb.RecordStatus_ACTIVE
+	case "entered-in-error":
+		return ehrpb.RecordStatus_DELETED
+	default:
+		return 0
+	}
+}
+
+func reference(resourceType string, id string) *Reference {
+	if id == "" {
+		return nil
+	}
+	return &Reference{Reference: resourceType + "/" + id}
+}
+
+// referenceId returns the id from a relative or absolute reference to a resource of the given type, or an empty
+// string if there is no reference.
+// RETURNS: string, error
+func referenceId(ref *Reference, resourceType string, field string) (string, error) {
+	if ref == nil || ref.Reference == "" {
+		return "", nil
+	}
+	parts := strings.Split(strings.TrimSuffix(ref.Reference, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] != resourceType {
+		return "", fmt.Errorf("%v must reference a %v, but was %q", field, resourceType, ref.Reference)
+	}
+	return parts[len(parts)-1], nil
+}
+
+// enumDisplay turns an enum name such as HISTORY_AND_PHYSICAL into 'History and physical'.
+func enumDisplay(name string) string {
+	if name == "" {
+		return ""
+	}
+	words := strings.ToLower(strings.Replace(name, "_", " ", -1))
+	return strings.ToUpper(words[:1]) + words[1:]
+}
@@ -0,0 +1,219 @@
+package fhir
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+func testNote() *ehrpb.Note {
+	return &ehrpb.Note{
+		Id:          7,
+		DateCreated: &timestamp.Timestamp{Seconds: 1552555800},
+		NoteGuid:    "4a3f1a6c-4f5e-4a6e-9b8a-2f3c1d0e9b7a",
+		VisitGuid:   "0f1e2d3c-4b5a-4978-8695-a4b3c2d1e0f9",
+		AuthorGuid:  "9e8d7c6b-5a49-4382-9170-6f5e4d3c2b1a",
+		PatientGuid: "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c6d",
+		Type:        ehrpb.NoteType_HISTORY_AND_PHYSICAL,
+		Status:      ehrpb.RecordStatus_ACTIVE,
+		Tags:        []string{"cardiology"},
+		Fragments: []*ehrpb.NoteFragment{
+			{
+				NoteFragmentGuid: "5b6c7d8e-9f0a-4b1c-8d2e-3f4a5b6c7d8e",
+				Description:      "Chest pain",
+				Content:          "Pain began <2 hours ago.\nWorse on exertion.",
+				Topic:            ehrpb.FragmentType_SUBJECTIVE,
+				Status:           ehrpb.RecordStatus_ACTIVE,
+				Priority:         ehrpb.RecordPriority_HIGH,
+				IssueGuid:        "6c7d8e9f-0a1b-4c2d-9e3f-4a5b6c7d8e9f",
+				Tags:             []string{"acute"},
+			},
+			{
+				NoteFragmentGuid: "7d8e9f0a-1b2c-4d3e-8f4a-5b6c7d8e9f0a",
+				Description:      "Hypertension",
+				Content:          "Diagnosed in 2010.",
+				Topic:            ehrpb.FragmentType_MEDICAL_HISTORY,
+				Status:           ehrpb.RecordStatus_ACTIVE,
+				Icd_10Code:       "I10",
+				Icd_10Long:       "Essential (primary) hypertension",
+			},
+			{
+				NoteFragmentGuid: "8e9f0a1b-2c3d-4e4f-9a5b-6c7d8e9f0a1b",
+				Description:      "Retracted",
+				Topic:            ehrpb.FragmentType_SUBJECTIVE,
+				Status:           ehrpb.RecordStatus_DELETED,
+			},
+		},
+	}
+}
+
+func TestNoteToComposition(t *testing.T) {
+	c := NoteToComposition(testNote())
+
+	if c.Id != testNote().NoteGuid || c.Status != "final" || c.Date != "2019-03-14T09:30:00Z" {
+		t.Fatalf("NoteToComposition() header = %v, %v, %v", c.Id, c.Status, c.Date)
+	}
+	if c.Type.Coding[0].Code != "34117-2" || c.Type.Coding[1].Code != "HISTORY_AND_PHYSICAL" {
+		t.Fatalf("NoteToComposition() type = %+v, want LOINC 34117-2 and HISTORY_AND_PHYSICAL", c.Type)
+	}
+	if c.Subject.Reference != "Patient/"+testNote().PatientGuid ||
+		c.Encounter.Reference != "Encounter/"+testNote().VisitGuid ||
+		c.Author[0].Reference != "Practitioner/"+testNote().AuthorGuid {
+		t.Fatalf("NoteToComposition() references = %v, %v, %v", c.Subject, c.Encounter, c.Author)
+	}
+
+	if len(c.Section) != 2 {
+		t.Fatalf("NoteToComposition() has %v sections, want one for each fragment type", len(c.Section))
+	}
+	subjective := c.Section[0]
+	if subjective.Code.Coding[0].Code != "61150-9" || len(subjective.Section) != 1 {
+		t.Fatalf("NoteToComposition() subjective section = %+v, want one fragment without the deleted one", subjective)
+	}
+	want := `<div xmlns="http://www.w3.org/1999/xhtml">Pain began &lt;2 hours ago.<br/>Worse on exertion.</div>`
+	if got := subjective.Section[0].Text.Div; got != want {
+		t.Fatalf("NoteToComposition() narrative = %v, want %v", got, want)
+	}
+	history := c.Section[1].Section[0]
+	if history.Code.Coding[0].System != Icd10CmSystem || history.Code.Coding[0].Code != "I10" {
+		t.Fatalf("NoteToComposition() history section code = %+v, want ICD-10-CM I10", history.Code)
+	}
+}
+
+func TestCompositionToNote_RoundTrip(t *testing.T) {
+	b, err := json.Marshal(NoteToComposition(testNote()))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var c Composition
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	got, err := CompositionToNote(&c)
+	if err != nil {
+		t.Fatalf("CompositionToNote() error = %v", err)
+	}
+	want := testNote()
+	want.Id = 0
+	want.DateCreated = nil
+	want.Fragments = want.Fragments[:2]
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("CompositionToNote() = %v, want %v", got, want)
+	}
+}
+
+func TestCompositionToNote_LoincAndPlainSections(t *testing.T) {
+	c := &Composition{
+		ResourceType: CompositionType,
+		Status:       "preliminary",
+		Type:         CodeableConcept{Coding: []Coding{{System: LoincSystem, Code: "11506-3"}}},
+		Subject:      &Reference{Reference: "https://example.org/fhir/Patient/" + testNote().PatientGuid},
+		Author:       []Reference{{Reference: "Practitioner/" + testNote().AuthorGuid}},
+		Section: []CompositionSection{{
+			Code: &CodeableConcept{Coding: []Coding{{System: LoincSystem, Code: "11348-0"}}},
+			Text: &Narrative{Div: `<div xmlns="http://www.w3.org/1999/xhtml"><p>Asthma.</p><p>Eczema.</p></div>`},
+		}},
+	}
+
+	note, err := CompositionToNote(c)
+	if err != nil {
+		t.Fatalf("CompositionToNote() error = %v", err)
+	}
+	if note.Type != ehrpb.NoteType_CONTINUED_CARE_DOCUMENTATION || note.Status != 0 ||
+		note.PatientGuid != testNote().PatientGuid {
+		t.Fatalf("CompositionToNote() = %v", note)
+	}
+	if len(note.Fragments) != 1 || note.Fragments[0].Topic != ehrpb.FragmentType_MEDICAL_HISTORY ||
+		note.Fragments[0].Content != "Asthma.\nEczema." {
+		t.Fatalf("CompositionToNote() fragments = %v", note.Fragments)
+	}
+}
+
+func TestCompositionToNote_RejectsInvalidResources(t *testing.T) {
+	valid := func() *Composition {
+		return &Composition{
+			ResourceType: CompositionType,
+			Subject:      &Reference{Reference: "Patient/" + testNote().PatientGuid},
+			Author:       []Reference{{Reference: "Practitioner/" + testNote().AuthorGuid}},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(c *Composition)
+	}{
+		{"resource type", func(c *Composition) { c.ResourceType = DocumentReferenceType }},
+		{"subject type", func(c *Composition) { c.Subject.Reference = "Group/1" }},
+		{"no author", func(c *Composition) { c.Author = nil }},
+		{"two authors", func(c *Composition) { c.Author = append(c.Author, c.Author[0]) }},
+		{"encounter type", func(c *Composition) { c.Encounter = &Reference{Reference: "Patient/1"} }},
+	}
+	for _, tt := range tests {
+		c := valid()
+		tt.change(c)
+		if _, err := CompositionToNote(c); err == nil {
+			t.Fatalf("CompositionToNote() with an invalid %v returned no error", tt.name)
+		}
+	}
+}
+
+func TestNoteToDocumentReference_RoundTrip(t *testing.T) {
+	d, err := NoteToDocumentReference(testNote())
+	if err != nil {
+		t.Fatalf("NoteToDocumentReference() error = %v", err)
+	}
+	if d.Status != "current" || d.DocStatus != "final" || d.Context.Encounter[0].Reference == "" {
+		t.Fatalf("NoteToDocumentReference() = %+v", d)
+	}
+	text := string(d.Content[0].Attachment.Data)
+	if !strings.Contains(text, "SUBJECTIVE\nChest pain\nPain began <2 hours ago.") {
+		t.Fatalf("NoteToDocumentReference() text = %q", text)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded DocumentReference
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	got, err := DocumentReferenceToNote(&decoded)
+	if err != nil {
+		t.Fatalf("DocumentReferenceToNote() error = %v", err)
+	}
+	want := testNote()
+	want.Id = 0
+	want.DateCreated = nil
+	want.Fragments = want.Fragments[:2]
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DocumentReferenceToNote() = %v, want %v", got, want)
+	}
+}
+
+func TestDocumentReferenceToNote_PlainText(t *testing.T) {
+	d := &DocumentReference{
+		ResourceType: DocumentReferenceType,
+		Status:       "current",
+		DocStatus:    "final",
+		Subject:      &Reference{Reference: "Patient/" + testNote().PatientGuid},
+		Author:       []Reference{{Reference: "Practitioner/" + testNote().AuthorGuid}},
+		Content:      []DocumentReferenceContent{{Attachment: Attachment{ContentType: "text/plain", Data: []byte("a < b")}}},
+	}
+
+	note, err := DocumentReferenceToNote(d)
+	if err != nil {
+		t.Fatalf("DocumentReferenceToNote() error = %v", err)
+	}
+	if note.Status != ehrpb.RecordStatus_ACTIVE || len(note.Fragments) != 1 || note.Fragments[0].Content != "a < b" {
+		t.Fatalf("DocumentReferenceToNote() = %v", note)
+	}
+
+	d.Content = nil
+	if _, err := DocumentReferenceToNote(d); err == nil {
+		t.Fatalf("DocumentReferenceToNote() without content returned no error")
+	}
+}
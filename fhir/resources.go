@@ -0,0 +1,249 @@
+// Package fhir maps NoteClerk notes to and from FHIR R4 resources: Composition, with a section for each fragment type,
+// and DocumentReference, which carries the note as a plain text attachment. It defines only the parts of each
+// resource that the mapping uses, and has no dependency on how notes are stored or served.
+package fhir
+
+import (
+	"encoding/json"
+)
+
+// Code systems and extension URLs used by the mapping. Codings in the NoteClerk systems carry the ehrproto enum names,
+// so that notes round trip exactly; the LOINC codings beside them are for other FHIR clients.
+const (
+	LoincSystem        = "http://loinc.org"
+	Icd10CmSystem      = "http://hl7.org/fhir/sid/icd-10-cm"
+	UriSystem          = "urn:ietf:rfc:3986"
+	NoteTypeSystem     = "https://geekmd.io/fhir/CodeSystem/note-type"
+	FragmentTypeSystem = "https://geekmd.io/fhir/CodeSystem/fragment-type"
+	TagSystem          = "https://geekmd.io/fhir/CodeSystem/tag"
+
+	PriorityExtension = "https://geekmd.io/fhir/StructureDefinition/fragment-priority"
+	IssueExtension    = "https://geekmd.io/fhir/StructureDefinition/fragment-issue"
+	TagExtension      = "https://geekmd.io/fhir/StructureDefinition/fragment-tag"
+)
+
+// ContentType is the media type of FHIR resources in JSON.
+const ContentType = "application/fhir+json"
+
+// Resource types served by the facade.
+const (
+	CompositionType       = "Composition"
+	DocumentReferenceType = "DocumentReference"
+	PatientType           = "Patient"
+	EncounterType         = "Encounter"
+	PractitionerType      = "Practitioner"
+)
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type Meta struct {
+	LastUpdated string   `json:"lastUpdated,omitempty"`
+	Tag         []Coding `json:"tag,omitempty"`
+}
+
+// Narrative is human readable XHTML. Div must be a single div element in the XHTML namespace.
+type Narrative struct {
+	Status string `json:"status"`
+	Div    string `json:"div"`
+}
+
+type Extension struct {
+	Url         string `json:"url"`
+	ValueCode   string `json:"valueCode,omitempty"`
+	ValueString string `json:"valueString,omitempty"`
+}
+
+type Composition struct {
+	ResourceType string               `json:"resourceType"`
+	Id           string               `json:"id,omitempty"`
+	Meta         *Meta                `json:"meta,omitempty"`
+	Identifier   *Identifier          `json:"identifier,omitempty"`
+	Status       string               `json:"status"`
+	Type         CodeableConcept      `json:"type"`
+	Subject      *Reference           `json:"subject,omitempty"`
+	Encounter    *Reference           `json:"encounter,omitempty"`
+	Date         string               `json:"date"`
+	Author       []Reference          `json:"author"`
+	Title        string               `json:"title"`
+	Section      []CompositionSection `json:"section,omitempty"`
+}
+
+type CompositionSection struct {
+	Id        string               `json:"id,omitempty"`
+	Extension []Extension          `json:"extension,omitempty"`
+	Title     string               `json:"title,omitempty"`
+	Code      *CodeableConcept     `json:"code,omitempty"`
+	Text      *Narrative           `json:"text,omitempty"`
+	Section   []CompositionSection `json:"section,omitempty"`
+}
+
+type DocumentReference struct {
+	ResourceType     string                     `json:"resourceType"`
+	Id               string                     `json:"id,omitempty"`
+	Meta             *Meta                      `json:"meta,omitempty"`
+	MasterIdentifier *Identifier                `json:"masterIdentifier,omitempty"`
+	Status           string                     `json:"status"`
+	DocStatus        string                     `json:"docStatus,omitempty"`
+	Type             *CodeableConcept           `json:"type,omitempty"`
+	Subject          *Reference                 `json:"subject,omitempty"`
+	Date             string                     `json:"date,omitempty"`
+	Author           []Reference                `json:"author,omitempty"`
+	Description      string                     `json:"description,omitempty"`
+	Content          []DocumentReferenceContent `json:"content"`
+	Context          *DocumentReferenceContext  `json:"context,omitempty"`
+}
+
+type DocumentReferenceContent struct {
+	Attachment Attachment `json:"attachment"`
+}
+
+// Attachment data is base64 encoded in JSON, which encoding/json does for []byte.
+type Attachment struct {
+	ContentType string `json:"contentType,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Creation    string `json:"creation,omitempty"`
+}
+
+type DocumentReferenceContext struct {
+	Encounter []Reference `json:"encounter,omitempty"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        int           `json:"total"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	Url      string `json:"url"`
+}
+
+type BundleEntry struct {
+	FullUrl  string          `json:"fullUrl,omitempty"`
+	Resource json.RawMessage `json:"resource"`
+	Search   *BundleSearch   `json:"search,omitempty"`
+}
+
+type BundleSearch struct {
+	Mode string `json:"mode"`
+}
+
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+type OperationOutcomeIssue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+}
+
+// NewOperationOutcome reports a single error, with an issue type code such as 'not-found' or 'invalid'.
+func NewOperationOutcome(code string, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []OperationOutcomeIssue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	}
+}
+
+// NewSearchSet bundles the resources matching a search, each given as its JSON and the URL it can be read from.
+// RETURNS: *Bundle, error
+func NewSearchSet(self string, fullUrls []string, resources []interface{}) (*Bundle, error) {
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset", Total: len(resources)}
+	if self != "" {
+		bundle.Link = []BundleLink{{Relation: "self", Url: self}}
+	}
+	for k, v := range resources {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Entry = append(bundle.Entry, BundleEntry{FullUrl: fullUrls[k], Resource: b,
+			Search: &BundleSearch{Mode: "match"}})
+	}
+	return bundle, nil
+}
+
+type CapabilityStatement struct {
+	ResourceType string                    `json:"resourceType"`
+	Status       string                    `json:"status"`
+	Date         string                    `json:"date"`
+	Kind         string                    `json:"kind"`
+	FhirVersion  string                    `json:"fhirVersion"`
+	Format       []string                  `json:"format"`
+	Rest         []CapabilityStatementRest `json:"rest"`
+}
+
+type CapabilityStatementRest struct {
+	Mode     string                        `json:"mode"`
+	Resource []CapabilityStatementResource `json:"resource"`
+}
+
+type CapabilityStatementResource struct {
+	Type        string                           `json:"type"`
+	Interaction []CapabilityStatementInteraction `json:"interaction"`
+	SearchParam []CapabilityStatementSearchParam `json:"searchParam"`
+}
+
+type CapabilityStatementInteraction struct {
+	Code string `json:"code"`
+}
+
+type CapabilityStatementSearchParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// NewCapabilityStatement describes the facade: read, search and create of Composition and DocumentReference, searched
+// by patient, encounter, author and date.
+func NewCapabilityStatement(date string) *CapabilityStatement {
+	var resources []CapabilityStatementResource
+	for _, t := range []string{CompositionType, DocumentReferenceType} {
+		resources = append(resources, CapabilityStatementResource{
+			Type: t,
+			Interaction: []CapabilityStatementInteraction{
+				{Code: "read"}, {Code: "search-type"}, {Code: "create"},
+			},
+			SearchParam: []CapabilityStatementSearchParam{
+				{Name: "patient", Type: "reference"},
+				{Name: "encounter", Type: "reference"},
+				{Name: "author", Type: "reference"},
+				{Name: "date", Type: "date"},
+			},
+		})
+	}
+	return &CapabilityStatement{
+		ResourceType: "CapabilityStatement",
+		Status:       "active",
+		Date:         date,
+		Kind:         "instance",
+		FhirVersion:  "4.0.1",
+		Format:       []string{"json"},
+		Rest:         []CapabilityStatementRest{{Mode: "server", Resource: resources}},
+	}
+}
@@ -0,0 +1,73 @@
+package fhir
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateParam is a parsed date search parameter, such as 'ge2019-03' or '2019-03-14T09:30:00Z'. The value covers the
+// whole of its precision, so '2019-03' is every instant from the start of March 2019 up to the start of April.
+type DateParam struct {
+	Prefix string
+	Start  time.Time
+	End    time.Time
+}
+
+// dateLayouts are the FHIR date and dateTime formats, from least to most precise, and the length of the range each
+// one covers. Dates and times without a time zone are taken to be UTC.
+var dateLayouts = []struct {
+	layout string
+	next   func(time.Time) time.Time
+}{
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01-02T15:04Z07:00", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02T15:04:05Z07:00", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{"2006-01-02T15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{time.RFC3339Nano, func(t time.Time) time.Time { return t.Add(time.Nanosecond) }},
+}
+
+// ParseDateParam parses a date search value with an optional eq, ne, lt, gt, le or ge prefix. Without a prefix the
+// value must match exactly, as with eq.
+// RETURNS: DateParam, error
+func ParseDateParam(value string) (DateParam, error) {
+	p := DateParam{Prefix: "eq"}
+	if len(value) > 2 {
+		switch prefix := value[:2]; prefix {
+		case "eq", "ne", "lt", "gt", "le", "ge":
+			p.Prefix, value = prefix, value[2:]
+		case "sa", "eb", "ap":
+			return p, fmt.Errorf("the %q date prefix is not supported", prefix)
+		}
+	}
+
+	for _, l := range dateLayouts {
+		t, err := time.Parse(l.layout, value)
+		if err != nil {
+			continue
+		}
+		p.Start, p.End = t.UTC(), l.next(t).UTC()
+		return p, nil
+	}
+	return p, fmt.Errorf("%q is not a FHIR date or dateTime", value)
+}
+
+// Matches reports whether t falls in the range the parameter searches for.
+func (p DateParam) Matches(t time.Time) bool {
+	inRange := !t.Before(p.Start) && t.Before(p.End)
+	switch p.Prefix {
+	case "ne":
+		return !inRange
+	case "lt":
+		return t.Before(p.Start)
+	case "le":
+		return t.Before(p.End)
+	case "gt":
+		return !t.Before(p.End)
+	case "ge":
+		return !t.Before(p.Start)
+	default:
+		return inRange
+	}
+}
@@ -0,0 +1,54 @@
+package fhir
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateParam(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatalf("time.Parse(%v) error = %v", s, err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		param string
+		at    string
+		want  bool
+	}{
+		{"2019", "2019-12-31T23:59:59Z", true},
+		{"2019", "2020-01-01T00:00:00Z", false},
+		{"eq2019-03", "2019-03-14T09:30:00Z", true},
+		{"ne2019-03", "2019-03-14T09:30:00Z", false},
+		{"lt2019-03-14", "2019-03-13T23:59:59Z", true},
+		{"lt2019-03-14", "2019-03-14T00:00:00Z", false},
+		{"le2019-03-14", "2019-03-14T23:59:59Z", true},
+		{"gt2019-03-14", "2019-03-14T23:59:59Z", false},
+		{"gt2019-03-14", "2019-03-15T00:00:00Z", true},
+		{"ge2019-03-14", "2019-03-14T00:00:00Z", true},
+		{"2019-03-14T09:30:00Z", "2019-03-14T09:30:00.5Z", true},
+		{"2019-03-14T10:30:00+01:00", "2019-03-14T09:30:00Z", true},
+		{"2019-03-14T09:30Z", "2019-03-14T09:30:59Z", true},
+		{"2019-03-14T09:30:00.25Z", "2019-03-14T09:30:00.25Z", true},
+	}
+	for _, tt := range tests {
+		p, err := ParseDateParam(tt.param)
+		if err != nil {
+			t.Fatalf("ParseDateParam(%v) error = %v", tt.param, err)
+		}
+		if got := p.Matches(at(tt.at)); got != tt.want {
+			t.Fatalf("ParseDateParam(%v).Matches(%v) = %v, want %v", tt.param, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseDateParam_RejectsInvalidValues(t *testing.T) {
+	for _, v := range []string{"", "yesterday", "sa2019", "2019-13", "ge"} {
+		if _, err := ParseDateParam(v); err == nil {
+			t.Fatalf("ParseDateParam(%q) returned no error", v)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/fhir"
+	"github.com/geekmdio/noted"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// FhirBasePath is the base of the FHIR R4 REST facade served on FhirHttpPort.
+const FhirBasePath = "/fhir"
+
+// MaxFhirRequestBytes bounds the size of a resource posted to the facade.
+const MaxFhirRequestBytes = 4 << 20
+
+// fhirResourceType maps notes to and from one of the resource types served by the facade.
+type fhirResourceType struct {
+	fromNote func(note *ehrpb.Note) (interface{}, error)
+	toNote   func(body []byte) (*ehrpb.Note, error)
+}
+
+var fhirResourceTypes = map[string]fhirResourceType{
+	fhir.CompositionType: {
+		fromNote: func(note *ehrpb.Note) (interface{}, error) {
+			return fhir.NoteToComposition(note), nil
+		},
+		toNote: func(body []byte) (*ehrpb.Note, error) {
+			var c fhir.Composition
+			if err := json.Unmarshal(body, &c); err != nil {
+				return nil, err
+			}
+			return fhir.CompositionToNote(&c)
+		},
+	},
+	fhir.DocumentReferenceType: {
+		fromNote: func(note *ehrpb.Note) (interface{}, error) {
+			return fhir.NoteToDocumentReference(note)
+		},
+		toNote: func(body []byte) (*ehrpb.Note, error) {
+			var d fhir.DocumentReference
+			if err := json.Unmarshal(body, &d); err != nil {
+				return nil, err
+			}
+			return fhir.DocumentReferenceToNote(&d)
+		},
+	},
+}
+
+// registerFhirHttp adds the FHIR facade to mux. Each note can be read, searched for and created as either a
+// Composition or a DocumentReference. Each interaction calls the NoteService RPC behind it through invokeUnary:
+//
+//	GET  /fhir/metadata
+//	GET  /fhir/{Composition|DocumentReference}/{note guid}
+//	GET  /fhir/{Composition|DocumentReference}?patient=&encounter=&author=&date=
+//	POST /fhir/{Composition|DocumentReference}
+func (n *Server) registerFhirHttp(mux *http.ServeMux) {
+	capabilities := fhir.NewCapabilityStatement(time.Now().UTC().Format(time.RFC3339))
+
+	mux.HandleFunc(FhirBasePath+"/", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, FhirBasePath), "/"), "/")
+
+		if len(parts) == 1 && parts[0] == "metadata" {
+			if r.Method != http.MethodGet {
+				writeFhirMethodNotAllowed(ctx, w, http.MethodGet)
+				return
+			}
+			writeFhirResource(ctx, w, http.StatusOK, capabilities)
+			return
+		}
+
+		resourceType, ok := fhirResourceTypes[parts[0]]
+		if !ok || len(parts) > 2 {
+			writeFhirOutcome(ctx, w, http.StatusNotFound, "not-supported",
+				fmt.Sprintf("%v is not served; the resource types served are %v and %v.", r.URL.Path,
+					fhir.CompositionType, fhir.DocumentReferenceType))
+			return
+		}
+
+		switch {
+		case len(parts) == 2 && r.Method == http.MethodGet:
+			n.readFhir(w, r, parts[0], parts[1], resourceType)
+		case len(parts) == 2:
+			writeFhirMethodNotAllowed(ctx, w, http.MethodGet)
+		case r.Method == http.MethodGet:
+			n.searchFhir(w, r, parts[0], resourceType)
+		case r.Method == http.MethodPost:
+			n.createFhir(w, r, parts[0], resourceType)
+		default:
+			writeFhirMethodNotAllowed(ctx, w, http.MethodGet, http.MethodPost)
+		}
+	})
+}
+
+// readFhir responds with the note whose GUID is id, as a resource of the requested type.
+func (n *Server) readFhir(w http.ResponseWriter, r *http.Request, name string, id string, rt fhirResourceType) {
+	ctx := r.Context()
+	notFound := fmt.Sprintf("%v/%v is not known.", name, id)
+	if _, err := uuid.Parse(id); err != nil {
+		writeFhirOutcome(ctx, w, http.StatusNotFound, "not-found", notFound)
+		return
+	}
+
+	res, err := n.invokeFhir(w, r, "RetrieveNote", &ehrpb.RetrieveNoteRequest{Guid: id},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return n.RetrieveNote(ctx, req.(*ehrpb.RetrieveNoteRequest))
+		})
+	if err != nil {
+		if code, _ := gatewayHttpStatus(res, err); code == http.StatusNotFound {
+			writeFhirOutcome(ctx, w, http.StatusNotFound, "not-found", notFound)
+			return
+		}
+		writeFhirError(ctx, w, NoteClerkErrWrap(err, ErrFhirReadFailsGetNote, name, id))
+		return
+	}
+
+	resource, err := rt.fromNote(res.(*ehrpb.RetrieveNoteResponse).GetNote())
+	if err != nil {
+		writeFhirError(ctx, w, NoteClerkErrWrap(err, ErrFhirHttpFailsWriteResource, name))
+		return
+	}
+	writeFhirResource(ctx, w, http.StatusOK, resource)
+}
+
+// fhirReferenceParams are the reference search parameters, and the filter field and resource type of each.
+var fhirReferenceParams = []struct {
+	name         string
+	resourceType string
+	field        func(filter *NoteFindFilter) *string
+}{
+	{"patient", fhir.PatientType, func(f *NoteFindFilter) *string { return &f.PatientGuid }},
+	{"encounter", fhir.EncounterType, func(f *NoteFindFilter) *string { return &f.VisitGuid }},
+	{"author", fhir.PractitionerType, func(f *NoteFindFilter) *string { return &f.AuthorGuid }},
+}
+
+// searchFhir responds with a searchset Bundle of the notes matching every search parameter given. At least one of
+// patient, encounter or author is required, so that a search never returns every note. Each date parameter narrows
+// the search further, so date=ge2019-01&date=lt2019-04 finds the notes of the first quarter of 2019. Other parameters
+// are ignored, as FHIR allows.
+func (n *Server) searchFhir(w http.ResponseWriter, r *http.Request, name string, rt fhirResourceType) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	var filter NoteFindFilter
+	var problems []string
+	for _, p := range fhirReferenceParams {
+		value := query.Get(p.name)
+		if value == "" {
+			continue
+		}
+		id := strings.TrimPrefix(value, p.resourceType+"/")
+		if _, err := uuid.Parse(id); err != nil {
+			problems = append(problems, fmt.Sprintf("%v must be a %v id or reference, but was %q", p.name,
+				p.resourceType, value))
+		}
+		*p.field(&filter) = id
+	}
+	if filter.PatientGuid == "" && filter.VisitGuid == "" && filter.AuthorGuid == "" {
+		problems = append(problems, "at least one of patient, encounter or author is required")
+	}
+
+	var dates []fhir.DateParam
+	for _, value := range query["date"] {
+		date, err := fhir.ParseDateParam(value)
+		if err != nil {
+			problems = append(problems, "date "+err.Error())
+			continue
+		}
+		dates = append(dates, date)
+	}
+
+	if len(problems) > 0 {
+		writeFhirOutcome(ctx, w, http.StatusBadRequest, "invalid", strings.Join(problems, "; "))
+		return
+	}
+
+	req := &ehrpb.SearchNotesRequest{
+		PatientGuid: filter.PatientGuid,
+		VisitGuid:   filter.VisitGuid,
+		AuthorGuid:  filter.AuthorGuid,
+	}
+	res, err := n.invokeFhir(w, r, "SearchNotes", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return n.SearchNotes(ctx, req.(*ehrpb.SearchNotesRequest))
+	})
+	if err != nil {
+		writeFhirError(ctx, w, NoteClerkErrWrap(err, ErrFhirSearchFailsFindNotes, name))
+		return
+	}
+
+	base := fhirBaseUrl(r)
+	var urls []string
+	var resources []interface{}
+	for _, note := range res.(*ehrpb.SearchNotesResponse).GetNotes() {
+		if !noteMatchesFhirSearch(note, filter, dates) {
+			continue
+		}
+		if err := noted.OrganizeNoteFragments(note); err != nil {
+			loggerFromContext(ctx).Warn("Could not organize the note fragments by fragment priority.")
+		}
+		resource, err := rt.fromNote(note)
+		if err != nil {
+			writeFhirError(ctx, w, NoteClerkErrWrap(err, ErrFhirHttpFailsWriteResource, name))
+			return
+		}
+		urls = append(urls, fmt.Sprintf("%v/%v/%v", base, name, note.GetNoteGuid()))
+		resources = append(resources, resource)
+	}
+
+	bundle, err := fhir.NewSearchSet(fmt.Sprintf("%v/%v?%v", base, name, r.URL.RawQuery), urls, resources)
+	if err != nil {
+		writeFhirError(ctx, w, NoteClerkErrWrap(err, ErrFhirHttpFailsWriteResource, name))
+		return
+	}
+	writeFhirResource(ctx, w, http.StatusOK, bundle)
+}
+
+// noteMatchesFhirSearch checks every search parameter against the note, whichever of them the RDBMSAccessor was able
+// to apply itself.
+func noteMatchesFhirSearch(note *ehrpb.Note, filter NoteFindFilter, dates []fhir.DateParam) bool {
+	if (filter.PatientGuid != "" && note.GetPatientGuid() != filter.PatientGuid) ||
+		(filter.VisitGuid != "" && note.GetVisitGuid() != filter.VisitGuid) ||
+		(filter.AuthorGuid != "" && note.GetAuthorGuid() != filter.AuthorGuid) {
+		return false
+	}
+	if len(dates) == 0 {
+		return true
+	}
+	created := note.GetDateCreated()
+	if created == nil {
+		return false
+	}
+	at := time.Unix(created.GetSeconds(), int64(created.GetNanos()))
+	for _, date := range dates {
+		if !date.Matches(at) {
+			return false
+		}
+	}
+	return true
+}
+
+// createFhir creates a note from the posted resource and responds with the resource as it was stored. The note is
+// created by CreateNote, so it is validated, and may carry an idempotency key, exactly as over gRPC. As FHIR requires,
+// any id in the resource is replaced with the GUID assigned to the new note.
+func (n *Server) createFhir(w http.ResponseWriter, r *http.Request, name string, rt fhirResourceType) {
+	ctx := r.Context()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != fhir.ContentType && mediaType != "application/json" {
+		writeFhirOutcome(ctx, w, http.StatusUnsupportedMediaType, "not-supported",
+			fmt.Sprintf("Resources must be posted as %v, not %q.", fhir.ContentType, mediaType))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxFhirRequestBytes))
+	if err != nil {
+		writeFhirOutcome(ctx, w, http.StatusRequestEntityTooLarge, "too-costly",
+			fmt.Sprintf("Resources must be no larger than %v bytes.", MaxFhirRequestBytes))
+		return
+	}
+	note, err := rt.toNote(body)
+	if err != nil {
+		writeFhirOutcome(ctx, w, http.StatusBadRequest, "structure", fmt.Sprintf("The %v is invalid: %v", name, err))
+		return
+	}
+	note.NoteGuid = ""
+
+	res, err := n.invokeFhir(w, r, "CreateNote", &ehrpb.CreateNoteRequest{Note: note},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return n.CreateNote(ctx, req.(*ehrpb.CreateNoteRequest))
+		})
+	if err != nil {
+		switch code, st := gatewayHttpStatus(res, err); code {
+		case http.StatusBadRequest:
+			writeFhirResource(ctx, w, http.StatusBadRequest, fhirOutcomeFromValidation(err))
+		case http.StatusConflict:
+			writeFhirOutcome(ctx, w, http.StatusConflict, "conflict", st.Message())
+		default:
+			writeFhirError(ctx, w, NoteClerkErrWrap(err, ErrFhirCreateFailsCreateNote, name))
+		}
+		return
+	}
+
+	created := res.(*ehrpb.CreateNoteResponse).GetNote()
+	resource, err := rt.fromNote(created)
+	if err != nil {
+		writeFhirError(ctx, w, NoteClerkErrWrap(err, ErrFhirHttpFailsWriteResource, name))
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%v/%v/%v", fhirBaseUrl(r), name, created.GetNoteGuid()))
+	writeFhirResource(ctx, w, http.StatusCreated, resource)
+}
+
+// invokeFhir calls a NoteService RPC for a FHIR interaction, through the same interceptors as over gRPC and with the
+// HTTP request headers as its metadata, as the gateway does, and returns the headers it set with the response.
+// RETURNS: the response, error
+func (n *Server) invokeFhir(w http.ResponseWriter, r *http.Request, rpc string, req interface{},
+	handler grpc.UnaryHandler) (interface{}, error) {
+	res, headers, err := n.invokeUnary(r.Context(), "/"+noteServiceName+"/"+rpc, gatewayMetadata(r.Header),
+		gatewayPeer(r), req, handler)
+	addGatewayHeaders(w, headers)
+	return res, err
+}
+
+// fhirOutcomeFromValidation reports each field violation found by validateRequest as an issue, with the field as its
+// expression.
+func fhirOutcomeFromValidation(err error) *fhir.OperationOutcome {
+	outcome := &fhir.OperationOutcome{ResourceType: "OperationOutcome"}
+	for _, detail := range status.Convert(err).Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		for _, v := range badRequest.GetFieldViolations() {
+			outcome.Issue = append(outcome.Issue, fhir.OperationOutcomeIssue{
+				Severity:    "error",
+				Code:        "invalid",
+				Diagnostics: fmt.Sprintf("%v %v", v.GetField(), v.GetDescription()),
+				Expression:  []string{v.GetField()},
+			})
+		}
+	}
+	if len(outcome.Issue) == 0 {
+		return fhir.NewOperationOutcome("invalid", status.Convert(err).Message())
+	}
+	return outcome
+}
+
+// fhirBaseUrl is the absolute URL of the facade, as the client addressed it.
+func fhirBaseUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + FhirBasePath
+}
+
+// writeFhirError logs err, which clients are not shown, and responds with a generic OperationOutcome.
+func writeFhirError(ctx context.Context, w http.ResponseWriter, err error) {
+	loggerFromContext(ctx).Warn(err)
+	writeFhirOutcome(ctx, w, http.StatusInternalServerError, "exception", "The request could not be completed.")
+}
+
+func writeFhirMethodNotAllowed(ctx context.Context, w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeFhirOutcome(ctx, w, http.StatusMethodNotAllowed, "not-supported",
+		fmt.Sprintf("The only methods allowed are %v.", strings.Join(allowed, ", ")))
+}
+
+func writeFhirOutcome(ctx context.Context, w http.ResponseWriter, code int, issueCode string, diagnostics string) {
+	writeFhirResource(ctx, w, code, fhir.NewOperationOutcome(issueCode, diagnostics))
+}
+
+func writeFhirResource(ctx context.Context, w http.ResponseWriter, code int, resource interface{}) {
+	b, err := json.Marshal(resource)
+	if err != nil {
+		loggerFromContext(ctx).Error(NoteClerkErrWrap(err, ErrFhirHttpFailsWriteResource, fmt.Sprintf("%T", resource)))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", fhir.ContentType+"; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(b)
+}
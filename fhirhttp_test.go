@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/fhir"
+	"github.com/google/uuid"
+)
+
+func TestFhirHttp_CreateReadAndSearch(t *testing.T) {
+	_, h := newHttpTestServer(t, (*Server).registerFhirHttp)
+
+	patient := uuid.New().String()
+	composition := fhir.NoteToComposition(&ehrpb.Note{
+		PatientGuid: patient,
+		AuthorGuid:  uuid.New().String(),
+		Type:        ehrpb.NoteType_CONTINUED_CARE_DOCUMENTATION,
+		Status:      ehrpb.RecordStatus_ACTIVE,
+		Fragments: []*ehrpb.NoteFragment{
+			{Topic: ehrpb.FragmentType_SUBJECTIVE, Status: ehrpb.RecordStatus_ACTIVE, Content: "Feeling better."},
+		},
+	})
+	body, _ := json.Marshal(composition)
+
+	rec := serveHttp(h, http.MethodPost, FhirBasePath+"/Composition", fhir.ContentType, string(body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 from create, but got %v: %v", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, "http://example.com"+FhirBasePath+"/Composition/") {
+		t.Fatalf("Expected a Location for the new Composition, but got %q", location)
+	}
+	id := location[strings.LastIndex(location, "/")+1:]
+
+	rec = serveHttp(h, http.MethodGet, FhirBasePath+"/DocumentReference/"+id, fhir.ContentType, "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != fhir.ContentType+"; charset=utf-8" {
+		t.Fatalf("Expected 200 from read, but got %v: %v", rec.Code, rec.Body)
+	}
+	var d fhir.DocumentReference
+	if err := json.Unmarshal(rec.Body.Bytes(), &d); err != nil {
+		t.Fatalf("Failed to decode the DocumentReference: %v", err)
+	}
+	if d.Id != id || d.Subject.Reference != "Patient/"+patient || d.Type.Coding[0].Code != "11506-3" {
+		t.Fatalf("Expected the created note as a DocumentReference, but got %+v", d)
+	}
+
+	tests := []struct {
+		query string
+		total int
+	}{
+		{"patient=" + patient, 1},
+		{"patient=Patient/" + patient + "&date=ge2000-01-01", 1},
+		{"patient=" + patient + "&date=lt2000", 0},
+		{"patient=" + patient + "&author=" + uuid.New().String(), 0},
+	}
+	for _, tt := range tests {
+		rec = serveHttp(h, http.MethodGet, FhirBasePath+"/Composition?"+tt.query, fhir.ContentType, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 from a search for %v, but got %v: %v", tt.query, rec.Code, rec.Body)
+		}
+		var bundle fhir.Bundle
+		if err := json.Unmarshal(rec.Body.Bytes(), &bundle); err != nil {
+			t.Fatalf("Failed to decode the Bundle: %v", err)
+		}
+		if bundle.Type != "searchset" || bundle.Total != tt.total {
+			t.Fatalf("Expected %v results from a search for %v, but got %v", tt.total, tt.query, bundle.Total)
+		}
+	}
+}
+
+func TestFhirHttp_Create_RunsThroughTheInterceptors(t *testing.T) {
+	_, h := newHttpTestServer(t, (*Server).registerFhirHttp)
+
+	body, _ := json.Marshal(fhir.NoteToComposition(&ehrpb.Note{
+		PatientGuid: uuid.New().String(),
+		AuthorGuid:  uuid.New().String(),
+		Type:        ehrpb.NoteType_CONTINUED_CARE_DOCUMENTATION,
+		Status:      ehrpb.RecordStatus_ACTIVE,
+	}))
+	create := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, FhirBasePath+"/Composition", bytes.NewReader(body))
+		req.Header.Set("Content-Type", fhir.ContentType)
+		req.Header.Set(RequestIdHeader, "fhir-42")
+		req.Header.Set(IdempotencyKeyHeader, "fhir-retry")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := create()
+	if first.Code != http.StatusCreated || first.Header().Get(RequestIdHeader) != "fhir-42" {
+		t.Fatalf("Expected 201 with the request id, but got %v %v: %v", first.Code, first.Header(), first.Body)
+	}
+	retry := create()
+	if retry.Code != http.StatusCreated || retry.Header().Get("Location") != first.Header().Get("Location") {
+		t.Fatalf("Expected a retry with the same idempotency key to return %v, but got %v: %v",
+			first.Header().Get("Location"), retry.Header().Get("Location"), retry.Body)
+	}
+}
+
+func TestFhirHttp_RejectsInvalidRequests(t *testing.T) {
+	_, h := newHttpTestServer(t, (*Server).registerFhirHttp)
+
+	noPatient, _ := json.Marshal(fhir.NoteToComposition(&ehrpb.Note{AuthorGuid: uuid.New().String()}))
+	noAuthor, _ := json.Marshal(fhir.NoteToComposition(&ehrpb.Note{PatientGuid: uuid.New().String()}))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   []byte
+		code   int
+		issue  string
+	}{
+		{"search without a reference", http.MethodGet, "/Composition?date=2019", nil, http.StatusBadRequest, "invalid"},
+		{"search with a bad date", http.MethodGet, "/Composition?patient=" + uuid.New().String() + "&date=soon", nil,
+			http.StatusBadRequest, "invalid"},
+		{"search with a bad patient", http.MethodGet, "/Composition?patient=Group/1", nil, http.StatusBadRequest,
+			"invalid"},
+		{"read of an unknown note", http.MethodGet, "/Composition/" + uuid.New().String(), nil, http.StatusNotFound,
+			"not-found"},
+		{"read of a malformed id", http.MethodGet, "/Composition/1", nil, http.StatusNotFound, "not-found"},
+		{"unknown resource type", http.MethodGet, "/Observation", nil, http.StatusNotFound, "not-supported"},
+		{"update", http.MethodPut, "/Composition/" + uuid.New().String(), noPatient, http.StatusMethodNotAllowed,
+			"not-supported"},
+		{"create without a patient", http.MethodPost, "/Composition", noPatient, http.StatusBadRequest, "invalid"},
+		{"create without an author", http.MethodPost, "/Composition", noAuthor, http.StatusBadRequest, "structure"},
+		{"create of malformed JSON", http.MethodPost, "/DocumentReference", []byte("{"), http.StatusBadRequest,
+			"structure"},
+	}
+	for _, tt := range tests {
+		rec := serveHttp(h, tt.method, FhirBasePath+tt.target, fhir.ContentType, string(tt.body))
+		if rec.Code != tt.code {
+			t.Fatalf("Expected %v for a %v, but got %v: %v", tt.code, tt.name, rec.Code, rec.Body)
+		}
+		var outcome fhir.OperationOutcome
+		if err := json.Unmarshal(rec.Body.Bytes(), &outcome); err != nil || outcome.ResourceType != "OperationOutcome" {
+			t.Fatalf("Expected an OperationOutcome for a %v, but got %v", tt.name, rec.Body)
+		}
+		if outcome.Issue[0].Code != tt.issue {
+			t.Fatalf("Expected a '%v' issue for a %v, but got %+v", tt.issue, tt.name, outcome.Issue)
+		}
+	}
+
+	rec := serveHttp(h, http.MethodPost, FhirBasePath+"/Composition", fhir.ContentType, string(noPatient))
+	var outcome fhir.OperationOutcome
+	json.Unmarshal(rec.Body.Bytes(), &outcome)
+	if outcome.Issue[0].Expression[0] != "note.patient_guid" {
+		t.Fatalf("Expected the invalid field to be named, but got %+v", outcome.Issue)
+	}
+}
+
+func TestFhirHttp_Metadata(t *testing.T) {
+	_, h := newHttpTestServer(t, (*Server).registerFhirHttp)
+
+	rec := serveHttp(h, http.MethodGet, FhirBasePath+"/metadata", fhir.ContentType, "")
+	var capabilities fhir.CapabilityStatement
+	if err := json.Unmarshal(rec.Body.Bytes(), &capabilities); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected a CapabilityStatement, but got %v: %v", rec.Code, rec.Body)
+	}
+	if capabilities.FhirVersion != "4.0.1" || len(capabilities.Rest[0].Resource) != 2 {
+		t.Fatalf("Expected Composition and DocumentReference to be described, but got %+v", capabilities)
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// GatewayBasePath is the base of the JSON/REST gateway to NoteService served on GatewayHttpPort.
+const GatewayBasePath = "/v1"
+
+// MaxGatewayRequestBytes bounds the size of a request body posted to the gateway.
+const MaxGatewayRequestBytes = 4 << 20
+
+// noteServiceName is the gRPC service name of NoteService, which prefixes the full method names of its RPCs.
+const noteServiceName = "ehrpb.NoteService"
+
+// gatewayOpenApi describes the gateway, and is served at GatewayBasePath/openapi.yaml.
+//
+//go:embed openapi.yaml
+var gatewayOpenApi []byte
+
+// gatewayRoute maps an HTTP method and path pattern to a NoteService RPC. newRequest builds the RPC's request from
+// the note GUID in the path, the query string and the body, which is only read for routes with a body.
+type gatewayRoute struct {
+	method     string
+	pattern    string
+	rpc        string
+	body       bool
+	newRequest func(guid string, query url.Values, body []byte) (proto.Message, error)
+	call       func(n *Server, ctx context.Context, req interface{}) (interface{}, error)
+}
+
+// gatewayRoutes are the REST endpoints of the gateway, relative to GatewayBasePath. They are described in
+// openapi.yaml, which must be kept in step with them.
+var gatewayRoutes = []gatewayRoute{
+	{
+		method: http.MethodPost, pattern: "/notes", rpc: "CreateNote", body: true,
+		newRequest: func(guid string, query url.Values, body []byte) (proto.Message, error) {
+			note := &ehrpb.Note{}
+			if err := decodeGatewayBody(body, note); err != nil {
+				return nil, err
+			}
+			return &ehrpb.CreateNoteRequest{Note: note}, decodeGatewayQuery(query, nil)
+		},
+		call: func(n *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return n.CreateNote(ctx, req.(*ehrpb.CreateNoteRequest))
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/notes/{guid}", rpc: "RetrieveNote",
+		newRequest: func(guid string, query url.Values, body []byte) (proto.Message, error) {
+			return &ehrpb.RetrieveNoteRequest{Guid: guid}, decodeGatewayQuery(query, nil)
+		},
+		call: func(n *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return n.RetrieveNote(ctx, req.(*ehrpb.RetrieveNoteRequest))
+		},
+	},
+	{
+		method: http.MethodPut, pattern: "/notes/{guid}", rpc: "UpdateNote", body: true,
+		newRequest: func(guid string, query url.Values, body []byte) (proto.Message, error) {
+			note := &ehrpb.Note{}
+			if err := decodeGatewayBody(body, note); err != nil {
+				return nil, err
+			}
+			if note.NoteGuid == "" {
+				note.NoteGuid = guid
+			}
+			if note.NoteGuid != guid {
+				return nil, fmt.Errorf("noteGuid %q does not match the note %q in the path", note.NoteGuid, guid)
+			}
+			return &ehrpb.UpdateNoteRequest{Id: note.GetId(), Note: note}, decodeGatewayQuery(query, nil)
+		},
+		call: func(n *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return n.UpdateNote(ctx, req.(*ehrpb.UpdateNoteRequest))
+		},
+	},
+	{
+		method: http.MethodDelete, pattern: "/notes/{guid}", rpc: "DeleteNote",
+		newRequest: func(guid string, query url.Values, body []byte) (proto.Message, error) {
+			return &ehrpb.DeleteNoteRequest{Guid: guid}, decodeGatewayQuery(query, nil)
+		},
+		call: func(n *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return n.DeleteNote(ctx, req.(*ehrpb.DeleteNoteRequest))
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/notes", rpc: "SearchNotes",
+		newRequest: func(guid string, query url.Values, body []byte) (proto.Message, error) {
+			req := &ehrpb.SearchNotesRequest{}
+			return req, decodeGatewayQuery(query, map[string]*string{
+				"visit_guid":   &req.VisitGuid,
+				"author_guid":  &req.AuthorGuid,
+				"patient_guid": &req.PatientGuid,
+				"search_terms": &req.SearchTerms,
+			})
+		},
+		call: func(n *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return n.SearchNotes(ctx, req.(*ehrpb.SearchNotesRequest))
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/fragments", rpc: "SearchNoteFragments",
+		newRequest: func(guid string, query url.Values, body []byte) (proto.Message, error) {
+			req := &ehrpb.SearchNoteFragmentRequest{}
+			return req, decodeGatewayQuery(query, map[string]*string{
+				"note_guid":    &req.NoteGuid,
+				"visit_guid":   &req.VisitGuid,
+				"author_guid":  &req.AuthorGuid,
+				"patient_guid": &req.PatientGuid,
+				"search_terms": &req.SearchTerms,
+			})
+		},
+		call: func(n *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return n.SearchNoteFragments(ctx, req.(*ehrpb.SearchNoteFragmentRequest))
+		},
+	},
+}
+
+// registerGatewayHttp adds the JSON/REST gateway to mux. Requests and responses are NoteService messages in the
+// protobuf JSON encoding, and each request calls the RPC it is mapped to through invokeUnary:
+//
+//	POST   /v1/notes          CreateNote, with the note as the body
+//	GET    /v1/notes/{guid}   RetrieveNote
+//	PUT    /v1/notes/{guid}   UpdateNote, with the note as the body
+//	DELETE /v1/notes/{guid}   DeleteNote
+//	GET    /v1/notes          SearchNotes, e.g. ?patient_guid=&search_terms=
+//	GET    /v1/fragments      SearchNoteFragments
+//	GET    /v1/openapi.yaml   the OpenAPI document describing the above
+func (n *Server) registerGatewayHttp(mux *http.ServeMux) {
+	mux.HandleFunc(GatewayBasePath+"/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeGatewayStatus(r.Context(), w, http.StatusMethodNotAllowed,
+				status.New(codes.Unimplemented, "The only methods allowed are GET, HEAD."))
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(gatewayOpenApi)
+	})
+
+	mux.HandleFunc(GatewayBasePath+"/", func(w http.ResponseWriter, r *http.Request) {
+		pattern, guid := gatewayPattern(strings.TrimPrefix(r.URL.Path, GatewayBasePath))
+		var allowed []string
+		for _, route := range gatewayRoutes {
+			if route.pattern != pattern {
+				continue
+			}
+			if route.method == r.Method {
+				n.serveGateway(w, r, route, guid)
+				return
+			}
+			allowed = append(allowed, route.method)
+		}
+
+		if len(allowed) == 0 {
+			writeGatewayStatus(r.Context(), w, http.StatusNotFound,
+				status.Newf(codes.NotFound, "%v is not served.", r.URL.Path))
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeGatewayStatus(r.Context(), w, http.StatusMethodNotAllowed,
+			status.Newf(codes.Unimplemented, "The only methods allowed are %v.", strings.Join(allowed, ", ")))
+	})
+}
+
+// gatewayPattern matches path against the route patterns, returning the pattern and the note GUID it names, if any.
+func gatewayPattern(path string) (pattern string, guid string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) == 1:
+		return "/" + parts[0], ""
+	case len(parts) == 2 && parts[1] != "":
+		return "/" + parts[0] + "/{guid}", parts[1]
+	}
+	return "", ""
+}
+
+// serveGateway calls the RPC of route with the request built from r, and responds with its response or error.
+func (n *Server) serveGateway(w http.ResponseWriter, r *http.Request, route gatewayRoute, guid string) {
+	ctx := r.Context()
+
+	var body []byte
+	if route.body {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" {
+			writeGatewayStatus(ctx, w, http.StatusUnsupportedMediaType, status.Newf(codes.InvalidArgument,
+				"Requests must be posted as application/json, not %q.", mediaType))
+			return
+		}
+		var err error
+		body, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxGatewayRequestBytes))
+		if err != nil {
+			writeGatewayStatus(ctx, w, http.StatusRequestEntityTooLarge, status.Newf(codes.ResourceExhausted,
+				"Requests must be no larger than %v bytes.", MaxGatewayRequestBytes))
+			return
+		}
+	}
+	req, err := route.newRequest(guid, r.URL.Query(), body)
+	if err != nil {
+		writeGatewayError(ctx, w, nil, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	res, headers, err := n.invokeUnary(ctx, "/"+noteServiceName+"/"+route.rpc, gatewayMetadata(r.Header),
+		gatewayPeer(r), req, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return route.call(n, ctx, req)
+		})
+	addGatewayHeaders(w, headers)
+	if err != nil {
+		writeGatewayError(ctx, w, res, err)
+		return
+	}
+	writeGatewayMessage(ctx, w, http.StatusOK, res.(proto.Message))
+}
+
+// invokeUnary calls handler with req through the same interceptors as RPCs served over gRPC, so that requests which
+// arrive another way are traced, logged, counted and validated alike. The context carries what it would over gRPC:
+// fullMethod, md as the incoming metadata and p as the peer.
+// RETURNS: the response, the headers set by the handler or interceptors, error
+func (n *Server) invokeUnary(ctx context.Context, fullMethod string, md metadata.MD, p *peer.Peer, req interface{},
+	handler grpc.UnaryHandler) (interface{}, metadata.MD, error) {
+	stream := &gatewayTransportStream{method: fullMethod}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	ctx = metadata.NewIncomingContext(ctx, md)
+	ctx = peer.NewContext(ctx, p)
+
+	recovering := func(ctx context.Context, req interface{}) (res interface{}, err error) {
+		// A panicking handler fails only its own request, as it would be unable to answer it at all otherwise
+		defer func() {
+			if r := recover(); r != nil {
+				err = status.Errorf(codes.Internal, "%v failed: %v", fullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+	res, err := chainUnaryInterceptors(n.unaryInterceptors(), &grpc.UnaryServerInfo{Server: n, FullMethod: fullMethod},
+		recovering)(ctx, req)
+	return res, stream.headers(), err
+}
+
+// addGatewayHeaders returns the headers an RPC set, such as x-request-id, as HTTP response headers.
+func addGatewayHeaders(w http.ResponseWriter, headers metadata.MD) {
+	for key, values := range headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+}
+
+// chainUnaryInterceptors calls interceptors in order around handler, as grpc.ChainUnaryInterceptor does for RPCs
+// served over gRPC.
+func chainUnaryInterceptors(interceptors []grpc.UnaryServerInterceptor, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) grpc.UnaryHandler {
+	for k := len(interceptors) - 1; k >= 0; k-- {
+		interceptor, next := interceptors[k], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler
+}
+
+// gatewayHopHeaders are the request headers which describe the HTTP connection or body rather than the request, and
+// are not passed on to the RPC as metadata.
+var gatewayHopHeaders = map[string]bool{
+	"connection": true, "content-length": true, "content-type": true, "host": true, "keep-alive": true,
+	"proxy-authorization": true, "proxy-connection": true, "te": true, "trailer": true, "transfer-encoding": true,
+	"upgrade": true,
+}
+
+// gatewayMetadata passes the request headers on to the RPC as incoming metadata, so that headers such as
+// x-request-id, idempotency-key and traceparent mean the same over HTTP as they do over gRPC.
+func gatewayMetadata(header http.Header) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range header {
+		key = strings.ToLower(key)
+		if gatewayHopHeaders[key] || strings.HasSuffix(key, "-bin") {
+			continue
+		}
+		md.Append(key, values...)
+	}
+	return md
+}
+
+// gatewayPeer describes the HTTP client as a gRPC peer, including any verified TLS client certificate, so that it is
+// identified as the same principal as it would be over gRPC.
+func gatewayPeer(r *http.Request) *peer.Peer {
+	p := &peer.Peer{Addr: &net.TCPAddr{}}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		p.Addr = addr
+	}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+	}
+	return p
+}
+
+// gatewayTransportStream collects the headers and trailers an RPC sets, which the gateway returns as HTTP response
+// headers.
+type gatewayTransportStream struct {
+	method string
+	mu     sync.Mutex
+	md     metadata.MD
+}
+
+func (s *gatewayTransportStream) Method() string {
+	return s.method
+}
+
+func (s *gatewayTransportStream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.md = metadata.Join(s.md, md)
+	return nil
+}
+
+func (s *gatewayTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *gatewayTransportStream) SetTrailer(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *gatewayTransportStream) headers() metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.md.Copy()
+}
+
+// decodeGatewayBody decodes a protobuf JSON body into msg. Unknown fields are refused, so that a misspelt field is
+// reported rather than silently dropped.
+func decodeGatewayBody(body []byte, msg proto.Message) error {
+	if err := (&jsonpb.Unmarshaler{}).Unmarshal(bytes.NewReader(body), msg); err != nil {
+		return fmt.Errorf("the body is not a valid %v: %v", proto.MessageName(msg), err)
+	}
+	return nil
+}
+
+// decodeGatewayQuery sets the string fields of a request from the query parameters. Each parameter may be given by
+// its proto field name, e.g. patient_guid, or its JSON name, e.g. patientGuid. Parameters which are not fields are
+// refused.
+func decodeGatewayQuery(query url.Values, fields map[string]*string) error {
+	for name, values := range query {
+		field, ok := fields[name]
+		if !ok {
+			field, ok = fields[snakeCase(name)]
+		}
+		if !ok {
+			return fmt.Errorf("%q is not a query parameter of this request", name)
+		}
+		*field = values[0]
+	}
+	return nil
+}
+
+// snakeCase turns a JSON field name such as patientGuid into its proto field name, patient_guid.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// gatewayHttpStatus maps the status of a failed RPC to an HTTP status code. Errors which carry no gRPC status take
+// their code from the HttpCode of the response, where the NoteService handlers set one: such errors reach gRPC
+// clients as codes.Unknown, but a missing note is still NOT_FOUND to HTTP clients.
+// RETURNS: int, *status.Status
+func gatewayHttpStatus(res interface{}, err error) (int, *status.Status) {
+	st := status.Convert(err)
+	if st.Code() == codes.Unknown {
+		if r, ok := res.(interface {
+			GetStatus() *ehrpb.NoteServiceResponseStatus
+		}); ok {
+			switch r.GetStatus().GetHttpCode() {
+			case ehrpb.StatusCodes_NOT_FOUND:
+				st = status.New(codes.NotFound, st.Message())
+			case ehrpb.StatusCodes_CONFLICT:
+				st = status.New(codes.Aborted, st.Message())
+			}
+		}
+	}
+
+	switch st.Code() {
+	case codes.OK:
+		return http.StatusOK, st
+	case codes.Canceled:
+		return 499, st
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest, st
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout, st
+	case codes.NotFound:
+		return http.StatusNotFound, st
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict, st
+	case codes.PermissionDenied:
+		return http.StatusForbidden, st
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized, st
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests, st
+	case codes.Unimplemented:
+		return http.StatusNotImplemented, st
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable, st
+	}
+	return http.StatusInternalServerError, st
+}
+
+// writeGatewayError responds with the google.rpc.Status of a failed RPC, including any BadRequest details listing
+// the fields which failed validation.
+func writeGatewayError(ctx context.Context, w http.ResponseWriter, res interface{}, err error) {
+	code, st := gatewayHttpStatus(res, err)
+	writeGatewayStatus(ctx, w, code, st)
+}
+
+func writeGatewayStatus(ctx context.Context, w http.ResponseWriter, code int, st *status.Status) {
+	writeGatewayMessage(ctx, w, code, st.Proto())
+}
+
+func writeGatewayMessage(ctx context.Context, w http.ResponseWriter, code int, msg proto.Message) {
+	var buf bytes.Buffer
+	if err := (&jsonpb.Marshaler{}).Marshal(&buf, msg); err != nil {
+		loggerFromContext(ctx).Error(NoteClerkErrWrap(err, ErrGatewayHttpFailsWriteMessage, proto.MessageName(msg)))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// gatewayTestNote is a note for CreateNote in the protobuf JSON encoding.
+func gatewayTestNote(patient string) string {
+	return `{"patientGuid": "` + patient + `", "authorGuid": "` + uuid.New().String() + `", "type": 1, "status": 1,
+		"fragments": [{"topic": 1, "status": 1, "description": "Chest pain", "content": "Began an hour ago."}]}`
+}
+
+func TestGatewayHttp_CreateRetrieveAndSearch(t *testing.T) {
+	_, h := newHttpTestServer(t, (*Server).registerGatewayHttp)
+	patient := uuid.New().String()
+
+	note := gatewayTestNote(patient)
+	rec := serveHttp(h, http.MethodPost, GatewayBasePath+"/notes", "application/json", note,
+		"Idempotency-Key", "gateway-test", "X-Request-Id", "req-1")
+	if rec.Code != http.StatusOK || rec.Header().Get(RequestIdHeader) != "req-1" {
+		t.Fatalf("Expected 200 with the request id from create, but got %v %v: %v", rec.Code, rec.Header(), rec.Body)
+	}
+	var created struct {
+		Note struct {
+			NoteGuid string `json:"noteGuid"`
+		} `json:"note"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.Note.NoteGuid == "" {
+		t.Fatalf("Expected the created note in protobuf JSON, but got %v: %v", rec.Body, err)
+	}
+
+	// The idempotency key is honoured as it is over gRPC
+	rec = serveHttp(h, http.MethodPost, GatewayBasePath+"/notes", "application/json", note,
+		"Idempotency-Key", "gateway-test")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), created.Note.NoteGuid) {
+		t.Fatalf("Expected the recorded response for a retry, but got %v: %v", rec.Code, rec.Body)
+	}
+	rec = serveHttp(h, http.MethodPost, GatewayBasePath+"/notes", "application/json", gatewayTestNote(patient),
+		"Idempotency-Key", "gateway-test")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"code":9`) {
+		t.Fatalf("Expected FAILED_PRECONDITION for a reused idempotency key, but got %v: %v", rec.Code, rec.Body)
+	}
+
+	rec = serveHttp(h, http.MethodGet, GatewayBasePath+"/notes/"+created.Note.NoteGuid, "application/json", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"noteGuid":"`+created.Note.NoteGuid+`"`) {
+		t.Fatalf("Expected 200 with the note from retrieve, but got %v: %v", rec.Code, rec.Body)
+	}
+
+	for _, param := range []string{"patient_guid", "patientGuid"} {
+		rec = serveHttp(h, http.MethodGet, GatewayBasePath+"/notes?"+param+"="+patient, "application/json", "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), created.Note.NoteGuid) {
+			t.Fatalf("Expected 200 with the note from a search by %v, but got %v: %v", param, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestGatewayHttp_MapsErrors(t *testing.T) {
+	_, h := newHttpTestServer(t, (*Server).registerGatewayHttp)
+	guid := uuid.New().String()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		code   int
+		expect string
+	}{
+		{"invalid note", http.MethodPost, "/notes", `{"patientGuid": "not a guid"}`, http.StatusBadRequest,
+			`"@type":"type.googleapis.com/google.rpc.BadRequest"`},
+		{"unknown body field", http.MethodPost, "/notes", `{"patient": "x"}`, http.StatusBadRequest, `"code":3`},
+		{"unknown query parameter", http.MethodGet, "/notes?patient=" + guid, "", http.StatusBadRequest,
+			`"code":3`},
+		{"missing note", http.MethodGet, "/notes/" + guid, "", http.StatusNotFound, `"code":5`},
+		{"invalid guid", http.MethodDelete, "/notes/not-a-guid", "", http.StatusBadRequest,
+			`"field":"guid"`},
+		{"mismatched guid", http.MethodPut, "/notes/" + guid, `{"noteGuid": "` + uuid.New().String() + `"}`,
+			http.StatusBadRequest, `"code":3`},
+		{"unimplemented RPC", http.MethodGet, "/fragments", "", http.StatusNotImplemented, `"code":12`},
+		{"unknown path", http.MethodGet, "/patients", "", http.StatusNotFound, `"code":5`},
+		{"unknown method", http.MethodPatch, "/notes/" + guid, "", http.StatusMethodNotAllowed, `"code":12`},
+	}
+	for _, tt := range tests {
+		rec := serveHttp(h, tt.method, GatewayBasePath+tt.target, "application/json", tt.body)
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.expect) {
+			t.Fatalf("%v: expected %v with %v, but got %v: %v", tt.name, tt.code, tt.expect, rec.Code, rec.Body)
+		}
+	}
+
+	rec := serveHttp(h, http.MethodPatch, GatewayBasePath+"/notes/"+guid, "application/json", "")
+	if allow := rec.Header().Get("Allow"); allow != "GET, PUT, DELETE" {
+		t.Fatalf("Expected the methods of the note to be allowed, but got %q", allow)
+	}
+	req := httptest.NewRequest(http.MethodPost, GatewayBasePath+"/notes", bytes.NewReader([]byte("{}")))
+	req.Header.Set("Content-Type", "text/plain")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected 415 for a body which is not JSON, but got %v", rec.Code)
+	}
+}
+
+func TestGatewayOpenApi_DescribesEveryRoute(t *testing.T) {
+	_, h := newHttpTestServer(t, (*Server).registerGatewayHttp)
+	rec := serveHttp(h, http.MethodGet, GatewayBasePath+"/openapi.yaml", "application/json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the OpenAPI document, but got %v", rec.Code)
+	}
+
+	var doc struct {
+		Paths map[string]map[string]interface{} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Expected the OpenAPI document to be YAML, but got %v", err)
+	}
+	operations := 0
+	for _, methods := range doc.Paths {
+		for method := range methods {
+			if method != "parameters" {
+				operations++
+			}
+		}
+	}
+	if operations != len(gatewayRoutes) {
+		t.Fatalf("Expected %v operations in the OpenAPI document, but got %v", len(gatewayRoutes), operations)
+	}
+	for _, route := range gatewayRoutes {
+		op, _ := doc.Paths[route.pattern][strings.ToLower(route.method)].(map[string]interface{})
+		if op["operationId"] != route.rpc {
+			t.Fatalf("Expected %v %v to be described as %v, but got %v", route.method, route.pattern, route.rpc, op)
+		}
+	}
+}
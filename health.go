@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// DefaultHealthCheckInterval is how often the database is checked when the configuration does not say otherwise.
+const DefaultHealthCheckInterval = 10 * time.Second
+
+// Paths of the HTTP liveness and readiness endpoints, for orchestrators which cannot speak gRPC health checking.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// healthMonitor periodically checks that the database is reachable and fully migrated, and publishes the result
+// through the standard grpc.health.v1 service and the HTTP readiness endpoint. Once the server starts draining it
+// reports NOT_SERVING for good, so load balancers stop routing to it before its connections close.
+type healthMonitor struct {
+	db       RDBMSAccessor
+	grpc     *health.Server
+	interval time.Duration
+	services []string
+
+	mu        sync.RWMutex
+	ready     bool
+	reason    string
+	checkedAt time.Time
+	draining  bool
+}
+
+// healthReport is the JSON body of the HTTP health endpoints.
+type healthReport struct {
+	Status    string     `json:"status"`
+	Reason    string     `json:"reason,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// newHealthMonitor creates a monitor reporting on the overall server, named by the empty string, and on each of the
+// given gRPC services. Every one of them is NOT_SERVING until the first check passes.
+func newHealthMonitor(db RDBMSAccessor, interval time.Duration, services []string) *healthMonitor {
+	h := &healthMonitor{
+		db:       db,
+		grpc:     health.NewServer(),
+		interval: interval,
+		services: append([]string{""}, services...),
+		reason:   "the first health check has not run yet",
+	}
+	h.publish(grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	return h
+}
+
+// run checks health immediately and then once per interval, until stop is closed.
+func (h *healthMonitor) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.check()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs a single database health check, bounded by the check interval, and publishes the result.
+func (h *healthMonitor) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+	defer cancel()
+	err := h.db.CheckHealth(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		return
+	}
+	wasReady := h.ready
+	h.ready = err == nil
+	h.reason = ""
+	if err != nil {
+		h.reason = err.Error()
+	}
+	h.checkedAt = time.Now()
+
+	switch {
+	case h.ready && !wasReady:
+		log.Info("Health check passed; the server is ready.")
+		h.publish(grpc_health_v1.HealthCheckResponse_SERVING)
+	case !h.ready:
+		log.Warnf("Health check failed; the server is not ready: %v", err)
+		h.publish(grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// drain permanently marks the server NOT_SERVING.
+func (h *healthMonitor) drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.draining = true
+	h.ready = false
+	h.reason = "the server is shutting down"
+	h.grpc.Shutdown()
+}
+
+func (h *healthMonitor) publish(status grpc_health_v1.HealthCheckResponse_ServingStatus) {
+	for _, v := range h.services {
+		h.grpc.SetServingStatus(v, status)
+	}
+}
+
+// httpHandler serves only the liveness and readiness endpoints.
+func (h *healthMonitor) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	h.registerHttp(mux)
+	return mux
+}
+
+// registerHttp adds the liveness and readiness endpoints to mux. Liveness only shows that the process is responding, so
+// an orchestrator does not restart the server because Postgres is down. Readiness answers 503 whenever the last check
+// failed or the server is draining.
+func (h *healthMonitor) registerHttp(mux *http.ServeMux) {
+	mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, http.StatusOK, healthReport{Status: "alive"})
+	})
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		h.mu.RLock()
+		report := healthReport{Status: "ready", Reason: h.reason}
+		if !h.checkedAt.IsZero() {
+			checkedAt := h.checkedAt
+			report.CheckedAt = &checkedAt
+		}
+		ready := h.ready
+		h.mu.RUnlock()
+
+		if !ready {
+			report.Status = "not ready"
+			writeHealthReport(w, http.StatusServiceUnavailable, report)
+			return
+		}
+		writeHealthReport(w, http.StatusOK, report)
+	})
+}
+
+func writeHealthReport(w http.ResponseWriter, code int, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
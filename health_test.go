@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// unhealthyDb is a MockDb whose health check fails with err.
+type unhealthyDb struct {
+	MockDb
+	err error
+}
+
+func (u *unhealthyDb) CheckHealth(ctx context.Context) error {
+	return u.err
+}
+
+func grpcHealthStatus(t *testing.T, h *healthMonitor, service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	res, err := h.grpc.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("The health check for service '%v' failed: %v", service, err)
+	}
+	return res.GetStatus()
+}
+
+func httpStatus(h *healthMonitor, path string) int {
+	rec := httptest.NewRecorder()
+	h.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+func TestHealthMonitor_BeforeFirstCheck_IsNotServing(t *testing.T) {
+	h := newHealthMonitor(&MockDb{}, DefaultHealthCheckInterval, []string{clerkServiceName})
+
+	if got := grpcHealthStatus(t, h, ""); got != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("Expected NOT_SERVING before the first check, but got %v", got)
+	}
+	if got := httpStatus(h, ReadinessPath); got != http.StatusServiceUnavailable {
+		t.Fatalf("Expected readiness to return 503 before the first check, but got %v", got)
+	}
+}
+
+func TestHealthMonitor_WithHealthyDb_IsServing(t *testing.T) {
+	h := newHealthMonitor(&MockDb{}, DefaultHealthCheckInterval, []string{clerkServiceName})
+	h.check()
+
+	for _, service := range []string{"", clerkServiceName} {
+		if got := grpcHealthStatus(t, h, service); got != grpc_health_v1.HealthCheckResponse_SERVING {
+			t.Fatalf("Expected service '%v' to be SERVING, but got %v", service, got)
+		}
+	}
+	if got := httpStatus(h, ReadinessPath); got != http.StatusOK {
+		t.Fatalf("Expected readiness to return 200, but got %v", got)
+	}
+}
+
+func TestHealthMonitor_WithUnhealthyDb_IsNotServingButAlive(t *testing.T) {
+	h := newHealthMonitor(&unhealthyDb{err: errors.New("connection refused")}, DefaultHealthCheckInterval, nil)
+	h.check()
+
+	if got := grpcHealthStatus(t, h, ""); got != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("Expected NOT_SERVING while the database is down, but got %v", got)
+	}
+	if got := httpStatus(h, ReadinessPath); got != http.StatusServiceUnavailable {
+		t.Fatalf("Expected readiness to return 503 while the database is down, but got %v", got)
+	}
+	if got := httpStatus(h, LivenessPath); got != http.StatusOK {
+		t.Fatalf("Expected liveness to return 200 while the database is down, but got %v", got)
+	}
+}
+
+func TestHealthMonitor_WhenDraining_StaysNotServing(t *testing.T) {
+	h := newHealthMonitor(&MockDb{}, DefaultHealthCheckInterval, nil)
+	h.check()
+	h.drain()
+	h.check()
+
+	if got := grpcHealthStatus(t, h, ""); got != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("Expected NOT_SERVING while draining, but got %v", got)
+	}
+	if got := httpStatus(h, ReadinessPath); got != http.StatusServiceUnavailable {
+		t.Fatalf("Expected readiness to return 503 while draining, but got %v", got)
+	}
+}
@@ -0,0 +1,160 @@
+package hl7
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/fhir"
+)
+
+// documentTypes maps the HL7 table 0270 document types sent in TXA-2 to note types, keyed by enum name. Document types
+// may also be sent as LOINC codes, with LN as their coding system.
+var documentTypes = map[string]string{
+	"HP": "HISTORY_AND_PHYSICAL",
+	"PR": "CONTINUED_CARE_DOCUMENTATION",
+}
+
+// MdmToNote maps an MDM^T02 message, a new document with its content, to a note.
+//
+//   - PID-3 identifies the patient, PV1-19 the visit and TXA-9, or else TXA-5, the author. Each must be the GUID
+//     NoteClerk knows them by.
+//   - TXA-2 gives the note type, TXA-17 (completion status) and TXA-19 (availability status) its status.
+//   - Each run of OBX segments with the same observation identifier (OBX-3) and sub-id (OBX-4) becomes a fragment,
+//     its content the text of their values, one line per OBX or repetition. OBX-3 gives the fragment type, as a LOINC
+//     code or a NoteClerk fragment type name, and its text the fragment description.
+//
+// RETURNS: *ehrpb.Note, error (an *Error)
+func MdmToNote(m *Message) (*ehrpb.Note, error) {
+	if code, trigger := m.Type(); code != "MDM" {
+		return nil, &Error{Code: ErrCodeUnsupportedMessageType, Location: "MSH-9",
+			Text: fmt.Sprintf("only MDM messages are accepted, not %v", code)}
+	} else if trigger != "T02" {
+		return nil, &Error{Code: ErrCodeUnsupportedEvent, Location: "MSH-9",
+			Text: fmt.Sprintf("only new documents (T02) are accepted, not %v", trigger)}
+	}
+
+	pid, txa := m.Segment("PID"), m.Segment("TXA")
+	if pid == nil || txa == nil {
+		return nil, &Error{Code: ErrCodeSegmentSequence, Text: "MDM messages must include PID and TXA segments"}
+	}
+
+	note := &ehrpb.Note{
+		PatientGuid: pid.Component(3, 1),
+		VisitGuid:   m.Segment("PV1").Component(19, 1),
+		AuthorGuid:  txa.Component(9, 1),
+		Type:        documentType(txa),
+	}
+	if note.AuthorGuid == "" {
+		note.AuthorGuid = txa.Component(5, 1)
+	}
+	if note.PatientGuid == "" {
+		return nil, &Error{Code: ErrCodeRequiredFieldMissing, Location: "PID-3", Text: "the patient is required"}
+	}
+	if note.AuthorGuid == "" {
+		return nil, &Error{Code: ErrCodeRequiredFieldMissing, Location: "TXA-9", Text: "the originator is required"}
+	}
+
+	status, err := documentStatus(txa)
+	if err != nil {
+		return nil, err
+	}
+	note.Status = status
+
+	var last *Segment
+	for k, obx := range m.Segments {
+		if obx.Name != "OBX" {
+			continue
+		}
+		switch valueType := obx.Field(2); valueType {
+		case "TX", "FT", "ST", "":
+		default:
+			return nil, &Error{Code: ErrCodeDataType, Location: "OBX-2",
+				Text: fmt.Sprintf("segment %v has a %v value; only text (TX, FT or ST) is accepted", k+1, valueType)}
+		}
+
+		if last != nil && obx.Field(3) == last.Field(3) && obx.Field(4) == last.Field(4) {
+			frag := note.Fragments[len(note.Fragments)-1]
+			frag.Content += "\n" + obx.Text(5)
+			continue
+		}
+		last = obx
+
+		frag := &ehrpb.NoteFragment{
+			Topic:       fragmentType(obx),
+			Description: obx.Component(3, 2),
+			Content:     obx.Text(5),
+			Status:      note.Status,
+		}
+		if frag.Description == "" {
+			frag.Description = obx.Component(3, 1)
+		}
+		if s := obx.Field(11); s == "D" || s == "W" {
+			frag.Status = ehrpb.RecordStatus_DELETED
+		}
+		note.Fragments = append(note.Fragments, frag)
+	}
+	if len(note.Fragments) == 0 {
+		return nil, &Error{Code: ErrCodeRequiredFieldMissing, Location: "OBX",
+			Text: "the document content is required in one or more OBX segments"}
+	}
+	return note, nil
+}
+
+// UniqueDocumentNumber returns TXA-12, which identifies a document across every message about it, with its assigning
+// authority, or an empty string if it was not sent.
+func UniqueDocumentNumber(m *Message) string {
+	txa := m.Segment("TXA")
+	number := txa.Component(12, 1)
+	if number == "" {
+		return ""
+	}
+	if namespace := txa.Component(12, 2); namespace != "" {
+		return namespace + ":" + number
+	}
+	return number
+}
+
+func documentType(txa *Segment) ehrpb.NoteType {
+	code := txa.Component(2, 1)
+	if txa.Component(2, 3) == "LN" {
+		return fhir.NoteTypeForLoinc(code)
+	}
+	return ehrpb.NoteType(ehrpb.NoteType_value[documentTypes[strings.ToUpper(code)]])
+}
+
+func fragmentType(obx *Segment) ehrpb.FragmentType {
+	code := obx.Component(3, 1)
+	if obx.Component(3, 3) == "LN" {
+		return fhir.FragmentTypeForLoinc(code)
+	}
+	return ehrpb.FragmentType(ehrpb.FragmentType_value[strings.ToUpper(code)])
+}
+
+// documentStatus maps the completion status (HL7 table 0271) and availability status (table 0275) of a document to
+// a record status. Authenticated and documented notes are active; those still being dictated or edited have no
+// status until they are complete; cancelled and obsolete documents are deleted.
+// RETURNS: ehrpb.RecordStatus, error (an *Error)
+func documentStatus(txa *Segment) (ehrpb.RecordStatus, error) {
+	switch availability := txa.Component(19, 1); availability {
+	case "CA", "OB":
+		return ehrpb.RecordStatus_DELETED, nil
+	case "", "AV", "UN":
+	default:
+		return 0, &Error{Code: ErrCodeTableValueNotFound, Location: "TXA-19",
+			Text: fmt.Sprintf("%q is not a document availability status", availability)}
+	}
+
+	switch completion := txa.Component(17, 1); completion {
+	case "AU", "LA", "DO":
+		return ehrpb.RecordStatus_ACTIVE, nil
+	case "DI", "IN", "IP", "PA":
+		return 0, nil
+	case "":
+		return 0, &Error{Code: ErrCodeRequiredFieldMissing, Location: "TXA-17",
+			Text: "the document completion status is required"}
+	default:
+		return 0, &Error{Code: ErrCodeTableValueNotFound, Location: "TXA-17",
+			Text: fmt.Sprintf("%q is not a document completion status", completion)}
+	}
+}
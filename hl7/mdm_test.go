@@ -0,0 +1,126 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+)
+
+const (
+	testPatient = "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c6d"
+	testVisit   = "0f1e2d3c-4b5a-4978-8695-a4b3c2d1e0f9"
+	testAuthor  = "9e8d7c6b-5a49-4382-9170-6f5e4d3c2b1a"
+)
+
+// testMdm builds an MDM^T02 message, with each replacement applied to its text.
+func testMdm(replacements ...string) []byte {
+	msg := strings.Join([]string{
+		"MSH|^~\\&|VENDOR|FACILITY|NOTECLERK|CLINIC|20190314093000||MDM^T02^MDM_T02|MSG0001|P|2.5",
+		"EVN|T02|20190314093000",
+		"PID|1||" + testPatient + "^^^NOTECLERK||Doe^Jane",
+		"PV1|1|O|||||||||||||||||" + testVisit,
+		"TXA|1|HP^History and physical^HL70270|TX|20190314090000|||||" + testAuthor +
+			"^Smith^John|||DOC123^VENDOR|||||LA||AV",
+		"OBX|1|TX|SUBJECTIVE^Chest pain||Pain began two hours ago.||||||F",
+		"OBX|2|TX|SUBJECTIVE^Chest pain||Worse on exertion.||||||F",
+		"OBX|3|FT|11348-0^Past medical history^LN||Hypertension.~Asthma.||||||F",
+		"OBX|4|TX|SUBJECTIVE^Retracted||Entered in error.||||||W",
+	}, "\r")
+	return []byte(strings.NewReplacer(replacements...).Replace(msg))
+}
+
+func parseTestMdm(t *testing.T, replacements ...string) *Message {
+	m, err := Parse(testMdm(replacements...))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return m
+}
+
+func TestMdmToNote(t *testing.T) {
+	note, err := MdmToNote(parseTestMdm(t))
+	if err != nil {
+		t.Fatalf("MdmToNote() error = %v", err)
+	}
+
+	if note.PatientGuid != testPatient || note.VisitGuid != testVisit || note.AuthorGuid != testAuthor {
+		t.Fatalf("MdmToNote() guids = %v, %v, %v", note.PatientGuid, note.VisitGuid, note.AuthorGuid)
+	}
+	if note.Type != ehrpb.NoteType_HISTORY_AND_PHYSICAL || note.Status != ehrpb.RecordStatus_ACTIVE {
+		t.Fatalf("MdmToNote() type = %v, status = %v", note.Type, note.Status)
+	}
+	if len(note.Fragments) != 3 {
+		t.Fatalf("MdmToNote() made %v fragments, want 3", len(note.Fragments))
+	}
+
+	subjective := note.Fragments[0]
+	if subjective.Topic != ehrpb.FragmentType_SUBJECTIVE || subjective.Description != "Chest pain" ||
+		subjective.Content != "Pain began two hours ago.\nWorse on exertion." {
+		t.Fatalf("MdmToNote() did not join the OBX segments of a fragment: %v", subjective)
+	}
+	history := note.Fragments[1]
+	if history.Topic != ehrpb.FragmentType_MEDICAL_HISTORY || history.Content != "Hypertension.\nAsthma." {
+		t.Fatalf("MdmToNote() did not map a LOINC section: %v", history)
+	}
+	if note.Fragments[2].Status != ehrpb.RecordStatus_DELETED {
+		t.Fatalf("MdmToNote() did not delete a fragment entered in error: %v", note.Fragments[2])
+	}
+	if got := UniqueDocumentNumber(parseTestMdm(t)); got != "VENDOR:DOC123" {
+		t.Fatalf("UniqueDocumentNumber() = %v", got)
+	}
+}
+
+func TestMdmToNote_DocumentStatus(t *testing.T) {
+	tests := []struct {
+		statuses string
+		want     ehrpb.RecordStatus
+	}{
+		{"|AU||AV", ehrpb.RecordStatus_ACTIVE},
+		{"|DO||", ehrpb.RecordStatus_ACTIVE},
+		{"|DI||AV", 0},
+		{"|IP||UN", 0},
+		{"|LA||CA", ehrpb.RecordStatus_DELETED},
+		{"|AU||OB", ehrpb.RecordStatus_DELETED},
+	}
+	for _, tt := range tests {
+		note, err := MdmToNote(parseTestMdm(t, "|LA||AV", tt.statuses))
+		if err != nil {
+			t.Fatalf("MdmToNote() with TXA-17..19 %v error = %v", tt.statuses, err)
+		}
+		if note.Status != tt.want {
+			t.Fatalf("MdmToNote() with TXA-17..19 %v status = %v, want %v", tt.statuses, note.Status, tt.want)
+		}
+	}
+}
+
+func TestMdmToNote_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		replacement []string
+		code        string
+		ack         string
+	}{
+		{"unsupported type", []string{"MDM^T02", "ADT^A01"}, ErrCodeUnsupportedMessageType, AckReject},
+		{"unsupported event", []string{"MDM^T02", "MDM^T08"}, ErrCodeUnsupportedEvent, AckReject},
+		{"no TXA", []string{"TXA|", "NTE|"}, ErrCodeSegmentSequence, AckReject},
+		{"no patient", []string{testPatient + "^^^NOTECLERK", ""}, ErrCodeRequiredFieldMissing, AckError},
+		{"no author", []string{testAuthor + "^Smith^John", ""}, ErrCodeRequiredFieldMissing, AckError},
+		{"no completion status", []string{"|LA||AV", "|||AV"}, ErrCodeRequiredFieldMissing, AckError},
+		{"unknown completion status", []string{"|LA||AV", "|ZZ||AV"}, ErrCodeTableValueNotFound, AckError},
+		{"unknown availability", []string{"|LA||AV", "|LA||ZZ"}, ErrCodeTableValueNotFound, AckError},
+		{"encapsulated data", []string{"OBX|1|TX", "OBX|1|ED"}, ErrCodeDataType, AckError},
+		{"no content", []string{"OBX|", "NTE|"}, ErrCodeRequiredFieldMissing, AckError},
+	}
+	for _, tt := range tests {
+		_, err := MdmToNote(parseTestMdm(t, tt.replacement...))
+		hl7Err, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("MdmToNote() with %v returned %v, want an *Error", tt.name, err)
+		}
+		if hl7Err.Code != tt.code || hl7Err.AckCode() != tt.ack {
+			t.Fatalf("MdmToNote() with %v returned code %v (%v), want %v (%v)", tt.name, hl7Err.Code,
+				hl7Err.AckCode(), tt.code, tt.ack)
+		}
+	}
+}
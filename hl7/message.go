@@ -0,0 +1,299 @@
+// Package hl7 parses HL7 v2 messages, maps MDM document notifications to notes, and sends and receives messages over
+// MLLP, the framing HL7 v2 interfaces use on TCP connections. Like the fhir package, it has no dependency on how notes
+// are stored or served.
+package hl7
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Delimiters are the separator and escape characters declared by a message in MSH-1 and MSH-2.
+type Delimiters struct {
+	Field        byte
+	Component    byte
+	Repetition   byte
+	Escape       byte
+	Subcomponent byte
+}
+
+// DefaultDelimiters are the delimiters recommended by the standard, and the ones used in acknowledgements.
+var DefaultDelimiters = Delimiters{Field: '|', Component: '^', Repetition: '~', Escape: '\\', Subcomponent: '&'}
+
+// Message is a parsed HL7 v2 message. Field values are kept as they were sent, and are unescaped as they are read.
+type Message struct {
+	Delimiters Delimiters
+	Segments   []*Segment
+}
+
+// Segment is one line of a message, such as its MSH or an OBX.
+type Segment struct {
+	Name       string
+	fields     []string
+	delimiters Delimiters
+}
+
+// Parse reads a message from its segments, which may be separated by carriage returns, as the standard requires, or
+// by line feeds, as they often are in files.
+// RETURNS: *Message, error
+func Parse(data []byte) (*Message, error) {
+	text := strings.Replace(strings.Replace(string(data), "\r\n", "\r", -1), "\n", "\r", -1)
+	lines := strings.Split(strings.Trim(text, "\r"), "\r")
+	if len(lines[0]) < 8 || !strings.HasPrefix(lines[0], "MSH") {
+		return nil, &Error{Code: ErrCodeSegmentSequence, Location: "MSH", Text: "the message must begin with an MSH segment"}
+	}
+
+	msh := lines[0]
+	d := Delimiters{Field: msh[3], Component: msh[4], Repetition: msh[5], Escape: msh[6], Subcomponent: msh[7]}
+	if strings.IndexByte(msh[4:8], d.Field) >= 0 {
+		return nil, &Error{Code: ErrCodeDataType, Location: "MSH-2", Text: "the encoding characters are invalid"}
+	}
+
+	m := &Message{Delimiters: d}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, string(d.Field))
+		if fields[0] == "MSH" {
+			// MSH-1 is the field separator itself, so the fields which follow it are numbered from 2
+			fields = append([]string{"MSH", string(d.Field)}, fields[1:]...)
+		}
+		m.Segments = append(m.Segments, &Segment{Name: fields[0], fields: fields, delimiters: d})
+	}
+	return m, nil
+}
+
+// Segment returns the first segment with the given name, or nil if the message has none.
+func (m *Message) Segment(name string) *Segment {
+	for _, s := range m.Segments {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Type returns the message code and trigger event from MSH-9, such as MDM and T02.
+func (m *Message) Type() (code string, trigger string) {
+	msh := m.Segment("MSH")
+	return msh.Component(9, 1), msh.Component(9, 2)
+}
+
+// ControlId returns MSH-10, which identifies the message to its sender and is echoed in its acknowledgement.
+func (m *Message) ControlId() string {
+	return m.Segment("MSH").Component(10, 1)
+}
+
+// Field returns field n exactly as it was sent, or an empty string if the segment has no such field.
+func (s *Segment) Field(n int) string {
+	if s == nil || n < 1 || n >= len(s.fields) {
+		return ""
+	}
+	return s.fields[n]
+}
+
+// Repetitions returns each repetition of field n, as sent.
+func (s *Segment) Repetitions(n int) []string {
+	field := s.Field(n)
+	if field == "" {
+		return nil
+	}
+	if s.Name == "MSH" && n <= 2 {
+		return []string{field}
+	}
+	return strings.Split(field, string(s.delimiters.Repetition))
+}
+
+// Component returns component c of the first repetition of field n, unescaped.
+func (s *Segment) Component(n int, c int) string {
+	reps := s.Repetitions(n)
+	if len(reps) == 0 {
+		return ""
+	}
+	return s.delimiters.component(reps[0], c)
+}
+
+// Text returns every repetition of field n unescaped, each on its own line. It reads the text of TX and FT values.
+func (s *Segment) Text(n int) string {
+	var lines []string
+	for _, rep := range s.Repetitions(n) {
+		lines = append(lines, s.delimiters.UnescapeText(rep))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (d Delimiters) component(value string, c int) string {
+	components := strings.Split(value, string(d.Component))
+	if c < 1 || c > len(components) {
+		return ""
+	}
+	return d.UnescapeText(components[c-1])
+}
+
+// UnescapeText replaces the escape sequences in value with the characters they stand for. Line breaks (\.br\) become
+// newlines, and other formatting and highlighting sequences are dropped.
+func (d Delimiters) UnescapeText(value string) string {
+	if strings.IndexByte(value, d.Escape) < 0 {
+		return value
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(value, d.Escape)
+		if start < 0 {
+			b.WriteString(value)
+			return b.String()
+		}
+		end := strings.IndexByte(value[start+1:], d.Escape)
+		if end < 0 {
+			b.WriteString(value)
+			return b.String()
+		}
+		b.WriteString(value[:start])
+		sequence := value[start+1 : start+1+end]
+		value = value[start+end+2:]
+
+		switch {
+		case sequence == "F":
+			b.WriteByte(d.Field)
+		case sequence == "S":
+			b.WriteByte(d.Component)
+		case sequence == "T":
+			b.WriteByte(d.Subcomponent)
+		case sequence == "R":
+			b.WriteByte(d.Repetition)
+		case sequence == "E":
+			b.WriteByte(d.Escape)
+		case sequence == ".br":
+			b.WriteByte('\n')
+		case strings.HasPrefix(sequence, "X"):
+			if decoded, err := hex.DecodeString(sequence[1:]); err == nil {
+				b.Write(decoded)
+			}
+		}
+	}
+}
+
+// EscapeText replaces the delimiters in value with escape sequences, and newlines with line breaks, so that it can be
+// sent as the text of a field.
+func (d Delimiters) EscapeText(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case d.Escape:
+			b.WriteString(string(d.Escape) + "E" + string(d.Escape))
+		case d.Field:
+			b.WriteString(string(d.Escape) + "F" + string(d.Escape))
+		case d.Component:
+			b.WriteString(string(d.Escape) + "S" + string(d.Escape))
+		case d.Subcomponent:
+			b.WriteString(string(d.Escape) + "T" + string(d.Escape))
+		case d.Repetition:
+			b.WriteString(string(d.Escape) + "R" + string(d.Escape))
+		case '\n':
+			b.WriteString(string(d.Escape) + ".br" + string(d.Escape))
+		case '\r':
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Acknowledgement codes, sent in MSA-1.
+const (
+	AckAccept = "AA"
+	AckError  = "AE"
+	AckReject = "AR"
+)
+
+// Error codes from HL7 table 0357, sent in ERR-3.
+const (
+	ErrCodeSegmentSequence        = "100"
+	ErrCodeRequiredFieldMissing   = "101"
+	ErrCodeDataType               = "102"
+	ErrCodeTableValueNotFound     = "103"
+	ErrCodeUnsupportedMessageType = "200"
+	ErrCodeUnsupportedEvent       = "201"
+	ErrCodeApplicationInternal    = "207"
+)
+
+var errCodeText = map[string]string{
+	ErrCodeSegmentSequence:        "Segment sequence error",
+	ErrCodeRequiredFieldMissing:   "Required field missing",
+	ErrCodeDataType:               "Data type error",
+	ErrCodeTableValueNotFound:     "Table value not found",
+	ErrCodeUnsupportedMessageType: "Unsupported message type",
+	ErrCodeUnsupportedEvent:       "Unsupported event code",
+	ErrCodeApplicationInternal:    "Application internal error",
+}
+
+// Error is a problem with a message, reported to its sender in the ERR segment of a negative acknowledgement.
+type Error struct {
+	Code     string
+	Location string
+	Text     string
+}
+
+func (e *Error) Error() string {
+	if e.Location == "" {
+		return e.Text
+	}
+	return fmt.Sprintf("%v: %v", e.Location, e.Text)
+}
+
+// AckCode is the acknowledgement code for a message which failed with err: AR for messages which will never be
+// accepted, such as those of an unsupported type, and AE for the rest.
+func (e *Error) AckCode() string {
+	switch e.Code {
+	case ErrCodeSegmentSequence, ErrCodeUnsupportedMessageType, ErrCodeUnsupportedEvent:
+		return AckReject
+	default:
+		return AckError
+	}
+}
+
+// Ack builds the acknowledgement of msg, addressed back to its sender and identified by controlId. The message is
+// accepted (AA) when err is nil; otherwise it is refused with the code err calls for, and err is reported in an ERR
+// segment. Msg may be nil when the message could not be parsed at all, in which case the acknowledgement has no
+// addressee.
+// RETURNS: []byte
+func Ack(msg *Message, err *Error, text string, controlId string, now time.Time) []byte {
+	d := DefaultDelimiters
+	var msh *Segment
+	trigger := ""
+	if msg != nil {
+		msh = msg.Segment("MSH")
+		_, trigger = msg.Type()
+	}
+	processingId, version := msh.Field(11), msh.Field(12)
+	if processingId == "" {
+		processingId = "P"
+	}
+	if version == "" {
+		version = "2.5"
+	}
+	code := AckAccept
+	if err != nil {
+		code = err.AckCode()
+	}
+
+	field := func(n int) string {
+		return d.EscapeText(msh.Component(n, 1))
+	}
+	segments := []string{
+		strings.Join([]string{"MSH", "^~\\&", field(5), field(6), field(3), field(4),
+			now.UTC().Format("20060102150405"), "", "ACK^" + d.EscapeText(trigger) + "^ACK", d.EscapeText(controlId),
+			d.EscapeText(processingId), d.EscapeText(version)}, "|"),
+		strings.Join([]string{"MSA", code, field(10), d.EscapeText(text)}, "|"),
+	}
+	if err != nil {
+		location := strings.Replace(d.EscapeText(err.Location), "-", "^1^", 1)
+		segments = append(segments, strings.Join([]string{"ERR", "", location,
+			err.Code + "^" + errCodeText[err.Code] + "^HL70357", "E", "", "", "", d.EscapeText(err.Text)}, "|"))
+	}
+	return []byte(strings.Join(segments, "\r") + "\r")
+}
@@ -0,0 +1,94 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte("MSH|^~\\&|VENDOR|FACILITY|NOTECLERK|CLINIC|20190314093000||MDM^T02^MDM_T02|MSG0001|P|2.5\n" +
+		"OBX|1|TX|SUBJECTIVE^Chest pain||Pain began \\T\\ worsened.\\.br\\Tender~Second line|||||F\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if code, trigger := m.Type(); code != "MDM" || trigger != "T02" || m.ControlId() != "MSG0001" {
+		t.Fatalf("Parse() type = %v^%v, control id = %v", code, trigger, m.ControlId())
+	}
+	msh := m.Segment("MSH")
+	if msh.Field(1) != "|" || msh.Field(2) != "^~\\&" || msh.Field(3) != "VENDOR" {
+		t.Fatalf("Parse() numbered the MSH fields wrongly: %v, %v, %v", msh.Field(1), msh.Field(2), msh.Field(3))
+	}
+	obx := m.Segment("OBX")
+	if obx.Component(3, 2) != "Chest pain" || obx.Component(3, 3) != "" || obx.Field(99) != "" {
+		t.Fatalf("Parse() OBX-3 = %v", obx.Field(3))
+	}
+	if got, want := obx.Text(5), "Pain began & worsened.\nTender\nSecond line"; got != want {
+		t.Fatalf("Text() = %q, want %q", got, want)
+	}
+	if m.Segment("PID") != nil || m.Segment("PID").Component(3, 1) != "" {
+		t.Fatalf("A missing segment should read as empty")
+	}
+}
+
+func TestParse_CustomDelimiters(t *testing.T) {
+	m, err := Parse([]byte("MSH#*%/!#A#B#C#D#20190314##MDM*T02#1#P#2.5\rPID###Id/S/1*Authority"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := m.Segment("PID").Component(3, 1); got != "Id*1" {
+		t.Fatalf("Component() = %q, want Id*1", got)
+	}
+}
+
+func TestParse_RejectsMessagesWithoutMsh(t *testing.T) {
+	for _, data := range []string{"", "PID|||1", "MSH|^~", "MSH|^|\\&"} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Fatalf("Parse(%q) returned no error", data)
+		}
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	value := "a|b^c&d~e\\f\ng"
+	escaped := DefaultDelimiters.EscapeText(value)
+	if escaped != "a\\F\\b\\S\\c\\T\\d\\R\\e\\E\\f\\.br\\g" {
+		t.Fatalf("EscapeText() = %q", escaped)
+	}
+	if got := DefaultDelimiters.UnescapeText(escaped); got != value {
+		t.Fatalf("UnescapeText(EscapeText()) = %q, want %q", got, value)
+	}
+	if got := DefaultDelimiters.UnescapeText("\\H\\bold\\N\\ \\X4869\\ \\unterminated"); got != "bold Hi \\unterminated" {
+		t.Fatalf("UnescapeText() = %q", got)
+	}
+}
+
+func TestAck(t *testing.T) {
+	m, err := Parse([]byte("MSH|^~\\&|VENDOR|FACILITY|NOTECLERK|CLINIC|20190314093000||MDM^T02|MSG0001|P|2.4"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	now := time.Date(2019, 3, 14, 9, 30, 1, 0, time.UTC)
+
+	ack := string(Ack(m, nil, "Created", "ACK0001", now))
+	want := "MSH|^~\\&|NOTECLERK|CLINIC|VENDOR|FACILITY|20190314093001||ACK^T02^ACK|ACK0001|P|2.4\rMSA|AA|MSG0001|Created\r"
+	if ack != want {
+		t.Fatalf("Ack() = %q, want %q", ack, want)
+	}
+
+	nack, err := Parse(Ack(m, &Error{Code: ErrCodeRequiredFieldMissing, Location: "TXA-17", Text: "a|b"}, "", "ACK2", now))
+	if err != nil {
+		t.Fatalf("Parse(Ack()) error = %v", err)
+	}
+	errSegment := nack.Segment("ERR")
+	if nack.Segment("MSA").Field(1) != AckError || errSegment.Field(2) != "TXA^1^17" ||
+		errSegment.Component(3, 1) != "101" || errSegment.Component(8, 1) != "a|b" {
+		t.Fatalf("Ack() with an error = %q", strings.Replace(string(Ack(m, nil, "", "", now)), "\r", "\n", -1))
+	}
+
+	reject := string(Ack(nil, &Error{Code: ErrCodeSegmentSequence, Text: "no MSH"}, "", "ACK3", now))
+	if !strings.Contains(reject, "\rMSA|AR||\r") {
+		t.Fatalf("Ack() of an unparsed message = %q", reject)
+	}
+}
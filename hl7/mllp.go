@@ -0,0 +1,286 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MLLP frames each message between a start block character and an end block character followed by a carriage
+// return.
+const (
+	startBlock     = 0x0b
+	endBlock       = 0x1c
+	carriageReturn = 0x0d
+)
+
+// DefaultMaxMessageSize bounds the size of a message when a Reader or Server is not given a limit.
+const DefaultMaxMessageSize = 4 << 20
+
+var (
+	// ErrMessageTooLarge is returned by Reader.ReadMessage for a message over its size limit.
+	ErrMessageTooLarge = errors.New("hl7: the MLLP message is larger than the size limit")
+
+	// ErrServerClosed is returned by Server.Serve once Shutdown has been called.
+	ErrServerClosed = errors.New("hl7: the MLLP server is closed")
+)
+
+// Reader reads MLLP framed messages.
+type Reader struct {
+	r       *bufio.Reader
+	maxSize int
+}
+
+// NewReader reads messages from r, refusing any larger than maxSize bytes, or DefaultMaxMessageSize if maxSize is
+// zero.
+func NewReader(r io.Reader, maxSize int) *Reader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+	return &Reader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+// ReadMessage returns the next message, without its framing. Anything between messages, such as the line breaks some
+// senders add, is skipped. A connection closed between messages returns io.EOF, and one closed part way through a
+// message io.ErrUnexpectedEOF.
+// RETURNS: []byte, error
+func (r *Reader) ReadMessage() ([]byte, error) {
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+
+	var msg bytes.Buffer
+	for {
+		b, err := r.r.ReadByte()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == endBlock {
+			if next, err := r.r.Peek(1); err == nil && next[0] == carriageReturn {
+				r.r.ReadByte()
+			}
+			return msg.Bytes(), nil
+		}
+		if msg.Len() >= r.maxSize {
+			return nil, ErrMessageTooLarge
+		}
+		msg.WriteByte(b)
+	}
+}
+
+// WriteMessage writes msg to w in an MLLP frame.
+// RETURNS: error
+func WriteMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 0, len(msg)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, msg...)
+	frame = append(frame, endBlock, carriageReturn)
+	_, err := w.Write(frame)
+	return err
+}
+
+// A Handler processes a message received over MLLP and returns the acknowledgement to send back. Senders wait for the
+// acknowledgement before sending their next message, so every message should be acknowledged, whatever its fate.
+type Handler func(ctx context.Context, msg []byte, remoteAddr net.Addr) []byte
+
+// Server receives messages over MLLP, passing each to its Handler and replying with the acknowledgement.
+type Server struct {
+	Handler        Handler
+	MaxMessageSize int
+
+	// ErrorLog, when set, is told of connections which fail other than by being closed.
+	ErrorLog func(err error)
+
+	mu       sync.Mutex
+	closing  bool
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// Serve accepts connections on lis until Shutdown is called, handling each on its own goroutine.
+// RETURNS: error, ErrServerClosed after Shutdown
+func (s *Server) Serve(lis net.Listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		lis.Close()
+		return ErrServerClosed
+	}
+	s.listener = lis
+	s.conns = make(map[net.Conn]struct{})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.mu.Unlock()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			s.mu.Unlock()
+			if closing {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := NewReader(conn, s.MaxMessageSize)
+	for {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			s.mu.Unlock()
+			if err != io.EOF && !closing && s.ErrorLog != nil {
+				s.ErrorLog(err)
+			}
+			return
+		}
+		if err := WriteMessage(conn, s.Handler(s.ctx, msg, conn.RemoteAddr())); err != nil {
+			if s.ErrorLog != nil {
+				s.ErrorLog(err)
+			}
+			return
+		}
+	}
+}
+
+// Shutdown stops accepting connections and interrupts those waiting for a message, then waits for the messages being
+// handled to be acknowledged. If ctx is done first, the remaining connections are closed and their handlers'
+// context cancelled; their senders, not having been acknowledged, will send those messages again.
+// RETURNS: error
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Client sends messages over an MLLP connection, one at a time.
+type Client struct {
+	conn    net.Conn
+	r       *Reader
+	timeout time.Duration
+}
+
+// Dial connects to an MLLP server at address, a host:port. Each message sent must be acknowledged within timeout.
+// RETURNS: *Client, error
+func Dial(address string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: NewReader(conn, 0), timeout: timeout}, nil
+}
+
+// Send sends msg and waits for its acknowledgement.
+// RETURNS: *Message, the acknowledgement, error
+func (c *Client) Send(msg []byte) (*Message, error) {
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	if err := WriteMessage(c.conn, msg); err != nil {
+		return nil, err
+	}
+	ack, err := c.r.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(ack)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// SplitMessages splits a file of messages, each beginning with its MSH segment and on lines of its own, into
+// messages with their segments separated by carriage returns.
+func SplitMessages(data []byte) [][]byte {
+	text := bytes.Replace(bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1), []byte("\r"), []byte("\n"), -1)
+	var messages [][]byte
+	var current [][]byte
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("MSH")) && len(current) > 0 {
+			messages = append(messages, append(bytes.Join(current, []byte("\r")), carriageReturn))
+			current = nil
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		messages = append(messages, append(bytes.Join(current, []byte("\r")), carriageReturn))
+	}
+	return messages
+}
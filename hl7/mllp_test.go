@@ -0,0 +1,149 @@
+package hl7
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	stream := "\r\n\x0bfirst\rmessage\x1c\r\x0bsecond\x1c\x0bthird"
+	r := NewReader(strings.NewReader(stream), 0)
+
+	for _, want := range []string{"first\rmessage", "second"} {
+		msg, err := r.ReadMessage()
+		if err != nil || string(msg) != want {
+			t.Fatalf("ReadMessage() = %q, %v, want %q", msg, err, want)
+		}
+	}
+	if _, err := r.ReadMessage(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("ReadMessage() of a truncated message returned %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, err := r.ReadMessage(); err != io.EOF {
+		t.Fatalf("ReadMessage() at the end returned %v, want io.EOF", err)
+	}
+
+	r = NewReader(strings.NewReader("\x0b12345\x1c\r"), 4)
+	if _, err := r.ReadMessage(); err != ErrMessageTooLarge {
+		t.Fatalf("ReadMessage() of a large message returned %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, []byte("MSH|")); err != nil {
+		t.Fatalf("WriteMessage() error = %v", err)
+	}
+	if buf.String() != "\x0bMSH|\x1c\r" {
+		t.Fatalf("WriteMessage() wrote %q", buf.String())
+	}
+}
+
+func TestSplitMessages(t *testing.T) {
+	messages := SplitMessages([]byte("MSH|1\r\nPID|1\n\nMSH|2\rPID|2\r"))
+	if len(messages) != 2 || string(messages[0]) != "MSH|1\rPID|1\r" || string(messages[1]) != "MSH|2\rPID|2\r" {
+		t.Fatalf("SplitMessages() = %q", messages)
+	}
+}
+
+func startTestServer(t *testing.T, handler Handler) (*Server, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &Server{Handler: handler}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(lis) }()
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+		if err := <-served; err != ErrServerClosed {
+			t.Errorf("Serve() returned %v, want ErrServerClosed", err)
+		}
+	})
+	return srv, lis.Addr().String()
+}
+
+func TestServerAndClient(t *testing.T) {
+	_, address := startTestServer(t, func(ctx context.Context, msg []byte, remoteAddr net.Addr) []byte {
+		m, err := Parse(msg)
+		if err != nil {
+			return Ack(nil, err.(*Error), "", "ACK", time.Now())
+		}
+		return Ack(m, nil, "Received "+m.ControlId(), "ACK", time.Now())
+	})
+
+	client, err := Dial(address, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	for _, id := range []string{"1", "2"} {
+		ack, err := client.Send([]byte("MSH|^~\\&|A|B|C|D|20190314||MDM^T02|" + id + "|P|2.5\r"))
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		if msa := ack.Segment("MSA"); msa.Field(1) != AckAccept || msa.Field(2) != id {
+			t.Fatalf("Send() acknowledgement MSA = %v|%v", msa.Field(1), msa.Field(2))
+		}
+	}
+
+	ack, err := client.Send([]byte("not hl7"))
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if ack.Segment("MSA").Field(1) != AckReject {
+		t.Fatalf("Send() of a malformed message was not rejected")
+	}
+}
+
+func TestServerShutdown_WaitsForMessagesBeingHandled(t *testing.T) {
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	srv, address := startTestServer(t, func(ctx context.Context, msg []byte, remoteAddr net.Addr) []byte {
+		close(handling)
+		<-release
+		return []byte("MSH|^~\\&|||||||ACK|1|P|2.5\rMSA|AA|1\r")
+	})
+
+	idle, err := Dial(address, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer idle.Close()
+	busy, err := Dial(address, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer busy.Close()
+
+	acked := make(chan error, 1)
+	go func() {
+		_, err := busy.Send([]byte("MSH|^~\\&|||||||MDM^T02|1|P|2.5\r"))
+		acked <- err
+	}()
+	<-handling
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown() returned %v before the message being handled was acknowledged", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-acked; err != nil {
+		t.Fatalf("The message being handled during Shutdown was not acknowledged: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if _, err := idle.Send([]byte("MSH|^~\\&|||||||MDM^T02|2|P|2.5\r")); err == nil {
+		t.Fatalf("An idle connection was still served after Shutdown")
+	}
+}
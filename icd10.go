@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+)
+
+// Default and maximum number of results returned by an ICD-10-CM code search.
+const (
+	DefaultIcd10SearchLimit = 20
+	MaxIcd10SearchLimit     = 100
+)
+
+// Icd10Code is a single ICD-10-CM code in its dotted form, e.g. 'J45.909', with its long description.
+type Icd10Code struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// Icd10CodeSet is an in-memory copy of the CMS ICD-10-CM code table. It is read-only once loaded and safe for
+// concurrent use. Codes are keyed in their undotted, upper case form, as they appear in the CMS files.
+type Icd10CodeSet struct {
+	descriptions map[string]string
+	sorted       []string
+}
+
+// LoadIcd10CodeSet reads a CMS ICD-10-CM flat file from disk. See ParseIcd10CodeSet for the supported formats.
+// RETURNS: *Icd10CodeSet, error
+func LoadIcd10CodeSet(path string) (*Icd10CodeSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrLoadIcd10CodeSetFailsOpenFile, path)
+	}
+	defer file.Close()
+
+	return ParseIcd10CodeSet(file)
+}
+
+// ParseIcd10CodeSet reads either of the CMS flat files: the codes file (icd10cm_codes_<year>.txt), where each line is a
+// code followed by its description, or the fixed width order file (icd10cm_order_<year>.txt), which also carries the
+// non-billable header codes.
+// RETURNS: *Icd10CodeSet, error
+func ParseIcd10CodeSet(r io.Reader) (*Icd10CodeSet, error) {
+	set := &Icd10CodeSet{descriptions: make(map[string]string)}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		code, description := parseIcd10Line(scanner.Text())
+		if code == "" || description == "" {
+			continue
+		}
+		if _, ok := set.descriptions[code]; !ok {
+			set.sorted = append(set.sorted, code)
+		}
+		set.descriptions[code] = description
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, NoteClerkErrWrap(err, ErrParseIcd10CodeSetFailsRead)
+	}
+
+	sort.Strings(set.sorted)
+	return set, nil
+}
+
+// parseIcd10Line splits a line of either CMS file into its undotted code and long description.
+func parseIcd10Line(line string) (code string, description string) {
+	line = strings.TrimRight(line, "\r\n ")
+
+	// Order file: 5 digit order number, code (7 wide), header flag, short description (60 wide), long description.
+	if len(line) > 77 && isDigits(line[0:5]) {
+		return normalizeIcd10Code(line[6:13]), strings.TrimSpace(line[77:])
+	}
+
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if len(fields) != 2 {
+		return "", ""
+	}
+	return normalizeIcd10Code(fields[0]), strings.TrimSpace(fields[1])
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns the number of codes in the set.
+func (s *Icd10CodeSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.sorted)
+}
+
+// Lookup finds a code, written with or without its dot and in any case.
+// RETURNS: Icd10Code, bool (false when the code is not in the set)
+func (s *Icd10CodeSet) Lookup(code string) (Icd10Code, bool) {
+	if s == nil {
+		return Icd10Code{}, false
+	}
+	key := normalizeIcd10Code(code)
+	description, ok := s.descriptions[key]
+	if !ok {
+		return Icd10Code{}, false
+	}
+	return Icd10Code{Code: formatIcd10Code(key), Description: description}, true
+}
+
+// Search supports autocomplete. A query that looks like a code matches codes beginning with it; any other query
+// matches descriptions containing every word of the query. Results are ordered by code.
+// RETURNS: []Icd10Code
+func (s *Icd10CodeSet) Search(query string, limit int) []Icd10Code {
+	results := make([]Icd10Code, 0)
+	if s == nil || strings.TrimSpace(query) == "" {
+		return results
+	}
+	if limit <= 0 {
+		limit = DefaultIcd10SearchLimit
+	}
+	if limit > MaxIcd10SearchLimit {
+		limit = MaxIcd10SearchLimit
+	}
+
+	if looksLikeIcd10Code(query) {
+		prefix := normalizeIcd10Code(query)
+		for i := sort.SearchStrings(s.sorted, prefix); i < len(s.sorted) && len(results) < limit; i++ {
+			if !strings.HasPrefix(s.sorted[i], prefix) {
+				break
+			}
+			results = append(results, Icd10Code{Code: formatIcd10Code(s.sorted[i]), Description: s.descriptions[s.sorted[i]]})
+		}
+		return results
+	}
+
+	words := strings.Fields(strings.ToLower(query))
+	for _, code := range s.sorted {
+		if len(results) >= limit {
+			break
+		}
+		description := strings.ToLower(s.descriptions[code])
+		matches := true
+		for _, w := range words {
+			if !strings.Contains(description, w) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			results = append(results, Icd10Code{Code: formatIcd10Code(code), Description: s.descriptions[code]})
+		}
+	}
+	return results
+}
+
+// FillNoteFragments normalizes the ICD-10-CM code of each fragment to its dotted form and fills in a missing long
+// description from the code set. Fragments with unknown codes are left untouched; rejecting them is the job of the
+// validation layer.
+func (s *Icd10CodeSet) FillNoteFragments(frags []*ehrpb.NoteFragment) {
+	for _, v := range frags {
+		found, ok := s.Lookup(v.GetIcd_10Code())
+		if !ok {
+			continue
+		}
+		v.Icd_10Code = found.Code
+		if strings.TrimSpace(v.GetIcd_10Long()) == "" {
+			v.Icd_10Long = found.Description
+		}
+	}
+}
+
+// DescriptionMatches reports whether description is the long description of code, ignoring case and surrounding
+// whitespace.
+func (c Icd10Code) DescriptionMatches(description string) bool {
+	return strings.EqualFold(strings.TrimSpace(description), c.Description)
+}
+
+// normalizeIcd10Code converts a code such as 'j45.909 ' to the undotted upper case key 'J45909'.
+func normalizeIcd10Code(code string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(code), ".", "", -1))
+}
+
+// formatIcd10Code converts an undotted key such as 'J45909' to its dotted display form 'J45.909'.
+func formatIcd10Code(key string) string {
+	if len(key) <= 3 {
+		return key
+	}
+	return key[:3] + "." + key[3:]
+}
+
+// looksLikeIcd10Code reports whether a query begins like a code: a letter followed by a digit.
+func looksLikeIcd10Code(query string) bool {
+	q := []rune(normalizeIcd10Code(query))
+	return len(q) >= 2 && unicode.IsLetter(q[0]) && unicode.IsDigit(q[1]) && !strings.Contains(query, " ")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/geekmdio/noted"
+)
+
+const icd10CodesFile = `A000    Cholera due to Vibrio cholerae 01, biovar cholerae
+J45901  Unspecified asthma with (acute) exacerbation
+J45902  Unspecified asthma with status asthmaticus
+J45909  Unspecified asthma, uncomplicated
+R05     Cough
+`
+
+func buildIcd10CodeSet(t *testing.T) *Icd10CodeSet {
+	set, err := ParseIcd10CodeSet(strings.NewReader(icd10CodesFile))
+	if err != nil {
+		t.Fatalf("Failed to parse ICD-10-CM codes. Error: %v", err)
+	}
+	return set
+}
+
+func TestParseIcd10CodeSet_CodesFile(t *testing.T) {
+	set := buildIcd10CodeSet(t)
+
+	if set.Len() != 5 {
+		t.Fatalf("Expected 5 codes, but got %v", set.Len())
+	}
+
+	code, ok := set.Lookup("j45.909")
+	if !ok {
+		t.Fatalf("Lookup should ignore case and the dot.")
+	}
+	if code.Code != "J45.909" || code.Description != "Unspecified asthma, uncomplicated" {
+		t.Fatalf("Unexpected code %v", code)
+	}
+}
+
+func TestParseIcd10CodeSet_OrderFile(t *testing.T) {
+	line := fmt.Sprintf("%05d %-7s %v %-60s %v\n", 12, "R05", 1, "Cough", "Cough")
+	set, err := ParseIcd10CodeSet(strings.NewReader(line))
+	if err != nil {
+		t.Fatalf("Failed to parse order file line. Error: %v", err)
+	}
+
+	code, ok := set.Lookup("R05")
+	if !ok || code.Description != "Cough" {
+		t.Fatalf("Expected R05 Cough from the order file, but got %v", code)
+	}
+}
+
+func TestIcd10CodeSet_Search_ByCodePrefix(t *testing.T) {
+	results := buildIcd10CodeSet(t).Search("J45.90", 2)
+
+	if len(results) != 2 || results[0].Code != "J45.901" || results[1].Code != "J45.902" {
+		t.Fatalf("Expected the first two J45.90 codes in order, but got %v", results)
+	}
+}
+
+func TestIcd10CodeSet_Search_ByDescriptionWords(t *testing.T) {
+	results := buildIcd10CodeSet(t).Search("asthma exacerbation", 0)
+
+	if len(results) != 1 || results[0].Code != "J45.901" {
+		t.Fatalf("Expected only J45.901, but got %v", results)
+	}
+}
+
+func TestIcd10CodeSet_FillNoteFragments_FillsMissingDescription(t *testing.T) {
+	frag := noted.NewNoteFragment()
+	frag.Icd_10Code = "r05"
+
+	buildIcd10CodeSet(t).FillNoteFragments([]*ehrpb.NoteFragment{frag})
+
+	if frag.Icd_10Code != "R05" || frag.Icd_10Long != "Cough" {
+		t.Fatalf("Expected code R05 with description Cough, but got %v %v", frag.Icd_10Code, frag.Icd_10Long)
+	}
+}
+
+func TestValidateRequest_RejectsUnknownIcd10CodeAndMismatchedDescription(t *testing.T) {
+	note := buildValidNote()
+	note.Fragments[0].Icd_10Code = "ZZZ.999"
+	second := noted.NewNoteFragment()
+	second.Icd_10Code = "R05"
+	second.Icd_10Long = "Fracture of femur"
+	note.Fragments = append(note.Fragments, second)
+
+	err := validateRequest(&ehrpb.CreateNoteRequest{Note: note}, ContentLimits{}, buildIcd10CodeSet(t))
+
+	fields := violatedFields(t, err)
+	if !fields["note.fragments[0].icd_10code"] || !fields["note.fragments[1].icd_10long"] {
+		t.Fatalf("Expected violations for the unknown code and the mismatched description, but got %v", fields)
+	}
+}
+
+func TestNoteClerkServer_LookupIcd10Codes_WithoutCodeSet_ReturnsError(t *testing.T) {
+	s := &Server{}
+
+	if _, err := s.LookupIcd10Codes(context.Background(), &clerkpb.LookupIcd10CodesRequest{Query: "R05"}); err == nil {
+		t.Fatalf("Lookup should fail when no code set is loaded.")
+	}
+}
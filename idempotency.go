@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// Clients retrying CreateNote send the same value in this request metadata header on every attempt. Repeated
+// requests with the same key return the response of the first request rather than creating another note.
+const IdempotencyKeyHeader = "idempotency-key"
+
+// DefaultIdempotencyKeyTtl is how long a key, and the response recorded for it, are kept when the configuration does
+// not say otherwise.
+const DefaultIdempotencyKeyTtl = 24 * time.Hour
+
+// MaxIdempotencyKeyLength matches the width of the idempotency_key.key column.
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyRecord is the stored outcome of a CreateNote call made with an idempotency key. Keys are scoped to the
+// principal which sent them, so two clients choosing the same key do not see each other's responses. The response is
+// recorded in the transaction which adds the note; Response is only nil for keys reserved by earlier versions, which
+// recorded it separately.
+type IdempotencyRecord struct {
+	Principal   string
+	Key         string
+	Fingerprint string
+	Response    *ehrpb.CreateNoteResponse
+	ExpiresAt   time.Time
+}
+
+// idempotencyKeyFromContext returns the idempotency key sent in the incoming request metadata, or an empty string.
+func idempotencyKeyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(IdempotencyKeyHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// fingerprintNote hashes the note as the client sent it, so a key reused for a different note can be detected.
+func fingerprintNote(note *ehrpb.Note) (string, error) {
+	b, err := proto.Marshal(note)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// purgeExpiredIdempotencyKeys periodically removes expired idempotency keys until stop is closed.
+func purgeExpiredIdempotencyKeys(db RDBMSAccessor, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			purged, err := db.DeleteExpiredIdempotencyKeys(now)
+			if err != nil {
+				log.Warn(NoteClerkErrWrap(err, ErrPurgeExpiredIdempotencyKeysFailsDelete))
+				continue
+			}
+			if purged > 0 {
+				log.Debugf("Purged %v expired idempotency keys.", purged)
+			}
+		}
+	}
+}
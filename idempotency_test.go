@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func contextWithIdempotencyKey(key string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyHeader, key))
+}
+
+func TestNoteClerkServer_CreateNote_WithRepeatedIdempotencyKey_ReturnsOriginalResponse(t *testing.T) {
+	s := &Server{}
+	s.Initialize(&Config{}, mockDb)
+	ctx := contextWithIdempotencyKey("retry")
+
+	note := buildValidNote()
+	retriedNote := proto.Clone(note).(*ehrpb.Note)
+
+	first, err := s.CreateNote(ctx, &ehrpb.CreateNoteRequest{Note: note})
+	if err != nil {
+		t.Fatalf("Error creating a new note, err %v", err)
+	}
+	notesAfterFirst, _ := s.db.AllNotes()
+
+	second, err := s.CreateNote(ctx, &ehrpb.CreateNoteRequest{Note: retriedNote})
+	if err != nil {
+		t.Fatalf("A retry with the same idempotency key should succeed, err %v", err)
+	}
+	if second.Note.GetNoteGuid() != first.Note.GetNoteGuid() {
+		t.Fatalf("The retry should return the original note %v, but returned %v",
+			first.Note.GetNoteGuid(), second.Note.GetNoteGuid())
+	}
+
+	notesAfterRetry, _ := s.db.AllNotes()
+	if len(notesAfterRetry) != len(notesAfterFirst) {
+		t.Fatalf("The retry should not add a note, but the note count went from %v to %v",
+			len(notesAfterFirst), len(notesAfterRetry))
+	}
+}
+
+func TestNoteClerkServer_CreateNote_WithIdempotencyKeyReusedForDifferentNote_ReturnsError(t *testing.T) {
+	s := &Server{}
+	s.Initialize(&Config{}, mockDb)
+	ctx := contextWithIdempotencyKey("reused")
+
+	if _, err := s.CreateNote(ctx, &ehrpb.CreateNoteRequest{Note: buildValidNote()}); err != nil {
+		t.Fatalf("Error creating a new note, err %v", err)
+	}
+
+	_, err := s.CreateNote(ctx, &ehrpb.CreateNoteRequest{Note: buildValidNote()})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Reusing a key for a different note should fail with FailedPrecondition, but got %v", err)
+	}
+}
+
+func TestNoteClerkServer_CreateNote_WithSameIdempotencyKeyFromAnotherPrincipal_CreatesNote(t *testing.T) {
+	s := &Server{}
+	s.Initialize(&Config{}, mockDb)
+	ctx := contextWithIdempotencyKey("shared")
+
+	first, err := s.CreateNote(contextWithPrincipal(ctx, "first-client"), &ehrpb.CreateNoteRequest{Note: buildValidNote()})
+	if err != nil {
+		t.Fatalf("Error creating a new note, err %v", err)
+	}
+
+	second, err := s.CreateNote(contextWithPrincipal(ctx, "second-client"), &ehrpb.CreateNoteRequest{Note: buildValidNote()})
+	if err != nil {
+		t.Fatalf("Another principal's key should not conflict with the first, err %v", err)
+	}
+	if second.Note.GetNoteGuid() == first.Note.GetNoteGuid() {
+		t.Fatalf("Another principal should not receive the first principal's response.")
+	}
+}
+
+func TestNoteClerkServer_Initialize_WithInvalidIdempotencyKeyTtl_ReturnsError(t *testing.T) {
+	s := &Server{}
+	if err := s.Initialize(&Config{IdempotencyKeyTtl: "tomorrow"}, mockDb); err == nil {
+		t.Fatalf("Initialize should reject an IdempotencyKeyTtl which is not a duration.")
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/geekmdio/noted"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultImportBatchSize is how many notes are added to the database in each transaction of an import.
+const DefaultImportBatchSize = 500
+
+// MaxImportBatchSize bounds ImportNotesRequest.BatchSize and the import command's -batch flag.
+const MaxImportBatchSize = 10000
+
+// ImportFailure is a record which could not be imported, identified by its line in the input.
+type ImportFailure struct {
+	Line     int    `json:"line"`
+	NoteGuid string `json:"note_guid,omitempty"`
+	Error    string `json:"error"`
+	Record   string `json:"record,omitempty"`
+}
+
+// ImportSummary counts the records of an import. Lines is the last line of the input committed, from which an
+// interrupted import is resumed.
+type ImportSummary struct {
+	Lines    int `json:"lines"`
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// importRejectedError reports that the database refused the notes being imported because of what they contain, for
+// instance a fragment GUID which is already taken, rather than because it failed.
+type importRejectedError struct {
+	err error
+}
+
+func (e *importRejectedError) Error() string {
+	return e.err.Error()
+}
+
+// importEntry is a note to import and the line of the input it was read from.
+type importEntry struct {
+	note   *ehrpb.Note
+	line   int
+	record string
+}
+
+// importNamespace is the UUID namespace of the GUIDs derived from imported records which have none.
+var importNamespace = uuid.MustParse("a0b3f180-c7dc-454a-95de-853b7245361a")
+
+// noteImporter adds notes read from NDJSON, one ehrpb.Note per line in the protobuf JSON encoding, to the database.
+// Unlike CreateNote it keeps the GUIDs and creation dates the notes carry, only assigning those which are missing, so
+// that notes can be moved from another system without breaking references to them. Notes whose GUID is already in the
+// database are skipped, so an import can safely be run again. Imported notes are historical, so no note events are
+// recorded for them.
+type noteImporter struct {
+	db        RDBMSAccessor
+	limits    ContentLimits
+	icd10     *Icd10CodeSet
+	batchSize int
+
+	// committed is called after each batch with the last line it covers and the records of the batch which failed,
+	// so that they can be recorded before the import moves on. An error stops the import.
+	committed func(line int, failures []*ImportFailure) error
+}
+
+// importNotes imports the records read from r, skipping its first skipLines lines, which an earlier import committed.
+// RETURNS: *ImportSummary, error
+func (im *noteImporter) importNotes(ctx context.Context, r io.Reader, skipLines int) (*ImportSummary, error) {
+	summary := &ImportSummary{Lines: skipLines}
+	reader := bufio.NewReader(r)
+	var batch []*importEntry
+	var failures []*ImportFailure
+	line := 0
+
+	flush := func() error {
+		if len(batch) > 0 || len(failures) > 0 {
+			batchFailures, err := im.addBatch(batch, summary)
+			if err != nil {
+				return NoteClerkErrWrap(err, ErrImportNotesFailsBatch, summary.Lines+1, line, summary.Lines)
+			}
+			failures = append(failures, batchFailures...)
+		}
+		summary.Failed += len(failures)
+		if im.committed != nil {
+			if err := im.committed(line, failures); err != nil {
+				return NoteClerkErrWrap(err, ErrImportNotesFailsRecordProgress, line)
+			}
+		}
+		summary.Lines = line
+		batch, failures = nil, nil
+		return nil
+	}
+
+	guids := make(map[string]bool)
+	for {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return summary, NoteClerkErrWrap(readErr, ErrImportNotesFailsRead, line+1)
+		}
+		if len(data) > 0 {
+			line++
+		}
+		record := bytes.TrimSpace(data)
+		if line > skipLines && len(record) > 0 {
+			note, failure := im.parse(record, line)
+			switch {
+			case failure != nil:
+				failures = append(failures, failure)
+			case guids[note.GetNoteGuid()]:
+				failures = append(failures, &ImportFailure{Line: line, NoteGuid: note.GetNoteGuid(),
+					Error: NoteClerkErrNew(ErrImportNotesFailsDuplicate, note.GetNoteGuid()).Error(), Record: string(record)})
+			default:
+				guids[note.GetNoteGuid()] = true
+				batch = append(batch, &importEntry{note: note, line: line, record: string(record)})
+			}
+		}
+
+		if len(batch)+len(failures) >= im.batchSize || (readErr == io.EOF && line > summary.Lines) {
+			if err := flush(); err != nil {
+				return summary, err
+			}
+			guids = make(map[string]bool)
+		}
+		if readErr == io.EOF {
+			return summary, nil
+		}
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+	}
+}
+
+// parse reads and validates the note on a line of the input, assigning a GUID and creation date to the note and its
+// fragments where they have none. The GUIDs assigned are derived from the record, so that importing it again, after an
+// interruption or a retry, finds the note already present. Ids are assigned by the database, so any the record carries
+// are dropped.
+// RETURNS: *ehrpb.Note, or the failure of the record
+func (im *noteImporter) parse(record []byte, line int) (*ehrpb.Note, *ImportFailure) {
+	note := &ehrpb.Note{}
+	if err := jsonpb.Unmarshal(bytes.NewReader(record), note); err != nil {
+		return nil, &ImportFailure{Line: line, Error: NoteClerkErrWrap(err, ErrImportNotesFailsParse).Error(),
+			Record: string(record)}
+	}
+
+	note.Id = 0
+	if note.GetNoteGuid() == "" {
+		note.NoteGuid = uuid.NewSHA1(importNamespace, record).String()
+	}
+	if note.GetDateCreated() == nil {
+		note.DateCreated = noted.TimestampNow()
+	}
+	for k, v := range note.GetFragments() {
+		if v == nil {
+			continue
+		}
+		v.Id = 0
+		if v.GetNoteFragmentGuid() == "" {
+			v.NoteFragmentGuid = uuid.NewSHA1(importNamespace, []byte(fmt.Sprintf("%s\n%v", record, k))).String()
+		}
+		if v.GetDateCreated() == nil {
+			v.DateCreated = note.GetDateCreated()
+		}
+	}
+
+	if err := validateRequest(&ehrpb.CreateNoteRequest{Note: note}, im.limits, im.icd10); err != nil {
+		return nil, &ImportFailure{Line: line, NoteGuid: note.GetNoteGuid(), Error: status.Convert(err).Message(),
+			Record: string(record)}
+	}
+	for _, v := range note.GetFragments() {
+		v.NoteGuid = note.GetNoteGuid()
+	}
+	im.icd10.FillNoteFragments(note.GetFragments())
+	return note, nil
+}
+
+// addBatch adds a batch of notes in one transaction. When the database rejects the batch, its notes are added one at
+// a time, so that only those at fault fail.
+// RETURNS: []*ImportFailure, error (when the database fails, rather than rejects notes)
+func (im *noteImporter) addBatch(batch []*importEntry, summary *ImportSummary) ([]*ImportFailure, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+	notes := make([]*ehrpb.Note, len(batch))
+	for k, v := range batch {
+		notes[k] = v.note
+	}
+	skipped, err := im.db.ImportNotes(notes)
+	if err == nil {
+		summary.Imported += len(batch) - len(skipped)
+		summary.Skipped += len(skipped)
+		return nil, nil
+	}
+	if _, rejected := errors.Cause(err).(*importRejectedError); !rejected {
+		return nil, err
+	}
+	if len(batch) == 1 {
+		return []*ImportFailure{{Line: batch[0].line, NoteGuid: batch[0].note.GetNoteGuid(), Error: err.Error(),
+			Record: batch[0].record}}, nil
+	}
+
+	var failures []*ImportFailure
+	for k := range batch {
+		f, err := im.addBatch(batch[k:k+1], summary)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, f...)
+	}
+	return failures, nil
+}
+
+// ImportNotes is a method contracted by the ClerkServiceServer interface. It imports the NDJSON notes in the
+// ImportNotesRequest as the import command does, in batches of BatchSize. Notes already in the database are skipped,
+// so a request which failed part way can be sent again. The ImportNotesResponse counts the records and lists those
+// which failed.
+// RETURNS: ImportNotesResponse, error
+func (n *Server) ImportNotes(ctx context.Context, req *clerkpb.ImportNotesRequest) (*clerkpb.ImportNotesResponse, error) {
+	settings := n.settings()
+	res := &clerkpb.ImportNotesResponse{}
+	im := &noteImporter{
+		db:        n.writer(ctx),
+		limits:    settings.limits,
+		icd10:     settings.icd10,
+		batchSize: int(req.BatchSize),
+		committed: func(line int, failures []*ImportFailure) error {
+			for _, v := range failures {
+				res.Failures = append(res.Failures, &clerkpb.ImportFailure{Line: int32(v.Line), NoteGuid: v.NoteGuid,
+					Error: v.Error, Record: v.Record})
+			}
+			return nil
+		},
+	}
+	if im.batchSize == 0 {
+		im.batchSize = DefaultImportBatchSize
+	}
+
+	summary, err := im.importNotes(ctx, strings.NewReader(req.Records), 0)
+	if err != nil {
+		loggerFromContext(ctx).Warn(err)
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	res.Lines, res.Imported = int32(summary.Lines), int32(summary.Imported)
+	res.Skipped, res.Failed = int32(summary.Skipped), int32(summary.Failed)
+	loggerFromContext(ctx).Infof("Imported %v notes, skipped %v already present and rejected %v.", summary.Imported,
+		summary.Skipped, summary.Failed)
+	return res, nil
+}
+
+// importCheckpoint records how far the import of a file, by its absolute path, has been committed.
+type importCheckpoint struct {
+	File  string `json:"file"`
+	Lines int    `json:"lines"`
+}
+
+// importCommand imports the notes in an NDJSON file into the database configured for the current
+// NOTECLERK_ENVIRONMENT. Records which fail are appended to an error file, one JSON object per line, and the number of
+// lines committed is kept in a checkpoint file, so an interrupted import carries on where it left off when run again.
+// The checkpoint is removed once the file has been imported.
+//
+//	noteclerk import [-batch n] [-errors path] [-checkpoint path] notes.ndjson
+func importCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(out)
+	batchSize := flags.Int("batch", DefaultImportBatchSize, "number of notes added in each transaction")
+	errorsPath := flags.String("errors", "", "file the records which fail are appended to (default <file>.errors.ndjson)")
+	checkpointPath := flags.String("checkpoint", "", "file the progress of the import is kept in (default <file>.checkpoint)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || *batchSize < 1 || *batchSize > MaxImportBatchSize {
+		return NoteClerkErrNew(ErrImportCommandFailsArguments, strings.Join(flags.Args(), " "))
+	}
+	path := flags.Arg(0)
+	if *errorsPath == "" {
+		*errorsPath = path + ".errors.ndjson"
+	}
+	if *checkpointPath == "" {
+		*checkpointPath = path + ".checkpoint"
+	}
+
+	config, err := LoadConfiguration(configPath)
+	if err != nil {
+		return err
+	}
+	settings, err := newServerSettings(config)
+	if err != nil {
+		return err
+	}
+	db := &DbPostgres{}
+	if err := db.Initialize(config); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	im := &noteImporter{db: instrumentDb(db), limits: settings.limits, icd10: settings.icd10, batchSize: *batchSize}
+	return runImport(im, path, *errorsPath, *checkpointPath, out)
+}
+
+// runImport imports the file at path as the import command does.
+// RETURNS: error
+func runImport(im *noteImporter, path string, errorsPath string, checkpointPath string, out io.Writer) error {
+	input, err := os.Open(path)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrImportCommandFailsOpenFile, path)
+	}
+	defer input.Close()
+
+	file, err := filepath.Abs(path)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrImportCommandFailsOpenFile, path)
+	}
+	checkpoint := &importCheckpoint{File: file}
+	if data, err := ioutil.ReadFile(checkpointPath); err == nil {
+		if err := json.Unmarshal(data, checkpoint); err != nil {
+			return NoteClerkErrWrap(err, ErrImportCommandFailsReadCheckpoint, checkpointPath)
+		}
+		// The lines counted belong to another file, so skipping them here would drop notes which were never imported
+		if checkpointFile, err := filepath.Abs(checkpoint.File); err != nil || checkpointFile != file {
+			return NoteClerkErrNew(ErrImportCommandFailsCheckpointFile, checkpointPath, checkpoint.File, path)
+		}
+		fmt.Fprintf(out, "Resuming the import of %v after line %v.\n", path, checkpoint.Lines)
+	} else if !os.IsNotExist(err) {
+		return NoteClerkErrWrap(err, ErrImportCommandFailsReadCheckpoint, checkpointPath)
+	}
+
+	errorFile, err := os.OpenFile(errorsPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrImportCommandFailsOpenFile, errorsPath)
+	}
+	defer errorFile.Close()
+
+	// Failures are written before the checkpoint moves past them, so none are lost if the import is interrupted
+	im.committed = func(line int, failures []*ImportFailure) error {
+		encoder := json.NewEncoder(errorFile)
+		for _, v := range failures {
+			if err := encoder.Encode(v); err != nil {
+				return err
+			}
+		}
+		if err := errorFile.Sync(); err != nil {
+			return err
+		}
+		checkpoint.Lines = line
+		data, _ := json.Marshal(checkpoint)
+		if err := ioutil.WriteFile(checkpointPath+".tmp", data, 0600); err != nil {
+			return err
+		}
+		return os.Rename(checkpointPath+".tmp", checkpointPath)
+	}
+
+	summary, err := im.importNotes(context.Background(), input, checkpoint.Lines)
+	fmt.Fprintf(out, "imported  %v\nskipped   %v (already present)\nfailed    %v\n", summary.Imported,
+		summary.Skipped, summary.Failed)
+	if err != nil {
+		return err
+	}
+	os.Remove(checkpointPath)
+	if summary.Failed > 0 {
+		return NoteClerkErrNew(ErrImportCommandFindsFailedRecords, summary.Failed, errorsPath)
+	}
+	return nil
+}
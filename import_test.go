@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/google/uuid"
+)
+
+// importTestNote is a note for the import in the protobuf JSON encoding. Empty GUIDs are left out.
+func importTestNote(noteGuid string, fragmentGuid string) string {
+	record := map[string]interface{}{
+		"patientGuid": uuid.New().String(),
+		"authorGuid":  uuid.New().String(),
+		"dateCreated": "2015-03-01T10:00:00Z",
+		"type":        1,
+		"status":      1,
+		"fragments": []map[string]interface{}{{"noteFragmentGuid": fragmentGuid, "topic": 1, "status": 1,
+			"description": "Chest pain", "content": "Began an hour ago."}},
+	}
+	if noteGuid != "" {
+		record["noteGuid"] = noteGuid
+	}
+	data, _ := json.Marshal(record)
+	return string(data)
+}
+
+// interruptedImportDb fails the import of its interruptAt'th batch as a lost connection would.
+type interruptedImportDb struct {
+	*MockDb
+	calls       int
+	interruptAt int
+}
+
+func (d *interruptedImportDb) ImportNotes(notes []*ehrpb.Note) ([]string, error) {
+	d.calls++
+	if d.calls == d.interruptAt {
+		return nil, errors.New("connection reset by peer")
+	}
+	return d.MockDb.ImportNotes(notes)
+}
+
+func TestRunImport_ResumesAfterInterruption(t *testing.T) {
+	_, db := newMockDbServer(t)
+	dir, err := ioutil.TempDir("", "noteclerk-import")
+	if err != nil {
+		t.Fatalf("Failed to create a directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kept, taken := uuid.New().String(), uuid.New().String()
+	lines := []string{
+		importTestNote(kept, taken),
+		`{"patientGuid": "not json`,
+		importTestNote("", ""),
+		"",
+		importTestNote(kept, ""),
+		importTestNote(uuid.New().String(), taken),
+		importTestNote(uuid.New().String(), ""),
+	}
+	path := filepath.Join(dir, "notes.ndjson")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write the import file: %v", err)
+	}
+	errorsPath, checkpointPath := path+".errors.ndjson", path+".checkpoint"
+	notesBefore := len(db.db)
+
+	interrupted := &interruptedImportDb{MockDb: db, interruptAt: 2}
+	im := &noteImporter{db: interrupted, batchSize: 2}
+	if err := runImport(im, path, errorsPath, checkpointPath, ioutil.Discard); err == nil {
+		t.Fatalf("Expected the import to fail when the database does")
+	}
+	var checkpoint importCheckpoint
+	if data, err := ioutil.ReadFile(checkpointPath); err != nil || json.Unmarshal(data, &checkpoint) != nil ||
+		checkpoint.Lines != 2 {
+		t.Fatalf("Expected a checkpoint after the first batch, but got %+v: %v", checkpoint, err)
+	}
+
+	var out bytes.Buffer
+	im = &noteImporter{db: db, batchSize: 2}
+	err = runImport(im, path, errorsPath, checkpointPath, &out)
+	if err == nil || !strings.Contains(out.String(), "imported  2\nskipped   1") {
+		t.Fatalf("Expected the resumed import to add the rest and report one failure, but got %v: %v", err, out.String())
+	}
+	if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected the checkpoint to be removed once the import finished, but got %v", err)
+	}
+	if added := len(db.db) - notesBefore; added != 3 {
+		t.Fatalf("Expected 3 notes to be imported across both runs, but %v were", added)
+	}
+	note, err := db.GetNoteByGuid(kept)
+	if err != nil || note.GetDateCreated().GetSeconds() != 1425204000 || note.GetFragments()[0].GetNoteGuid() != kept {
+		t.Fatalf("Expected the note to keep its GUID and creation date, but got %+v: %v", note, err)
+	}
+
+	file, _ := os.Open(errorsPath)
+	defer file.Close()
+	var failed []int
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		f := &ImportFailure{}
+		if err := json.Unmarshal(scanner.Bytes(), f); err != nil || f.Error == "" || f.Record == "" {
+			t.Fatalf("Expected each failure with its error and record, but got %v", scanner.Text())
+		}
+		failed = append(failed, f.Line)
+	}
+	if len(failed) != 2 || failed[0] != 2 || failed[1] != 6 {
+		t.Fatalf("Expected the record which is not JSON and the one reusing a fragment GUID to fail, but got %v", failed)
+	}
+}
+
+func TestServer_ImportNotes(t *testing.T) {
+	s, _ := newMockDbServer(t)
+	guid := uuid.New().String()
+	records := strings.Join([]string{importTestNote(guid, ""), importTestNote(guid, ""),
+		strings.Replace(importTestNote("", ""), `"status":1`, `"status":99`, 1)}, "\n")
+
+	res, err := s.ImportNotes(context.Background(), &clerkpb.ImportNotesRequest{Records: records})
+	if err != nil {
+		t.Fatalf("Failed to import notes: %v", err)
+	}
+	if res.Imported != 1 || res.Failed != 2 || len(res.Failures) != 2 || res.Lines != 3 ||
+		!strings.Contains(res.Failures[0].Error, guid) || !strings.Contains(res.Failures[1].Error, ".status has unknown value") {
+		t.Fatalf("Expected the duplicate and the invalid status to fail, but got %+v", res)
+	}
+
+	// Sending the records again imports nothing twice
+	res, err = s.ImportNotes(context.Background(), &clerkpb.ImportNotesRequest{Records: records, BatchSize: 1})
+	if err != nil || res.Imported != 0 || res.Skipped != 2 || res.Failed != 1 {
+		t.Fatalf("Expected the imported note to be skipped the second time, but got %+v: %v", res, err)
+	}
+}
+
+func TestServer_ImportNotes_RecordsWithoutGuidsAreNotImportedTwice(t *testing.T) {
+	s, db := newMockDbServer(t)
+	records := importTestNote("", "") + "\n" + importTestNote("", "")
+	notesBefore := len(db.db)
+
+	for run := 1; run <= 2; run++ {
+		res, err := s.ImportNotes(context.Background(), &clerkpb.ImportNotesRequest{Records: records})
+		if err != nil || res.Failed != 0 || res.Imported+res.Skipped != 2 || (run == 2 && res.Skipped != 2) {
+			t.Fatalf("Expected run %v to import or skip both notes, but got %+v: %v", run, res, err)
+		}
+	}
+	if added := len(db.db) - notesBefore; added != 2 {
+		t.Fatalf("Expected the notes without GUIDs to be imported once, but %v notes were added", added)
+	}
+}
+
+func TestRunImport_RefusesTheCheckpointOfAnotherFile(t *testing.T) {
+	_, db := newMockDbServer(t)
+	dir, err := ioutil.TempDir("", "noteclerk-import")
+	if err != nil {
+		t.Fatalf("Failed to create a directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notes.ndjson")
+	if err := ioutil.WriteFile(path, []byte(importTestNote("", "")+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write the import file: %v", err)
+	}
+	checkpointPath := filepath.Join(dir, "import.checkpoint")
+	data, _ := json.Marshal(&importCheckpoint{File: filepath.Join(dir, "other.ndjson"), Lines: 1})
+	if err := ioutil.WriteFile(checkpointPath, data, 0600); err != nil {
+		t.Fatalf("Failed to write the checkpoint: %v", err)
+	}
+	notesBefore := len(db.db)
+
+	im := &noteImporter{db: db, batchSize: 2}
+	if err := runImport(im, path, path+".errors.ndjson", checkpointPath, ioutil.Discard); err == nil ||
+		!strings.Contains(err.Error(), "other.ndjson") {
+		t.Fatalf("Expected the checkpoint of another file to be refused, but got %v", err)
+	}
+	if len(db.db) != notesBefore {
+		t.Fatalf("Expected nothing to be imported with the checkpoint of another file")
+	}
+}
@@ -1,62 +1,68 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/beevik/guid"
 	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
 	"github.com/geekmdio/noted"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"strings"
 	"testing"
+	"time"
 )
 
 var postgresDb = &DbPostgres{}
 
-func TestCreateTable_ReturnsError_WithImproperQuery(t *testing.T) {
+func TestMigrator_Integration_UpIsIdempotent(t *testing.T) {
 	setup(t)
 
-	if err := postgresDb.createTable("CREATE BLAH"); err == nil {
-		t.Fatalf("Should not be able to create table from improper query.")
+	m, err := NewMigrator(postgresDb.db)
+	if err != nil {
+		t.Fatalf("Failed to create migrator. Error: %v", err)
 	}
 
-	tearDown(t)
-}
-
-func TestCreateTable_WhichDoesNotExist_ReturnsNil(t *testing.T) {
-	setup(t)
-
-	dropQuery := `DROP TABLE TestCreateTable_WhichDoesNotExist_ReturnsNil;`
-	postgresDb.db.Exec(dropQuery)
-
-	createQuery := `CREATE TABLE TestCreateTable_WhichDoesNotExist_ReturnsNil (id serial NOT NULL);`
-	err := postgresDb.createTable(createQuery)
+	applied, err := m.Up()
 	if err != nil {
-		t.Fatalf("Create table should return nil, but returned error '%v'", err)
+		t.Fatalf("Migrating an up to date schema should not return an error. Error: %v", err)
 	}
 
-	postgresDb.db.Exec(dropQuery)
+	if len(applied) != 0 {
+		t.Fatalf("Setup already migrated the schema, so no migrations should be applied, but %v were.", len(applied))
+	}
 
 	tearDown(t)
 }
 
-func TestCreateTable_WhichAlreadyExists_ReturnsProperError(t *testing.T) {
+func TestMigrator_Integration_DownThenUpRestoresSchema(t *testing.T) {
 	setup(t)
 
-	dropQuery := `DROP TABLE create_table_returns_error;`
-	postgresDb.db.Exec(dropQuery)
-
-	createQuery := `CREATE TABLE create_table_returns_error (id serial NOT NULL);`
+	m, err := NewMigrator(postgresDb.db)
+	if err != nil {
+		t.Fatalf("Failed to create migrator. Error: %v", err)
+	}
 
-	if err := postgresDb.createTable(createQuery); err != nil {
-		t.Fatalf("Create table should not return error when given proper query. Error: %v", err)
+	reverted, err := m.Down(1)
+	if err != nil || len(reverted) != 1 {
+		t.Fatalf("Expected to roll back exactly one migration. Rolled back %v, error: %v", len(reverted), err)
 	}
 
-	if err := postgresDb.createTable(createQuery); err == nil {
-		t.Fatalf("Create table should return an error indicating the table already exists. Actual error: %v", err)
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Failed to read migration status. Error: %v", err)
+	}
+	if last := statuses[len(statuses)-1]; last.Applied {
+		t.Fatalf("Migration %v should be pending after rolling it back.", last.Migration)
 	}
 
-	postgresDb.db.Exec(dropQuery)
+	applied, err := m.Up()
+	if err != nil || len(applied) != 1 || applied[0].Version != reverted[0].Version {
+		t.Fatalf("Expected to re-apply migration %v. Applied %v, error: %v", reverted[0], applied, err)
+	}
 
 	tearDown(t)
 }
@@ -109,6 +115,57 @@ func TestDbPostgres_AddNote(t *testing.T) {
 	tearDown(t)
 }
 
+func TestDbPostgres_AddNote_WithContentLongerThanLegacyColumn(t *testing.T) {
+	setup(t)
+	note := buildNote()
+	note.Fragments[0].Content = strings.Repeat("a", 2501)
+	note.Fragments[0].Description = strings.Repeat("d", 151)
+
+	if _, _, err := postgresDb.AddNote(note); err != nil {
+		t.Fatalf("Long fragment content should be stored in full. Error: %v", err)
+	}
+	tearDown(t)
+}
+
+func TestDbPostgres_CheckHealth_AfterMigration(t *testing.T) {
+	setup(t)
+	if err := postgresDb.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("A reachable, migrated database should be healthy. Error: %v", err)
+	}
+	tearDown(t)
+}
+
+func TestDbPostgres_AddNoteWithIdempotencyKey_ReturnsRecordedResponse(t *testing.T) {
+	setup(t)
+	note := buildNote()
+	record := &IdempotencyRecord{
+		Principal:   "client",
+		Key:         uuid.New().String(),
+		Fingerprint: "fingerprint",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		Response:    &ehrpb.CreateNoteResponse{Note: note},
+	}
+
+	id, existing, err := postgresDb.AddNoteWithIdempotencyKey(note, record)
+	if err != nil || existing != nil || id == 0 {
+		t.Fatalf("A new key should add the note. Id: %v, existing: %v, error: %v", id, existing, err)
+	}
+
+	repeated := *record
+	id, existing, err = postgresDb.AddNoteWithIdempotencyKey(buildNote(), &repeated)
+	if err != nil {
+		t.Fatalf("Failed to add a note with a repeated key. Error: %v", err)
+	}
+	if id != 0 || existing == nil || existing.Response.GetNote().GetNoteGuid() != note.GetNoteGuid() {
+		t.Fatalf("A repeated key should return the recorded response, but returned %v", existing)
+	}
+	if existing.Response.GetNote().GetId() != note.GetId() {
+		t.Fatalf("The recorded response should carry the note Id %v, but carried %v", note.GetId(),
+			existing.Response.GetNote().GetId())
+	}
+	tearDown(t)
+}
+
 func TestDbPostgres_UpdateNote(t *testing.T) {
 	setup(t)
 	note := buildNote()
@@ -364,7 +421,9 @@ func setup(t *testing.T) {
 		db: openDb,
 	}
 
-	server.createSchema()
+	if err := server.migrate(); err != nil {
+		t.Fatalf("Failed to migrate the integration testing database. Error: %v", err)
+	}
 
 }
 
@@ -374,3 +433,170 @@ func tearDown(t *testing.T) {
 		t.Fatalf("Failed to tear down integration testing by closing database.")
 	}
 }
+
+func TestDbPostgres_NoteEvents_Integration(t *testing.T) {
+	setup(t)
+	latest, err := postgresDb.SequenceNoteEvents()
+	if err != nil {
+		t.Fatalf("Failed to sequence note events. Error: %v", err)
+	}
+
+	note := buildNote()
+	postgresDb.AddNote(note)
+	prior, priorFragment := note.GetNoteGuid(), note.GetFragments()[0].GetNoteFragmentGuid()
+	if err := postgresDb.UpdateNote(note); err != nil {
+		t.Fatalf("Failed to update note. Error: %v", err)
+	}
+	if err := postgresDb.DeleteNote(note.GetNoteGuid()); err != nil {
+		t.Fatalf("Failed to delete note. Error: %v", err)
+	}
+	if _, err := postgresDb.SequenceNoteEvents(); err != nil {
+		t.Fatalf("Failed to sequence note events. Error: %v", err)
+	}
+
+	events, err := postgresDb.NoteEventsAfter(latest, 10)
+	if err != nil {
+		t.Fatalf("Failed to read note events. Error: %v", err)
+	}
+	if types := eventTypesOf(events); strings.Join(types, ",") != "NoteCreated,NoteUpdated,FragmentSuperseded,NoteDeleted" {
+		t.Fatalf("Expected the events of creating, updating and deleting the note, but got %v", types)
+	}
+	for k, v := range events {
+		if v.Offset != latest+int64(k)+1 {
+			t.Fatalf("Expected offsets to follow on from %v without gaps, but got %v", latest, v.Offset)
+		}
+	}
+	if events[1].PreviousNoteGuid != prior || events[2].PreviousNoteFragmentGuid != priorFragment {
+		t.Fatalf("Expected the update to name the versions it replaced, but got %+v and %+v", events[1], events[2])
+	}
+
+	consumer, owner := uuid.New().String(), uuid.New().String()
+	if _, claimed, err := postgresDb.ClaimNoteEventCursor(consumer, owner, time.Minute); !claimed || err != nil {
+		t.Fatalf("Failed to claim a new event cursor. Error: %v", err)
+	}
+	if err := postgresDb.AdvanceNoteEventCursor(consumer, owner, events[0].Offset, time.Minute); err != nil {
+		t.Fatalf("Failed to advance the event cursor. Error: %v", err)
+	}
+	if _, claimed, _ := postgresDb.ClaimNoteEventCursor(consumer, uuid.New().String(), time.Minute); claimed {
+		t.Fatalf("Another owner should not claim an event cursor whose lease has not expired")
+	}
+	if offset, _, _ := postgresDb.ClaimNoteEventCursor(consumer, owner, time.Minute); offset != events[0].Offset {
+		t.Fatalf("Expected the cursor at %v, but got %v", events[0].Offset, offset)
+	}
+	tearDown(t)
+}
+
+func TestDbPostgres_WebhookSubscriptions_Integration(t *testing.T) {
+	setup(t)
+	sub := &WebhookSubscription{Guid: uuid.New().String(), Url: "https://example.com/hook", Secret: "whsec_test",
+		PatientGuid: uuid.New().String(), NoteTypes: []string{"HISTORY_AND_PHYSICAL"},
+		EventTypes: []string{EventNoteSigned}, AfterOffset: 3, DateCreated: time.Now().UTC().Truncate(time.Second)}
+	if err := postgresDb.AddWebhookSubscription(sub); err != nil {
+		t.Fatalf("Failed to add a webhook subscription. Error: %v", err)
+	}
+
+	subs, err := postgresDb.WebhookSubscriptions()
+	if err != nil {
+		t.Fatalf("Failed to list webhook subscriptions. Error: %v", err)
+	}
+	var stored *WebhookSubscription
+	for _, v := range subs {
+		if v.Guid == sub.Guid {
+			stored = v
+		}
+	}
+	if stored == nil || stored.Secret != sub.Secret || strings.Join(stored.NoteTypes, ",") != "HISTORY_AND_PHYSICAL" ||
+		strings.Join(stored.EventTypes, ",") != EventNoteSigned || stored.AfterOffset != 3 ||
+		!stored.DateCreated.Equal(sub.DateCreated) {
+		t.Fatalf("Expected the subscription as it was added, but got %+v", stored)
+	}
+
+	letter := &WebhookDeadLetter{SubscriptionGuid: sub.Guid, Event: &NoteEvent{Offset: 4, Type: EventNoteSigned,
+		NoteGuid: uuid.New().String()}, Attempts: 8, LastError: "refused", FailedAt: time.Now().UTC()}
+	if err := postgresDb.AddWebhookDeadLetter(letter); err != nil {
+		t.Fatalf("Failed to record a dead letter. Error: %v", err)
+	}
+
+	if deleted, err := postgresDb.DeleteWebhookSubscription(sub.Guid); !deleted || err != nil {
+		t.Fatalf("Failed to delete the webhook subscription, along with its dead letter. Error: %v", err)
+	}
+	if deleted, err := postgresDb.DeleteWebhookSubscription(sub.Guid); deleted || err != nil {
+		t.Fatalf("Expected nothing to delete the second time, but got %v, %v", deleted, err)
+	}
+	tearDown(t)
+}
+
+func TestDbPostgres_ImportNotes_Integration(t *testing.T) {
+	setup(t)
+	note := buildNote()
+	note.DateCreated = &timestamp.Timestamp{Seconds: 1425204000}
+	for _, v := range note.GetFragments() {
+		v.NoteGuid = note.GetNoteGuid()
+	}
+	if skipped, err := postgresDb.ImportNotes([]*ehrpb.Note{note}); err != nil || len(skipped) != 0 {
+		t.Fatalf("Failed to import a note. Error: %v", err)
+	}
+	imported, err := postgresDb.GetNoteByGuid(note.GetNoteGuid())
+	if err != nil || imported.GetDateCreated().GetSeconds() != 1425204000 ||
+		len(imported.GetFragments()) != len(note.GetFragments()) {
+		t.Fatalf("Expected the note as it was imported, with its creation date, but got %+v. Error: %v", imported, err)
+	}
+
+	if skipped, err := postgresDb.ImportNotes([]*ehrpb.Note{note}); err != nil || len(skipped) != 1 {
+		t.Fatalf("Expected a note already present to be skipped, but got %v. Error: %v", skipped, err)
+	}
+	other := buildNote()
+	other.Fragments = note.GetFragments()
+	_, err = postgresDb.ImportNotes([]*ehrpb.Note{other})
+	if _, rejected := errors.Cause(err).(*importRejectedError); !rejected {
+		t.Fatalf("Expected a fragment GUID which is taken to be rejected, but got %v", err)
+	}
+	tearDown(t)
+}
+
+func TestDbPostgres_ExportNotes_Integration(t *testing.T) {
+	setup(t)
+	latest, err := postgresDb.SequenceNoteEvents()
+	if err != nil {
+		t.Fatalf("Failed to sequence note events. Error: %v", err)
+	}
+
+	first, second := buildNote(), buildNote()
+	second.PatientGuid = first.GetPatientGuid()
+	first.DateCreated = &timestamp.Timestamp{Seconds: 1425204000}
+	second.DateCreated = &timestamp.Timestamp{Seconds: 1425204000, Nanos: 1}
+	if _, err := postgresDb.ImportNotes([]*ehrpb.Note{second, first}); err != nil {
+		t.Fatalf("Failed to import notes. Error: %v", err)
+	}
+	filter := NoteExportFilter{PatientGuids: []string{first.GetPatientGuid()},
+		Types: []ehrpb.NoteType{ehrpb.NoteType_HISTORY_AND_PHYSICAL}, CreatedFrom: time.Unix(1425204000, 0)}
+
+	notes, mark, err := postgresDb.ExportNotes(filter, NoteExportMark{}, 1)
+	if err != nil || len(notes) != 1 || notes[0].GetNoteGuid() != first.GetNoteGuid() ||
+		len(notes[0].GetFragments()) != 1 || len(notes[0].GetTags()) != 2 {
+		t.Fatalf("Expected the note created first, with its fragment and tags, but got %+v. Error: %v", notes, err)
+	}
+	notes, mark, err = postgresDb.ExportNotes(filter, mark, 10)
+	if err != nil || len(notes) != 1 || notes[0].GetNoteGuid() != second.GetNoteGuid() {
+		t.Fatalf("Expected the note created second after the first, but got %+v. Error: %v", notes, err)
+	}
+	if notes, _, err = postgresDb.ExportNotes(filter, mark, 10); err != nil || len(notes) != 0 {
+		t.Fatalf("Expected no notes after the last, but got %+v. Error: %v", notes, err)
+	}
+
+	// Imported notes have no events; deleting one records the only event naming either of them
+	if err := postgresDb.DeleteNote(second.GetNoteGuid()); err != nil {
+		t.Fatalf("Failed to delete note. Error: %v", err)
+	}
+	if filter.ChangedUntil, err = postgresDb.SequenceNoteEvents(); err != nil {
+		t.Fatalf("Failed to sequence note events. Error: %v", err)
+	}
+	filter.ChangedAfter = latest
+	notes, mark, err = postgresDb.ExportNotes(filter, NoteExportMark{}, 10)
+	if err != nil || len(notes) != 1 || notes[0].GetNoteGuid() != second.GetNoteGuid() ||
+		notes[0].GetStatus() != ehrpb.RecordStatus_DELETED || mark.Offset != filter.ChangedUntil {
+		t.Fatalf("Expected only the deleted note, at the offset of its event, but got %+v at %+v. Error: %v", notes,
+			mark, err)
+	}
+	tearDown(t)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long in-flight RPCs are given to finish on shutdown when the configuration does not
+// say otherwise. Orchestrators commonly send SIGKILL 30 seconds after SIGTERM, so the default stays under that.
+const DefaultShutdownTimeout = 25 * time.Second
+
+// serveUntilSignal runs the server until it stops by itself or the process receives SIGINT or SIGTERM. On a signal,
+// the server is shut down gracefully, giving in-flight RPCs up to timeout to finish. It returns only once the server
+// has stopped and its database has been closed.
+// RETURNS: error
+func serveUntilSignal(srv NoteClerkServer, config *Config, db RDBMSAccessor, timeout time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Initialize(config, db)
+	}()
+
+	select {
+	case err := <-served:
+		// The server failed to start or stopped by itself; make sure its resources are released all the same.
+		if shutdownErr := srv.Shutdown(context.Background()); err == nil {
+			err = shutdownErr
+		}
+		return err
+	case sig := <-signals:
+		log.Infof("Received %v; shutting down within %v.", sig, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	shutdownErr := srv.Shutdown(ctx)
+
+	if err := <-served; err != nil {
+		return err
+	}
+	return shutdownErr
+}
+
+// shutdownTimeoutFromConfig reads the optional ShutdownTimeout setting.
+// RETURNS: time.Duration, error
+func shutdownTimeoutFromConfig(config *Config) (time.Duration, error) {
+	if config.ShutdownTimeout == "" {
+		return DefaultShutdownTimeout, nil
+	}
+	timeout, err := time.ParseDuration(config.ShutdownTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, NoteClerkErrWrap(err, ErrShutdownTimeoutFromConfigFailsParse, config.ShutdownTimeout)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// closeCountingDb is a MockDb which records how often it was closed.
+type closeCountingDb struct {
+	MockDb
+	closed int32
+}
+
+func (c *closeCountingDb) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+func localServerConfig() *Config {
+	return &Config{ServerIp: "127.0.0.1", ServerPort: "0", ServerProtocol: "tcp"}
+}
+
+// newMockDbServer constructs a server, without serving it, on an empty MockDb of its own.
+func newMockDbServer(t *testing.T) (*Server, *MockDb) {
+	db := &MockDb{}
+	if err := db.Initialize(nil); err != nil {
+		t.Fatalf("Failed to initialize the mock database: %v", err)
+	}
+	s := &Server{}
+	if err := s.constructor(localServerConfig(), db); err != nil {
+		t.Fatalf("Failed to construct the server: %v", err)
+	}
+	return s, db
+}
+
+// newHttpTestServer constructs a server as newMockDbServer does, and returns it with a handler for the routes that
+// register adds, e.g. (*Server).registerFhirHttp.
+func newHttpTestServer(t *testing.T, register func(*Server, *http.ServeMux)) (*Server, http.Handler) {
+	s, _ := newMockDbServer(t)
+	mux := http.NewServeMux()
+	register(s, mux)
+	return s, mux
+}
+
+// serveHttp sends a request to h and records the response. A body, when there is one, is sent as contentType, and
+// header holds further header names and values in pairs.
+func serveHttp(h http.Handler, method string, target string, contentType string, body string,
+	header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k := 0; k+1 < len(header); k += 2 {
+		req.Header.Set(header[k], header[k+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// waitUntilServing blocks until Initialize has handed the gRPC server to s.
+func waitUntilServing(t *testing.T, s *Server) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.lifecycle.Lock()
+		serving := s.server != nil
+		s.lifecycle.Unlock()
+		if serving {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("The server did not start serving within 5 seconds.")
+}
+
+func TestNoteClerkServer_Shutdown_StopsServingAndClosesDb(t *testing.T) {
+	s := &Server{}
+	db := &closeCountingDb{}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Initialize(localServerConfig(), db)
+	}()
+	waitUntilServing(t, s)
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown should succeed, but returned %v", err)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("Initialize should return nil after a shutdown, but returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Initialize did not return after Shutdown.")
+	}
+	if closed := atomic.LoadInt32(&db.closed); closed != 1 {
+		t.Fatalf("Shutdown should close the database once, but closed it %v times", closed)
+	}
+}
+
+func TestNoteClerkServer_Shutdown_BeforeInitialize_PreventsServing(t *testing.T) {
+	s := &Server{}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown of a server which never started should succeed, but returned %v", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Initialize(localServerConfig(), &closeCountingDb{})
+	}()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("Initialize after Shutdown should return nil, but returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Initialize served after Shutdown had been called.")
+	}
+}
+
+func TestServeUntilSignal_OnSigterm_ShutsDownGracefully(t *testing.T) {
+	s := &Server{}
+	db := &closeCountingDb{}
+	served := make(chan error, 1)
+	go func() {
+		served <- serveUntilSignal(s, localServerConfig(), db, time.Second)
+	}()
+	waitUntilServing(t, s)
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Unable to signal the test process: %v", err)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("serveUntilSignal should return nil after SIGTERM, but returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("serveUntilSignal did not return after SIGTERM.")
+	}
+	if closed := atomic.LoadInt32(&db.closed); closed != 1 {
+		t.Fatalf("The database should be closed once, but was closed %v times", closed)
+	}
+}
+
+func TestShutdownTimeoutFromConfig(t *testing.T) {
+	timeout, err := shutdownTimeoutFromConfig(&Config{})
+	if err != nil || timeout != DefaultShutdownTimeout {
+		t.Fatalf("An absent ShutdownTimeout should default to %v, but got %v, %v", DefaultShutdownTimeout, timeout, err)
+	}
+
+	timeout, err = shutdownTimeoutFromConfig(&Config{ShutdownTimeout: "10s"})
+	if err != nil || timeout != 10*time.Second {
+		t.Fatalf("ShutdownTimeout '10s' should parse to 10s, but got %v, %v", timeout, err)
+	}
+
+	if _, err := shutdownTimeoutFromConfig(&Config{ShutdownTimeout: "-1s"}); err == nil {
+		t.Fatalf("A negative ShutdownTimeout should be rejected.")
+	}
+}
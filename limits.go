@@ -0,0 +1,45 @@
+package main
+
+// Default limits, in characters, applied when the configuration does not set its own. Content is stored in a text
+// column and may be far longer than a typical H&P or discharge summary; the default only guards against runaway input.
+const (
+	DefaultMaxFragmentContentLength     = 1000000
+	DefaultMaxFragmentDescriptionLength = 1000
+	DefaultMaxTagLength                 = 255
+)
+
+// ContentLimits caps the length, in characters, of free text accepted for notes and note fragments. Requests are
+// checked against these limits by the validation layer. A zero value for any field means the default is used.
+type ContentLimits struct {
+	MaxFragmentContentLength     int
+	MaxFragmentDescriptionLength int
+	MaxTagLength                 int
+}
+
+// contentLimitsFromConfig builds the ContentLimits described by the configuration.
+func contentLimitsFromConfig(config *Config) ContentLimits {
+	return ContentLimits{
+		MaxFragmentContentLength:     config.MaxFragmentContentLength,
+		MaxFragmentDescriptionLength: config.MaxFragmentDescriptionLength,
+		MaxTagLength:                 config.MaxTagLength,
+	}
+}
+
+func (l ContentLimits) maxFragmentContentLength() int {
+	return limitOrDefault(l.MaxFragmentContentLength, DefaultMaxFragmentContentLength)
+}
+
+func (l ContentLimits) maxFragmentDescriptionLength() int {
+	return limitOrDefault(l.MaxFragmentDescriptionLength, DefaultMaxFragmentDescriptionLength)
+}
+
+func (l ContentLimits) maxTagLength() int {
+	return limitOrDefault(l.MaxTagLength, DefaultMaxTagLength)
+}
+
+func limitOrDefault(limit int, def int) int {
+	if limit > 0 {
+		return limit
+	}
+	return def
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Clients may correlate their logs with NoteClerk's by sending a request id in this metadata header. Requests
+// without one are assigned a new id, which is returned in the response header of the same name.
+const RequestIdHeader = "x-request-id"
+
+// The principal logged for requests which do not identify their caller.
+const anonymousPrincipal = "anonymous"
+
+type loggerKey struct{}
+
+type principalKey struct{}
+
+// loggingInterceptor gives each unary RPC a logger carrying its request id, RPC name, principal and trace id, stores
+// it in the request context for handlers to retrieve with loggerFromContext, and logs the outcome of the call. It
+// runs just inside the tracing interceptor, so that the trace id is known, and ahead of the others, so that they log
+// with the request-scoped logger too.
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	requestId := requestIdFromContext(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIdHeader, requestId))
+
+	fields := logrus.Fields{
+		"request_id": requestId,
+		"rpc":        info.FullMethod,
+		"principal":  principalFromContext(ctx),
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+	ctx = contextWithSensitiveValues(ctx, req)
+	entry := log.WithContext(ctx).WithFields(fields)
+	ctx = context.WithValue(ctx, loggerKey{}, entry)
+
+	res, err := handler(ctx, req)
+
+	entry = entry.WithFields(logrus.Fields{
+		"code":        status.Code(err).String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	if err != nil {
+		entry.WithError(err).Info("Handled RPC with an error.")
+	} else {
+		entry.Info("Handled RPC.")
+	}
+	return res, err
+}
+
+// loggerFromContext returns the request-scoped logger stored by loggingInterceptor, or a logger without request
+// fields when ctx did not come through it.
+// RETURNS: *logrus.Entry
+func loggerFromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(log).WithContext(ctx)
+}
+
+// contextWithPrincipal records the authenticated caller of a request, for authentication layers to call before
+// loggingInterceptor runs.
+func contextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// principalFromContext identifies the caller: the principal recorded by contextWithPrincipal, else the common name of
+// a verified TLS client certificate, else 'anonymous'.
+func principalFromContext(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalKey{}).(string); ok && principal != "" {
+		return principal
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			if chain := tlsInfo.State.VerifiedChains[0]; len(chain) > 0 && chain[0].Subject.CommonName != "" {
+				return chain[0].Subject.CommonName
+			}
+		}
+	}
+	return anonymousPrincipal
+}
+
+// requestIdFromContext returns the request id sent by the client, or a new one.
+func requestIdFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIdHeader); len(values) > 0 && values[0] != "" && len(values[0]) <= 128 {
+			return values[0]
+		}
+	}
+	return uuid.New().String()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// captureLog sends log output at info level and above to a buffer, in JSON through the redacting formatter, for the
+// duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	out, formatter, level := log.Out, log.Formatter, log.GetLevel()
+	log.Out = buf
+	log.Formatter = &redactingFormatter{Formatter: &logrus.JSONFormatter{}}
+	log.SetLevel(logrus.InfoLevel)
+	t.Cleanup(func() {
+		log.Out = out
+		log.Formatter = formatter
+		log.SetLevel(level)
+	})
+	return buf
+}
+
+func TestLoggingInterceptor_AttachesRequestFieldsToContextLogger(t *testing.T) {
+	captureLog(t)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIdHeader, "req-42"))
+	ctx = contextWithPrincipal(ctx, "dr-house")
+	info := &grpc.UnaryServerInfo{FullMethod: "/ehrpb.NoteService/RetrieveNote"}
+
+	var fields logrus.Fields
+	loggingInterceptor(ctx, &ehrpb.RetrieveNoteRequest{}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		fields = loggerFromContext(ctx).Data
+		return nil, nil
+	})
+
+	want := map[string]string{"request_id": "req-42", "rpc": info.FullMethod, "principal": "dr-house"}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Fatalf("Expected the request logger to have %v=%v, but it had %v", k, v, fields[k])
+		}
+	}
+}
+
+func TestLoggingInterceptor_WithoutRequestId_AssignsOne(t *testing.T) {
+	captureLog(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/ehrpb.NoteService/RetrieveNote"}
+
+	var fields logrus.Fields
+	loggingInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		fields = loggerFromContext(ctx).Data
+		return nil, nil
+	})
+
+	if id, _ := fields["request_id"].(string); id == "" {
+		t.Fatalf("Expected a request id to be assigned, but got %v", fields["request_id"])
+	}
+	if fields["principal"] != anonymousPrincipal {
+		t.Fatalf("Expected an unidentified caller to be logged as %v, but got %v", anonymousPrincipal, fields["principal"])
+	}
+}
+
+func TestLoggingInterceptor_RedactsRequestPhiFromHandlerLogs(t *testing.T) {
+	buf := captureLog(t)
+	note := buildValidNote()
+	content := note.Fragments[0].Content
+	info := &grpc.UnaryServerInfo{FullMethod: "/ehrpb.NoteService/CreateNote"}
+
+	loggingInterceptor(context.Background(), &ehrpb.CreateNoteRequest{Note: note}, info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			err := errors.New("pq: value too long for content '" + content + "' of patient " + note.PatientGuid)
+			loggerFromContext(ctx).Warn(NoteClerkErrWrap(err, ErrNoteClerkServerCreateNoteFailsAddNoteToDb))
+			return nil, nil
+		})
+
+	output := buf.String()
+	for _, phi := range []string{content, note.PatientGuid} {
+		if strings.Contains(output, phi) {
+			t.Fatalf("Expected %q to be redacted, but the log contained:\n%v", phi, output)
+		}
+	}
+	if !strings.Contains(output, RedactedValue) {
+		t.Fatalf("Expected the log to mark redacted values, but it contained:\n%v", output)
+	}
+}
+
+func TestSensitiveValues_CoversClerkServiceRequests(t *testing.T) {
+	patientGuid := "7b2c6f0e-1111-4222-8333-944455556666"
+	record := `{"noteGuid":"1c1b4b1e-5f83-4f5c-9d7e-2a4c2f4a3b21","patientGuid":"` + patientGuid + `",` +
+		`"fragments":[{"content":"Patient reports chest pain."}]}`
+
+	tests := []struct {
+		req  interface{}
+		want []string
+	}{
+		{&clerkpb.ImportNotesRequest{Records: record}, []string{record, patientGuid, "Patient reports chest pain."}},
+		{&clerkpb.DeidentifyNotesRequest{Records: "not json " + patientGuid}, []string{"not json " + patientGuid}},
+		{&clerkpb.CreateWebhookSubscriptionRequest{Url: "https://example.org/hook", PatientGuid: patientGuid},
+			[]string{"https://example.org/hook", patientGuid}},
+		{&clerkpb.LookupIcd10CodesRequest{Query: "asthma exacerbation"}, []string{"asthma exacerbation"}},
+	}
+	for _, tt := range tests {
+		values := sensitiveValues(tt.req)
+		for _, want := range tt.want {
+			if !containsString(values, want) {
+				t.Errorf("Expected %T to have %q redacted, but the values were %q", tt.req, want, values)
+			}
+		}
+		if containsString(values, "1c1b4b1e-5f83-4f5c-9d7e-2a4c2f4a3b21") {
+			t.Errorf("Expected the note GUID in %T to be left in the log, but the values were %q", tt.req, values)
+		}
+	}
+}
+
+func TestRedactingFormatter_RedactsPhiFieldsAndDatabaseErrorValues(t *testing.T) {
+	buf := captureLog(t)
+
+	log.WithField("patient_guid", "7b2c6f0e-1111-4222-8333-944455556666").
+		WithError(errors.New(`sql: Scan error on column index 11, name "content": converting driver.Value type string ("chest pain") to a int64`)).
+		Warn(`pq: duplicate key value violates unique constraint. Key (content)=(patient reports chest pain)`)
+
+	output := buf.String()
+	for _, phi := range []string{"7b2c6f0e-1111-4222-8333-944455556666", "chest pain", "patient reports chest pain"} {
+		if strings.Contains(output, phi) {
+			t.Fatalf("Expected %q to be redacted, but the log contained:\n%v", phi, output)
+		}
+	}
+}
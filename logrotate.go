@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLogMaxSizeMb is the size at which the log file is rotated when the configuration does not say otherwise.
+const DefaultLogMaxSizeMb = 100
+
+// Rotated log files are named after the log file with the time of rotation inserted before the extension, e.g.
+// 'server-20060102T150405.000.log'.
+const rotatedLogTimeFormat = "20060102T150405.000"
+
+// rotatingFile is an io.Writer to a log file which is rotated once it grows past maxSize bytes or, when interval is
+// set, once it has been open for that long. Rotated files older than maxAge, or beyond the newest maxBackups, are
+// removed; zero values keep them all. The file and its directory are created if they do not exist.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxAge     time.Duration
+	maxBackups int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// openRotatingFile opens, or creates, the log file at path for appending.
+// RETURNS: *rotatingFile, error
+func openRotatingFile(path string, maxSize int64, interval time.Duration, maxAge time.Duration,
+	maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, interval: interval, maxAge: maxAge, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size, r.openedAt = file, info.Size(), time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize
+	tooOld := r.interval > 0 && time.Since(r.openedAt) >= r.interval
+	if tooBig || tooOld {
+		if err := r.rotate(); err != nil {
+			// Keep logging to the current file rather than losing entries.
+			fmt.Fprintln(os.Stderr, NoteClerkErrWrap(err, ErrRotatingFileFailsRotate, r.path))
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file aside, starts a new one and removes expired backups.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(r.path)
+	rotated := fmt.Sprintf("%v-%v%v", strings.TrimSuffix(r.path, ext), time.Now().Format(rotatedLogTimeFormat), ext)
+	renameErr := os.Rename(r.path, rotated)
+	if err := r.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	return r.prune()
+}
+
+// prune removes rotated files beyond the retention limits.
+func (r *rotatingFile) prune() error {
+	if r.maxAge <= 0 && r.maxBackups <= 0 {
+		return nil
+	}
+	ext := filepath.Ext(r.path)
+	backups, err := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-*" + ext)
+	if err != nil {
+		return err
+	}
+	// The timestamp in the name sorts chronologically, so the newest backups come first once reversed.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, v := range backups {
+		expired := r.maxBackups > 0 && i >= r.maxBackups
+		if !expired && r.maxAge > 0 {
+			if info, err := os.Stat(v); err == nil && time.Since(info.ModTime()) > r.maxAge {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Sync flushes the current file to disk.
+func (r *rotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+// Close flushes and closes the current file. Later writes fail.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	file := r.file
+	r.file = nil
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
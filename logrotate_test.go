@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile_RotatesOnceMaxSizeIsReached(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "server.log")
+	file, err := openRotatingFile(logPath, 64, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open the log file: %v", err)
+	}
+	defer file.Close()
+
+	entry := strings.Repeat("x", 40) + "\n"
+	for i := 0; i < 2; i++ {
+		if _, err := file.Write([]byte(entry)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "server-*.log"))
+	if len(backups) != 1 {
+		t.Fatalf("Expected one rotated file, but found %v", backups)
+	}
+	info, _ := os.Stat(logPath)
+	if info.Size() != int64(len(entry)) {
+		t.Fatalf("Expected the current file to hold only the latest entry, but it is %v bytes", info.Size())
+	}
+}
+
+func TestRotatingFile_RotatesOnceIntervalHasPassed(t *testing.T) {
+	dir := t.TempDir()
+	file, err := openRotatingFile(filepath.Join(dir, "server.log"), 0, time.Hour, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open the log file: %v", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("first\n"))
+	file.openedAt = file.openedAt.Add(-2 * time.Hour)
+	file.Write([]byte("second\n"))
+
+	if backups, _ := filepath.Glob(filepath.Join(dir, "server-*.log")); len(backups) != 1 {
+		t.Fatalf("Expected one rotated file, but found %v", backups)
+	}
+}
+
+func TestRotatingFile_PrunesBackupsBeyondRetention(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 4; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("server-20200101T00000%v.000.log", i))
+		if err := os.WriteFile(name, []byte("old\n"), 0640); err != nil {
+			t.Fatalf("Failed to create a backup: %v", err)
+		}
+	}
+	expired := filepath.Join(dir, "server-20200101T000003.000.log")
+	old := time.Now().Add(-72 * time.Hour)
+	os.Chtimes(expired, old, old)
+
+	file, err := openRotatingFile(filepath.Join(dir, "server.log"), 0, 0, 48*time.Hour, 3)
+	if err != nil {
+		t.Fatalf("Failed to open the log file: %v", err)
+	}
+	defer file.Close()
+	file.Write([]byte("entry\n"))
+	if err := file.rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "server-*.log"))
+	// Of the three newest backups, the one past its age is removed as well.
+	if len(backups) != 2 {
+		t.Fatalf("Expected two backups to be kept, but found %v", backups)
+	}
+	for _, v := range backups {
+		if v == expired {
+			t.Fatalf("Expected %v to be removed for its age", v)
+		}
+	}
+}
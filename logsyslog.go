@@ -0,0 +1,22 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/sirupsen/logrus"
+	logrussyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// newSyslogHook connects to the syslog daemon at address over network, or to the local daemon when both are empty.
+// Entries are sent with the syslog severity matching their level. The returned io.Closer closes the connection.
+// RETURNS: logrus.Hook, io.Closer, error
+func newSyslogHook(network string, address string, tag string) (logrus.Hook, io.Closer, error) {
+	hook, err := logrussyslog.NewSyslogHook(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hook, hook.Writer, nil
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newSyslogHook is unavailable where the standard library has no syslog support.
+func newSyslogHook(network string, address string, tag string) (logrus.Hook, io.Closer, error) {
+	return nil, nil, errors.New("syslog is not supported on this platform")
+}
@@ -1,38 +1,70 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 )
 
 func main() {
 
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		exitOnCommandError(runCommand(os.Args[1:], os.Stdout))
+		return
+	}
+
 	validateEnv()
 
-	config := loadConfig()
+	config := loadConfig(os.Args[1:])
 
 	initLogger(config)
 
+	shutdownTracing := initTracer(config)
+
 	initStatement(config)
 
-	if err := server.Initialize(config, db); err != nil {
+	shutdownTimeout, err := shutdownTimeoutFromConfig(config)
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	stopWatchingConfig := watchConfig(server, config, func() (*Config, error) {
+		return LoadConfiguration(configPath, os.Args[1:]...)
+	})
+	err = serveUntilSignal(server, config, db, shutdownTimeout)
+	stopWatchingConfig()
+	if err != nil {
+		log.Error(err)
+	}
+	flushTraces(shutdownTracing, shutdownTimeout)
+	log.Info("NoteClerk has shut down.")
+	if closeErr := CloseLogger(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "Unable to flush the log file: %v\n", closeErr)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
 }
 
 func initStatement(config *Config) {
 	initStatement := fmt.Sprintf("NoteClerk v%v is launching in %v", config.Version, strings.ToUpper(NoteClerkEnv))
 	fmt.Println(initStatement)
-	log.Infof(initStatement)
+	log.Info(initStatement)
 
 	serverStartStatement := fmt.Sprintf("Starting GeekMD's NoteClerk Server on %v:%v.", config.ServerIp, config.ServerPort)
 	fmt.Println(serverStartStatement)
-	log.Infof(serverStartStatement)
+	log.Info(serverStartStatement)
 }
 
-func loadConfig() *Config {
-	fmt.Printf("Loading configuration file from %v", configPath)
-	config, err := LoadConfiguration(configPath)
+func loadConfig(args []string) *Config {
+	fmt.Printf("Loading configuration from %v, the environment and flags\n", configPath)
+	config, err := LoadConfiguration(configPath, args...)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
 	if err != nil {
 		log.Panic(err)
 	}
@@ -40,8 +72,24 @@ func loadConfig() *Config {
 }
 
 func initLogger(config *Config) {
-	if err := InitializeLogger(config.LogPath); err != nil {
-		log.Fatalf("Unable to load the configuration file %v", config.LogPath)
+	if err := InitializeLogger(config); err != nil {
+		log.Fatalf("Unable to initialize logging: %v", err)
+	}
+}
+
+func initTracer(config *Config) func(context.Context) error {
+	shutdownTracing, err := initTracing(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return shutdownTracing
+}
+
+func flushTraces(shutdownTracing func(context.Context) error, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Warnf("Unable to flush buffered traces: %v", err)
 	}
 }
 
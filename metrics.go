@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsPath is the HTTP path at which the Prometheus metrics are exposed.
+const MetricsPath = "/metrics"
+
+const metricsNamespace = "noteclerk"
+
+// NoteClerk's collectors are registered with their own registry, rather than the Prometheus default, so that only
+// metrics this service means to publish are exposed.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	rpcRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpc_requests_total",
+		Help:      "Unary RPCs handled, by full method name and gRPC status code.",
+	}, []string{"method", "code"})
+
+	rpcDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Time taken to handle unary RPCs, by full method name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	dbQueryDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by RDBMSAccessor calls, by method and whether they returned an error.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "result"})
+
+	notesCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "notes_created_total",
+		Help:      "Notes created through CreateNote. Repeated requests answered from an idempotency key are not counted.",
+	})
+
+	fragmentsSupersededTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "fragments_superseded_total",
+		Help:      "Note fragments replaced by a newer version when their note was updated.",
+	})
+
+	searchesWithoutResultsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "searches_without_results_total",
+		Help:      "Successful searches which found nothing, by RPC.",
+	}, []string{"rpc"})
+
+	mllpMessagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mllp_messages_total",
+		Help:      "HL7 v2 messages received over MLLP, by the acknowledgement code they were answered with.",
+	}, []string{"ack"})
+
+	eventsPublishedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_published_total",
+		Help:      "Note events accepted by each event publisher; webhook_subscription counts every webhook subscription.",
+	}, []string{"publisher"})
+
+	eventPublishFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "event_publish_failures_total",
+		Help:      "Attempts to publish a note event which failed and will be retried, by event publisher; webhook_subscription counts every webhook subscription.",
+	}, []string{"publisher"})
+
+	webhookDeadLettersTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "webhook_dead_letters_total",
+		Help:      "Note events given up on after every delivery to a webhook subscription failed.",
+	})
+
+	dbStats = &dbStatsCollector{}
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		rpcRequestsTotal,
+		rpcDurationSeconds,
+		dbQueryDurationSeconds,
+		notesCreatedTotal,
+		fragmentsSupersededTotal,
+		searchesWithoutResultsTotal,
+		mllpMessagesTotal,
+		eventsPublishedTotal,
+		eventPublishFailuresTotal,
+		webhookDeadLettersTotal,
+		dbStats,
+	)
+}
+
+// registerMetricsHttp adds the endpoint serving every registered metric, in the Prometheus exposition format, to mux.
+func registerMetricsHttp(mux *http.ServeMux) {
+	mux.Handle(MetricsPath, promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+}
+
+// metricsInterceptor counts and times every unary RPC. It runs ahead of the other interceptors so that requests they
+// reject are recorded as well.
+func metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	res, err := handler(ctx, req)
+	rpcDurationSeconds.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	rpcRequestsTotal.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	return res, err
+}
+
+// observeDbCall records the duration of an RDBMSAccessor call. It is deferred with a pointer to the call's error so
+// that the result is known when it runs.
+func observeDbCall(method string, start time.Time, err *error) {
+	result := "ok"
+	if *err != nil {
+		result = "error"
+	}
+	dbQueryDurationSeconds.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+}
+
+// dbStatsCollector exports the connection pool statistics of whichever database was most recently set as its
+// source. Databases which do not expose a pool export nothing.
+type dbStatsCollector struct {
+	mu     sync.Mutex
+	source func() sql.DBStats
+}
+
+var (
+	dbOpenConnectionsDesc = prometheus.NewDesc(metricsNamespace+"_db_open_connections",
+		"Established connections to the database, both in use and idle.", nil, nil)
+	dbInUseConnectionsDesc = prometheus.NewDesc(metricsNamespace+"_db_in_use_connections",
+		"Connections currently in use.", nil, nil)
+	dbIdleConnectionsDesc = prometheus.NewDesc(metricsNamespace+"_db_idle_connections",
+		"Idle connections.", nil, nil)
+	dbMaxOpenConnectionsDesc = prometheus.NewDesc(metricsNamespace+"_db_max_open_connections",
+		"Maximum number of open connections to the database, or zero for no limit.", nil, nil)
+	dbWaitCountDesc = prometheus.NewDesc(metricsNamespace+"_db_wait_count_total",
+		"Times a query waited for a free connection.", nil, nil)
+	dbWaitDurationDesc = prometheus.NewDesc(metricsNamespace+"_db_wait_duration_seconds_total",
+		"Total time spent waiting for a free connection.", nil, nil)
+)
+
+// setSource makes the collector report on the connection pool of db, or on nothing when db has no pool.
+func (c *dbStatsCollector) setSource(db RDBMSAccessor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.source = nil
+	if pool, ok := db.(interface{ Stats() sql.DBStats }); ok {
+		c.source = pool.Stats
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbOpenConnectionsDesc
+	ch <- dbInUseConnectionsDesc
+	ch <- dbIdleConnectionsDesc
+	ch <- dbMaxOpenConnectionsDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	source := c.source
+	c.mu.Unlock()
+	if source == nil {
+		return
+	}
+
+	s := source()
+	ch <- prometheus.MustNewConstMetric(dbOpenConnectionsDesc, prometheus.GaugeValue, float64(s.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUseConnectionsDesc, prometheus.GaugeValue, float64(s.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdleConnectionsDesc, prometheus.GaugeValue, float64(s.Idle))
+	ch <- prometheus.MustNewConstMetric(dbMaxOpenConnectionsDesc, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, s.WaitDuration.Seconds())
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// histogramSampleCount returns how many observations the named histogram series holds in the metrics registry.
+func histogramSampleCount(t *testing.T, name string, labels map[string]string) uint64 {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		t.Fatalf("Unable to gather metrics: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if want, ok := labels[l.GetName()]; ok && want != l.GetValue() {
+					continue metrics
+				}
+			}
+			return m.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestMetricsInterceptor_CountsRequestsByStatusCode(t *testing.T) {
+	const method = "/noteclerk.Test/Rejected"
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.InvalidArgument, "rejected")
+	}
+	before := testutil.ToFloat64(rpcRequestsTotal.WithLabelValues(method, codes.InvalidArgument.String()))
+
+	metricsInterceptor(context.Background(), nil, info, handler)
+
+	after := testutil.ToFloat64(rpcRequestsTotal.WithLabelValues(method, codes.InvalidArgument.String()))
+	if after-before != 1 {
+		t.Fatalf("Expected the InvalidArgument count for %v to rise by 1, but it rose by %v", method, after-before)
+	}
+	if got := histogramSampleCount(t, "noteclerk_rpc_duration_seconds", map[string]string{"method": method}); got != 1 {
+		t.Fatalf("Expected one latency observation for %v, but found %v", method, got)
+	}
+}
+
+func TestInstrumentedDb_RecordsQueryDurations(t *testing.T) {
+	db := instrumentDb(&MockDb{})
+	db.Initialize(&Config{})
+	labels := map[string]string{"method": "AllNotes", "result": "ok"}
+	before := histogramSampleCount(t, "noteclerk_db_query_duration_seconds", labels)
+
+	if _, err := db.AllNotes(); err != nil {
+		t.Fatalf("AllNotes failed: %v", err)
+	}
+
+	if got := histogramSampleCount(t, "noteclerk_db_query_duration_seconds", labels); got-before != 1 {
+		t.Fatalf("Expected one more AllNotes observation, but found %v more", got-before)
+	}
+	if instrumentDb(db) != db {
+		t.Fatalf("Instrumenting an instrumented database should not wrap it again.")
+	}
+}
+
+func TestNoteClerkServer_CreateNote_CountsNotesCreated(t *testing.T) {
+	s := &Server{}
+	s.Initialize(&Config{}, mockDb)
+	before := testutil.ToFloat64(notesCreatedTotal)
+
+	if _, err := s.CreateNote(context.Background(), &ehrpb.CreateNoteRequest{Note: buildValidNote()}); err != nil {
+		t.Fatalf("Error creating a new note, err %v", err)
+	}
+
+	if after := testutil.ToFloat64(notesCreatedTotal); after-before != 1 {
+		t.Fatalf("Expected notes_created_total to rise by 1, but it rose by %v", after-before)
+	}
+}
+
+func TestMetricsEndpoint_ServesPrometheusFormat(t *testing.T) {
+	rpcRequestsTotal.WithLabelValues("/noteclerk.Test/Served", codes.OK.String()).Inc()
+	mux := http.NewServeMux()
+	registerMetricsHttp(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, MetricsPath, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected %v to return 200, but got %v", MetricsPath, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "noteclerk_rpc_requests_total") {
+		t.Fatalf("Expected %v to include noteclerk_rpc_requests_total, but got:\n%v", MetricsPath, rec.Body.String())
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+)
+
+// instrumentedDb decorates an RDBMSAccessor, recording the duration and outcome of every data access call in the
+// noteclerk_db_query_duration_seconds histogram. Lifecycle methods, such as Initialize and Close, are passed through
+// untimed.
+type instrumentedDb struct {
+	RDBMSAccessor
+}
+
+// instrumentDb wraps db so that its calls are measured. A db which is already instrumented is returned as it is.
+func instrumentDb(db RDBMSAccessor) RDBMSAccessor {
+	if _, ok := db.(*instrumentedDb); ok {
+		return db
+	}
+	return &instrumentedDb{RDBMSAccessor: db}
+}
+
+func (i *instrumentedDb) WithContext(ctx context.Context) RDBMSAccessor {
+	return &instrumentedDb{RDBMSAccessor: i.RDBMSAccessor.WithContext(ctx)}
+}
+
+func (i *instrumentedDb) AddNote(note *ehrpb.Note) (id int64, guid string, err error) {
+	defer observeDbCall("AddNote", time.Now(), &err)
+	return i.RDBMSAccessor.AddNote(note)
+}
+
+func (i *instrumentedDb) UpdateNote(note *ehrpb.Note) (err error) {
+	defer observeDbCall("UpdateNote", time.Now(), &err)
+	return i.RDBMSAccessor.UpdateNote(note)
+}
+
+func (i *instrumentedDb) DeleteNote(guid string) (err error) {
+	defer observeDbCall("DeleteNote", time.Now(), &err)
+	return i.RDBMSAccessor.DeleteNote(guid)
+}
+
+func (i *instrumentedDb) AllNotes() (notes []*ehrpb.Note, err error) {
+	defer observeDbCall("AllNotes", time.Now(), &err)
+	return i.RDBMSAccessor.AllNotes()
+}
+
+func (i *instrumentedDb) GetNoteByGuid(guid string) (note *ehrpb.Note, err error) {
+	defer observeDbCall("GetNoteByGuid", time.Now(), &err)
+	return i.RDBMSAccessor.GetNoteByGuid(guid)
+}
+
+func (i *instrumentedDb) FindNotes(filter NoteFindFilter) (notes []*ehrpb.Note, err error) {
+	defer observeDbCall("FindNotes", time.Now(), &err)
+	return i.RDBMSAccessor.FindNotes(filter)
+}
+
+func (i *instrumentedDb) AddNoteTag(noteGuid string, tag string) (id int64, err error) {
+	defer observeDbCall("AddNoteTag", time.Now(), &err)
+	return i.RDBMSAccessor.AddNoteTag(noteGuid, tag)
+}
+
+func (i *instrumentedDb) GetNoteTagsByNoteGuid(noteGuid string) (tags []string, err error) {
+	defer observeDbCall("GetNoteTagsByNoteGuid", time.Now(), &err)
+	return i.RDBMSAccessor.GetNoteTagsByNoteGuid(noteGuid)
+}
+
+func (i *instrumentedDb) AddNoteFragment(frag *ehrpb.NoteFragment) (id int64, guid string, err error) {
+	defer observeDbCall("AddNoteFragment", time.Now(), &err)
+	return i.RDBMSAccessor.AddNoteFragment(frag)
+}
+
+func (i *instrumentedDb) UpdateNoteFragment(frag *ehrpb.NoteFragment) (err error) {
+	defer observeDbCall("UpdateNoteFragment", time.Now(), &err)
+	return i.RDBMSAccessor.UpdateNoteFragment(frag)
+}
+
+func (i *instrumentedDb) DeleteNoteFragment(noteFragmentGuid string) (err error) {
+	defer observeDbCall("DeleteNoteFragment", time.Now(), &err)
+	return i.RDBMSAccessor.DeleteNoteFragment(noteFragmentGuid)
+}
+
+func (i *instrumentedDb) AllNoteFragments() (frags []*ehrpb.NoteFragment, err error) {
+	defer observeDbCall("AllNoteFragments", time.Now(), &err)
+	return i.RDBMSAccessor.AllNoteFragments()
+}
+
+func (i *instrumentedDb) GetNoteFragmentByGuid(guid string) (frag *ehrpb.NoteFragment, err error) {
+	defer observeDbCall("GetNoteFragmentByGuid", time.Now(), &err)
+	return i.RDBMSAccessor.GetNoteFragmentByGuid(guid)
+}
+
+func (i *instrumentedDb) GetNoteFragmentsByNoteGuid(noteGuid string) (frags []*ehrpb.NoteFragment, err error) {
+	defer observeDbCall("GetNoteFragmentsByNoteGuid", time.Now(), &err)
+	return i.RDBMSAccessor.GetNoteFragmentsByNoteGuid(noteGuid)
+}
+
+func (i *instrumentedDb) FindNoteFragments(filter NoteFragmentFindFilter) (frags []*ehrpb.NoteFragment, err error) {
+	defer observeDbCall("FindNoteFragments", time.Now(), &err)
+	return i.RDBMSAccessor.FindNoteFragments(filter)
+}
+
+func (i *instrumentedDb) AddNoteFragmentTag(noteGuid string, tag string) (id int64, err error) {
+	defer observeDbCall("AddNoteFragmentTag", time.Now(), &err)
+	return i.RDBMSAccessor.AddNoteFragmentTag(noteGuid, tag)
+}
+
+func (i *instrumentedDb) GetNoteFragmentTagsByNoteFragmentGuid(noteFragGuid string) (tags []string, err error) {
+	defer observeDbCall("GetNoteFragmentTagsByNoteFragmentGuid", time.Now(), &err)
+	return i.RDBMSAccessor.GetNoteFragmentTagsByNoteFragmentGuid(noteFragGuid)
+}
+
+func (i *instrumentedDb) AddNoteWithIdempotencyKey(note *ehrpb.Note, record *IdempotencyRecord) (id int64,
+	existing *IdempotencyRecord, err error) {
+	defer observeDbCall("AddNoteWithIdempotencyKey", time.Now(), &err)
+	return i.RDBMSAccessor.AddNoteWithIdempotencyKey(note, record)
+}
+
+func (i *instrumentedDb) DeleteExpiredIdempotencyKeys(now time.Time) (deleted int64, err error) {
+	defer observeDbCall("DeleteExpiredIdempotencyKeys", time.Now(), &err)
+	return i.RDBMSAccessor.DeleteExpiredIdempotencyKeys(now)
+}
+
+func (i *instrumentedDb) SequenceNoteEvents() (latest int64, err error) {
+	defer observeDbCall("SequenceNoteEvents", time.Now(), &err)
+	return i.RDBMSAccessor.SequenceNoteEvents()
+}
+
+func (i *instrumentedDb) NoteEventsAfter(offset int64, limit int) (events []*NoteEvent, err error) {
+	defer observeDbCall("NoteEventsAfter", time.Now(), &err)
+	return i.RDBMSAccessor.NoteEventsAfter(offset, limit)
+}
+
+func (i *instrumentedDb) ClaimNoteEventCursor(consumer string, owner string, lease time.Duration) (offset int64, claimed bool, err error) {
+	defer observeDbCall("ClaimNoteEventCursor", time.Now(), &err)
+	return i.RDBMSAccessor.ClaimNoteEventCursor(consumer, owner, lease)
+}
+
+func (i *instrumentedDb) AdvanceNoteEventCursor(consumer string, owner string, offset int64, lease time.Duration) (err error) {
+	defer observeDbCall("AdvanceNoteEventCursor", time.Now(), &err)
+	return i.RDBMSAccessor.AdvanceNoteEventCursor(consumer, owner, offset, lease)
+}
+
+func (i *instrumentedDb) AddWebhookSubscription(sub *WebhookSubscription) (err error) {
+	defer observeDbCall("AddWebhookSubscription", time.Now(), &err)
+	return i.RDBMSAccessor.AddWebhookSubscription(sub)
+}
+
+func (i *instrumentedDb) WebhookSubscriptions() (subs []*WebhookSubscription, err error) {
+	defer observeDbCall("WebhookSubscriptions", time.Now(), &err)
+	return i.RDBMSAccessor.WebhookSubscriptions()
+}
+
+func (i *instrumentedDb) DeleteWebhookSubscription(guid string) (deleted bool, err error) {
+	defer observeDbCall("DeleteWebhookSubscription", time.Now(), &err)
+	return i.RDBMSAccessor.DeleteWebhookSubscription(guid)
+}
+
+func (i *instrumentedDb) AddWebhookDeadLetter(letter *WebhookDeadLetter) (err error) {
+	defer observeDbCall("AddWebhookDeadLetter", time.Now(), &err)
+	return i.RDBMSAccessor.AddWebhookDeadLetter(letter)
+}
+
+func (i *instrumentedDb) ImportNotes(notes []*ehrpb.Note) (skipped []string, err error) {
+	defer observeDbCall("ImportNotes", time.Now(), &err)
+	return i.RDBMSAccessor.ImportNotes(notes)
+}
+
+func (i *instrumentedDb) ExportNotes(filter NoteExportFilter, after NoteExportMark,
+	limit int) (notes []*ehrpb.Note, last NoteExportMark, err error) {
+	defer observeDbCall("ExportNotes", time.Now(), &err)
+	return i.RDBMSAccessor.ExportNotes(filter, after, limit)
+}
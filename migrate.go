@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The SQL migrations are embedded in the binary so that a deployed server always carries the schema it expects. Files
+// are named <version>_<name>.up.sql and <version>_<name>.down.sql, e.g. '0005_add_note_fragment_issue_guid.up.sql'.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const migrationDir = "migrations"
+
+// All replicas use the same Postgres advisory lock key, so only one of them can run migrations at any given time. The
+// others block until the lock is released and then find nothing left to apply.
+const migrationAdvisoryLockKey int64 = 6582143307
+
+const createSchemaMigrationsTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations
+(
+  version    bigint      NOT NULL
+    CONSTRAINT schema_migrations_pkey
+    PRIMARY KEY,
+  name       varchar(255) NOT NULL,
+  applied_at timestamptz  default now() NOT NULL
+);`
+
+const getAppliedMigrationsQuery = `SELECT version, applied_at FROM schema_migrations ORDER BY version;`
+
+const addSchemaMigrationQuery = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`
+
+const deleteSchemaMigrationQuery = `DELETE FROM schema_migrations WHERE version = $1;`
+
+const acquireAdvisoryLockQuery = `SELECT pg_advisory_lock($1);`
+
+const releaseAdvisoryLockQuery = `SELECT pg_advisory_unlock($1);`
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a single numbered schema change. Up applies the change and Down reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a known migration has been applied to the database, and when.
+type MigrationStatus struct {
+	Migration *Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back the embedded migrations against a Postgres database. Applied versions are recorded
+// in the schema_migrations table, and every operation holds an advisory lock for its duration.
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+}
+
+// NewMigrator loads the embedded migrations and returns a Migrator bound to the given database.
+// RETURNS: *Migrator, error
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, migrationDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every migration which has not yet been applied, in version order. Each migration runs in its own
+// transaction together with its schema_migrations record.
+// RETURNS: []*Migration (the migrations applied), error
+func (m *Migrator) Up() ([]*Migration, error) {
+	var applied []*Migration
+	err := m.withLock(func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(context.Background(), conn)
+		if err != nil {
+			return err
+		}
+		for _, v := range m.migrations {
+			if _, ok := done[v.Version]; ok {
+				continue
+			}
+			if err := m.apply(conn, v.Up, addSchemaMigrationQuery, v.Version, v.Name); err != nil {
+				return NoteClerkErrWrap(err, ErrMigratorUpFailsApplyMigration, v.Version, v.Name)
+			}
+			applied = append(applied, v)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the given number of most recently applied migrations, newest first.
+// RETURNS: []*Migration (the migrations rolled back), error
+func (m *Migrator) Down(steps int) ([]*Migration, error) {
+	var reverted []*Migration
+	err := m.withLock(func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(context.Background(), conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			v := m.migrations[i]
+			if _, ok := done[v.Version]; !ok {
+				continue
+			}
+			if err := m.apply(conn, v.Down, deleteSchemaMigrationQuery, v.Version); err != nil {
+				return NoteClerkErrWrap(err, ErrMigratorDownFailsRevertMigration, v.Version, v.Name)
+			}
+			reverted = append(reverted, v)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration along with whether, and when, it was applied.
+// RETURNS: []MigrationStatus, error
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(context.Background(), conn)
+		if err != nil {
+			return err
+		}
+		for _, v := range m.migrations {
+			appliedAt, ok := done[v.Version]
+			statuses = append(statuses, MigrationStatus{Migration: v, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending counts the migrations which have not been applied. Unlike the other operations it takes no lock and creates
+// nothing, so it is cheap enough for health checks; a missing schema_migrations table is reported as an error.
+// RETURNS: int, error
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	done, err := m.appliedVersions(ctx, m.db)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, v := range m.migrations {
+		if _, ok := done[v.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a single connection while holding the migration advisory lock. Advisory locks belong to the
+// session, so the lock, the work and the unlock must all share the same connection.
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrMigratorFailsAcquireConnection)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, acquireAdvisoryLockQuery, migrationAdvisoryLockKey); err != nil {
+		return NoteClerkErrWrap(err, ErrMigratorFailsAcquireAdvisoryLock)
+	}
+	defer conn.ExecContext(ctx, releaseAdvisoryLockQuery, migrationAdvisoryLockKey)
+
+	if _, err := conn.ExecContext(ctx, createSchemaMigrationsTableQuery); err != nil {
+		return NoteClerkErrWrap(err, ErrMigratorFailsCreateSchemaMigrationsTable)
+	}
+
+	return fn(conn)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Conn.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// appliedVersions returns the applied migration versions mapped to the time they were applied.
+func (m *Migrator) appliedVersions(ctx context.Context, q queryer) (map[int64]time.Time, error) {
+	rows, err := q.QueryContext(ctx, getAppliedMigrationsQuery)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrMigratorFailsReadSchemaMigrations)
+	}
+	defer rows.Close()
+
+	done := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, NoteClerkErrWrap(err, ErrMigratorFailsReadSchemaMigrations)
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+// apply executes a migration script and its schema_migrations bookkeeping statement in one transaction.
+func (m *Migrator) apply(conn *sql.Conn, script string, bookkeeping string, args ...interface{}) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// loadMigrations reads every migration file in dir and pairs up the up and down scripts by version. Every version
+// must have both scripts, and a version may only be used by one migration name.
+// RETURNS: []*Migration sorted by version, error
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrLoadMigrationsFailsReadDir)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		parts := migrationFileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || parts == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, NoteClerkErrWrap(err, ErrLoadMigrationsFailsInvalidFile, e.Name())
+		}
+		contents, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, NoteClerkErrWrap(err, ErrLoadMigrationsFailsInvalidFile, e.Name())
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != parts[2] {
+			return nil, NoteClerkErrNew(ErrLoadMigrationsFailsDuplicateVersion, version)
+		}
+		if parts[3] == "up" {
+			mig.Up = string(contents)
+		} else {
+			mig.Down = string(contents)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, v := range byVersion {
+		if v.Up == "" || v.Down == "" {
+			return nil, NoteClerkErrNew(ErrLoadMigrationsFailsMissingScript, v.Version)
+		}
+		migrations = append(migrations, v)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// String renders a migration as '0005_add_note_fragment_issue_guid'.
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%v", m.Version, m.Name)
+}
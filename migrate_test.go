@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations_EmbeddedMigrationsArePairedAndOrdered(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, migrationDir)
+	if err != nil {
+		t.Fatalf("Embedded migrations should load without error, but got %v", err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatalf("Expected at least one embedded migration.")
+	}
+
+	for k, v := range migrations {
+		if v.Up == "" || v.Down == "" {
+			t.Fatalf("Migration %v should have both an up and a down script.", v)
+		}
+		if k > 0 && migrations[k-1].Version >= v.Version {
+			t.Fatalf("Migrations should be sorted by version, but %v came before %v.", migrations[k-1], v)
+		}
+	}
+}
+
+func TestLoadMigrations_WithMissingDownScript_ReturnsError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_create_foo.up.sql": {Data: []byte("CREATE TABLE foo (id serial);")},
+	}
+
+	if _, err := loadMigrations(fsys, "migrations"); err == nil {
+		t.Fatalf("A migration without a down script should be rejected.")
+	}
+}
+
+func TestLoadMigrations_WithDuplicateVersion_ReturnsError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_create_foo.up.sql":   {Data: []byte("CREATE TABLE foo (id serial);")},
+		"migrations/0001_create_foo.down.sql": {Data: []byte("DROP TABLE foo;")},
+		"migrations/0001_create_bar.up.sql":   {Data: []byte("CREATE TABLE bar (id serial);")},
+		"migrations/0001_create_bar.down.sql": {Data: []byte("DROP TABLE bar;")},
+	}
+
+	if _, err := loadMigrations(fsys, "migrations"); err == nil {
+		t.Fatalf("Two migrations sharing a version should be rejected.")
+	}
+}
+
+func TestLoadMigrations_IgnoresFilesThatAreNotMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_create_foo.up.sql":   {Data: []byte("CREATE TABLE foo (id serial);")},
+		"migrations/0002_create_foo.down.sql": {Data: []byte("DROP TABLE foo;")},
+		"migrations/README.md":                {Data: []byte("notes")},
+	}
+
+	migrations, err := loadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(migrations) != 1 || migrations[0].Version != 2 || migrations[0].Name != "create_foo" {
+		t.Fatalf("Expected only migration 0002_create_foo, but got %v", migrations)
+	}
+}
+
+func TestRunCommand_WithUnknownCommand_ReturnsError(t *testing.T) {
+	if err := runCommand([]string{"frobnicate"}, nil); err == nil {
+		t.Fatalf("An unknown command should return an error.")
+	}
+}
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS note
+(
+  id                   serial            NOT NULL
+    CONSTRAINT note_pkey
+    PRIMARY KEY,
+  date_created_seconds integer           NOT NULL,
+  date_created_nanos   integer default 0 NOT NULL,
+  note_guid            varchar(38)       NOT NULL,
+  visit_guid           varchar(38)       NOT NULL,
+  author_guid          varchar(38)       NOT NULL,
+  patient_guid         varchar(38)       NOT NULL,
+  type                 integer           NOT NULL,
+  status               integer           NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS note_id_uindex
+  ON note (id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS note_note_guid_uindex
+  ON note (note_guid);
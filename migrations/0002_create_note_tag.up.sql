@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS note_tag
+(
+  id        serial      NOT NULL
+    CONSTRAINT note_tag_pkey
+    PRIMARY KEY,
+  note_guid varchar(38) NOT NULL
+    CONSTRAINT note_tag_note_note_guid_fk
+    REFERENCES note (note_guid)
+    ON DELETE CASCADE,
+  tag       varchar(55) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS note_tag_id_uindex
+  ON note_tag (id);
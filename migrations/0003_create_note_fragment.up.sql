@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS note_fragment
+(
+  id                   serial            NOT NULL
+    CONSTRAINT note_fragment_pkey
+    PRIMARY KEY,
+  date_created_seconds integer           NOT NULL,
+  date_created_nanos   integer default 0 NOT NULL,
+  note_fragment_guid   varchar(38)       NOT NULL,
+  note_guid            varchar(38)       NOT NULL
+    CONSTRAINT note_fragment_note_note_guid_fk
+    REFERENCES note (note_guid)
+    ON DELETE CASCADE,
+  icd_10code           varchar(15)       NOT NULL,
+  icd_10long           varchar(250)      NOT NULL,
+  description          varchar(150)      NOT NULL,
+  status               integer           NOT NULL,
+  priority             integer           NOT NULL,
+  topic                integer           NOT NULL,
+  content              varchar(2500)     NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS note_fragment_id_uindex
+  ON note_fragment (id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS note_fragment_note_fragment_guid_uindex
+  ON note_fragment (note_fragment_guid);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS note_fragment_tag
+(
+  id                 serial      NOT NULL
+    CONSTRAINT note_fragment_tag_pkey
+    PRIMARY KEY,
+  note_fragment_guid varchar(38) NOT NULL
+    CONSTRAINT note_fragment_tag_note_fragment_note_fragment_guid_fk
+    REFERENCES note_fragment (note_fragment_guid)
+    ON DELETE CASCADE,
+  tag                varchar(55) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS note_fragment_tag_id_uindex
+  ON note_fragment_tag (id);
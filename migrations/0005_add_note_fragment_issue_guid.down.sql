@@ -0,0 +1,2 @@
+ALTER TABLE note_fragment
+  DROP COLUMN IF EXISTS issue_guid;
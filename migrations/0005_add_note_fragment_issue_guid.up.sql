@@ -0,0 +1,2 @@
+ALTER TABLE note_fragment
+  ADD COLUMN IF NOT EXISTS issue_guid varchar(38) default '' NOT NULL;
@@ -0,0 +1,10 @@
+-- Rolling back fails, rather than truncating clinical text, if any stored value exceeds the original limits.
+ALTER TABLE note_fragment
+  ALTER COLUMN content TYPE varchar(2500),
+  ALTER COLUMN description TYPE varchar(150);
+
+ALTER TABLE note_tag
+  ALTER COLUMN tag TYPE varchar(55);
+
+ALTER TABLE note_fragment_tag
+  ALTER COLUMN tag TYPE varchar(55);
@@ -0,0 +1,9 @@
+ALTER TABLE note_fragment
+  ALTER COLUMN content TYPE text,
+  ALTER COLUMN description TYPE text;
+
+ALTER TABLE note_tag
+  ALTER COLUMN tag TYPE text;
+
+ALTER TABLE note_fragment_tag
+  ALTER COLUMN tag TYPE text;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_key
+(
+  key         varchar(255) NOT NULL
+    CONSTRAINT idempotency_key_pkey
+    PRIMARY KEY,
+  fingerprint varchar(64)  NOT NULL,
+  response    text,
+  created_at  timestamptz  default now() NOT NULL,
+  expires_at  timestamptz  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_key_expires_at_index
+  ON idempotency_key (expires_at);
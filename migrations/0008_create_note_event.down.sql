@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS note_event_cursor;
+DROP TABLE IF EXISTS note_event;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS note_event
+(
+  id                          bigserial                  NOT NULL
+    CONSTRAINT note_event_pkey
+    PRIMARY KEY,
+  event_offset                bigint,
+  event_type                  varchar(32)                NOT NULL,
+  occurred_at                 timestamptz                NOT NULL,
+  note_guid                   varchar(38)                NOT NULL,
+  previous_note_guid          varchar(38) default ''     NOT NULL,
+  note_fragment_guid          varchar(38) default ''     NOT NULL,
+  previous_note_fragment_guid varchar(38) default ''     NOT NULL,
+  patient_guid                varchar(38)                NOT NULL,
+  author_guid                 varchar(38)                NOT NULL,
+  visit_guid                  varchar(38)                NOT NULL,
+  note_type                   varchar(64)                NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS note_event_event_offset_uindex
+  ON note_event (event_offset);
+
+CREATE INDEX IF NOT EXISTS note_event_unsequenced_index
+  ON note_event (id)
+  WHERE event_offset IS NULL;
+
+CREATE TABLE IF NOT EXISTS note_event_cursor
+(
+  consumer                    varchar(255)               NOT NULL
+    CONSTRAINT note_event_cursor_pkey
+    PRIMARY KEY,
+  event_offset                bigint default 0           NOT NULL,
+  owner                       varchar(38)                NOT NULL,
+  lease_expires_at            timestamptz                NOT NULL
+);
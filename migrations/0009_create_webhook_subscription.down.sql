@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS webhook_dead_letter;
+DROP TABLE IF EXISTS webhook_subscription;
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS webhook_subscription
+(
+  id                          bigserial                  NOT NULL
+    CONSTRAINT webhook_subscription_pkey
+    PRIMARY KEY,
+  subscription_guid           varchar(38)                NOT NULL,
+  url                         text                       NOT NULL,
+  secret                      varchar(255)               NOT NULL,
+  patient_guid                varchar(38) default ''     NOT NULL,
+  note_types                  text[] default '{}'        NOT NULL,
+  event_types                 text[] default '{}'        NOT NULL,
+  after_offset                bigint default 0           NOT NULL,
+  date_created                timestamptz                NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_subscription_subscription_guid_uindex
+  ON webhook_subscription (subscription_guid);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letter
+(
+  id                          bigserial                  NOT NULL
+    CONSTRAINT webhook_dead_letter_pkey
+    PRIMARY KEY,
+  subscription_guid           varchar(38)                NOT NULL
+    CONSTRAINT webhook_dead_letter_webhook_subscription_subscription_guid_fk
+    REFERENCES webhook_subscription (subscription_guid)
+    ON DELETE CASCADE,
+  event_offset                bigint                     NOT NULL,
+  event_type                  varchar(32)                NOT NULL,
+  note_guid                   varchar(38)                NOT NULL,
+  payload                     text                       NOT NULL,
+  attempts                    integer                    NOT NULL,
+  last_error                  text                       NOT NULL,
+  failed_at                   timestamptz                NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_dead_letter_subscription_guid_index
+  ON webhook_dead_letter (subscription_guid);
@@ -0,0 +1,10 @@
+DELETE FROM idempotency_key WHERE principal <> '';
+
+ALTER TABLE idempotency_key
+  DROP CONSTRAINT IF EXISTS idempotency_key_pkey;
+
+ALTER TABLE idempotency_key
+  ADD CONSTRAINT idempotency_key_pkey PRIMARY KEY (key);
+
+ALTER TABLE idempotency_key
+  DROP COLUMN IF EXISTS principal;
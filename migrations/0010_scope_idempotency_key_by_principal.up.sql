@@ -0,0 +1,8 @@
+ALTER TABLE idempotency_key
+  ADD COLUMN IF NOT EXISTS principal varchar(255) NOT NULL DEFAULT '';
+
+ALTER TABLE idempotency_key
+  DROP CONSTRAINT IF EXISTS idempotency_key_pkey;
+
+ALTER TABLE idempotency_key
+  ADD CONSTRAINT idempotency_key_pkey PRIMARY KEY (principal, key);
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/hl7"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// serveMllp receives HL7 v2 messages on lis until the returned server is shut down.
+func (n *Server) serveMllp(lis net.Listener) *hl7.Server {
+	srv := &hl7.Server{
+		Handler: n.handleMllpMessage,
+		ErrorLog: func(err error) {
+			log.Warnf("An MLLP connection failed: %v", err)
+		},
+	}
+	go func() {
+		log.Infof("Receiving HL7 v2 messages over MLLP on %v.", lis.Addr())
+		if err := srv.Serve(lis); err != nil && err != hl7.ErrServerClosed {
+			log.Error(NoteClerkErrWrap(err, ErrNoteClerkServerFailsServeMllp, lis.Addr()))
+		}
+	}()
+	return srv
+}
+
+// handleMllpMessage creates a note from an MDM^T02 message, calling CreateNote through invokeUnary, and acknowledges
+// it. Messages which cannot be parsed, mapped or validated are refused with an ERR segment saying why. A message for a
+// document which has already been received, as when the sender did not see the first acknowledgement, is acknowledged
+// again without creating another note; see mdmIdempotencyKey.
+func (n *Server) handleMllpMessage(ctx context.Context, data []byte, remoteAddr net.Addr) []byte {
+	logger := logrus.NewEntry(log).WithField("remote_addr", remoteAddr.String())
+
+	// Parse and mapping errors may quote the message, so only their HL7 error code is logged.
+	msg, err := hl7.Parse(data)
+	if err != nil {
+		hl7Err := asHl7Error(err)
+		logger.Warnf("Refused an HL7 v2 message which could not be parsed, with error code %v.", hl7Err.Code)
+		return mllpAck(nil, hl7Err, "")
+	}
+	logger = logger.WithField("message_control_id", msg.ControlId())
+
+	note, err := hl7.MdmToNote(msg)
+	if err != nil {
+		hl7Err := asHl7Error(err)
+		logger.Warnf("Refused an HL7 v2 message, with error code %v.", hl7Err.Code)
+		return mllpAck(msg, hl7Err, "")
+	}
+
+	req := &ehrpb.CreateNoteRequest{Note: note}
+	logger = logger.WithContext(contextWithSensitiveValues(ctx, req))
+	md := metadata.Pairs(IdempotencyKeyHeader, mdmIdempotencyKey(msg))
+	res, _, err := n.invokeUnary(ctx, "/"+noteServiceName+"/CreateNote", md, &peer.Peer{Addr: remoteAddr}, req,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return n.CreateNote(ctx, req.(*ehrpb.CreateNoteRequest))
+		})
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.InvalidArgument:
+		logger.Warn("Refused an invalid HL7 v2 document.")
+		return mllpAck(msg, &hl7.Error{Code: hl7.ErrCodeDataType, Text: status.Convert(err).Message()}, "")
+	default:
+		logger.Warn(NoteClerkErrWrap(err, ErrHandleMllpMessageFailsCreateNote, msg.ControlId()))
+		text := "The note could not be stored; send the message again later."
+		if status.Code(err) == codes.FailedPrecondition {
+			text = "A different document with the same unique document number (TXA-12) was already received."
+		}
+		return mllpAck(msg, &hl7.Error{Code: hl7.ErrCodeApplicationInternal, Text: text}, "")
+	}
+
+	noteGuid := res.(*ehrpb.CreateNoteResponse).GetNote().GetNoteGuid()
+	logger.Infof("Created note %v from an HL7 v2 message.", noteGuid)
+	return mllpAck(msg, nil, "Created note "+noteGuid)
+}
+
+// mdmIdempotencyKey identifies the document in msg by its sending facility and unique document number, so that it is
+// only stored once however many times it is sent. Documents without a unique document number are identified by the
+// message control id instead, which only catches the same message being sent again.
+func mdmIdempotencyKey(msg *hl7.Message) string {
+	facility := msg.Segment("MSH").Component(4, 1)
+	key := "hl7:" + facility + ":msg:" + msg.ControlId()
+	if number := hl7.UniqueDocumentNumber(msg); number != "" {
+		key = "hl7:" + facility + ":doc:" + number
+	}
+	if len(key) > MaxIdempotencyKeyLength {
+		sum := sha256.Sum256([]byte(key))
+		key = "hl7:" + hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+// mllpAck acknowledges msg, counting the acknowledgement code sent.
+func mllpAck(msg *hl7.Message, err *hl7.Error, text string) []byte {
+	code := hl7.AckAccept
+	if err != nil {
+		code = err.AckCode()
+	}
+	mllpMessagesTotal.WithLabelValues(code).Inc()
+
+	// MSH-10 is at most 20 characters
+	controlId := strings.Replace(uuid.New().String(), "-", "", -1)[:20]
+	return hl7.Ack(msg, err, text, controlId, time.Now())
+}
+
+func asHl7Error(err error) *hl7.Error {
+	var hl7Err *hl7.Error
+	if errors.As(err, &hl7Err) {
+		return hl7Err
+	}
+	return &hl7.Error{Code: hl7.ErrCodeApplicationInternal, Text: err.Error()}
+}
+
+// mllpCommand is a test client for the MLLP listener. It sends the HL7 v2 messages in each file, or on stdin for '-',
+// and prints the acknowledgement of each. Messages in a file begin with their MSH segment, and their segments may be
+// on separate lines.
+//
+//	noteclerk mllp send [-address host:port] [-timeout 10s] file ...
+func mllpCommand(args []string, out io.Writer) error {
+	action := ""
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	if action != "send" {
+		return NoteClerkErrNew(ErrMllpCommandFailsUnknownAction, action)
+	}
+
+	flags := flag.NewFlagSet("mllp", flag.ContinueOnError)
+	flags.SetOutput(out)
+	address := flags.String("address", "localhost:2575", "host:port of the MLLP listener")
+	timeout := flags.Duration("timeout", 10*time.Second, "time to wait for each acknowledgement")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var messages [][]byte
+	for _, path := range flags.Args() {
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = ioutil.ReadAll(commandInput)
+		} else {
+			data, err = ioutil.ReadFile(path)
+		}
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrMllpCommandFailsReadFile, path)
+		}
+		messages = append(messages, hl7.SplitMessages(data)...)
+	}
+	if len(messages) == 0 {
+		return NoteClerkErrNew(ErrMllpCommandFailsReadFile, strings.Join(flags.Args(), ", "))
+	}
+
+	client, err := hl7.Dial(*address, *timeout)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrMllpCommandFailsSend, 1, *address)
+	}
+	defer client.Close()
+
+	unaccepted := 0
+	for k, msg := range messages {
+		ack, err := client.Send(msg)
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrMllpCommandFailsSend, k+1, *address)
+		}
+		msa, errSegment := ack.Segment("MSA"), ack.Segment("ERR")
+		fmt.Fprintf(out, "%v: %v %v%v\n", msa.Component(2, 1), msa.Component(1, 1), msa.Component(3, 1),
+			errSegment.Component(8, 1))
+		if msa.Component(1, 1) != hl7.AckAccept {
+			unaccepted++
+		}
+	}
+	if unaccepted > 0 {
+		return NoteClerkErrNew(ErrMllpCommandFindsUnacceptedMessages, unaccepted, len(messages))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/noteclerk/hl7"
+)
+
+const exampleMdmPath = "example/mdm_t02.hl7"
+
+func exampleMdm(t *testing.T, replacements ...string) []byte {
+	data, err := ioutil.ReadFile(exampleMdmPath)
+	if err != nil {
+		t.Fatalf("Failed to read the example message: %v", err)
+	}
+	return hl7.SplitMessages([]byte(strings.NewReplacer(replacements...).Replace(string(data))))[0]
+}
+
+func sendMllpTestMessage(t *testing.T, s *Server, msg []byte) *hl7.Segment {
+	ack, err := hl7.Parse(s.handleMllpMessage(context.Background(), msg, &net.TCPAddr{}))
+	if err != nil {
+		t.Fatalf("Failed to parse the acknowledgement: %v", err)
+	}
+	return ack.Segment("MSA")
+}
+
+func TestHandleMllpMessage_CreatesNoteOncePerDocument(t *testing.T) {
+	s, db := newMockDbServer(t)
+	before, _ := db.AllNotes()
+
+	msa := sendMllpTestMessage(t, s, exampleMdm(t))
+	if msa.Field(1) != hl7.AckAccept || msa.Field(2) != "MSG0001" {
+		t.Fatalf("Expected the message to be accepted, but got MSA %v|%v|%v", msa.Field(1), msa.Field(2), msa.Field(3))
+	}
+	after, _ := db.AllNotes()
+	if len(after) != len(before)+1 {
+		t.Fatalf("Expected one note to be created, but there are %v notes, up from %v", len(after), len(before))
+	}
+	note := after[len(after)-1]
+	if note.GetPatientGuid() != "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c6d" || len(note.GetFragments()) != 2 {
+		t.Fatalf("Expected the note to be mapped from the message, but got %v", note)
+	}
+
+	// The vendor sends the document again, in a new message, because it did not see the acknowledgement
+	msa = sendMllpTestMessage(t, s, exampleMdm(t, "MSG0001", "MSG0002"))
+	if msa.Field(1) != hl7.AckAccept || !strings.HasSuffix(msa.Field(3), note.GetNoteGuid()) {
+		t.Fatalf("Expected the repeated document to be accepted as note %v, but got MSA %v|%v", note.GetNoteGuid(),
+			msa.Field(1), msa.Field(3))
+	}
+	if again, _ := db.AllNotes(); len(again) != len(after) {
+		t.Fatalf("Expected the repeated document not to create another note")
+	}
+
+	msa = sendMllpTestMessage(t, s, exampleMdm(t, "MSG0001", "MSG0003", "two hours", "three hours"))
+	if msa.Field(1) != hl7.AckError {
+		t.Fatalf("Expected a different document with the same number to be refused, but got %v", msa.Field(1))
+	}
+}
+
+func TestHandleMllpMessage_RefusesInvalidMessages(t *testing.T) {
+	s, db := newMockDbServer(t)
+	before, _ := db.AllNotes()
+
+	tests := []struct {
+		name string
+		msg  []byte
+		ack  string
+	}{
+		{"malformed message", []byte("not hl7"), hl7.AckReject},
+		{"unsupported message type", exampleMdm(t, "MDM^T02", "ADT^A08"), hl7.AckReject},
+		{"patient which is not a GUID", exampleMdm(t, "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c6d", "MRN123"), hl7.AckError},
+		{"unknown completion status", exampleMdm(t, "|LA||AV", "|XX||AV"), hl7.AckError},
+	}
+	for _, tt := range tests {
+		if msa := sendMllpTestMessage(t, s, tt.msg); msa.Field(1) != tt.ack {
+			t.Fatalf("Expected a %v to be answered with %v, but got %v", tt.name, tt.ack, msa.Field(1))
+		}
+	}
+	if after, _ := db.AllNotes(); len(after) != len(before) {
+		t.Fatalf("Expected no notes to be created from invalid messages")
+	}
+}
+
+func TestHandleMllpMessage_RefusalsDoNotLogMessageValues(t *testing.T) {
+	buf := captureLog(t)
+	s, _ := newMockDbServer(t)
+
+	msg := exampleMdm(t, "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c6d", "MRN12345")
+	if msa := sendMllpTestMessage(t, s, msg); msa.Field(1) != hl7.AckError {
+		t.Fatalf("Expected a patient which is not a GUID to be refused, but got %v", msa.Field(1))
+	}
+	if strings.Contains(buf.String(), "MRN12345") {
+		t.Fatalf("Expected the refusal to be logged without the MRN, but the log holds %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "/ehrpb.NoteService/CreateNote") {
+		t.Fatalf("Expected the message to be logged as a CreateNote RPC, but the log holds %q", buf.String())
+	}
+}
+
+func TestMllpCommand_Send(t *testing.T) {
+	s, _ := newMockDbServer(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := s.serveMllp(lis)
+	defer srv.Shutdown(context.Background())
+
+	var out bytes.Buffer
+	if err := mllpCommand([]string{"send", "-address", lis.Addr().String(), exampleMdmPath}, &out); err != nil {
+		t.Fatalf("mllp send should succeed, but returned %v: %v", err, out.String())
+	}
+	if !strings.HasPrefix(out.String(), "MSG0001: AA Created note ") {
+		t.Fatalf("Expected the acknowledgement to be printed, but got %q", out.String())
+	}
+
+	input := commandInput
+	defer func() { commandInput = input }()
+	commandInput = strings.NewReader(strings.Replace(string(exampleMdm(t)), "|LA||AV", "|XX||AV", 1))
+	out.Reset()
+	if err := mllpCommand([]string{"send", "-address", lis.Addr().String(), "-"}, &out); err == nil {
+		t.Fatalf("mllp send should fail when a message is refused, but printed %q", out.String())
+	}
+	if !strings.Contains(out.String(), "AE") {
+		t.Fatalf("Expected the refusal to be printed, but got %q", out.String())
+	}
+}
@@ -1,17 +1,36 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
 	"github.com/geekmdio/noted"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"sort"
+	"sync"
+	"time"
 )
 
 // MockDb implements RDBMSAccessor, but the database is simply a slice of Note pointers. Used in unit testing.
 type MockDb struct {
-	db []*ehrpb.Note
+	db              []*ehrpb.Note
+	idempotencyKeys map[string]*IdempotencyRecord
+
+	// Guards events, eventCursors, webhookSubscriptions and deadLetters, which the event relay reads while notes are
+	// written.
+	eventsMu             sync.Mutex
+	events               []*NoteEvent
+	eventCursors         map[string]*mockEventCursor
+	webhookSubscriptions []*WebhookSubscription
+	deadLetters          []*WebhookDeadLetter
+}
+
+// mockEventCursor is the offset a consumer has received events up to, and the owner holding it until expiresAt.
+type mockEventCursor struct {
+	offset    int64
+	owner     string
+	expiresAt time.Time
 }
 
 // The database should be initialized after instantiation for all structs implementing the RDBMSAccessor interface.
@@ -19,7 +38,34 @@ func (m *MockDb) Initialize(config *Config) error {
 	var notes []*ehrpb.Note
 	notes = append(notes, buildNote1(), buildNote2())
 	m.db = notes
+	m.idempotencyKeys = make(map[string]*IdempotencyRecord)
+	m.eventsMu.Lock()
+	m.events = nil
+	m.eventCursors = make(map[string]*mockEventCursor)
+	m.webhookSubscriptions = nil
+	m.deadLetters = nil
+	m.eventsMu.Unlock()
+
+	return nil
+}
+
+// There is no connection to close for the mock database.
+func (m *MockDb) Close() error {
+	return nil
+}
+
+// There is no connection pool to configure for the mock database.
+func (m *MockDb) ConfigurePool(config *Config) error {
+	return nil
+}
 
+// The mock database ignores contexts, so it is returned as it is.
+func (m *MockDb) WithContext(ctx context.Context) RDBMSAccessor {
+	return m
+}
+
+// The mock database is always healthy.
+func (m *MockDb) CheckHealth(ctx context.Context) error {
 	return nil
 }
 
@@ -32,6 +78,7 @@ func (m *MockDb) AddNote(note *ehrpb.Note) (id int64, guid string, err error) {
 	note.Id = m.generateUniqueId()
 
 	m.db = append(m.db, note)
+	m.addNoteEvents(noteCreatedEvents(note))
 
 	return note.GetId(), note.GetNoteGuid(), nil
 }
@@ -53,7 +100,9 @@ func (m *MockDb) UpdateNote(note *ehrpb.Note) error {
 	if !found {
 		return errors.New("cannot update note because it could not be found")
 	}
+	prior := m.db[noteIndex]
 	m.db[noteIndex] = note
+	m.addNoteEvents(noteUpdatedEvents(prior, note, nil))
 
 	return nil
 }
@@ -75,6 +124,7 @@ func (m *MockDb) DeleteNote(guid string) error {
 		return fmt.Errorf("note with guid %v not located in database", guid)
 	}
 
+	m.addNoteEvents([]*NoteEvent{newNoteEvent(EventNoteDeleted, m.db[index])})
 	var newDb []*ehrpb.Note
 	newDb = append(newDb, m.db[:index]...)
 	newDb = append(newDb, m.db[index+1:]...)
@@ -171,8 +221,249 @@ func (m *MockDb) GetNoteFragmentTagsByNoteFragmentGuid(noteFragGuid string) (tag
 	panic("implement me")
 }
 
-func (*MockDb) createSchema() error {
-	panic("implement me")
+// Add a note to the mock database and record its response against the idempotency key, or return the record of the
+// unexpired request already holding the key.
+func (m *MockDb) AddNoteWithIdempotencyKey(note *ehrpb.Note, record *IdempotencyRecord) (id int64,
+	existing *IdempotencyRecord, err error) {
+	k := mockIdempotencyKey(record.Principal, record.Key)
+	if existing, ok := m.idempotencyKeys[k]; ok && existing.ExpiresAt.After(time.Now()) {
+		return 0, existing, nil
+	}
+	id, _, err = m.AddNote(note)
+	if err != nil {
+		return 0, nil, err
+	}
+	m.idempotencyKeys[k] = record
+	return id, nil, nil
+}
+
+// mockIdempotencyKey scopes an idempotency key to the principal which sent it.
+func mockIdempotencyKey(principal string, key string) string {
+	return principal + "\x00" + key
+}
+
+func (m *MockDb) DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	var deleted int64
+	for k, v := range m.idempotencyKeys {
+		if v.ExpiresAt.Before(now) {
+			delete(m.idempotencyKeys, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Record events in the mock outbox. They are given offsets by SequenceNoteEvents.
+func (m *MockDb) addNoteEvents(events []*NoteEvent) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	m.events = append(m.events, events...)
+}
+
+// Give offsets to the events recorded since the last call; the mock outbox is in the order events were recorded.
+func (m *MockDb) SequenceNoteEvents() (int64, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	for k, v := range m.events {
+		v.Offset = int64(k + 1)
+	}
+	return int64(len(m.events)), nil
+}
+
+// Return copies of up to limit events with offsets greater than offset.
+func (m *MockDb) NoteEventsAfter(offset int64, limit int) ([]*NoteEvent, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	events := make([]*NoteEvent, 0)
+	for _, v := range m.events {
+		if v.Offset > offset && len(events) < limit {
+			e := *v
+			events = append(events, &e)
+		}
+	}
+	return events, nil
+}
+
+func (m *MockDb) ClaimNoteEventCursor(consumer string, owner string, lease time.Duration) (int64, bool, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	if m.eventCursors == nil {
+		m.eventCursors = make(map[string]*mockEventCursor)
+	}
+	cursor, ok := m.eventCursors[consumer]
+	if !ok {
+		cursor = &mockEventCursor{}
+		m.eventCursors[consumer] = cursor
+	} else if cursor.owner != owner && cursor.expiresAt.After(time.Now()) {
+		return 0, false, nil
+	}
+	cursor.owner = owner
+	cursor.expiresAt = time.Now().Add(lease)
+	return cursor.offset, true, nil
+}
+
+func (m *MockDb) AdvanceNoteEventCursor(consumer string, owner string, offset int64, lease time.Duration) error {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	cursor, ok := m.eventCursors[consumer]
+	if !ok || cursor.owner != owner {
+		return fmt.Errorf("event cursor of %v is not claimed by %v", consumer, owner)
+	}
+	cursor.offset = offset
+	cursor.expiresAt = time.Now().Add(lease)
+	return nil
+}
+
+func (m *MockDb) AddWebhookSubscription(sub *WebhookSubscription) error {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	stored := *sub
+	m.webhookSubscriptions = append(m.webhookSubscriptions, &stored)
+	return nil
+}
+
+// Return copies of the webhook subscriptions, in the order they were added.
+func (m *MockDb) WebhookSubscriptions() ([]*WebhookSubscription, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	subs := make([]*WebhookSubscription, 0)
+	for _, v := range m.webhookSubscriptions {
+		sub := *v
+		subs = append(subs, &sub)
+	}
+	return subs, nil
+}
+
+// Remove the subscription with its dead letters and event cursor, as the database would.
+func (m *MockDb) DeleteWebhookSubscription(guid string) (bool, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	for k, v := range m.webhookSubscriptions {
+		if v.Guid != guid {
+			continue
+		}
+		m.webhookSubscriptions = append(m.webhookSubscriptions[:k], m.webhookSubscriptions[k+1:]...)
+		letters := m.deadLetters[:0]
+		for _, l := range m.deadLetters {
+			if l.SubscriptionGuid != guid {
+				letters = append(letters, l)
+			}
+		}
+		m.deadLetters = letters
+		delete(m.eventCursors, v.consumer())
+		return true, nil
+	}
+	return false, nil
+}
+
+// Add notes as they are, skipping those whose GUID is present. A fragment GUID which is taken rejects the notes, as
+// the unique index on note_fragment_guid would.
+func (m *MockDb) ImportNotes(notes []*ehrpb.Note) ([]string, error) {
+	existing := make(map[string]bool)
+	for _, v := range m.db {
+		existing[v.GetNoteGuid()] = true
+		for _, f := range v.GetFragments() {
+			existing[f.GetNoteFragmentGuid()] = true
+		}
+	}
+
+	var skipped, added []*ehrpb.Note
+	for _, v := range notes {
+		if existing[v.GetNoteGuid()] {
+			skipped = append(skipped, v)
+			continue
+		}
+		for _, f := range v.GetFragments() {
+			if existing[f.GetNoteFragmentGuid()] {
+				return nil, &importRejectedError{err: fmt.Errorf("note fragment %v already exists", f.GetNoteFragmentGuid())}
+			}
+			existing[f.GetNoteFragmentGuid()] = true
+		}
+		added = append(added, v)
+	}
+	for _, v := range added {
+		v.Id = m.generateUniqueId()
+		m.db = append(m.db, v)
+	}
+
+	guids := make([]string, 0)
+	for _, v := range skipped {
+		guids = append(guids, v.GetNoteGuid())
+	}
+	return guids, nil
+}
+
+// Return the notes matching filter after the position after, ordered as DbPostgres orders them.
+func (m *MockDb) ExportNotes(filter NoteExportFilter, after NoteExportMark, limit int) ([]*ehrpb.Note,
+	NoteExportMark, error) {
+	changed := make(map[string]int64)
+	m.eventsMu.Lock()
+	for _, e := range m.events {
+		if e.Offset > filter.ChangedAfter && e.Offset <= filter.ChangedUntil {
+			for _, guid := range []string{e.NoteGuid, e.PreviousNoteGuid} {
+				if guid != "" && e.Offset > changed[guid] {
+					changed[guid] = e.Offset
+				}
+			}
+		}
+	}
+	m.eventsMu.Unlock()
+
+	// The seed notes have no ids, so notes are told apart by their position in the mock database instead
+	var marks []NoteExportMark
+	notes := make(map[int64]*ehrpb.Note)
+	for k, v := range m.db {
+		created := time.Unix(v.GetDateCreated().GetSeconds(), int64(v.GetDateCreated().GetNanos())).UTC()
+		mark := NoteExportMark{DateCreated: created, Offset: changed[v.GetNoteGuid()], NoteId: int64(k + 1)}
+		if (len(filter.PatientGuids) > 0 && !containsString(filter.PatientGuids, v.GetPatientGuid())) ||
+			(!filter.CreatedFrom.IsZero() && created.Unix() < filter.CreatedFrom.Unix()) ||
+			(!filter.CreatedTo.IsZero() && created.Unix() >= filter.CreatedTo.Unix()) ||
+			(filter.ChangedUntil > 0 && mark.Offset == 0) {
+			continue
+		}
+		typeMatches := len(filter.Types) == 0
+		for _, t := range filter.Types {
+			typeMatches = typeMatches || t == v.GetType()
+		}
+		if typeMatches && mockExportMarkBefore(after, mark, filter.ChangedUntil > 0) {
+			marks = append(marks, mark)
+			notes[mark.NoteId] = v
+		}
+	}
+	sort.Slice(marks, func(i, j int) bool {
+		return mockExportMarkBefore(marks[i], marks[j], filter.ChangedUntil > 0)
+	})
+
+	page := make([]*ehrpb.Note, 0)
+	for _, v := range marks {
+		if len(page) == limit {
+			break
+		}
+		page = append(page, notes[v.NoteId])
+		after = v
+	}
+	return page, after, nil
+}
+
+func mockExportMarkBefore(a NoteExportMark, b NoteExportMark, byOffset bool) bool {
+	if byOffset && a.Offset != b.Offset {
+		return a.Offset < b.Offset
+	}
+	if !byOffset && !a.DateCreated.Equal(b.DateCreated) {
+		return a.DateCreated.Before(b.DateCreated)
+	}
+	return a.NoteId < b.NoteId
+}
+
+func (m *MockDb) AddWebhookDeadLetter(letter *WebhookDeadLetter) error {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	m.deadLetters = append(m.deadLetters, letter)
+	return nil
+}
+
+func (*MockDb) migrate() error {
+	return nil
 }
 
 func (m *MockDb) generateUniqueId() int64 {
@@ -1,19 +1,31 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
 	"github.com/geekmdio/noted"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"strings"
+	"time"
 )
 
-// DbPostgres implements RDBMSAccessor; purpose is to access the database via the Postgres driver.
+// DefaultDbMaxIdleConns matches the database/sql default, which applies when DbMaxIdleConns is not set.
+const DefaultDbMaxIdleConns = 2
+
+// DbPostgres implements RDBMSAccessor; purpose is to access the database via the Postgres driver. Copies returned by
+// WithContext share the connection pool but carry their own context. Changes to notes are written in a transaction,
+// along with the note events describing them.
 type DbPostgres struct {
-	db *sql.DB
+	db  *sql.DB
+	tx  *sql.Tx
+	ctx context.Context
 }
 
 // Initialize() initializes the connection to database. Ensure that the ./config/config.<environment>.json
@@ -22,27 +34,171 @@ type DbPostgres struct {
 // RETURNS: *sql.db, error
 func (d *DbPostgres) Initialize(config *Config) error {
 
-	connStr := generateConnStrFromCfg(config)
-
-	var err error
-	if d.db, err = sql.Open("postgres", connStr); err != nil {
-		return NoteClerkErrWrap(err, ErrDbPostgresInitializeFailsOpenConn)
+	d.db = openPostgres(config)
+	if err := d.ConfigurePool(config); err != nil {
+		d.db.Close()
+		return err
 	}
-	defer d.db.Close()
 
-	if err = d.db.Ping(); err != nil {
+	if err := d.db.Ping(); err != nil {
+		d.db.Close()
 		return NoteClerkErrWrap(err, ErrDbPostgresInitializeFailsDbPing)
 	}
 
-	if schemaErr := d.createSchema(); schemaErr != nil {
+	if schemaErr := d.migrate(); schemaErr != nil {
+		d.db.Close()
 		return NoteClerkErrWrap(schemaErr, ErrDbPostgresInitializeFailsSchemaCreation)
 	}
 
 	return nil
 }
 
+// Close closes the connection pool opened by Initialize, waiting for queries in progress to finish. It is safe to
+// call on a database which was never initialized.
+func (d *DbPostgres) Close() error {
+	if d.db == nil {
+		return nil
+	}
+	if err := d.db.Close(); err != nil {
+		return NoteClerkErrWrap(err, ErrDbPostgresCloseFailsDbClose)
+	}
+	return nil
+}
+
+// ConfigurePool applies the DbMaxOpenConns, DbMaxIdleConns and DbConnMaxLifetime settings to the connection pool.
+// Open connections are kept; connections beyond a lowered limit are closed as they are returned to the pool.
+// RETURNS: error
+func (d *DbPostgres) ConfigurePool(config *Config) error {
+	var lifetime time.Duration
+	if config.DbConnMaxLifetime != "" {
+		var err error
+		lifetime, err = time.ParseDuration(config.DbConnMaxLifetime)
+		if err != nil || lifetime <= 0 {
+			return NoteClerkErrWrap(err, ErrDbPostgresConfigurePoolFailsInvalidLifetime, config.DbConnMaxLifetime)
+		}
+	}
+	maxIdle := config.DbMaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = DefaultDbMaxIdleConns
+	}
+
+	d.db.SetMaxOpenConns(config.DbMaxOpenConns)
+	d.db.SetMaxIdleConns(maxIdle)
+	d.db.SetConnMaxLifetime(lifetime)
+	return nil
+}
+
+// WithContext returns a DbPostgres sharing this connection pool whose queries run with ctx, so that they are cancelled
+// with the request and traced as children of its span.
+// RETURNS: RDBMSAccessor
+func (d *DbPostgres) WithContext(ctx context.Context) RDBMSAccessor {
+	scoped := *d
+	scoped.ctx = ctx
+	return &scoped
+}
+
+func (d *DbPostgres) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// sqlRunner runs statements. Both the connection pool and a transaction are sqlRunners.
+type sqlRunner interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// runner returns the transaction statements should run in, or the connection pool outside of a transaction.
+func (d *DbPostgres) runner() sqlRunner {
+	if d.tx != nil {
+		return d.tx
+	}
+	return d.db
+}
+
+// inTransaction runs fn with a DbPostgres whose statements run in a single transaction, which is committed if fn
+// returns nil and rolled back otherwise. Within a transaction, fn joins it. A transaction uses a single connection, so
+// rows must be read to the end before the next statement is run.
+// RETURNS: error
+func (d *DbPostgres) inTransaction(fn func(tx *DbPostgres) error) error {
+	if d.tx != nil {
+		return fn(d)
+	}
+
+	tx, err := d.db.BeginTx(d.context(), nil)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrDbPostgresBeginTransactionFails)
+	}
+	scoped := *d
+	scoped.tx = tx
+	if err := fn(&scoped); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return NoteClerkErrWrap(err, ErrDbPostgresCommitTransactionFails)
+	}
+	return nil
+}
+
+// query, queryRow and exec run a statement with the DbPostgres context, inside a span of its own.
+func (d *DbPostgres) query(query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(d.context(), query)
+	rows, err := d.runner().QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (d *DbPostgres) queryRow(query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(d.context(), query)
+	row := d.runner().QueryRowContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+func (d *DbPostgres) exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(d.context(), query)
+	res, err := d.runner().ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return res, err
+}
+
+// Stats returns the statistics of the connection pool, which are exported as metrics.
+func (d *DbPostgres) Stats() sql.DBStats {
+	if d.db == nil {
+		return sql.DBStats{}
+	}
+	return d.db.Stats()
+}
+
+// CheckHealth reports whether the database is reachable and every embedded migration has been applied to it.
+// RETURNS: error, or nil when the database is ready to serve requests
+func (d *DbPostgres) CheckHealth(ctx context.Context) error {
+	if d.db == nil {
+		return NoteClerkErrNew(ErrDbPostgresCheckHealthFailsNotInitialized)
+	}
+	if err := d.db.PingContext(ctx); err != nil {
+		return NoteClerkErrWrap(err, ErrDbPostgresCheckHealthFailsPing)
+	}
+	m, err := NewMigrator(d.db)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrDbPostgresCheckHealthFailsReadMigrations)
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrDbPostgresCheckHealthFailsReadMigrations)
+	}
+	if pending > 0 {
+		return NoteClerkErrNew(ErrDbPostgresCheckHealthFailsPendingMigrations, pending)
+	}
+	return nil
+}
+
 func (d *DbPostgres) GetNoteFragmentsByNoteGuid(noteGuid string) ([]*ehrpb.NoteFragment, error) {
-	rows, err := d.db.Query(getNoteFragmentByNoteGuidQuery, noteGuid)
+	rows, err := d.query(getNoteFragmentByNoteGuidQuery, noteGuid)
 	if err != nil {
 		return nil, NoteClerkErrWrap(err, ErrDbPostgresGetNoteFragmentsByNoteGuidFailsQuery)
 	}
@@ -53,19 +209,24 @@ func (d *DbPostgres) GetNoteFragmentsByNoteGuid(noteGuid string) ([]*ehrpb.NoteF
 		tmp := noted.NewNoteFragment()
 		if err := rows.Scan(&tmp.Id, &tmp.DateCreated.Seconds, &tmp.DateCreated.Nanos, &tmp.NoteFragmentGuid,
 			&tmp.NoteGuid, &tmp.Icd_10Code, &tmp.Icd_10Long, &tmp.Description, &tmp.Status,
-			&tmp.Priority, &tmp.Topic, &tmp.Content); err != nil {
+			&tmp.Priority, &tmp.Topic, &tmp.Content, &tmp.IssueGuid); err != nil {
 			return nil, NoteClerkErrWrap(err, ErrDbPostgresGetNoteFragmentsByNoteGuidFailsScan)
 		}
-		if tmp.Tags, err = d.GetNoteFragmentTagsByNoteFragmentGuid(tmp.GetNoteFragmentGuid()); err != nil {
+		noteFragments = append(noteFragments, tmp)
+	}
+	rows.Close()
+
+	// Tags are read once the fragments have been, so that this also works within a transaction
+	for _, v := range noteFragments {
+		if v.Tags, err = d.GetNoteFragmentTagsByNoteFragmentGuid(v.GetNoteFragmentGuid()); err != nil {
 			return nil, NoteClerkErrWrap(err, ErrDbPostgresGetNoteFragmentsByNoteGuidFailsGetTags)
 		}
-		noteFragments = append(noteFragments, tmp)
 	}
 	return noteFragments, nil
 }
 
 func (d *DbPostgres) GetNoteTagsByNoteGuid(noteGuid string) (tag []string, err error) {
-	rows, err := d.db.Query(getNoteTagByNoteGuidQuery, noteGuid)
+	rows, err := d.query(getNoteTagByNoteGuidQuery, noteGuid)
 	if err != nil {
 		return nil, NoteClerkErrWrap(err, ErrDbPostgresGetNoteTagsByNoteGuidQueryFails)
 	}
@@ -86,7 +247,7 @@ func (d *DbPostgres) GetNoteTagsByNoteGuid(noteGuid string) (tag []string, err e
 }
 
 func (d *DbPostgres) GetNoteFragmentTagsByNoteFragmentGuid(noteFragGuid string) (tag []string, err error) {
-	rows, err := d.db.Query(getNoteFragmentTagsByNoteFragmentGuidQuery, noteFragGuid)
+	rows, err := d.query(getNoteFragmentTagsByNoteFragmentGuidQuery, noteFragGuid)
 	if err != nil {
 		return nil, NoteClerkErrWrap(err, ErrDbPostgresGetNoteFragTagByNoteGuidQueryFails)
 	}
@@ -106,21 +267,35 @@ func (d *DbPostgres) GetNoteFragmentTagsByNoteFragmentGuid(noteFragGuid string)
 	return tags, nil
 }
 
+// AddNote adds the note, its tags and its fragments, and records the NoteCreated event.
+// RETURNS: int64 (the note's id), string (the note's GUID), error
 func (d *DbPostgres) AddNote(n *ehrpb.Note) (id int64, guid string, err error) {
+	err = d.inTransaction(func(tx *DbPostgres) error {
+		if err := tx.addNote(n); err != nil {
+			return err
+		}
+		return tx.addNoteEvents(noteCreatedEvents(n))
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return n.GetId(), n.GetNoteGuid(), nil
+}
 
-	row := d.db.QueryRow(addNoteQuery, n.DateCreated.GetSeconds(), n.DateCreated.GetNanos(),
+func (d *DbPostgres) addNote(n *ehrpb.Note) error {
+	row := d.queryRow(addNoteQuery, n.DateCreated.GetSeconds(), n.DateCreated.GetNanos(),
 		n.GetNoteGuid(), n.GetVisitGuid(), n.GetAuthorGuid(), n.GetPatientGuid(), n.GetType(),
 		n.GetStatus())
 
 	if err := row.Scan(&n.Id); err != nil {
-		return 0, "", NoteClerkErrWrap(err, ErrDbPostgresAddNoteFailsScan)
+		return NoteClerkErrWrap(err, ErrDbPostgresAddNoteFailsScan)
 	}
 
 	for _, v := range n.GetTags() {
 		_, err := d.AddNoteTag(n.GetNoteGuid(), v)
 
 		if err != nil {
-			return 0, "", NoteClerkErrWrap(err, ErrDbPostgresAddNoteFailsToAddNoteTags)
+			return NoteClerkErrWrap(err, ErrDbPostgresAddNoteFailsToAddNoteTags)
 		}
 	}
 
@@ -128,42 +303,73 @@ func (d *DbPostgres) AddNote(n *ehrpb.Note) (id int64, guid string, err error) {
 		_, _, err := d.AddNoteFragment(v)
 
 		if err != nil {
-			return 0, "", NoteClerkErrWrap(err, ErrDbPostgresAddNoteFailsToAddNoteFragments)
+			return NoteClerkErrWrap(err, ErrDbPostgresAddNoteFailsToAddNoteFragments)
 		}
 	}
 
-	return n.GetId(), n.GetNoteGuid(), nil
+	return nil
 }
 
+// UpdateNote marks the note with the GUID of n deleted and adds n in its place, under a new GUID, recording the
+// NoteUpdated event. Fragments of n are also given new GUIDs; those which carried the GUID of one of the prior note's
+// fragments are recorded as superseding it.
+// RETURNS: error
 func (d *DbPostgres) UpdateNote(n *ehrpb.Note) error {
-	err := d.DeleteNote(n.GetNoteGuid())
-	if err != nil {
-		return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFailsToChangeStatusToDeleted)
-	}
-	n.NoteGuid = uuid.New().String()
-	for _, v := range n.GetFragments() {
-		v.NoteFragmentGuid = uuid.New().String()
-		v.NoteGuid = n.NoteGuid
-	}
-	_, _, err = d.AddNote(n)
-	if err != nil {
-		return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFailsToChangeStatusToDeleted)
-	}
-	return nil
+	return d.inTransaction(func(tx *DbPostgres) error {
+		prior, err := tx.GetNoteByGuid(n.GetNoteGuid())
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFailsToChangeStatusToDeleted)
+		}
+		if err := tx.deleteNote(prior); err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFailsToChangeStatusToDeleted)
+		}
+
+		priorFragments := make(map[string]bool)
+		for _, v := range prior.GetFragments() {
+			if v.GetStatus() != ehrpb.RecordStatus_DELETED {
+				priorFragments[v.GetNoteFragmentGuid()] = true
+			}
+		}
+		supersedes := make(map[string]string)
+		n.NoteGuid = uuid.New().String()
+		for _, v := range n.GetFragments() {
+			next := uuid.New().String()
+			if priorFragments[v.GetNoteFragmentGuid()] {
+				supersedes[next] = v.GetNoteFragmentGuid()
+			}
+			v.NoteFragmentGuid = next
+			v.NoteGuid = n.NoteGuid
+		}
+		if err := tx.addNote(n); err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFailsToAddUpdatedNote)
+		}
+		return tx.addNoteEvents(noteUpdatedEvents(prior, n, supersedes))
+	})
 }
 
+// DeleteNote marks the note and its fragments deleted, and records the NoteDeleted event.
+// RETURNS: error
 func (d *DbPostgres) DeleteNote(guid string) error {
-	note, getNoteErr := d.GetNoteByGuid(guid)
-	if getNoteErr != nil {
-		return getNoteErr
-	}
+	return d.inTransaction(func(tx *DbPostgres) error {
+		note, err := tx.GetNoteByGuid(guid)
+		if err != nil {
+			return err
+		}
+		if err := tx.deleteNote(note); err != nil {
+			return err
+		}
+		return tx.addNoteEvents([]*NoteEvent{newNoteEvent(EventNoteDeleted, note)})
+	})
+}
+
+func (d *DbPostgres) deleteNote(note *ehrpb.Note) error {
 	for _, v := range note.GetFragments() {
 		delErr := d.DeleteNoteFragment(v.GetNoteFragmentGuid())
 		if delErr != nil {
 			return delErr
 		}
 	}
-	row := d.db.QueryRow(updateNoteStatusToStatusByNoteGuidQuery, ehrpb.RecordStatus_DELETED, guid)
+	row := d.queryRow(updateNoteStatusToStatusByNoteGuidQuery, ehrpb.RecordStatus_DELETED, note.GetNoteGuid())
 	var newId int64
 	scanErr := row.Scan(&newId)
 	if scanErr != nil {
@@ -173,7 +379,7 @@ func (d *DbPostgres) DeleteNote(guid string) error {
 }
 
 func (d *DbPostgres) AllNotes() ([]*ehrpb.Note, error) {
-	rows, err := d.db.Query(getAllNotesQuery)
+	rows, err := d.query(getAllNotesQuery)
 	if err != nil {
 		return nil, NoteClerkErrWrap(err, ErrDbPostgresAllNotesFailsQuery)
 	}
@@ -205,7 +411,7 @@ func (d *DbPostgres) AllNotes() ([]*ehrpb.Note, error) {
 }
 
 func (d *DbPostgres) AddNoteTag(noteGuid string, tag string) (id int64, err error) {
-	row := d.db.QueryRow(addNoteTagQuery, noteGuid, tag)
+	row := d.queryRow(addNoteTagQuery, noteGuid, tag)
 
 	var newId int64
 	if err := row.Scan(&newId); err != nil {
@@ -216,7 +422,7 @@ func (d *DbPostgres) AddNoteTag(noteGuid string, tag string) (id int64, err erro
 }
 
 func (d *DbPostgres) GetNoteByGuid(guid string) (*ehrpb.Note, error) {
-	row := d.db.QueryRow(getNoteByGuidQuery, guid)
+	row := d.queryRow(getNoteByGuidQuery, guid)
 
 	newNote := noted.NewNote()
 	err := row.Scan(&newNote.Id, &newNote.DateCreated.Seconds, &newNote.DateCreated.Nanos, &newNote.NoteGuid,
@@ -252,7 +458,7 @@ func (d *DbPostgres) FindNotes(filter NoteFindFilter) ([]*ehrpb.Note, error) {
 	}
 	transEmptyFieldToWildcard(&filter)
 
-	rows, err := d.db.Query(getNotesByFindQuery, filter.AuthorGuid, filter.VisitGuid, filter.PatientGuid)
+	rows, err := d.query(getNotesByFindQuery, filter.AuthorGuid, filter.VisitGuid, filter.PatientGuid)
 	if err != nil {
 		return nil, NoteClerkErrWrap(err, ErrDbPostgresFindNotesFailsQuery)
 	}
@@ -311,7 +517,7 @@ func validateNoteFormFilterFields(queryFilter NoteFindFilter) error {
 }
 
 func (d *DbPostgres) AllNoteFragments() ([]*ehrpb.NoteFragment, error) {
-	rows, err := d.db.Query(getAllNoteFragmentsQuery)
+	rows, err := d.query(getAllNoteFragmentsQuery)
 
 	if err != nil {
 		return nil, NoteClerkErrWrap(err, ErrDbPostgresAllNoteFragmentsQueryFails)
@@ -323,7 +529,8 @@ func (d *DbPostgres) AllNoteFragments() ([]*ehrpb.NoteFragment, error) {
 		tmpFrag := noted.NewNoteFragment()
 		err := rows.Scan(&tmpFrag.Id, &tmpFrag.DateCreated.Seconds, &tmpFrag.DateCreated.Nanos,
 			&tmpFrag.NoteFragmentGuid, &tmpFrag.NoteGuid, &tmpFrag.Icd_10Code, &tmpFrag.Icd_10Long,
-			&tmpFrag.Description, &tmpFrag.Status, &tmpFrag.Priority, &tmpFrag.Topic, &tmpFrag.Content)
+			&tmpFrag.Description, &tmpFrag.Status, &tmpFrag.Priority, &tmpFrag.Topic, &tmpFrag.Content,
+			&tmpFrag.IssueGuid)
 
 		if err != nil {
 			return nil, NoteClerkErrWrap(err, ErrDbPostgresAllNoteFragmentsFailsScanRow)
@@ -341,9 +548,9 @@ func (d *DbPostgres) AllNoteFragments() ([]*ehrpb.NoteFragment, error) {
 }
 
 func (d *DbPostgres) AddNoteFragment(nf *ehrpb.NoteFragment) (id int64, guid string, err error) {
-	row := d.db.QueryRow(addNoteFragmentQuery, nf.DateCreated.Seconds, nf.DateCreated.Nanos,
+	row := d.queryRow(addNoteFragmentQuery, nf.DateCreated.Seconds, nf.DateCreated.Nanos,
 		nf.GetNoteFragmentGuid(), nf.GetNoteGuid(), nf.GetIcd_10Code(), nf.GetIcd_10Long(),
-		nf.GetDescription(), nf.GetStatus(), nf.GetPriority(), nf.GetTopic(), nf.GetContent())
+		nf.GetDescription(), nf.GetStatus(), nf.GetPriority(), nf.GetTopic(), nf.GetContent(), nf.GetIssueGuid())
 	scanErr := row.Scan(&nf.Id)
 	if scanErr != nil {
 		return 0, "", NoteClerkErrWrap(scanErr, ErrDbPostgresAddNoteFragmentFailsScan)
@@ -359,21 +566,30 @@ func (d *DbPostgres) AddNoteFragment(nf *ehrpb.NoteFragment) (id int64, guid str
 	return nf.GetId(), nf.GetNoteFragmentGuid(), nil
 }
 
+// UpdateNoteFragment adds a new version of the fragment n and marks n deleted, recording the FragmentSuperseded
+// event.
+// RETURNS: error
 func (d *DbPostgres) UpdateNoteFragment(n *ehrpb.NoteFragment) error {
+	return d.inTransaction(func(tx *DbPostgres) error {
+		newFrag := buildNewFragmentFromOldFragment(n)
 
-	newFrag := buildNewFragmentFromOldFragment(n)
-
-	_, _, err := d.AddNoteFragment(newFrag)
-	if err != nil {
-		return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFragmentFailsAddNewNoteFragment)
-	}
+		_, _, err := tx.AddNoteFragment(newFrag)
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFragmentFailsAddNewNoteFragment)
+		}
 
-	err = d.DeleteNoteFragment(n.GetNoteFragmentGuid())
-	if err != nil {
-		return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFragmentFailsDeletePriorNoteFragment)
-	}
+		err = tx.DeleteNoteFragment(n.GetNoteFragmentGuid())
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFragmentFailsDeletePriorNoteFragment)
+		}
 
-	return nil
+		note, err := tx.GetNoteByGuid(n.GetNoteGuid())
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresUpdateNoteFragmentFailsGetNote)
+		}
+		return tx.addNoteEvents([]*NoteEvent{
+			fragmentSupersededEvent(note, n.GetNoteFragmentGuid(), newFrag.GetNoteFragmentGuid())})
+	})
 }
 
 func buildNewFragmentFromOldFragment(n *ehrpb.NoteFragment) *ehrpb.NoteFragment {
@@ -391,11 +607,10 @@ func buildNewFragmentFromOldFragment(n *ehrpb.NoteFragment) *ehrpb.NoteFragment
 	return newFrag
 }
 
-//TODO: Need to create row in table for issue_guid and set as additional foreign key.
 // This is not a true delete. It changes the status of the note to DELETED. Health care
 // records should not be deleted.
 func (d *DbPostgres) DeleteNoteFragment(noteFragmentGuid string) error {
-	row := d.db.QueryRow(updateNoteFragmentStatusToStatusByNoteFragmentGuidQuery, ehrpb.RecordStatus_DELETED, noteFragmentGuid)
+	row := d.queryRow(updateNoteFragmentStatusToStatusByNoteFragmentGuidQuery, ehrpb.RecordStatus_DELETED, noteFragmentGuid)
 	var newId int64
 	scanErr := row.Scan(&newId)
 	//TODO: Custom error
@@ -418,7 +633,7 @@ func (d *DbPostgres) FindNoteFragments(filter NoteFragmentFindFilter) ([]*ehrpb.
 }
 
 func (d *DbPostgres) AddNoteFragmentTag(noteGuid string, tag string) (id int64, err error) {
-	row := d.db.QueryRow(addNoteFragmentTagQuery, noteGuid, tag)
+	row := d.queryRow(addNoteFragmentTagQuery, noteGuid, tag)
 
 	var newId int64
 	if err := row.Scan(&newId); err != nil {
@@ -428,53 +643,465 @@ func (d *DbPostgres) AddNoteFragmentTag(noteGuid string, tag string) (id int64,
 	return newId, nil
 }
 
-func generateConnStrFromCfg(config *Config) string {
-	connStr := fmt.Sprintf("user=%v password=%v host=%v dbname=%v sslmode=%v port=%v",
-		config.DbUsername, config.DbPassword, config.DbIp, config.DbName, config.DbSslMode, config.DbPort)
-	return connStr
+// AddNoteWithIdempotencyKey adds the note as AddNote does and, in the same transaction, records the key with
+// record.Response, which should carry the note, so the note is never added without its response being recorded. If the
+// principal already holds the key and it has not expired, nothing is added and the earlier record is returned instead;
+// a concurrent request with the same key waits for the first to commit or roll back. An expired key is taken over as if
+// it were new.
+// RETURNS: int64 (the note Id), *IdempotencyRecord (nil when the note was added), error
+func (d *DbPostgres) AddNoteWithIdempotencyKey(n *ehrpb.Note, record *IdempotencyRecord) (id int64,
+	existing *IdempotencyRecord, err error) {
+	err = d.inTransaction(func(tx *DbPostgres) error {
+		var reservedKey string
+		err := tx.queryRow(reserveIdempotencyKeyQuery, record.Principal, record.Key, record.Fingerprint,
+			record.ExpiresAt).Scan(&reservedKey)
+		if err == sql.ErrNoRows {
+			existing, err = tx.getIdempotencyKey(record.Principal, record.Key)
+			return err
+		}
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresAddNoteWithIdempotencyKeyFailsQuery)
+		}
+
+		if err := tx.addNote(n); err != nil {
+			return err
+		}
+		if err := tx.addNoteEvents(noteCreatedEvents(n)); err != nil {
+			return err
+		}
+		response, err := (&jsonpb.Marshaler{}).MarshalToString(record.Response)
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresAddNoteWithIdempotencyKeyFailsMarshalResponse)
+		}
+		_, err = tx.exec(completeIdempotencyKeyQuery, record.Principal, record.Key, response)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if existing != nil {
+		return 0, existing, nil
+	}
+	return n.GetId(), nil, nil
+}
+
+func (d *DbPostgres) getIdempotencyKey(principal string, key string) (*IdempotencyRecord, error) {
+	existing := &IdempotencyRecord{}
+	var response sql.NullString
+	err := d.queryRow(getIdempotencyKeyQuery, principal, key).Scan(&existing.Principal, &existing.Key,
+		&existing.Fingerprint, &response, &existing.ExpiresAt)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrDbPostgresAddNoteWithIdempotencyKeyFailsQuery)
+	}
+	if response.Valid {
+		existing.Response = &ehrpb.CreateNoteResponse{}
+		if err := jsonpb.UnmarshalString(response.String, existing.Response); err != nil {
+			return nil, NoteClerkErrWrap(err, ErrDbPostgresAddNoteWithIdempotencyKeyFailsReadResponse)
+		}
+	}
+	return existing, nil
+}
+
+// DeleteExpiredIdempotencyKeys removes every idempotency key which expired before now.
+// RETURNS: int64 (the number of keys deleted), error
+func (d *DbPostgres) DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	res, err := d.exec(deleteExpiredIdempotencyKeysQuery, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// addNoteEvents records events in the outbox. It is called in the transaction making the change they describe.
+// RETURNS: error
+func (d *DbPostgres) addNoteEvents(events []*NoteEvent) error {
+	for _, e := range events {
+		_, err := d.exec(addNoteEventQuery, e.Type, e.OccurredAt, e.NoteGuid, e.PreviousNoteGuid, e.NoteFragmentGuid,
+			e.PreviousNoteFragmentGuid, e.PatientGuid, e.AuthorGuid, e.VisitGuid, e.NoteType)
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresAddNoteEventsFailsExec, e.Type, e.NoteGuid)
+		}
+	}
+	return nil
+}
+
+// SequenceNoteEvents gives offsets to the events committed since it was last called, in the order they were recorded.
+// RETURNS: int64 (the latest offset), error
+func (d *DbPostgres) SequenceNoteEvents() (latest int64, err error) {
+	err = d.inTransaction(func(tx *DbPostgres) error {
+		if _, err := tx.exec(lockNoteEventSequenceQuery, noteEventSequenceAdvisoryLockKey); err != nil {
+			return err
+		}
+		if _, err := tx.exec(sequenceNoteEventsQuery); err != nil {
+			return err
+		}
+		return tx.queryRow(latestNoteEventOffsetQuery).Scan(&latest)
+	})
+	if err != nil {
+		return 0, NoteClerkErrWrap(err, ErrDbPostgresSequenceNoteEventsFailsQuery)
+	}
+	return latest, nil
+}
+
+// NoteEventsAfter returns up to limit events with offsets greater than offset, in offset order.
+// RETURNS: []*NoteEvent, error
+func (d *DbPostgres) NoteEventsAfter(offset int64, limit int) ([]*NoteEvent, error) {
+	rows, err := d.query(noteEventsAfterQuery, offset, limit)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrDbPostgresNoteEventsAfterFailsQuery, offset)
+	}
+	defer rows.Close()
+
+	events := make([]*NoteEvent, 0)
+	for rows.Next() {
+		e := &NoteEvent{}
+		if err := rows.Scan(&e.Offset, &e.Type, &e.OccurredAt, &e.NoteGuid, &e.PreviousNoteGuid, &e.NoteFragmentGuid,
+			&e.PreviousNoteFragmentGuid, &e.PatientGuid, &e.AuthorGuid, &e.VisitGuid, &e.NoteType); err != nil {
+			return nil, NoteClerkErrWrap(err, ErrDbPostgresNoteEventsAfterFailsScan)
+		}
+		e.OccurredAt = e.OccurredAt.UTC()
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// ClaimNoteEventCursor takes, or renews, the lease on the event cursor of consumer for owner. A cursor is claimed
+// only when it is new, already held by owner or its lease has expired.
+// RETURNS: int64 (the offset of the last event consumer received), bool (whether the cursor was claimed), error
+func (d *DbPostgres) ClaimNoteEventCursor(consumer string, owner string, lease time.Duration) (int64, bool, error) {
+	var offset int64
+	err := d.queryRow(claimNoteEventCursorQuery, consumer, owner, lease.Seconds()).Scan(&offset)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, NoteClerkErrWrap(err, ErrDbPostgresClaimNoteEventCursorFailsQuery, consumer)
+	}
+	return offset, true, nil
+}
+
+// AdvanceNoteEventCursor records that consumer received the events up to offset and renews owner's lease on its
+// cursor. It fails if owner no longer holds the cursor.
+// RETURNS: error
+func (d *DbPostgres) AdvanceNoteEventCursor(consumer string, owner string, offset int64, lease time.Duration) error {
+	var advanced int64
+	err := d.queryRow(advanceNoteEventCursorQuery, consumer, owner, offset, lease.Seconds()).Scan(&advanced)
+	if err == sql.ErrNoRows {
+		return NoteClerkErrNew(ErrDbPostgresAdvanceNoteEventCursorFailsNotClaimed, consumer)
+	}
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrDbPostgresAdvanceNoteEventCursorFailsQuery, consumer, offset)
+	}
+	return nil
 }
 
-// https://www.calhoun.io/updating-and-deleting-postgresql-records-using-gos-sql-package/
-func (d *DbPostgres) createSchema() error {
+// ImportNotes adds notes, with their tags and fragments, as they are, in one transaction using COPY. Notes whose GUID
+// is already in the database are left alone. No note events are recorded. When the database refuses the notes
+// because of their data, for instance a GUID which is taken or a value too long for its column, the error is an
+// importRejectedError.
+// RETURNS: []string (the GUIDs of the notes skipped), error
+func (d *DbPostgres) ImportNotes(notes []*ehrpb.Note) (skipped []string, err error) {
+	err = d.inTransaction(func(tx *DbPostgres) error {
+		guids := make([]string, len(notes))
+		for k, v := range notes {
+			guids[k] = v.GetNoteGuid()
+		}
+		rows, err := tx.query(existingNoteGuidsQuery, pq.Array(guids))
+		if err != nil {
+			return NoteClerkErrWrap(err, ErrDbPostgresImportNotesFailsQuery)
+		}
+		existing := make(map[string]bool)
+		for rows.Next() {
+			var guid string
+			if err := rows.Scan(&guid); err != nil {
+				rows.Close()
+				return NoteClerkErrWrap(err, ErrDbPostgresImportNotesFailsQuery)
+			}
+			existing[guid] = true
+			skipped = append(skipped, guid)
+		}
+		rows.Close()
+
+		var noteRows, noteTagRows, fragmentRows, fragmentTagRows [][]interface{}
+		for _, n := range notes {
+			if existing[n.GetNoteGuid()] {
+				continue
+			}
+			noteRows = append(noteRows, []interface{}{n.GetDateCreated().GetSeconds(), n.GetDateCreated().GetNanos(),
+				n.GetNoteGuid(), n.GetVisitGuid(), n.GetAuthorGuid(), n.GetPatientGuid(), n.GetType(), n.GetStatus()})
+			for _, t := range n.GetTags() {
+				noteTagRows = append(noteTagRows, []interface{}{n.GetNoteGuid(), t})
+			}
+			for _, f := range n.GetFragments() {
+				fragmentRows = append(fragmentRows, []interface{}{f.GetDateCreated().GetSeconds(),
+					f.GetDateCreated().GetNanos(), f.GetNoteFragmentGuid(), n.GetNoteGuid(), f.GetIcd_10Code(),
+					f.GetIcd_10Long(), f.GetDescription(), f.GetStatus(), f.GetPriority(), f.GetTopic(), f.GetContent(),
+					f.GetIssueGuid()})
+				for _, t := range f.GetTags() {
+					fragmentTagRows = append(fragmentTagRows, []interface{}{f.GetNoteFragmentGuid(), t})
+				}
+			}
+		}
+
+		// Tables are copied in the order their foreign keys require
+		copies := []struct {
+			table   string
+			columns []string
+			rows    [][]interface{}
+		}{
+			{"note", importNoteColumns, noteRows},
+			{"note_tag", importNoteTagColumns, noteTagRows},
+			{"note_fragment", importNoteFragmentColumns, fragmentRows},
+			{"note_fragment_tag", importNoteFragmentTagColumns, fragmentTagRows},
+		}
+		for _, c := range copies {
+			if err := tx.copyIn(c.table, c.columns, c.rows); err != nil {
+				return NoteClerkErrWrap(err, ErrDbPostgresImportNotesFailsCopy, len(noteRows))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
 
-	err := d.createTable(createNoteTable)
-	if notNilNotTableExists(err) {
-		return errors.Wrapf(err, "%v. Target Table: note", ErrDbPostgresCreateSchemaFailsTableCreation)
+// ExportNotes returns up to limit notes matching filter, with their tags and fragments, which come after the position
+// after, in the order described by NoteExportMark.
+// RETURNS: []*ehrpb.Note, NoteExportMark (the position of the last note returned, or after when there are none), error
+func (d *DbPostgres) ExportNotes(filter NoteExportFilter, after NoteExportMark, limit int) ([]*ehrpb.Note,
+	NoteExportMark, error) {
+	types := make([]int64, len(filter.Types))
+	for k, v := range filter.Types {
+		types[k] = int64(v)
 	}
+	var from, to interface{}
+	if !filter.CreatedFrom.IsZero() {
+		from = filter.CreatedFrom.Unix()
+	}
+	if !filter.CreatedTo.IsZero() {
+		to = filter.CreatedTo.Unix()
+	}
+	args := []interface{}{pq.Array(filter.PatientGuids), pq.Array(types), from, to}
 
-	err = d.createTable(createNoteTagTable)
-	if notNilNotTableExists(err) {
-		return errors.Wrapf(err, "%v. Target Table: note_tag", ErrDbPostgresCreateSchemaFailsTableCreation)
+	var rows *sql.Rows
+	var err error
+	if filter.ChangedUntil > 0 {
+		rows, err = d.query(exportNotesChangedQuery, append(args, filter.ChangedAfter, filter.ChangedUntil,
+			after.Offset, after.NoteId, limit)...)
+	} else {
+		rows, err = d.query(exportNotesCreatedQuery, append(args, after.DateCreated.Unix(),
+			after.DateCreated.Nanosecond(), after.NoteId, limit)...)
+	}
+	if err != nil {
+		return nil, after, NoteClerkErrWrap(err, ErrDbPostgresExportNotesFailsQuery)
 	}
+	defer rows.Close()
 
-	err = d.createTable(createNoteFragmentTable)
-	if notNilNotTableExists(err) {
-		return errors.Wrapf(err, "%v. Target Table: note_fragment", ErrDbPostgresCreateSchemaFailsTableCreation)
+	notes := make([]*ehrpb.Note, 0)
+	for rows.Next() {
+		n := noted.NewNote()
+		if err := rows.Scan(&n.Id, &n.DateCreated.Seconds, &n.DateCreated.Nanos, &n.NoteGuid, &n.VisitGuid,
+			&n.AuthorGuid, &n.PatientGuid, &n.Type, &n.Status, &after.Offset); err != nil {
+			return nil, after, NoteClerkErrWrap(err, ErrDbPostgresExportNotesFailsScan)
+		}
+		after.NoteId = n.Id
+		after.DateCreated = time.Unix(n.DateCreated.Seconds, int64(n.DateCreated.Nanos)).UTC()
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, after, NoteClerkErrWrap(err, ErrDbPostgresExportNotesFailsScan)
 	}
+	rows.Close()
 
-	err = d.createTable(createNoteFragmentTagTable)
-	if notNilNotTableExists(err) {
-		return errors.Wrapf(err, "%v. Target Table: note_fragment_tag", ErrDbPostgresCreateSchemaFailsTableCreation)
+	for _, n := range notes {
+		if n.Tags, err = d.GetNoteTagsByNoteGuid(n.GetNoteGuid()); err == nil {
+			n.Fragments, err = d.GetNoteFragmentsByNoteGuid(n.GetNoteGuid())
+		}
+		if err != nil {
+			return nil, after, NoteClerkErrWrap(err, ErrDbPostgresExportNotesFailsGetNote, n.GetNoteGuid())
+		}
 	}
+	return notes, after, nil
+}
 
+// copyIn loads rows into table with COPY. It must be called within a transaction.
+// RETURNS: error, which is an importRejectedError when the rows are refused because of their data
+func (d *DbPostgres) copyIn(table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	stmt, err := d.tx.PrepareContext(d.context(), pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	for _, v := range rows {
+		if _, err = stmt.ExecContext(d.context(), v...); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		_, err = stmt.ExecContext(d.context())
+	}
+	if closeErr := stmt.Close(); err == nil {
+		err = closeErr
+	}
+
+	// Class 22 is data exceptions, such as values too long for their column, and class 23 integrity constraint
+	// violations, such as duplicate GUIDs
+	if pqErr, ok := errors.Cause(err).(*pq.Error); ok && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23") {
+		return &importRejectedError{err: err}
+	}
+	return err
+}
+
+// AddWebhookSubscription stores a webhook subscription, including its signing secret.
+// RETURNS: error
+func (d *DbPostgres) AddWebhookSubscription(sub *WebhookSubscription) error {
+	_, err := d.exec(addWebhookSubscriptionQuery, sub.Guid, sub.Url, sub.Secret, sub.PatientGuid,
+		pq.Array(sub.NoteTypes), pq.Array(sub.EventTypes), sub.AfterOffset, sub.DateCreated)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrDbPostgresAddWebhookSubscriptionFailsExec, sub.Guid)
+	}
 	return nil
 }
 
-func (d *DbPostgres) createTable(query string) error {
-	_, err := d.db.Exec(query)
+// WebhookSubscriptions returns every webhook subscription, in the order they were created, with their secrets.
+// RETURNS: []*WebhookSubscription, error
+func (d *DbPostgres) WebhookSubscriptions() ([]*WebhookSubscription, error) {
+	rows, err := d.query(webhookSubscriptionsQuery)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrDbPostgresWebhookSubscriptionsFailsQuery)
+	}
+	defer rows.Close()
+
+	subs := make([]*WebhookSubscription, 0)
+	for rows.Next() {
+		sub := &WebhookSubscription{}
+		if err := rows.Scan(&sub.Guid, &sub.Url, &sub.Secret, &sub.PatientGuid, pq.Array(&sub.NoteTypes),
+			pq.Array(&sub.EventTypes), &sub.AfterOffset, &sub.DateCreated); err != nil {
+			return nil, NoteClerkErrWrap(err, ErrDbPostgresWebhookSubscriptionsFailsScan)
+		}
+		sub.DateCreated = sub.DateCreated.UTC()
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// DeleteWebhookSubscription removes a webhook subscription, with its dead letters and event cursor.
+// RETURNS: bool (whether there was such a subscription), error
+func (d *DbPostgres) DeleteWebhookSubscription(guid string) (deleted bool, err error) {
+	err = d.inTransaction(func(tx *DbPostgres) error {
+		res, err := tx.exec(deleteWebhookSubscriptionQuery, guid)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		deleted = true
+		_, err = tx.exec(deleteNoteEventCursorQuery, (&WebhookSubscription{Guid: guid}).consumer())
+		return err
+	})
+	if err != nil {
+		return false, NoteClerkErrWrap(err, ErrDbPostgresDeleteWebhookSubscriptionFailsExec, guid)
+	}
+	return deleted, nil
+}
 
-	tableExistsError := strings.Contains(fmt.Sprintf("%v", err), "already exists")
-	if tableExistsError {
-		return NoteClerkErrWrap(err, ErrDbPostgresCreateTableFailsAlreadyExists)
+// AddWebhookDeadLetter records an event which could not be delivered to a webhook subscription, along with the event
+// as it was sent.
+// RETURNS: error
+func (d *DbPostgres) AddWebhookDeadLetter(letter *WebhookDeadLetter) error {
+	payload, err := json.Marshal(letter.Event)
+	if err == nil {
+		_, err = d.exec(addWebhookDeadLetterQuery, letter.SubscriptionGuid, letter.Event.Offset, letter.Event.Type,
+			letter.Event.NoteGuid, string(payload), letter.Attempts, letter.LastError, letter.FailedAt)
 	}
 	if err != nil {
-		return NoteClerkErrWrap(err, ErrDbPostgresCreateTableFailsDueToUnexpectedError)
+		return NoteClerkErrWrap(err, ErrDbPostgresAddWebhookDeadLetterFailsExec, letter.Event.Offset,
+			letter.SubscriptionGuid)
 	}
 	return nil
 }
 
-func notNilNotTableExists(err error) bool {
-	errMsg := fmt.Sprintf("%v", err)
-	alreadyExistsError := strings.Contains(errMsg, "relation") && strings.Contains(errMsg, "already exists")
-	return err != nil && !alreadyExistsError
+// openPostgres returns a connection pool for the database in the config. No connection is made until the pool is
+// first used.
+// RETURNS: *sql.DB
+func openPostgres(config *Config) *sql.DB {
+	return sql.OpenDB(&postgresConnector{config: config})
+}
+
+// postgresConnector opens each new connection with the settings in the config, looking the password up every time
+// so that a rotated secret is used without restarting the server.
+type postgresConnector struct {
+	config *Config
+}
+
+// Connect is a method contracted by the driver.Connector interface.
+func (c *postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	password, err := dbPassword(ctx, c.config)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := pq.NewConnector(generateConnStrFromCfg(c.config, password))
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// Driver is a method contracted by the driver.Connector interface.
+func (c *postgresConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// generateConnStrFromCfg builds a key/value connection string. Every value is quoted and escaped, so passwords and
+// paths may contain spaces, quotes and backslashes. The client certificate settings are only included when set.
+func generateConnStrFromCfg(config *Config, password string) string {
+	params := []struct {
+		key   string
+		value string
+	}{
+		{"user", config.DbUsername},
+		{"password", password},
+		{"host", config.DbIp},
+		{"port", config.DbPort},
+		{"dbname", config.DbName},
+		{"sslmode", config.DbSslMode},
+		{"sslcert", config.DbSslCert},
+		{"sslkey", config.DbSslKey},
+		{"sslrootcert", config.DbSslRootCert},
+	}
+
+	var connStr []string
+	for _, p := range params {
+		if p.value == "" && p.key != "password" {
+			continue
+		}
+		value := strings.Replace(p.value, `\`, `\\`, -1)
+		value = strings.Replace(value, `'`, `\'`, -1)
+		connStr = append(connStr, fmt.Sprintf("%v='%v'", p.key, value))
+	}
+	return strings.Join(connStr, " ")
+}
+
+// migrate brings the schema up to date by applying any pending embedded migrations. Migrations hold an advisory lock,
+// so replicas starting at the same time will apply each migration exactly once.
+func (d *DbPostgres) migrate() error {
+	m, err := NewMigrator(d.db)
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.Up()
+	if err != nil {
+		return err
+	}
+	for _, v := range applied {
+		log.Infof("Applied database migration %v.", v)
+	}
+
+	return nil
 }
@@ -1,106 +1,5 @@
 package main
 
-// TODO: Consider moving to SQL files
-const createNoteTable = `CREATE TABLE IF NOT EXISTS note
-(
-  id                   serial            NOT NULL
-    CONSTRAINT note_pkey
-    PRIMARY KEY, 
-  date_created_seconds integer           NOT NULL,
-  date_created_nanos   integer default 0 NOT NULL,
-  note_guid            varchar(38)       NOT NULL,
-  visit_guid           varchar(38)       NOT NULL,
-  author_guid          varchar(38)       NOT NULL,
-  patient_guid         varchar(38)       NOT NULL,
-  type                 integer           NOT NULL,
-  status               integer           NOT NULL
-);
-
-ALTER TABLE note
-  OWNER to postgres;
-
-CREATE UNIQUE INDEX note_id_uindex
-  ON note (id);
-
-CREATE UNIQUE INDEX note_note_guid_uindex
-  ON note (note_guid);
-`
-
-const createNoteFragmentTable = `CREATE TABLE IF NOT EXISTS note_fragment
-(
-  id                   serial            NOT NULL
-    CONSTRAINT note_fragment_pkey
-    PRIMARY KEY, 
-  date_created_seconds integer           NOT NULL,
-  date_created_nanos   integer default 0 NOT NULL,
-  note_fragment_guid   varchar(38)       NOT NULL,
-  note_guid            varchar(38)       NOT NULL
-    CONSTRAINT note_fragment_note_note_guid_fk
-    REFERENCES note (note_guid)
-	ON DELETE CASCADE,
-  icd_10code           varchar(15)       NOT NULL,
-  icd_10long           varchar(250)      NOT NULL,
-  description          varchar(150)      NOT NULL,
-  status               integer           NOT NULL,
-  priority             integer           NOT NULL,
-  topic                integer           NOT NULL,
-  content     varchar(2500)     NOT NULL
-);
-
-ALTER TABLE note_fragment
-  OWNER to postgres;
-
-CREATE UNIQUE INDEX note_fragment_id_uindex
-  ON note_fragment (id);
-
-CREATE UNIQUE INDEX note_fragment_note_fragment_guid_uindex
-  ON note_fragment (note_fragment_guid);
-
-`
-
-const createNoteTagTable = `CREATE TABLE IF NOT EXISTS note_tag
-(
-	id serial NOT NULL
-		CONSTRAINT note_tag_pkey
-			PRIMARY KEY, 
-	note_guid varchar(38) NOT NULL
-		CONSTRAINT note_tag_note_note_guid_fk
-			REFERENCES note (note_guid)
-			ON DELETE CASCADE,
-	tag varchar(55) NOT NULL
-)
-;
-
-ALTER TABLE note_tag OWNER to postgres
-;
-
-CREATE UNIQUE INDEX note_tag_id_uindex
-	ON note_tag (id)
-;
-
-`
-
-const createNoteFragmentTagTable = `CREATE TABLE IF NOT EXISTS note_fragment_tag
-(
-	id serial NOT NULL
-		CONSTRAINT note_fragment_tag_pkey
-			PRIMARY KEY, 
-	note_fragment_guid varchar(38) NOT NULL
-		CONSTRAINT note_fragment_tag_note_fragment_note_fragment_guid_fk
-			REFERENCES note_fragment (note_fragment_guid)
-			ON DELETE CASCADE,
-	tag varchar(55) NOT NULL
-)
-;
-
-ALTER TABLE note_fragment_tag OWNER to postgres
-;
-
-CREATE UNIQUE INDEX note_fragment_tag_id_uindex
-	ON note_fragment_tag (id)
-;
-`
-
 const addNoteQuery = `INSERT INTO "public"."note" 
 (
 	"id", 
@@ -140,7 +39,8 @@ const addNoteFragmentQuery = `INSERT INTO "public"."note_fragment"
 	"status", 
 	"priority", 
 	"topic", 
-	"content"
+	"content",
+	"issue_guid"
 ) 
 VALUES 
 (
@@ -155,7 +55,8 @@ VALUES
 	$8, 
 	$9, 
 	$10,
-	$11
+	$11,
+	$12
 )
 RETURNING id;`
 
@@ -212,3 +113,121 @@ const getNotesByFindQuery = `SELECT * FROM note
 WHERE author_guid LIKE $1
 AND visit_guid LIKE $2
 AND patient_guid LIKE $3;`
+
+const reserveIdempotencyKeyQuery = `INSERT INTO idempotency_key (principal, key, fingerprint, response, expires_at)
+VALUES ($1, $2, $3, NULL, $4)
+ON CONFLICT (principal, key) DO UPDATE
+SET fingerprint = EXCLUDED.fingerprint, response = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+WHERE idempotency_key.expires_at < now()
+RETURNING key;`
+
+const getIdempotencyKeyQuery = `SELECT principal, key, fingerprint, response, expires_at FROM idempotency_key
+WHERE principal = $1 AND key = $2;`
+
+const completeIdempotencyKeyQuery = `UPDATE idempotency_key SET response = $3 WHERE principal = $1 AND key = $2;`
+
+const deleteExpiredIdempotencyKeysQuery = `DELETE FROM idempotency_key WHERE expires_at < $1;`
+
+const addNoteEventQuery = `INSERT INTO note_event (event_type, occurred_at, note_guid, previous_note_guid,
+  note_fragment_guid, previous_note_fragment_guid, patient_guid, author_guid, visit_guid, note_type)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
+
+// Offsets are assigned by one transaction at a time, holding this advisory lock, to the events committed before it
+// began. They therefore follow the order in which events were committed, without gaps, however many replicas write.
+const noteEventSequenceAdvisoryLockKey int64 = 6582143308
+
+const lockNoteEventSequenceQuery = `SELECT pg_advisory_xact_lock($1);`
+
+const sequenceNoteEventsQuery = `WITH pending AS (
+  SELECT id, row_number() OVER (ORDER BY id) AS n FROM note_event WHERE event_offset IS NULL
+), latest AS (
+  SELECT COALESCE(MAX(event_offset), 0) AS event_offset FROM note_event
+)
+UPDATE note_event
+SET event_offset = latest.event_offset + pending.n
+FROM pending, latest
+WHERE note_event.id = pending.id;`
+
+const latestNoteEventOffsetQuery = `SELECT COALESCE(MAX(event_offset), 0) FROM note_event;`
+
+const noteEventsAfterQuery = `SELECT event_offset, event_type, occurred_at, note_guid, previous_note_guid,
+  note_fragment_guid, previous_note_fragment_guid, patient_guid, author_guid, visit_guid, note_type
+FROM note_event
+WHERE event_offset > $1
+ORDER BY event_offset
+LIMIT $2;`
+
+const claimNoteEventCursorQuery = `INSERT INTO note_event_cursor (consumer, event_offset, owner, lease_expires_at)
+VALUES ($1, 0, $2, now() + $3::double precision * interval '1 second')
+ON CONFLICT (consumer) DO UPDATE
+SET owner = EXCLUDED.owner, lease_expires_at = EXCLUDED.lease_expires_at
+WHERE note_event_cursor.owner = EXCLUDED.owner OR note_event_cursor.lease_expires_at < now()
+RETURNING event_offset;`
+
+const advanceNoteEventCursorQuery = `UPDATE note_event_cursor
+SET event_offset = $3, lease_expires_at = now() + $4::double precision * interval '1 second'
+WHERE consumer = $1 AND owner = $2
+RETURNING event_offset;`
+
+const addWebhookSubscriptionQuery = `INSERT INTO webhook_subscription (subscription_guid, url, secret, patient_guid,
+  note_types, event_types, after_offset, date_created)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+const webhookSubscriptionsQuery = `SELECT subscription_guid, url, secret, patient_guid, note_types, event_types,
+  after_offset, date_created
+FROM webhook_subscription
+ORDER BY id;`
+
+const deleteWebhookSubscriptionQuery = `DELETE FROM webhook_subscription WHERE subscription_guid = $1;`
+
+const deleteNoteEventCursorQuery = `DELETE FROM note_event_cursor WHERE consumer = $1;`
+
+const addWebhookDeadLetterQuery = `INSERT INTO webhook_dead_letter (subscription_guid, event_offset, event_type,
+  note_guid, payload, attempts, last_error, failed_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+const existingNoteGuidsQuery = `SELECT note_guid FROM note WHERE note_guid = ANY($1);`
+
+// Columns filled by COPY when notes are imported. Ids are left to their sequences.
+var (
+	importNoteColumns = []string{"date_created_seconds", "date_created_nanos", "note_guid", "visit_guid",
+		"author_guid", "patient_guid", "type", "status"}
+	importNoteTagColumns      = []string{"note_guid", "tag"}
+	importNoteFragmentColumns = []string{"date_created_seconds", "date_created_nanos", "note_fragment_guid",
+		"note_guid", "icd_10code", "icd_10long", "description", "status", "priority", "topic", "content", "issue_guid"}
+	importNoteFragmentTagColumns = []string{"note_fragment_guid", "tag"}
+)
+
+// The notes to export are read a page at a time, after the position where the last page ended. Empty arrays and
+// NULL creation dates match every note.
+const exportNotesFilter = `(COALESCE(cardinality($1::varchar[]), 0) = 0 OR note.patient_guid = ANY($1))
+AND (COALESCE(cardinality($2::integer[]), 0) = 0 OR note.type = ANY($2))
+AND ($3::bigint IS NULL OR note.date_created_seconds >= $3)
+AND ($4::bigint IS NULL OR note.date_created_seconds < $4)`
+
+const exportNotesCreatedQuery = `SELECT id, date_created_seconds, date_created_nanos, note_guid, visit_guid,
+  author_guid, patient_guid, type, status, 0
+FROM note
+WHERE ` + exportNotesFilter + `
+AND (date_created_seconds, date_created_nanos, id) > ($5::bigint, $6::integer, $7::integer)
+ORDER BY date_created_seconds, date_created_nanos, id
+LIMIT $8;`
+
+// An updated note is named by its NoteUpdated event as the prior version, so that it is exported again as deleted.
+const exportNotesChangedQuery = `WITH changed AS (
+  SELECT note_guid, MAX(event_offset) AS event_offset
+  FROM (
+    SELECT note_guid, event_offset FROM note_event WHERE event_offset > $5 AND event_offset <= $6
+    UNION ALL
+    SELECT previous_note_guid, event_offset FROM note_event
+    WHERE event_offset > $5 AND event_offset <= $6 AND previous_note_guid <> ''
+  ) named
+  GROUP BY note_guid
+)
+SELECT note.id, note.date_created_seconds, note.date_created_nanos, note.note_guid, note.visit_guid,
+  note.author_guid, note.patient_guid, note.type, note.status, changed.event_offset
+FROM note JOIN changed ON changed.note_guid = note.note_guid
+WHERE ` + exportNotesFilter + `
+AND (changed.event_offset, note.id) > ($7::bigint, $8::integer)
+ORDER BY changed.event_offset, note.id
+LIMIT $9;`
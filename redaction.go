@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RedactedValue replaces protected health information in log output.
+const RedactedValue = "[REDACTED]"
+
+// Values shorter than this are too likely to occur by chance elsewhere in a log line to be worth redacting.
+const minRedactedValueLength = 4
+
+// Log fields which may only ever hold protected health information are redacted whatever their value.
+var phiLogFields = map[string]bool{
+	"content":      true,
+	"description":  true,
+	"patient_guid": true,
+	"search_terms": true,
+	"icd_10long":   true,
+	"note":         true,
+	"fragment":     true,
+	"fragments":    true,
+}
+
+var (
+	// Postgres reports the values behind constraint violations as 'Key (column)=(value)'.
+	postgresDetailValue = regexp.MustCompile(`\(([^()]*)\)=\(([^()]*)\)`)
+	// database/sql quotes the offending value in scan errors, e.g. 'converting driver.Value type string ("...")'.
+	quotedScanValue = regexp.MustCompile(`\("(?:[^"\\]|\\.)*"\)`)
+)
+
+// redactingFormatter removes protected health information from every entry before the wrapped formatter renders it.
+// Entries logged through a request-scoped logger have the sensitive values of their request, such as fragment
+// content, descriptions and the patient GUID, replaced wherever they appear. Every entry also has known PHI fields and
+// the values quoted in Postgres and database/sql error text replaced.
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+func (f *redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	values := sensitiveValuesFromContext(entry.Context)
+
+	redacted := *entry
+	redacted.Message = redactString(entry.Message, values)
+	redacted.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		switch {
+		case phiLogFields[strings.ToLower(k)]:
+			redacted.Data[k] = RedactedValue
+		case k == logrus.ErrorKey:
+			if err, ok := v.(error); ok {
+				redacted.Data[k] = redactString(err.Error(), values)
+			} else {
+				redacted.Data[k] = redactString(fmt.Sprint(v), values)
+			}
+		default:
+			if s, ok := v.(string); ok {
+				redacted.Data[k] = redactString(s, values)
+			} else {
+				redacted.Data[k] = v
+			}
+		}
+	}
+	return f.Formatter.Format(&redacted)
+}
+
+// redactString replaces each of the sensitive values, longest first so that a value containing another is replaced
+// whole, and then the values quoted in database error text.
+func redactString(s string, values []string) string {
+	for _, v := range values {
+		s = strings.Replace(s, v, RedactedValue, -1)
+	}
+	s = postgresDetailValue.ReplaceAllString(s, "($1)=("+RedactedValue+")")
+	return quotedScanValue.ReplaceAllString(s, `("`+RedactedValue+`")`)
+}
+
+type sensitiveValuesKey struct{}
+
+// contextWithSensitiveValues records the protected health information carried by a request, so that entries logged
+// with the returned context have it redacted.
+func contextWithSensitiveValues(ctx context.Context, req interface{}) context.Context {
+	values := sensitiveValues(req)
+	if len(values) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, sensitiveValuesKey{}, values)
+}
+
+func sensitiveValuesFromContext(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	values, _ := ctx.Value(sensitiveValuesKey{}).([]string)
+	return values
+}
+
+// Fields which identify notes rather than patients, or which only hold enum names or formats, are left in log output so
+// that requests can still be followed. Every other string field of a ClerkService request, or of a note carried as
+// NDJSON, is treated as protected health information. Names are compared in lower case without underscores, so that
+// both the proto and the JSON name of a field match.
+var nonSensitiveFields = map[string]bool{
+	"guid":             true,
+	"noteguid":         true,
+	"noteguids":        true,
+	"notefragmentguid": true,
+	"type":             true,
+	"status":           true,
+	"priority":         true,
+	"topic":            true,
+	"notetypes":        true,
+	"eventtypes":       true,
+	"format":           true,
+	"documenttype":     true,
+}
+
+// Fields carrying notes as NDJSON, one ehrpb.Note per line in the protobuf JSON encoding.
+var ndjsonFields = map[string]bool{
+	"records": true,
+}
+
+// sensitiveValues lists the protected health information in a NoteService or ClerkService request. For NoteService
+// requests these are patient GUIDs, search terms, and the content, descriptions, ICD-10-CM descriptions and tags of
+// notes and their fragments. For ClerkService requests they are every string field not in nonSensitiveFields, and the
+// lines of NDJSON records along with every value in them not in nonSensitiveFields.
+// RETURNS: []string, longest first
+func sensitiveValues(req interface{}) []string {
+	var values []string
+	seen := map[string]bool{}
+	add := func(v ...string) {
+		for _, s := range v {
+			if len(strings.TrimSpace(s)) >= minRedactedValueLength && !seen[s] {
+				seen[s] = true
+				values = append(values, s)
+			}
+		}
+	}
+	addNote := func(note *ehrpb.Note) {
+		add(note.GetPatientGuid())
+		add(note.GetTags()...)
+		for _, frag := range note.GetFragments() {
+			add(frag.GetContent(), frag.GetDescription(), frag.GetIcd_10Long())
+			add(frag.GetTags()...)
+		}
+	}
+
+	switch r := req.(type) {
+	case *ehrpb.CreateNoteRequest:
+		addNote(r.GetNote())
+	case *ehrpb.UpdateNoteRequest:
+		addNote(r.GetNote())
+	case *ehrpb.SearchNotesRequest:
+		add(r.GetPatientGuid(), r.GetSearchTerms())
+	case *ehrpb.SearchNoteFragmentRequest:
+		add(r.GetPatientGuid(), r.GetSearchTerms())
+	case *ehrpb.RetrieveNoteRequest, *ehrpb.DeleteNoteRequest:
+		// These carry only the id and GUID of a note.
+	case protoreflect.ProtoMessage:
+		addMessageValues(r.ProtoReflect(), add)
+	}
+
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	return values
+}
+
+// addMessageValues adds the value of every string and bytes field of a message, and of the messages within it, except
+// the fields in nonSensitiveFields.
+func addMessageValues(m protoreflect.Message, add func(...string)) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if nonSensitiveFields[normalizedFieldName(string(fd.Name()))] {
+			return true
+		}
+		if fd.IsList() {
+			for i := 0; i < v.List().Len(); i++ {
+				addFieldValue(fd, v.List().Get(i), add)
+			}
+			return true
+		}
+		if fd.IsMap() {
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				addFieldValue(fd.MapValue(), mv, add)
+				return true
+			})
+			return true
+		}
+		addFieldValue(fd, v, add)
+		return true
+	})
+}
+
+func addFieldValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, add func(...string)) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if ndjsonFields[normalizedFieldName(string(fd.Name()))] {
+			addRecordValues(v.String(), add)
+			return
+		}
+		add(v.String())
+	case protoreflect.BytesKind:
+		add(string(v.Bytes()))
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		addMessageValues(v.Message(), add)
+	}
+}
+
+// addRecordValues adds each line of NDJSON records and, for lines which are JSON, every string in them outside
+// nonSensitiveFields. Lines which are not JSON are only redacted whole.
+func addRecordValues(records string, add func(...string)) {
+	for _, line := range strings.Split(records, "\n") {
+		line = strings.TrimSpace(line)
+		add(line)
+		var record interface{}
+		if err := json.Unmarshal([]byte(line), &record); err == nil {
+			addJsonValues(record, add)
+		}
+	}
+}
+
+func addJsonValues(v interface{}, add func(...string)) {
+	switch t := v.(type) {
+	case string:
+		add(t)
+	case []interface{}:
+		for _, e := range t {
+			addJsonValues(e, add)
+		}
+	case map[string]interface{}:
+		for k, e := range t {
+			if !nonSensitiveFields[normalizedFieldName(k)] {
+				addJsonValues(e, add)
+			}
+		}
+	}
+}
+
+func normalizedFieldName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
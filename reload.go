@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/geekmdio/noteclerk/render"
+)
+
+// serverSettings are the settings which Reload can change while the server is running. They are replaced as a whole,
+// so each request sees either the old settings or the new ones, never a mix of both.
+type serverSettings struct {
+	limits            ContentLimits
+	icd10             *Icd10CodeSet
+	idempotencyKeyTtl time.Duration
+	renderer          *render.Renderer
+	deidentifier      *Deidentifier
+}
+
+// newServerSettings validates the reloadable settings in config and loads the ICD-10-CM code set, if one is set, the
+// rendering templates and the de-identification key and rules, if a key is set.
+// RETURNS: *serverSettings, error
+func newServerSettings(config *Config) (*serverSettings, error) {
+	settings := &serverSettings{
+		limits:            contentLimitsFromConfig(config),
+		idempotencyKeyTtl: DefaultIdempotencyKeyTtl,
+	}
+
+	if config.IdempotencyKeyTtl != "" {
+		ttl, err := time.ParseDuration(config.IdempotencyKeyTtl)
+		if err != nil || ttl <= 0 {
+			return nil, NoteClerkErrWrap(err, ErrNoteClerkServerConstructorFailsInvalidIdempotencyTtl, config.IdempotencyKeyTtl)
+		}
+		settings.idempotencyKeyTtl = ttl
+	}
+
+	if config.Icd10CodeFilePath != "" {
+		icd10, err := LoadIcd10CodeSet(config.Icd10CodeFilePath)
+		if err != nil {
+			return nil, NoteClerkErrWrap(err, ErrNoteClerkServerInitializeFailsLoadIcd10CodeSet)
+		}
+		settings.icd10 = icd10
+		log.Infof("Loaded %v ICD-10-CM codes.", icd10.Len())
+	} else {
+		log.Warn("No ICD-10-CM code file is configured; ICD-10-CM codes will not be validated.")
+	}
+
+	renderer, err := render.NewRenderer(config.RenderTemplateDir)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrNoteClerkServerInitializeFailsLoadRenderTemplates, config.RenderTemplateDir)
+	}
+	settings.renderer = renderer
+
+	if settings.deidentifier, err = newDeidentifierFromConfig(context.Background(), config); err != nil {
+		return nil, NoteClerkErrWrap(err, ErrNoteClerkServerInitializeFailsLoadDeidentifier)
+	}
+
+	return settings, nil
+}
+
+// settings returns the settings currently in effect. A Server which was never initialized has the defaults.
+func (n *Server) settings() *serverSettings {
+	if settings, ok := n.reloadable.Load().(*serverSettings); ok {
+		return settings
+	}
+	return &serverSettings{}
+}
+
+// Reload is a method contracted by the NoteClerkServer interface. It validates the reloadable settings in config, the
+// content limits, ICD-10-CM code set, idempotency key TTL, rendering templates, de-identification settings and database
+// connection pool limits, and only then swaps them in. Requests in progress finish with the settings they started with
+// and no connections are dropped. Other settings in config are ignored; see restartRequiredSettings.
+// RETURNS: error
+func (n *Server) Reload(config *Config) error {
+	settings, err := newServerSettings(config)
+	if err != nil {
+		return err
+	}
+
+	n.lifecycle.Lock()
+	db := n.db
+	n.lifecycle.Unlock()
+	if db != nil {
+		if err := db.ConfigurePool(config); err != nil {
+			return NoteClerkErrWrap(err, ErrNoteClerkServerReloadFailsConfigurePool)
+		}
+	}
+
+	n.reloadable.Store(settings)
+	return nil
+}
+
+// reloadableSettings are the Config fields which take effect without a restart. Changes to any other field are
+// reported, and ignored, until the server is restarted. The gRPC listener has no TLS, rate limit or authorization
+// settings yet, so there are none of those to reload; the database client certificate files are read for each new
+// connection instead.
+var reloadableSettings = map[string]bool{
+	"MaxFragmentContentLength":         true,
+	"MaxFragmentDescriptionLength":     true,
+	"MaxTagLength":                     true,
+	"Icd10CodeFilePath":                true,
+	"IdempotencyKeyTtl":                true,
+	"RenderTemplateDir":                true,
+	"DeidentificationKeySecret":        true,
+	"DeidentificationMaxDateShiftDays": true,
+	"DeidentificationRulesPath":        true,
+	"DbMaxOpenConns":                   true,
+	"DbMaxIdleConns":                   true,
+	"DbConnMaxLifetime":                true,
+	"LogPath":                          true,
+	"LogLevel":                         true,
+	"LogFormat":                        true,
+	"LogOutputs":                       true,
+	"LogMaxSizeMb":                     true,
+	"LogRotateInterval":                true,
+	"LogMaxAgeDays":                    true,
+	"LogMaxBackups":                    true,
+	"LogSyslogNetwork":                 true,
+	"LogSyslogAddress":                 true,
+	"LogSyslogTag":                     true,
+}
+
+// loggingSettings are the reloadable fields which require the logger to be initialized again.
+var loggingSettings = []string{"LogPath", "LogLevel", "LogFormat", "LogOutputs", "LogMaxSizeMb", "LogRotateInterval",
+	"LogMaxAgeDays", "LogMaxBackups", "LogSyslogNetwork", "LogSyslogAddress", "LogSyslogTag"}
+
+// restartRequiredSettings lists the fields which differ between running and next but cannot be reloaded, such as the
+// listen address and database host.
+// RETURNS: []string of field names
+func restartRequiredSettings(running *Config, next *Config) []string {
+	var changed []string
+	for _, f := range configFields() {
+		if !reloadableSettings[f.name] && settingChanged(running, next, f.name) {
+			changed = append(changed, f.name)
+		}
+	}
+	return changed
+}
+
+func settingChanged(running *Config, next *Config, name string) bool {
+	return !reflect.DeepEqual(reflect.ValueOf(running).Elem().FieldByName(name).Interface(),
+		reflect.ValueOf(next).Elem().FieldByName(name).Interface())
+}
+
+// configReloader loads the configuration again on request and applies what it can to the running server.
+type configReloader struct {
+	srv  NoteClerkServer
+	load func() (*Config, error)
+
+	mu      sync.Mutex
+	running *Config
+}
+
+// reload loads the configuration and validates the log settings and the server's reloadable settings, and only once
+// both are valid applies them. When the new configuration is invalid nothing is changed. Settings which need a restart
+// are logged and kept as they are, so that they are reported again on later reloads until the server is restarted.
+// RETURNS: error
+func (r *configReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrReloadConfigFailsLoad)
+	}
+
+	applied := *next
+	for _, name := range restartRequiredSettings(r.running, next) {
+		log.Warnf("The %v setting has changed, but it only takes effect once NoteClerk is restarted.", name)
+		field := reflect.ValueOf(&applied).Elem().FieldByName(name)
+		field.Set(reflect.ValueOf(r.running).Elem().FieldByName(name))
+	}
+
+	var logger *loggerSettings
+	for _, name := range loggingSettings {
+		if settingChanged(r.running, &applied, name) {
+			if logger, err = newLoggerSettings(&applied); err != nil {
+				return NoteClerkErrWrap(err, ErrReloadConfigFailsReinitializeLogger)
+			}
+			break
+		}
+	}
+
+	// Server.Reload validates every setting before swapping any in, so the logger is only switched once it succeeds.
+	if err := r.srv.Reload(&applied); err != nil {
+		if logger != nil {
+			logger.discard()
+		}
+		return err
+	}
+	if logger != nil {
+		logger.apply()
+	}
+	r.running = &applied
+	log.Info("Reloaded the configuration.")
+	return nil
+}
+
+// watchConfig reloads the configuration whenever the process receives SIGHUP and, when ConfigWatchInterval is set,
+// whenever the configuration file changes. Failed reloads are logged and leave the running configuration in place.
+// RETURNS: func() which stops watching
+func watchConfig(srv NoteClerkServer, running *Config, load func() (*Config, error)) func() {
+	r := &configReloader{srv: srv, load: load, running: running}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	var changes <-chan struct{}
+	stop := make(chan struct{})
+	if interval, err := time.ParseDuration(running.ConfigWatchInterval); err == nil && interval > 0 {
+		changes = pollFileChanges(running.filePath, interval, stop)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-signals:
+				log.Info("Received SIGHUP; reloading the configuration.")
+			case <-changes:
+				log.Info("The configuration file has changed; reloading the configuration.")
+			}
+			if err := r.reload(); err != nil {
+				log.Error(err)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(stop)
+		<-done
+	}
+}
+
+// pollFileChanges checks path for a new modification time or size every interval until stop is closed. Editors
+// often replace a file rather than write to it, which polling handles without special cases.
+// RETURNS: <-chan struct{} receiving once per change
+func pollFileChanges(path string, interval time.Duration, stop <-chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	if path == "" {
+		return changes
+	}
+
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		modTime, size := stat()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				nextModTime, nextSize := stat()
+				if nextModTime.Equal(modTime) && nextSize == size {
+					continue
+				}
+				modTime, size = nextModTime, nextSize
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes
+}
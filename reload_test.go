@@ -0,0 +1,181 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// poolRecordingDb is a MockDb which records the pool settings it was given.
+type poolRecordingDb struct {
+	MockDb
+	maxOpenConns int32
+}
+
+func (p *poolRecordingDb) ConfigurePool(config *Config) error {
+	atomic.StoreInt32(&p.maxOpenConns, int32(config.DbMaxOpenConns))
+	return nil
+}
+
+func TestServerReload_SwapsReloadableSettings(t *testing.T) {
+	s := &Server{}
+	db := &poolRecordingDb{}
+	if err := s.constructor(localServerConfig(), db); err != nil {
+		t.Fatalf("Failed to construct the server: %v", err)
+	}
+
+	next := localServerConfig()
+	next.MaxTagLength = 16
+	next.IdempotencyKeyTtl = "1h"
+	next.DbMaxOpenConns = 7
+	if err := s.Reload(next); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	if s.settings().limits.maxTagLength() != 16 {
+		t.Fatalf("Expected the reloaded tag limit, but got %v", s.settings().limits.maxTagLength())
+	}
+	if s.getIdempotencyKeyTtl() != time.Hour {
+		t.Fatalf("Expected the reloaded idempotency key TTL, but got %v", s.getIdempotencyKeyTtl())
+	}
+	if atomic.LoadInt32(&db.maxOpenConns) != 7 {
+		t.Fatalf("Expected the pool limits to be passed to the database, but got %v", db.maxOpenConns)
+	}
+}
+
+func TestServerReload_WithInvalidSettings_KeepsRunningSettings(t *testing.T) {
+	s := &Server{}
+	config := localServerConfig()
+	config.MaxTagLength = 32
+	if err := s.constructor(config, &MockDb{}); err != nil {
+		t.Fatalf("Failed to construct the server: %v", err)
+	}
+
+	next := localServerConfig()
+	next.MaxTagLength = 8
+	next.IdempotencyKeyTtl = "forever"
+	if err := s.Reload(next); err == nil {
+		t.Fatalf("Expected an error for an invalid TTL, but got nil")
+	}
+	if s.settings().limits.maxTagLength() != 32 {
+		t.Fatalf("Expected the running tag limit to be kept, but got %v", s.settings().limits.maxTagLength())
+	}
+}
+
+func TestRestartRequiredSettings_ReportsOnlyUnreloadableChanges(t *testing.T) {
+	running := localServerConfig()
+	next := localServerConfig()
+	next.ServerPort = "50052"
+	next.DbIp = "db.internal"
+	next.LogLevel = "warn"
+	next.LogOutputs = []string{"stdout"}
+
+	changed := restartRequiredSettings(running, next)
+	if len(changed) != 2 || changed[0] != "ServerPort" || changed[1] != "DbIp" {
+		t.Fatalf("Expected ServerPort and DbIp to require a restart, but got %v", changed)
+	}
+}
+
+func TestConfigReloader_AppliesLogLevelAndKeepsListenAddress(t *testing.T) {
+	restoreLogger(t)
+	buf := captureLog(t)
+	s := &Server{}
+	running := localServerConfig()
+	if err := s.constructor(running, &MockDb{}); err != nil {
+		t.Fatalf("Failed to construct the server: %v", err)
+	}
+
+	next := localServerConfig()
+	next.ServerPort = "50052"
+	next.LogLevel = "error"
+	next.LogOutputs = []string{"stdout"}
+	r := &configReloader{srv: s, running: running, load: func() (*Config, error) { return next, nil }}
+
+	if err := r.reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if log.GetLevel() != logrus.ErrorLevel {
+		t.Fatalf("Expected the reloaded log level, but it is %v", log.GetLevel())
+	}
+	if r.running.ServerPort != "0" {
+		t.Fatalf("Expected the running port to be kept until restart, but it is %v", r.running.ServerPort)
+	}
+	// The warning is written before the new log settings, and their output, take effect.
+	if !strings.Contains(buf.String(), "The ServerPort setting has changed") {
+		t.Fatalf("Expected the unreloadable change to be reported, but the log holds %q", buf.String())
+	}
+}
+
+func TestWatchConfig_ReloadsOnSighupAndFileChange(t *testing.T) {
+	captureLog(t)
+	path := filepath.Join(t.TempDir(), "config.test.json")
+	ioutil.WriteFile(path, []byte("{}"), 0600)
+
+	s := &Server{}
+	running := localServerConfig()
+	running.ConfigWatchInterval = "10ms"
+	running.filePath = path
+	if err := s.constructor(running, &MockDb{}); err != nil {
+		t.Fatalf("Failed to construct the server: %v", err)
+	}
+
+	var loads int32
+	stop := watchConfig(s, running, func() (*Config, error) {
+		next := *running
+		next.MaxTagLength = int(atomic.AddInt32(&loads, 1))
+		return &next, nil
+	})
+	defer stop()
+
+	waitForLoads := func(n int32) {
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&loads) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %v reloads, but there were %v", n, atomic.LoadInt32(&loads))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("Failed to send SIGHUP: %v", err)
+	}
+	waitForLoads(1)
+
+	ioutil.WriteFile(path, []byte(`{"MaxTagLength": 2}`), 0600)
+	waitForLoads(2)
+}
+
+func TestConfigReloader_WithInvalidServerSettings_KeepsLogLevel(t *testing.T) {
+	restoreLogger(t)
+	captureLog(t)
+	s := &Server{}
+	running := localServerConfig()
+	if err := s.constructor(running, &MockDb{}); err != nil {
+		t.Fatalf("Failed to construct the server: %v", err)
+	}
+	level := log.GetLevel()
+
+	next := localServerConfig()
+	next.LogLevel = "error"
+	next.LogOutputs = []string{"stdout"}
+	next.IdempotencyKeyTtl = "forever"
+	r := &configReloader{srv: s, running: running, load: func() (*Config, error) { return next, nil }}
+
+	if err := r.reload(); err == nil {
+		t.Fatalf("Expected an error for an invalid TTL, but got nil")
+	}
+	if log.GetLevel() != level {
+		t.Fatalf("Expected the log level to be kept as %v, but it is %v", level, log.GetLevel())
+	}
+	if r.running != running {
+		t.Fatalf("Expected the running configuration to be kept")
+	}
+}
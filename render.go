@@ -0,0 +1,28 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/geekmdio/noteclerk/render"
+)
+
+var (
+	renderLookupMu      sync.RWMutex
+	renderLookupCurrent render.Lookup = render.GuidLookup{}
+)
+
+// RegisterRenderLookup makes lookup the means by which RenderNote names the patient, author and visit of a note,
+// e.g. from a master patient index and a provider directory. Until one is registered, notes are rendered with GUIDs
+// alone. It is intended to be called from an init function.
+func RegisterRenderLookup(lookup render.Lookup) {
+	renderLookupMu.Lock()
+	defer renderLookupMu.Unlock()
+	renderLookupCurrent = lookup
+}
+
+// renderLookup returns the registered render.Lookup.
+func renderLookup() render.Lookup {
+	renderLookupMu.RLock()
+	defer renderLookupMu.RUnlock()
+	return renderLookupCurrent
+}
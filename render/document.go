@@ -0,0 +1,166 @@
+// Package render turns notes into documents people can read and print: Markdown, HTML and PDF. The patient, author
+// and visit named in a note are shown as resolved by a Lookup, so that a printed note identifies them by name rather
+// than by GUID alone.
+package render
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+)
+
+// Kind is the kind of identifier a Lookup resolves.
+type Kind string
+
+const (
+	KindPatient Kind = "patient"
+	KindAuthor  Kind = "author"
+	KindVisit   Kind = "visit"
+)
+
+// Lookup resolves the GUID of a patient, author or visit into the text shown for it in a note's header, such as a
+// name and medical record number. An empty result shows the GUID alone.
+type Lookup interface {
+	Lookup(ctx context.Context, kind Kind, guid string) (string, error)
+}
+
+// LookupFunc adapts an ordinary function to the Lookup interface.
+type LookupFunc func(ctx context.Context, kind Kind, guid string) (string, error)
+
+// Lookup is a method contracted by the Lookup interface.
+func (f LookupFunc) Lookup(ctx context.Context, kind Kind, guid string) (string, error) {
+	return f(ctx, kind, guid)
+}
+
+// GuidLookup resolves nothing, so notes are shown with GUIDs alone. It is the Lookup used when no other is
+// configured.
+type GuidLookup struct{}
+
+// Lookup is a method contracted by the Lookup interface.
+func (GuidLookup) Lookup(ctx context.Context, kind Kind, guid string) (string, error) {
+	return "", nil
+}
+
+// Document is a note as it is rendered, and is the data passed to the Markdown and HTML templates.
+type Document struct {
+	Title    string
+	NoteGuid string
+	Created  string
+	Status   string
+	Patient  Party
+	Author   Party
+	Visit    Party
+	Tags     []string
+	Sections []Section
+}
+
+// Party is a patient, author or visit named in a note. Name is empty when the Lookup did not resolve the GUID.
+type Party struct {
+	Guid string
+	Name string
+}
+
+// String shows the party by name and GUID, or by GUID alone.
+func (p Party) String() string {
+	if p.Name == "" {
+		return p.Guid
+	}
+	return p.Name + " (" + p.Guid + ")"
+}
+
+// Section holds the fragments of one fragment type.
+type Section struct {
+	Title     string
+	Fragments []Fragment
+}
+
+// Fragment is a fragment as it is rendered. Lines is its content split into lines.
+type Fragment struct {
+	Description  string
+	Lines        []string
+	Icd10Code    string
+	Icd10Long    string
+	HighPriority bool
+	Tags         []string
+}
+
+// NewDocument prepares note for rendering, resolving its patient, author and visit with lookup. Fragments are grouped
+// into one section per fragment type, in the order the types first appear, so a note whose fragments have been
+// ordered with noted.OrganizeNoteFragments is rendered in that order. Deleted fragments are left out.
+// RETURNS: *Document, error
+func NewDocument(ctx context.Context, note *ehrpb.Note, lookup Lookup) (*Document, error) {
+	doc := &Document{
+		Title:    enumDisplay(ehrpb.NoteType_name[int32(note.GetType())]),
+		NoteGuid: note.GetNoteGuid(),
+		Status:   enumDisplay(ehrpb.RecordStatus_name[int32(note.GetStatus())]),
+		Tags:     note.GetTags(),
+	}
+	if doc.Title == "" || note.GetType() == 0 {
+		doc.Title = "Note"
+	}
+	if note.GetStatus() == 0 {
+		doc.Status = ""
+	}
+	if ts := note.GetDateCreated(); ts != nil {
+		doc.Created = time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC().Format("2006-01-02 15:04 MST")
+	}
+
+	parties := []struct {
+		party *Party
+		kind  Kind
+		guid  string
+	}{
+		{&doc.Patient, KindPatient, note.GetPatientGuid()},
+		{&doc.Author, KindAuthor, note.GetAuthorGuid()},
+		{&doc.Visit, KindVisit, note.GetVisitGuid()},
+	}
+	for _, p := range parties {
+		p.party.Guid = p.guid
+		if p.guid == "" {
+			continue
+		}
+		name, err := lookup.Lookup(ctx, p.kind, p.guid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up %v %v: %v", p.kind, p.guid, err)
+		}
+		p.party.Name = name
+	}
+
+	sections := map[ehrpb.FragmentType]int{}
+	for _, frag := range note.GetFragments() {
+		if frag.GetStatus() == ehrpb.RecordStatus_DELETED {
+			continue
+		}
+		k, ok := sections[frag.GetTopic()]
+		if !ok {
+			k = len(doc.Sections)
+			sections[frag.GetTopic()] = k
+			title := enumDisplay(ehrpb.FragmentType_name[int32(frag.GetTopic())])
+			if frag.GetTopic() == 0 {
+				title = "Other"
+			}
+			doc.Sections = append(doc.Sections, Section{Title: title})
+		}
+		doc.Sections[k].Fragments = append(doc.Sections[k].Fragments, Fragment{
+			Description:  frag.GetDescription(),
+			Lines:        strings.Split(strings.TrimRight(frag.GetContent(), "\n"), "\n"),
+			Icd10Code:    frag.GetIcd_10Code(),
+			Icd10Long:    frag.GetIcd_10Long(),
+			HighPriority: frag.GetPriority() == ehrpb.RecordPriority_HIGH,
+			Tags:         frag.GetTags(),
+		})
+	}
+	return doc, nil
+}
+
+// enumDisplay turns an enum name such as HISTORY_AND_PHYSICAL into 'History and physical'.
+func enumDisplay(name string) string {
+	if name == "" {
+		return ""
+	}
+	words := strings.ToLower(strings.Replace(name, "_", " ", -1))
+	return strings.ToUpper(words[:1]) + words[1:]
+}
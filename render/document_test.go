@@ -0,0 +1,106 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+const (
+	testPatient = "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c6d"
+	testVisit   = "0f1e2d3c-4b5a-4978-8695-a4b3c2d1e0f9"
+	testAuthor  = "9e8d7c6b-5a49-4382-9170-6f5e4d3c2b1a"
+)
+
+func testNote() *ehrpb.Note {
+	return &ehrpb.Note{
+		DateCreated: &timestamp.Timestamp{Seconds: 1552555800},
+		NoteGuid:    "4a3f1a6c-4f5e-4a6e-9b8a-2f3c1d0e9b7a",
+		VisitGuid:   testVisit,
+		AuthorGuid:  testAuthor,
+		PatientGuid: testPatient,
+		Type:        ehrpb.NoteType_HISTORY_AND_PHYSICAL,
+		Status:      ehrpb.RecordStatus_ACTIVE,
+		Tags:        []string{"cardiology"},
+		Fragments: []*ehrpb.NoteFragment{
+			{
+				Description: "Chest pain",
+				Content:     "Pain began <2 hours ago.\nWorse on exertion.\n",
+				Topic:       ehrpb.FragmentType_SUBJECTIVE,
+				Status:      ehrpb.RecordStatus_ACTIVE,
+				Priority:    ehrpb.RecordPriority_HIGH,
+			},
+			{
+				Description: "Hypertension",
+				Content:     "Diagnosed in 2010.",
+				Topic:       ehrpb.FragmentType_MEDICAL_HISTORY,
+				Status:      ehrpb.RecordStatus_ACTIVE,
+				Icd_10Code:  "I10",
+				Icd_10Long:  "Essential (primary) hypertension",
+			},
+			{
+				Description: "Retracted",
+				Content:     "Entered in error.",
+				Topic:       ehrpb.FragmentType_SUBJECTIVE,
+				Status:      ehrpb.RecordStatus_DELETED,
+			},
+			{
+				Description: "Onset",
+				Content:     "While shovelling snow.",
+				Topic:       ehrpb.FragmentType_SUBJECTIVE,
+				Status:      ehrpb.RecordStatus_ACTIVE,
+			},
+		},
+	}
+}
+
+// testLookup names the test patient and author, and leaves the visit unresolved.
+var testLookup = LookupFunc(func(ctx context.Context, kind Kind, guid string) (string, error) {
+	switch {
+	case kind == KindPatient && guid == testPatient:
+		return "Jane Doe, MRN 001234", nil
+	case kind == KindAuthor && guid == testAuthor:
+		return "Dr. John Smith", nil
+	}
+	return "", nil
+})
+
+func TestNewDocument(t *testing.T) {
+	doc, err := NewDocument(context.Background(), testNote(), testLookup)
+	if err != nil {
+		t.Fatalf("NewDocument() returned %v", err)
+	}
+	if doc.Title != "History and physical" || doc.Status != "Active" || doc.Created != "2019-03-14 09:30 UTC" {
+		t.Fatalf("NewDocument() = %+v, expected the note's type, status and creation time", doc)
+	}
+	if doc.Patient.String() != "Jane Doe, MRN 001234 ("+testPatient+")" || doc.Visit.String() != testVisit {
+		t.Fatalf("NewDocument() = %+v, expected the patient resolved and the visit shown by GUID", doc)
+	}
+
+	if len(doc.Sections) != 2 || doc.Sections[0].Title != "Subjective" || doc.Sections[1].Title != "Medical history" {
+		t.Fatalf("NewDocument() sections = %+v, expected Subjective then Medical history", doc.Sections)
+	}
+	subjective := doc.Sections[0].Fragments
+	if len(subjective) != 2 || subjective[0].Description != "Chest pain" || subjective[1].Description != "Onset" {
+		t.Fatalf("NewDocument() subjective = %+v, expected the active fragments in order", subjective)
+	}
+	if !subjective[0].HighPriority || len(subjective[0].Lines) != 2 {
+		t.Fatalf("NewDocument() fragment = %+v, expected a high priority fragment of two lines", subjective[0])
+	}
+}
+
+func TestNewDocument_LookupFails(t *testing.T) {
+	lookup := LookupFunc(func(ctx context.Context, kind Kind, guid string) (string, error) {
+		return "", errors.New("directory unavailable")
+	})
+	if _, err := NewDocument(context.Background(), testNote(), lookup); err == nil {
+		t.Fatalf("NewDocument() should fail when the lookup fails")
+	}
+	if doc, err := NewDocument(context.Background(), testNote(), GuidLookup{}); err != nil ||
+		doc.Author.String() != testAuthor {
+		t.Fatalf("NewDocument() = %+v, %v, expected the author shown by GUID", doc, err)
+	}
+}
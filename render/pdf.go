@@ -0,0 +1,251 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The PDF is laid out on US Letter pages in the standard Helvetica fonts, which every PDF reader provides, so no font
+// is embedded.
+const (
+	pdfPageWidth    = 612
+	pdfPageHeight   = 792
+	pdfMargin       = 54
+	pdfFooterHeight = 18
+	pdfLeading      = 1.35
+	pdfRegular      = "F1"
+	pdfBold         = "F2"
+)
+
+// helveticaWidths are the widths of the printable ASCII characters in Helvetica, in thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+// pdfLine is a line of text on a page. gap is the space left above it.
+type pdfLine struct {
+	font string
+	size float64
+	gap  float64
+	text string
+}
+
+// writePdf lays doc out as a PDF document, wrapping long lines and breaking pages as needed.
+func writePdf(w io.Writer, doc *Document) error {
+	var lines []pdfLine
+	add := func(font string, size, gap float64, text string) {
+		for k, line := range wrapPdfText(encodePdfText(text), font, size, pdfPageWidth-2*pdfMargin) {
+			if k > 0 {
+				gap = 0
+			}
+			lines = append(lines, pdfLine{font: font, size: size, gap: gap, text: line})
+		}
+	}
+
+	add(pdfBold, 16, 0, doc.Title)
+	add(pdfRegular, 10, 6, "Patient: "+doc.Patient.String())
+	add(pdfRegular, 10, 0, "Author: "+doc.Author.String())
+	if doc.Visit.Guid != "" {
+		add(pdfRegular, 10, 0, "Visit: "+doc.Visit.String())
+	}
+	if doc.Created != "" {
+		add(pdfRegular, 10, 0, "Created: "+doc.Created)
+	}
+	if doc.Status != "" {
+		add(pdfRegular, 10, 0, "Status: "+doc.Status)
+	}
+	add(pdfRegular, 10, 0, "Note: "+doc.NoteGuid)
+	if len(doc.Tags) > 0 {
+		add(pdfRegular, 10, 0, "Tags: "+strings.Join(doc.Tags, ", "))
+	}
+	for _, section := range doc.Sections {
+		add(pdfBold, 13, 12, section.Title)
+		for _, frag := range section.Fragments {
+			gap := 6.0
+			if frag.Description != "" || frag.HighPriority {
+				heading := frag.Description
+				if frag.HighPriority {
+					heading = strings.TrimSpace(heading + " (high priority)")
+				}
+				add(pdfBold, 10, gap, heading)
+				gap = 0
+			}
+			if frag.Icd10Code != "" {
+				code := "ICD-10-CM " + frag.Icd10Code
+				if frag.Icd10Long != "" {
+					code += ": " + frag.Icd10Long
+				}
+				add(pdfRegular, 9, gap, code)
+				gap = 0
+			}
+			for _, line := range frag.Lines {
+				add(pdfRegular, 10, gap, line)
+				gap = 0
+			}
+		}
+	}
+
+	// Break the lines into pages.
+	var pages [][]pdfLine
+	y := float64(pdfPageHeight - pdfMargin)
+	for _, line := range lines {
+		height := line.gap + line.size*pdfLeading
+		if len(pages) == 0 || y-height < pdfMargin+pdfFooterHeight {
+			pages = append(pages, nil)
+			y = pdfPageHeight - pdfMargin
+			line.gap = 0
+			height = line.size * pdfLeading
+		}
+		y -= height
+		pages[len(pages)-1] = append(pages[len(pages)-1], line)
+	}
+
+	// Objects 1 to 5 are the catalog, the page tree, the two fonts and the document information; each page is then
+	// a page object followed by its content stream.
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title (%v) /Producer (noteclerk) >>", escapePdfString(encodePdfText(doc.Title))),
+	}
+	var kids []string
+	for k, page := range pages {
+		var content bytes.Buffer
+		y := float64(pdfPageHeight - pdfMargin)
+		for _, line := range page {
+			y -= line.gap + line.size*pdfLeading
+			fmt.Fprintf(&content, "BT /%v %v Tf %v %.2f Td (%v) Tj ET\n", line.font, line.size, pdfMargin, y,
+				escapePdfString(line.text))
+		}
+		footer := encodePdfText(fmt.Sprintf("Note %v - Page %v of %v", doc.NoteGuid, k+1, len(pages)))
+		fmt.Fprintf(&content, "BT /%v 8 Tf %v %v Td (%v) Tj ET\n", pdfRegular, pdfMargin, pdfMargin-pdfFooterHeight,
+			escapePdfString(footer))
+
+		kids = append(kids, fmt.Sprintf("%v 0 R", len(objects)+1))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %v %v] /Resources << /Font << /%v 3 0 R /%v 4 0 R >> >> /Contents %v 0 R >>",
+				pdfPageWidth, pdfPageHeight, pdfRegular, pdfBold, len(objects)+2),
+			fmt.Sprintf("<< /Length %v >>\nstream\n%vendstream", content.Len(), content.String()))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %v >>", strings.Join(kids, " "), len(pages))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for k, object := range objects {
+		offsets[k] = buf.Len()
+		fmt.Fprintf(&buf, "%v 0 obj\n%v\nendobj\n", k+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %v\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %v /Root 1 0 R /Info 5 0 R >>\nstartxref\n%v\n%%%%EOF\n", len(objects)+1, xref)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// encodePdfText encodes text in WinAnsiEncoding, which matches Latin-1 outside the range 128 to 159, where it has the
+// curly quotes, dashes, bullet, ellipsis and a few letters. Tabs become spaces and other control characters are
+// dropped. Characters the encoding lacks are spelled in ASCII where there is a usual spelling, e.g. '>=' for '≥', and
+// are otherwise written as their code point, e.g. '[U+2211]', so that the printed note never reads differently from
+// the stored one.
+func encodePdfText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			b.WriteByte(' ')
+		case r < 32 || (r >= 127 && r < 160):
+		case r < 256:
+			b.WriteByte(byte(r))
+		default:
+			if c, ok := winAnsiCodes[r]; ok {
+				b.WriteByte(c)
+			} else if spelling, ok := pdfAsciiSpellings[r]; ok {
+				b.WriteString(spelling)
+			} else {
+				fmt.Fprintf(&b, "[U+%04X]", r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// winAnsiCodes are the characters WinAnsiEncoding places from 128 to 159.
+var winAnsiCodes = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a,
+	'‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// pdfAsciiSpellings spell characters found in clinical text which WinAnsiEncoding lacks.
+var pdfAsciiSpellings = map[rune]string{
+	'≥': ">=", '≤': "<=", '≠': "!=", '≈': "~", '∼': "~", '−': "-", '‐': "-", '‑': "-", '‒': "-", '―': "-",
+	'→': "->", '←': "<-", '↔': "<->", '⇒': "=>", '↑': "up", '↓': "down", '′': "'", '″': "\"", '⁄': "/", '∙': "\xb7",
+	'‣': "\x95", '◦': "\x95", '\u2009': " ", '\u200a': " ", '\u202f': " ", '\u2002': " ", '\u2003': " ",
+	'\u200b': "", '\ufeff': "", 'μ': "\xb5", 'α': "alpha", 'β': "beta", 'γ': "gamma", 'δ': "delta", 'Δ': "delta",
+	'κ': "kappa", 'λ': "lambda",
+}
+
+// escapePdfString escapes the characters that would end a PDF literal string early.
+func escapePdfString(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(text)
+}
+
+// pdfTextWidth is the width of encoded text in points. Characters outside printable ASCII are taken to be as wide as
+// a digit, and bold text to be a tenth wider than regular, which is enough for wrapping.
+func pdfTextWidth(text, font string, size float64) float64 {
+	width := 0
+	for k := 0; k < len(text); k++ {
+		if c := text[k]; c >= 32 && c < 127 {
+			width += helveticaWidths[c-32]
+		} else {
+			width += 556
+		}
+	}
+	points := float64(width) * size / 1000
+	if font == pdfBold {
+		points *= 1.1
+	}
+	return points
+}
+
+// wrapPdfText breaks encoded text into lines no wider than width, between words where it can.
+func wrapPdfText(text, font string, size, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Split(text, " ") {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if pdfTextWidth(candidate, font, size) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		// A word wider than the line is broken wherever it must be.
+		for pdfTextWidth(word, font, size) > width {
+			k := 1
+			for k < len(word) && pdfTextWidth(word[:k+1], font, size) <= width {
+				k++
+			}
+			lines = append(lines, word[:k])
+			word = word[k:]
+		}
+		line = word
+	}
+	return append(lines, line)
+}
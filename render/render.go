@@ -0,0 +1,137 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Format is a format a note can be rendered in.
+type Format string
+
+const (
+	Markdown Format = "markdown"
+	HTML     Format = "html"
+	PDF      Format = "pdf"
+)
+
+// Formats lists the formats a note can be rendered in.
+var Formats = []Format{Markdown, HTML, PDF}
+
+// ContentType is the media type of a document in the format.
+func (f Format) ContentType() string {
+	switch f {
+	case Markdown:
+		return "text/markdown; charset=utf-8"
+	case HTML:
+		return "text/html; charset=utf-8"
+	case PDF:
+		return "application/pdf"
+	}
+	return ""
+}
+
+const (
+	// MarkdownTemplate is the file name of the Markdown template, and of the file in a template directory that
+	// overrides it.
+	MarkdownTemplate = "note.md.tmpl"
+	// HTMLTemplate is the file name of the HTML template, and of the file in a template directory that overrides it.
+	HTMLTemplate = "note.html.tmpl"
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// templateFuncs are the functions available to templates, besides those built in to text/template and
+// html/template. md escapes text for Markdown.
+var templateFuncs = map[string]interface{}{
+	"join": strings.Join,
+	"md":   escapeMarkdown,
+}
+
+// Renderer renders documents from its Markdown and HTML templates. PDF is laid out by the renderer itself.
+type Renderer struct {
+	markdown *texttemplate.Template
+	html     *htmltemplate.Template
+}
+
+// NewRenderer loads the bundled templates, or those in dir that override them. Either template is overridden by a
+// file of the same name in dir, and dir may be empty to use the bundled templates alone. The templates are executed
+// with a *Document.
+// RETURNS: *Renderer, error
+func NewRenderer(dir string) (*Renderer, error) {
+	r := &Renderer{}
+	text, err := readTemplate(dir, MarkdownTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if r.markdown, err = texttemplate.New(MarkdownTemplate).Funcs(templateFuncs).Parse(text); err != nil {
+		return nil, err
+	}
+	if text, err = readTemplate(dir, HTMLTemplate); err != nil {
+		return nil, err
+	}
+	if r.html, err = htmltemplate.New(HTMLTemplate).Funcs(templateFuncs).Parse(text); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readTemplate reads the template named name from dir, or the bundled template when dir has none.
+func readTemplate(dir, name string) (string, error) {
+	if dir != "" {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	data, err := defaultTemplates.ReadFile("templates/" + name)
+	return string(data), err
+}
+
+// Render renders doc in format.
+// RETURNS: []byte, error
+func (r *Renderer) Render(doc *Document, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case Markdown:
+		err = r.markdown.Execute(&buf, doc)
+	case HTML:
+		err = r.html.Execute(&buf, doc)
+	case PDF:
+		err = writePdf(&buf, doc)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	markdownSpecial   = regexp.MustCompile("[\\\\`*_{}\\[\\]<>#|!~]")
+	markdownLineStart = regexp.MustCompile(`^(\s*)([-+=]|\d+[.)])`)
+)
+
+// escapeMarkdown escapes the characters of text that Markdown would otherwise interpret, so that content is shown as
+// it was written.
+func escapeMarkdown(text string) string {
+	text = markdownSpecial.ReplaceAllString(text, "\\$0")
+	if m := markdownLineStart.FindStringSubmatchIndex(text); m != nil {
+		// Escape the last character of a list marker or heading underline, such as the '.' of '1.'.
+		text = text[:m[5]-1] + "\\" + text[m[5]-1:]
+	}
+	return text
+}
@@ -0,0 +1,182 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testDocument(t *testing.T) *Document {
+	doc, err := NewDocument(context.Background(), testNote(), testLookup)
+	if err != nil {
+		t.Fatalf("NewDocument() returned %v", err)
+	}
+	return doc
+}
+
+func TestRenderer_Markdown(t *testing.T) {
+	r, err := NewRenderer("")
+	if err != nil {
+		t.Fatalf("NewRenderer() returned %v", err)
+	}
+	data, err := r.Render(testDocument(t), Markdown)
+	if err != nil {
+		t.Fatalf("Render() returned %v", err)
+	}
+	for _, want := range []string{
+		"# History and physical\n",
+		"| Patient | Jane Doe, MRN 001234 (" + testPatient + ") |\n",
+		"## Subjective\n",
+		"### Chest pain (high priority)\n",
+		"Pain began \\<2 hours ago.\\\nWorse on exertion.\n",
+		"*ICD-10-CM I10: Essential (primary) hypertension*\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("Render() = %v, expected it to contain %q", string(data), want)
+		}
+	}
+	if strings.Contains(string(data), "Retracted") {
+		t.Fatalf("Render() = %v, expected the deleted fragment to be left out", string(data))
+	}
+}
+
+func TestRenderer_HTML(t *testing.T) {
+	r, err := NewRenderer("")
+	if err != nil {
+		t.Fatalf("NewRenderer() returned %v", err)
+	}
+	data, err := r.Render(testDocument(t), HTML)
+	if err != nil {
+		t.Fatalf("Render() returned %v", err)
+	}
+	for _, want := range []string{
+		"<h1>History and physical</h1>",
+		"<tr><th>Author</th><td>Dr. John Smith (" + testAuthor + ")</td></tr>",
+		"<p>Pain began &lt;2 hours ago.<br>Worse on exertion.</p>",
+		`<p class="priority">High priority</p>`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("Render() = %v, expected it to contain %q", string(data), want)
+		}
+	}
+}
+
+func TestNewRenderer_Overrides(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, MarkdownTemplate), []byte("{{.Patient.Name}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRenderer(dir)
+	if err != nil {
+		t.Fatalf("NewRenderer() returned %v", err)
+	}
+	if data, err := r.Render(testDocument(t), Markdown); err != nil || string(data) != "Jane Doe, MRN 001234" {
+		t.Fatalf("Render() = %q, %v, expected the overriding template", data, err)
+	}
+	if data, err := r.Render(testDocument(t), HTML); err != nil || !bytes.HasPrefix(data, []byte("<!DOCTYPE html>")) {
+		t.Fatalf("Render() = %q, %v, expected the bundled HTML template", data, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, HTMLTemplate), []byte("{{.Missing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRenderer(dir); err == nil {
+		t.Fatalf("NewRenderer() should refuse a template that does not parse")
+	}
+}
+
+func TestRenderer_PDF(t *testing.T) {
+	r, err := NewRenderer("")
+	if err != nil {
+		t.Fatalf("NewRenderer() returned %v", err)
+	}
+	doc := testDocument(t)
+	data, err := r.Render(doc, PDF)
+	if err != nil {
+		t.Fatalf("Render() returned %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatalf("Render() = %q, expected a PDF document", data)
+	}
+	for _, want := range []string{"(Patient: Jane Doe, MRN 001234 \\(" + testPatient + "\\)) Tj", "/Count 1 "} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Fatalf("Render() = %s, expected it to contain %q", data, want)
+		}
+	}
+	checkPdfXref(t, data)
+
+	// A long note runs onto further pages, with every line inside the margins.
+	long := testNote()
+	long.Fragments[0].Content = strings.Repeat("The quick brown fox jumps over the lazy dog. ", 40) +
+		"\n" + strings.Repeat("x", 400) + strings.Repeat("\nline", 80)
+	doc, err = NewDocument(context.Background(), long, GuidLookup{})
+	if err != nil {
+		t.Fatalf("NewDocument() returned %v", err)
+	}
+	if data, err = r.Render(doc, PDF); err != nil {
+		t.Fatalf("Render() returned %v", err)
+	}
+	if !bytes.Contains(data, []byte("/Count 3 ")) || !bytes.Contains(data, []byte("Page 3 of 3")) {
+		t.Fatalf("Render() = %s, expected three pages", data)
+	}
+	checkPdfXref(t, data)
+	for _, m := range regexp.MustCompile(`/F\d ([\d.]+) Tf \d+ ([\d.]+) Td \((.*)\) Tj`).FindAllSubmatch(data, -1) {
+		size, _ := strconv.ParseFloat(string(m[1]), 64)
+		y, _ := strconv.ParseFloat(string(m[2]), 64)
+		if pdfTextWidth(string(m[3]), pdfRegular, size) > pdfPageWidth-2*pdfMargin || y < pdfMargin-pdfFooterHeight {
+			t.Fatalf("Render() placed %q outside the margins", m[0])
+		}
+	}
+}
+
+// checkPdfXref checks that each entry of the cross-reference table points at the object it numbers.
+func checkPdfXref(t *testing.T, data []byte) {
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if m == nil {
+		t.Fatalf("Expected a startxref, but got %s", data)
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("Expected startxref to point at the cross-reference table")
+	}
+	for k, entry := range regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(data[xref:], -1) {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := strconv.Itoa(k+1) + " 0 obj\n"; !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Fatalf("Expected object %v at offset %v, but got %q", k+1, offset, data[offset:offset+10])
+		}
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	for text, want := range map[string]string{
+		"plain text":         "plain text",
+		"*bold* and _it_":    `\*bold\* and \_it\_`,
+		"# not a heading":    `\# not a heading`,
+		"- not a list":       `\- not a list`,
+		"1. not a list":      `1\. not a list`,
+		"2019-03-14 and 1.5": "2019-03-14 and 1.5",
+	} {
+		if got := escapeMarkdown(text); got != want {
+			t.Fatalf("escapeMarkdown(%q) = %q, expected %q", text, got, want)
+		}
+	}
+}
+
+func TestEncodePdfText(t *testing.T) {
+	for text, want := range map[string]string{
+		"café\tnaïve — ok":              "caf\xe9 na\xefve \x97 ok",
+		"“Better” – he said… • ‘ok’ €5": "\x93Better\x94 \x96 he said\x85 \x95 \x91ok\x92 \x805",
+		"K ≥ 5.5, Na ≤ 130, T 38 ± 0.5": "K >= 5.5, Na <= 130, T 38 \xb1 0.5",
+		"AF → β-blocker, 5 μg":          "AF -> beta-blocker, 5 \xb5g",
+		"∑ scores 漢":                    "[U+2211] scores [U+6F22]",
+	} {
+		if got := encodePdfText(text); got != want {
+			t.Fatalf("encodePdfText(%q) = %q, expected %q", text, got, want)
+		}
+	}
+}
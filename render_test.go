@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/geekmdio/noteclerk/render"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// addRenderNote adds a note with one fragment to db.
+func addRenderNote(t *testing.T, db *MockDb) *ehrpb.Note {
+	note := &ehrpb.Note{
+		NoteGuid:    uuid.New().String(),
+		VisitGuid:   uuid.New().String(),
+		PatientGuid: uuid.New().String(),
+		AuthorGuid:  uuid.New().String(),
+		Type:        ehrpb.NoteType_HISTORY_AND_PHYSICAL,
+		Status:      ehrpb.RecordStatus_ACTIVE,
+		Fragments: []*ehrpb.NoteFragment{
+			{NoteFragmentGuid: uuid.New().String(), Topic: ehrpb.FragmentType_SUBJECTIVE,
+				Status: ehrpb.RecordStatus_ACTIVE, Description: "Chest pain", Content: "Began two hours ago."},
+		},
+	}
+	if _, _, err := db.AddNote(note); err != nil {
+		t.Fatalf("Failed to add a note: %v", err)
+	}
+	return note
+}
+
+func TestServer_RenderNote(t *testing.T) {
+	s, db := newMockDbServer(t)
+	note := addRenderNote(t, db)
+	defer RegisterRenderLookup(render.GuidLookup{})
+	RegisterRenderLookup(render.LookupFunc(func(ctx context.Context, kind render.Kind, guid string) (string, error) {
+		if kind == render.KindPatient && guid == note.PatientGuid {
+			return "Jane Doe", nil
+		}
+		return "", nil
+	}))
+
+	res, err := s.RenderNote(context.Background(), &clerkpb.RenderNoteRequest{NoteGuid: note.NoteGuid, Format: "markdown"})
+	if err != nil {
+		t.Fatalf("RenderNote should succeed, but returned %v", err)
+	}
+	if res.ContentType != "text/markdown; charset=utf-8" ||
+		!strings.Contains(string(res.Content), "| Patient | Jane Doe ("+note.PatientGuid+") |") ||
+		!strings.Contains(string(res.Content), "### Chest pain") {
+		t.Fatalf("Expected the note as Markdown naming the patient, but got %v: %v", res.ContentType, string(res.Content))
+	}
+
+	res, err = s.RenderNote(context.Background(), &clerkpb.RenderNoteRequest{NoteGuid: note.NoteGuid, Format: "pdf"})
+	if err != nil || res.ContentType != "application/pdf" || !bytes.HasPrefix(res.Content, []byte("%PDF-")) {
+		t.Fatalf("Expected the note as a PDF, but got %v, %v", res, err)
+	}
+
+	_, err = s.RenderNote(context.Background(), &clerkpb.RenderNoteRequest{NoteGuid: uuid.New().String(), Format: "html"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound for an unknown note, but got %v", err)
+	}
+
+	RegisterRenderLookup(render.LookupFunc(func(ctx context.Context, kind render.Kind, guid string) (string, error) {
+		return "", errors.New("directory unavailable")
+	}))
+	_, err = s.RenderNote(context.Background(), &clerkpb.RenderNoteRequest{NoteGuid: note.NoteGuid, Format: "html"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected Unavailable when the lookup fails, but got %v", err)
+	}
+}
+
+func TestServer_RenderNote_UsesReloadedTemplates(t *testing.T) {
+	s, db := newMockDbServer(t)
+	note := addRenderNote(t, db)
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, render.HTMLTemplate), []byte("<p>{{.NoteGuid}}</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	next := localServerConfig()
+	next.RenderTemplateDir = dir
+	if err := s.Reload(next); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	res, err := s.RenderNote(context.Background(), &clerkpb.RenderNoteRequest{NoteGuid: note.NoteGuid, Format: "html"})
+	if err != nil || string(res.Content) != "<p>"+note.NoteGuid+"</p>" {
+		t.Fatalf("Expected the overriding template, but got %v, %v", res, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, render.HTMLTemplate), []byte("{{if}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(next); err == nil {
+		t.Fatalf("Expected the reload to fail on a template that does not parse")
+	}
+}
+
+func TestValidateRequest_RenderNote(t *testing.T) {
+	guid := uuid.New().String()
+	for _, req := range []*clerkpb.RenderNoteRequest{
+		{Format: "html"},
+		{NoteGuid: "not a guid", Format: "html"},
+		{NoteGuid: guid},
+		{NoteGuid: guid, Format: "docx"},
+	} {
+		if err := validateRequest(req, ContentLimits{}, nil); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected %+v to be invalid, but got %v", req, err)
+		}
+	}
+	if err := validateRequest(&clerkpb.RenderNoteRequest{NoteGuid: guid, Format: "pdf"}, ContentLimits{}, nil); err != nil {
+		t.Fatalf("Expected a PDF rendering to be valid, but got %v", err)
+	}
+}
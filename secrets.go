@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SecretProvider looks up a secret, such as the database password, by name. The meaning of the name is up to the
+// provider: a file path, an environmental variable, or a path in an external secret store.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// SecretProviderFunc adapts an ordinary function to the SecretProvider interface.
+type SecretProviderFunc func(ctx context.Context, name string) (string, error)
+
+// Secret is a method contracted by the SecretProvider interface.
+func (f SecretProviderFunc) Secret(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// Secret references take the form '<scheme>:<name>', e.g. 'file:/run/secrets/db_password' or 'env:PGPASSWORD'. The
+// file and env schemes are built in; others are added with RegisterSecretProvider.
+const (
+	SecretSchemeFile = "file"
+	SecretSchemeEnv  = "env"
+)
+
+var (
+	secretProvidersMu sync.RWMutex
+	secretProviders   = map[string]SecretProvider{
+		SecretSchemeFile: SecretProviderFunc(readSecretFile),
+		SecretSchemeEnv:  SecretProviderFunc(readSecretEnv),
+	}
+)
+
+// RegisterSecretProvider makes provider available for secret references with the given scheme, replacing any
+// provider already registered for it. It is intended to be called from an init function.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[strings.ToLower(scheme)] = provider
+}
+
+// ResolveSecret looks up a secret reference of the form '<scheme>:<name>' with the provider registered for scheme.
+// RETURNS: string, error
+func ResolveSecret(ctx context.Context, reference string) (string, error) {
+	scheme, name, err := parseSecretReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	secretProvidersMu.RLock()
+	provider := secretProviders[scheme]
+	secretProvidersMu.RUnlock()
+
+	secret, err := provider.Secret(ctx, name)
+	if err != nil {
+		return "", NoteClerkErrWrap(err, ErrResolveSecretFailsLookup, reference)
+	}
+	return secret, nil
+}
+
+// parseSecretReference splits a reference into its scheme and name, checking that a provider handles the scheme.
+// RETURNS: string, string, error
+func parseSecretReference(reference string) (scheme string, name string, err error) {
+	parts := strings.SplitN(reference, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", NoteClerkErrNew(ErrResolveSecretFailsInvalidReference, reference)
+	}
+	scheme = strings.ToLower(parts[0])
+
+	secretProvidersMu.RLock()
+	_, ok := secretProviders[scheme]
+	secretProvidersMu.RUnlock()
+	if !ok {
+		return "", "", NoteClerkErrNew(ErrResolveSecretFailsUnknownScheme, scheme, reference)
+	}
+	return scheme, parts[1], nil
+}
+
+// readSecretFile reads a secret mounted as a file, as Docker and Kubernetes do. A single trailing newline, which most
+// tools append when writing the file, is not part of the secret.
+func readSecretFile(ctx context.Context, path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSuffix(string(b), "\n")
+	return strings.TrimSuffix(secret, "\r"), nil
+}
+
+func readSecretEnv(ctx context.Context, name string) (string, error) {
+	secret, ok := os.LookupEnv(name)
+	if !ok {
+		return "", NoteClerkErrNew(ErrResolveSecretFailsUnsetEnv, name)
+	}
+	return secret, nil
+}
+
+// dbPassword returns the database password from whichever of DbPassword, DbPasswordFile and DbPasswordSecret is set.
+// It is read each time a connection is opened, so a rotated secret is picked up without restarting the server.
+// RETURNS: string, error
+func dbPassword(ctx context.Context, config *Config) (string, error) {
+	switch {
+	case config.DbPasswordFile != "":
+		return ResolveSecret(ctx, SecretSchemeFile+":"+config.DbPasswordFile)
+	case config.DbPasswordSecret != "":
+		return ResolveSecret(ctx, config.DbPasswordSecret)
+	default:
+		return config.DbPassword, nil
+	}
+}
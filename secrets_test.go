@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestResolveSecret_FileScheme_TrimsTrailingNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	ioutil.WriteFile(path, []byte("s3cret with spaces\n"), 0600)
+
+	secret, err := ResolveSecret(context.Background(), "file:"+path)
+	if err != nil {
+		t.Fatalf("Failed to resolve the file secret: %v", err)
+	}
+	if secret != "s3cret with spaces" {
+		t.Fatalf("Expected the file contents without the newline, but got %q", secret)
+	}
+}
+
+func TestResolveSecret_EnvScheme_FailsWhenUnset(t *testing.T) {
+	t.Setenv("NOTECLERK_TEST_SECRET", "from-env")
+	if secret, err := ResolveSecret(context.Background(), "env:NOTECLERK_TEST_SECRET"); err != nil || secret != "from-env" {
+		t.Fatalf("Expected the environmental variable, but got %q and %v", secret, err)
+	}
+	if _, err := ResolveSecret(context.Background(), "env:NOTECLERK_TEST_SECRET_UNSET"); err == nil {
+		t.Fatalf("Expected an error for an unset variable, but got nil")
+	}
+}
+
+func TestResolveSecret_UsesRegisteredProvider(t *testing.T) {
+	RegisterSecretProvider("vault", SecretProviderFunc(func(ctx context.Context, name string) (string, error) {
+		if name != "secret/noteclerk/db" {
+			return "", errors.New("no such secret")
+		}
+		return "from-vault", nil
+	}))
+
+	if secret, err := ResolveSecret(context.Background(), "vault:secret/noteclerk/db"); err != nil || secret != "from-vault" {
+		t.Fatalf("Expected the registered provider's secret, but got %q and %v", secret, err)
+	}
+	if _, err := ResolveSecret(context.Background(), "keychain:db"); err == nil {
+		t.Fatalf("Expected an error for a scheme without a provider, but got nil")
+	}
+}
+
+func TestDbPassword_PrefersFileThenSecretThenPlainValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	ioutil.WriteFile(path, []byte("from-file"), 0600)
+	t.Setenv("NOTECLERK_TEST_DB_PASSWORD", "from-env")
+
+	configs := map[string]*Config{
+		"from-file":  {DbPasswordFile: path},
+		"from-env":   {DbPasswordSecret: "env:NOTECLERK_TEST_DB_PASSWORD"},
+		"from-value": {DbPassword: "from-value"},
+	}
+	for expected, config := range configs {
+		if password, err := dbPassword(context.Background(), config); err != nil || password != expected {
+			t.Fatalf("Expected %q, but got %q and %v", expected, password, err)
+		}
+	}
+}
+
+func TestGenerateConnStrFromCfg_EscapesValues(t *testing.T) {
+	config := &Config{DbUsername: "noteclerk", DbIp: "localhost", DbPort: "5432", DbName: "noteclerk",
+		DbSslMode: "verify-full", DbSslCert: "/certs/client.crt", DbSslKey: "/certs/client.key"}
+
+	connStr := generateConnStrFromCfg(config, `it's a \ secret`)
+	if !strings.Contains(connStr, `password='it\'s a \\ secret'`) {
+		t.Fatalf("Expected the password quoted and escaped, but got %v", connStr)
+	}
+	if !strings.Contains(connStr, "sslcert='/certs/client.crt'") || strings.Contains(connStr, "sslrootcert") {
+		t.Fatalf("Expected only the client certificate settings which are set, but got %v", connStr)
+	}
+	if _, err := pq.NewConnector(connStr); err != nil {
+		t.Fatalf("Expected the driver to accept the connection string, but got %v", err)
+	}
+}
+
+func TestPostgresConnector_FailsWhenPasswordCannotBeRead(t *testing.T) {
+	connector := &postgresConnector{config: &Config{DbPasswordFile: filepath.Join(t.TempDir(), "missing")}}
+	if _, err := connector.Connect(context.Background()); err == nil {
+		t.Fatalf("Expected an error when the password file is missing, but got nil")
+	}
+}
@@ -4,12 +4,22 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/geekmdio/noteclerk/clerkpb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 
 	"github.com/google/uuid"
 
 	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/hl7"
+	"github.com/geekmdio/noteclerk/render"
 	"github.com/geekmdio/noted"
 )
 
@@ -23,44 +33,127 @@ type Server struct {
 	protocol string
 	connAddr string
 	server   *grpc.Server
+
+	// Holds the *serverSettings which Reload may replace while the server is running.
+	reloadable atomic.Value
+
+	// Relays note events from the outbox to WatchNotes streams and event publishers.
+	events *eventRelay
+
+	healthCheckInterval time.Duration
+	healthHttpPort      string
+	metricsHttpPort     string
+	fhirHttpPort        string
+	gatewayHttpPort     string
+	mllpPort            string
+
+	// Guards db, events, server, health, httpEndpoints, mllpServer, stopBackground and stopping, which are shared
+	// between Initialize and Shutdown.
+	lifecycle      sync.Mutex
+	health         *healthMonitor
+	httpEndpoints  []*httpEndpoint
+	mllpServer     *hl7.Server
+	stopBackground chan struct{}
+	stopping       bool
+	shutdownOnce   sync.Once
+	shutdownErr    error
 }
 
 // CreateNote is a method contracted by the NoteServiceServer interface. It therefore complies with gRPC conventions.
 // The CreateNoteRequest object carries only a Note to be added. This Note should not have an Id assigned to it, or it
 // will likely generate an error when there is an attempt to add it to the database. The CreateNoteResponse contains
-// a status, which includes a message and a HttpCode.
+// a status, which includes a message and a HttpCode. Clients which retry should send an idempotency key in the
+// request metadata (see IdempotencyKeyHeader); a retry carrying the key of an earlier request receives that request's
+// response instead of creating a duplicate note.
 // RETURNS: CreateNoteResponse, error
 func (n *Server) CreateNote(ctx context.Context, nr *ehrpb.CreateNoteRequest) (*ehrpb.CreateNoteResponse, error) {
-	cnr := &ehrpb.CreateNoteResponse{
-		Status: &ehrpb.NoteServiceResponseStatus{},
+	key := idempotencyKeyFromContext(ctx)
+	if key == "" {
+		return n.createNote(ctx, nr, nil)
+	}
+	if len(key) > MaxIdempotencyKeyLength {
+		err := NoteClerkErrNew(ErrNoteClerkServerCreateNoteRejectsIdempotencyKeyLength, MaxIdempotencyKeyLength)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	fingerprint, err := fingerprintNote(nr.Note)
+	if err != nil {
+		return nil, NoteClerkErrWrap(err, ErrNoteClerkServerCreateNoteFailsReserveIdempotencyKey)
 	}
 
+	return n.createNote(ctx, nr, &IdempotencyRecord{
+		Principal:   principalFromContext(ctx),
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Add(n.getIdempotencyKeyTtl()),
+	})
+}
+
+// createNote assigns the new note its GUID and creation date and adds it to the database. When the request carries an
+// idempotency key, the response is recorded against it in the same transaction, unless an earlier request holds the
+// key, whose response is returned instead.
+func (n *Server) createNote(ctx context.Context, nr *ehrpb.CreateNoteRequest,
+	idempotency *IdempotencyRecord) (*ehrpb.CreateNoteResponse, error) {
 	noteToAdd := nr.Note
 	noteToAdd.NoteGuid = uuid.New().String()
 	noteToAdd.DateCreated = noted.TimestampNow()
+	for _, v := range noteToAdd.GetFragments() {
+		v.NoteGuid = noteToAdd.GetNoteGuid()
+	}
+	n.settings().icd10.FillNoteFragments(noteToAdd.GetFragments())
 
 	if nr.Note.GetId() > 0 {
 		return nil, NoteClerkErrNew(ErrNoteClerkServerCreateNoteRejectsNoteDueToId)
 	}
 
-	id, _, err := n.db.AddNote(noteToAdd)
-	if err != nil {
-		err := NoteClerkErrWrap(err, ErrNoteClerkServerCreateNoteFailsAddNoteToDb)
-		log.Warn(err)
-		cnr.Status.HttpCode = ehrpb.StatusCodes_NOT_MODIFIED
-		cnr.Status.Message = "Failed to insert new note into database."
-		cnr.Note = nil
-		return nil, err
+	cnr := &ehrpb.CreateNoteResponse{
+		Status: &ehrpb.NoteServiceResponseStatus{
+			HttpCode: ehrpb.StatusCodes_OK,
+			Message:  "Successfully submit new note.",
+		},
+		Note: noteToAdd,
 	}
 
-	cnr.Note = noteToAdd
-	cnr.Note.Id = id
-	cnr.Status.HttpCode = ehrpb.StatusCodes_OK
-	cnr.Status.Message = "Successfully submit new note."
+	if idempotency == nil {
+		if _, _, err := n.writer(ctx).AddNote(noteToAdd); err != nil {
+			err := NoteClerkErrWrap(err, ErrNoteClerkServerCreateNoteFailsAddNoteToDb)
+			loggerFromContext(ctx).Warn(err)
+			return nil, err
+		}
+	} else {
+		idempotency.Response = cnr
+		_, existing, err := n.writer(ctx).AddNoteWithIdempotencyKey(noteToAdd, idempotency)
+		if err != nil {
+			err := NoteClerkErrWrap(err, ErrNoteClerkServerCreateNoteFailsRecordIdempotencyKey)
+			loggerFromContext(ctx).Warn(err)
+			return nil, err
+		}
+		if existing != nil {
+			return repeatedCreateNoteResponse(ctx, idempotency, existing)
+		}
+	}
 
+	notesCreatedTotal.Inc()
+	n.events.nudge()
 	return cnr, nil
 }
 
+// repeatedCreateNoteResponse returns the response recorded for an earlier request with the same idempotency key, if
+// it was made for the same note.
+func repeatedCreateNoteResponse(ctx context.Context, idempotency *IdempotencyRecord,
+	existing *IdempotencyRecord) (*ehrpb.CreateNoteResponse, error) {
+	switch {
+	case existing.Fingerprint != idempotency.Fingerprint:
+		err := NoteClerkErrNew(ErrNoteClerkServerCreateNoteRejectsReusedIdempotencyKey)
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case existing.Response == nil:
+		err := NoteClerkErrNew(ErrNoteClerkServerCreateNoteRejectsIdempotencyKeyInProgress)
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	loggerFromContext(ctx).Infof("Returning the recorded response for a repeated CreateNote request.")
+	return existing.Response, nil
+}
+
 // DeleteNote is a method contracted by the NoteServiceServer interface. It therefore complies with gRPC conventions.
 // The DeleteNoteRequest object carries only the Id of the target note. The DeleteNoteResponse contains only
 // a status, which includes a message and a HttpCode.
@@ -73,14 +166,15 @@ func (n *Server) DeleteNote(ctx context.Context, dnr *ehrpb.DeleteNoteRequest) (
 		},
 	}
 
-	err := n.db.DeleteNote(dnr.GetGuid())
+	err := n.writer(ctx).DeleteNote(dnr.GetGuid())
 	if err != nil {
 		err := NoteClerkErrWrap(err, ErrNoteClerkServerDeleteNoteFailsDeleteNoteFromDb)
-		log.Warn(err)
+		loggerFromContext(ctx).Warn(err)
 		dnRes.Status.HttpCode = ehrpb.StatusCodes_NOT_MODIFIED
 		dnRes.Status.Message = "Failed to change the notes status to deleted in the database."
 		return dnRes, err
 	}
+	n.events.nudge()
 
 	return dnRes, nil
 }
@@ -97,10 +191,10 @@ func (n *Server) RetrieveNote(ctx context.Context, rnr *ehrpb.RetrieveNoteReques
 		},
 	}
 
-	note, err := n.db.GetNoteByGuid(rnr.GetGuid())
+	note, err := n.reader(ctx).GetNoteByGuid(rnr.GetGuid())
 	if err != nil {
 		err := NoteClerkErrWrap(err, ErrNoteClerkServerRetrieveNoteFailsToGetNoteFromDb)
-		log.Warn(err)
+		loggerFromContext(ctx).Warn(err)
 		res.Status.HttpCode = ehrpb.StatusCodes_NOT_FOUND
 		res.Status.Message = "Failed to retrieve note from database."
 		return res, err
@@ -108,7 +202,7 @@ func (n *Server) RetrieveNote(ctx context.Context, rnr *ehrpb.RetrieveNoteReques
 
 	err = noted.OrganizeNoteFragments(note)
 	if err != nil {
-		log.Warn("Could not organize the note fragments by fragment priority.")
+		loggerFromContext(ctx).Warn("Could not organize the note fragments by fragment priority.")
 	}
 	res.Note = note
 
@@ -135,10 +229,10 @@ func (n *Server) SearchNotes(ctx context.Context, fnr *ehrpb.SearchNotesRequest)
 		},
 	}
 
-	notes, err := n.db.FindNotes(filter)
+	notes, err := n.reader(ctx).FindNotes(filter)
 	if err != nil {
 		err := NoteClerkErrWrap(err, ErrNoteClerkServerSearchNotesFailsToFindNotesInDb)
-		log.Warn(err)
+		loggerFromContext(ctx).Warn(err)
 		res.Status.HttpCode = ehrpb.StatusCodes_NOT_FOUND
 		res.Status.Message = "Failed to locate notes matching query"
 		return res, err
@@ -147,10 +241,13 @@ func (n *Server) SearchNotes(ctx context.Context, fnr *ehrpb.SearchNotesRequest)
 	for _, v := range res.Notes {
 		err := noted.OrganizeNoteFragments(v)
 		if err != nil {
-			log.Warn("Could not organize the note fragments by fragment priority.")
+			loggerFromContext(ctx).Warn("Could not organize the note fragments by fragment priority.")
 		}
 	}
 
+	if len(notes) == 0 {
+		searchesWithoutResultsTotal.WithLabelValues("SearchNotes").Inc()
+	}
 	res.Notes = notes
 	return res, nil
 }
@@ -171,20 +268,25 @@ func (n *Server) UpdateNote(ctx context.Context, unr *ehrpb.UpdateNoteRequest) (
 
 	if unr.Id != unr.Note.Id {
 		newErr := NoteClerkErrNew(ErrNoteClerkServerUpdateNoteFailsDueToIdMismatch)
-		log.Warn(newErr)
+		loggerFromContext(ctx).Warn(newErr)
 		updateNoteResponse.Status.HttpCode = ehrpb.StatusCodes_CONFLICT
 		updateNoteResponse.Status.Message = "Failed to update note. The id provided for the update note request does not match the id of the note."
 		return updateNoteResponse, newErr
 	}
 
-	err := n.db.UpdateNote(unr.Note)
+	n.settings().icd10.FillNoteFragments(unr.Note.GetFragments())
+
+	err := n.writer(ctx).UpdateNote(unr.Note)
 	if err != nil {
 		newErr := NoteClerkErrWrap(err, ErrNoteClerkServerUpdateNoteFailsToUpdateNoteInDb)
-		log.Warn(newErr)
+		loggerFromContext(ctx).Warn(newErr)
 		updateNoteResponse.Status.HttpCode = ehrpb.StatusCodes_NOT_FOUND
 		updateNoteResponse.Status.Message = "UpdateNote failed. Unable to update note in the database."
 		return updateNoteResponse, newErr
 	}
+	// Every fragment of an updated note is stored as a new version, superseding the one before it
+	fragmentsSupersededTotal.Add(float64(len(unr.Note.GetFragments())))
+	n.events.nudge()
 
 	return updateNoteResponse, nil
 }
@@ -193,9 +295,223 @@ func (n *Server) UpdateNote(ctx context.Context, unr *ehrpb.UpdateNoteRequest) (
 // The SearchNoteFragmentsRequest object carries fields for GUID's of patient, author, visit, and note. There is also a
 // search terms field, where search terms will be evaluated against note fragment content and tags. The
 // SearchNoteFragmentsResponse contains a slice of NoteFragment and a status, which includes a message and a HttpCode.
+// It is not implemented yet, and fails with codes.Unimplemented.
 // RETURNS: SearchNoteFragmentsResponse, error
 func (n *Server) SearchNoteFragments(ctx context.Context, snf *ehrpb.SearchNoteFragmentRequest) (*ehrpb.SearchNoteFragmentResponse, error) {
-	panic("implement me")
+	err := NoteClerkErrNew(ErrNoteClerkServerSearchNoteFragmentsIsUnimplemented)
+	return nil, status.Error(codes.Unimplemented, err.Error())
+}
+
+// LookupIcd10Codes is a method contracted by the ClerkServiceServer interface. The LookupIcd10CodesRequest carries a
+// query, which is either the beginning of a code (e.g. 'J45.9') or words from a code's description (e.g. 'asthma
+// exacerbation'), and an optional limit on the number of results. The LookupIcd10CodesResponse contains the matching
+// codes and their long descriptions.
+// RETURNS: LookupIcd10CodesResponse, error
+func (n *Server) LookupIcd10Codes(ctx context.Context, req *clerkpb.LookupIcd10CodesRequest) (*clerkpb.LookupIcd10CodesResponse, error) {
+	icd10 := n.settings().icd10
+	if icd10 == nil {
+		err := NoteClerkErrNew(ErrNoteClerkServerLookupIcd10CodesFailsCodeSetNotLoaded)
+		loggerFromContext(ctx).Warn(err)
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	res := &clerkpb.LookupIcd10CodesResponse{}
+	for _, v := range icd10.Search(req.Query, int(req.Limit)) {
+		res.Codes = append(res.Codes, &clerkpb.Icd10Code{Code: v.Code, Description: v.Description})
+	}
+	return res, nil
+}
+
+// ExportCcda is a method contracted by the ClerkServiceServer interface. The ExportCcdaRequest carries the GUID of a
+// note, or of a visit whose notes are all exported, and the kind of document wanted. The ExportCcdaResponse contains
+// the C-CDA document and the GUIDs of the notes rendered into it.
+// RETURNS: ExportCcdaResponse, error
+func (n *Server) ExportCcda(ctx context.Context, req *clerkpb.ExportCcdaRequest) (*clerkpb.ExportCcdaResponse, error) {
+	res, err := exportCcda(n.reader(ctx), req, time.Now())
+	if err != nil {
+		loggerFromContext(ctx).Warn(err)
+		return nil, err
+	}
+	return res, nil
+}
+
+// RenderNote is a method contracted by the ClerkServiceServer interface. The RenderNoteRequest carries the GUID of a
+// note and the format wanted. The note's fragments are organized as RetrieveNote organizes them, and its patient,
+// author and visit are named by the registered RenderLookup. The RenderNoteResponse contains the rendered note.
+// RETURNS: RenderNoteResponse, error
+func (n *Server) RenderNote(ctx context.Context, req *clerkpb.RenderNoteRequest) (*clerkpb.RenderNoteResponse, error) {
+	logger := loggerFromContext(ctx)
+	note, err := n.reader(ctx).GetNoteByGuid(req.NoteGuid)
+	if err != nil {
+		err := NoteClerkErrWrap(err, ErrNoteClerkServerRenderNoteFailsGetNote, req.NoteGuid)
+		logger.Warn(err)
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err := noted.OrganizeNoteFragments(note); err != nil {
+		logger.Warn("Could not organize the note fragments by fragment priority.")
+	}
+
+	doc, err := render.NewDocument(ctx, note, renderLookup())
+	if err != nil {
+		err := NoteClerkErrWrap(err, ErrNoteClerkServerRenderNoteFailsLookup, req.NoteGuid)
+		logger.Warn(err)
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	format := render.Format(req.Format)
+	renderer := n.settings().renderer
+	if renderer == nil {
+		renderer, err = render.NewRenderer("")
+	}
+	var content []byte
+	if err == nil {
+		content, err = renderer.Render(doc, format)
+	}
+	if err != nil {
+		err := NoteClerkErrWrap(err, ErrNoteClerkServerRenderNoteFailsRender, req.NoteGuid, format)
+		logger.Warn(err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &clerkpb.RenderNoteResponse{Content: content, ContentType: format.ContentType()}, nil
+}
+
+// WatchNotes is a method contracted by the ClerkServiceServer interface. It streams note events, in offset order,
+// starting after the WatchNotesRequest's AfterOffset, and then each new event as it is committed. The stream ends only
+// when the client cancels it or the server stops, in which case it ends with codes.Unavailable and the client should
+// resume after the offset of the last event it received.
+// RETURNS: error
+func (n *Server) WatchNotes(req *clerkpb.WatchNotesRequest, stream clerkpb.ClerkService_WatchNotesServer) error {
+	ctx := stream.Context()
+	settings := n.settings()
+	if err := validateRequest(req, settings.limits, settings.icd10); err != nil {
+		loggerFromContext(ctx).Warnf("Rejected an invalid request: %v", err)
+		return err
+	}
+
+	after := req.AfterOffset
+	for {
+		changed := n.events.changes()
+		events, err := n.reader(ctx).NoteEventsAfter(after, eventBatchSize)
+		if err != nil {
+			err := NoteClerkErrWrap(err, ErrNoteClerkServerWatchNotesFailsReadEvents, after)
+			loggerFromContext(ctx).Warn(err)
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		for _, e := range events {
+			after = e.Offset
+			if !matchesEventTypes(e, req.EventTypes) {
+				continue
+			}
+			if err := stream.Send(noteEventMessage(e)); err != nil {
+				return err
+			}
+		}
+		if len(events) > 0 {
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-n.events.closed:
+			return status.Errorf(codes.Unavailable, "The server is stopping; resume watching after offset %v.", after)
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// CreateWebhookSubscription is a method contracted by the ClerkServiceServer interface. It stores a subscription for
+// the note events matching the CreateWebhookSubscriptionRequest, with a new signing secret, and starts delivering
+// events to it. URLs which are not https, or are of private addresses, are refused unless the configuration allows
+// them. The CreateWebhookSubscriptionResponse carries the subscription and its secret.
+// RETURNS: CreateWebhookSubscriptionResponse, error
+func (n *Server) CreateWebhookSubscription(ctx context.Context,
+	req *clerkpb.CreateWebhookSubscriptionRequest) (*clerkpb.CreateWebhookSubscriptionResponse, error) {
+	logger := loggerFromContext(ctx)
+	if violation := n.events.targets.violation(req.Url); violation != "" {
+		v := &validator{}
+		v.addViolation("url", "%v", violation)
+		err := v.err()
+		logger.Warnf("Rejected an invalid request: %v", err)
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		err := NoteClerkErrWrap(err, ErrNoteClerkServerCreateWebhookSubscriptionFailsSecret)
+		logger.Warn(err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var afterOffset int64
+	if req.AfterOffset != nil {
+		afterOffset = *req.AfterOffset
+	} else if afterOffset, err = n.writer(ctx).SequenceNoteEvents(); err != nil {
+		err := NoteClerkErrWrap(err, ErrNoteClerkServerCreateWebhookSubscriptionFailsOffset)
+		logger.Warn(err)
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	sub := &WebhookSubscription{
+		Guid:        uuid.New().String(),
+		Url:         req.Url,
+		Secret:      secret,
+		PatientGuid: req.PatientGuid,
+		NoteTypes:   req.NoteTypes,
+		EventTypes:  req.EventTypes,
+		AfterOffset: afterOffset,
+		DateCreated: time.Now().UTC(),
+	}
+	if err := n.writer(ctx).AddWebhookSubscription(sub); err != nil {
+		err := NoteClerkErrWrap(err, ErrNoteClerkServerCreateWebhookSubscriptionFailsAdd)
+		logger.Warn(err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	logger.Infof("Created webhook subscription %v delivering to %v.", sub.Guid, sub.Url)
+	n.events.nudge()
+	return &clerkpb.CreateWebhookSubscriptionResponse{Subscription: webhookSubscriptionMessage(sub)}, nil
+}
+
+// ListWebhookSubscriptions is a method contracted by the ClerkServiceServer interface. The
+// ListWebhookSubscriptionsResponse carries every webhook subscription, without its secret.
+// RETURNS: ListWebhookSubscriptionsResponse, error
+func (n *Server) ListWebhookSubscriptions(ctx context.Context,
+	req *clerkpb.ListWebhookSubscriptionsRequest) (*clerkpb.ListWebhookSubscriptionsResponse, error) {
+	subs, err := n.reader(ctx).WebhookSubscriptions()
+	if err != nil {
+		err := NoteClerkErrWrap(err, ErrNoteClerkServerListWebhookSubscriptionsFailsQuery)
+		loggerFromContext(ctx).Warn(err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &clerkpb.ListWebhookSubscriptionsResponse{}
+	for _, v := range subs {
+		v.Secret = ""
+		res.Subscriptions = append(res.Subscriptions, webhookSubscriptionMessage(v))
+	}
+	return res, nil
+}
+
+// DeleteWebhookSubscription is a method contracted by the ClerkServiceServer interface. It deletes the subscription
+// with the DeleteWebhookSubscriptionRequest's GUID, along with its dead letters. Events stop being delivered to it
+// within EventPollInterval.
+// RETURNS: DeleteWebhookSubscriptionResponse, error
+func (n *Server) DeleteWebhookSubscription(ctx context.Context,
+	req *clerkpb.DeleteWebhookSubscriptionRequest) (*clerkpb.DeleteWebhookSubscriptionResponse, error) {
+	logger := loggerFromContext(ctx)
+	deleted, err := n.writer(ctx).DeleteWebhookSubscription(req.Guid)
+	if err != nil {
+		err := NoteClerkErrWrap(err, ErrNoteClerkServerDeleteWebhookSubscriptionFailsDelete, req.Guid)
+		logger.Warn(err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !deleted {
+		err := NoteClerkErrNew(ErrNoteClerkServerDeleteWebhookSubscriptionFailsNotFound, req.Guid)
+		logger.Warn(err)
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	logger.Infof("Deleted webhook subscription %v.", req.Guid)
+	n.events.nudge()
+	return &clerkpb.DeleteWebhookSubscriptionResponse{}, nil
 }
 
 // Initialize takes a configuration file and a struct which implements the RDBMSAccessor interface. That is, generally
@@ -204,7 +520,9 @@ func (n *Server) SearchNoteFragments(ctx context.Context, snf *ehrpb.SearchNoteF
 // RETURNS: error
 func (n *Server) Initialize(config *Config, db RDBMSAccessor) error {
 	// Build up the server's fields
+	n.lifecycle.Lock()
 	conErr := n.constructor(config, db)
+	n.lifecycle.Unlock()
 	if conErr != nil {
 		return conErr
 	}
@@ -217,26 +535,201 @@ func (n *Server) Initialize(config *Config, db RDBMSAccessor) error {
 	log.Info("Successfully connected to database.")
 
 	// Create and register gRPC server
-	n.server = grpc.NewServer()
-	ehrpb.RegisterNoteServiceServer(n.server, n)
+	rpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(n.unaryInterceptors()...))
+	ehrpb.RegisterNoteServiceServer(rpcServer, n)
+	clerkpb.RegisterClerkServiceServer(rpcServer, n)
 	log.Info("Assigning server a new instance of gRPC server.")
 
-	// Create listener
+	// Report health through grpc.health.v1, for the server as a whole and for each service it hosts
+	var services []string
+	for name := range rpcServer.GetServiceInfo() {
+		services = append(services, name)
+	}
+	monitor := newHealthMonitor(n.db, n.healthCheckInterval, services)
+	grpc_health_v1.RegisterHealthServer(rpcServer, monitor.grpc)
+
+	// Create listeners
 	lis, err := net.Listen(n.getProtocol(), n.getConnectionAddr())
 	if err != nil {
 		return NoteClerkErrWrap(err, ErrNoteClerkServerInitializeFailsCreateListener)
 	}
 	log.Info("Successfully created a listener.")
 
+	// Endpoints configured on the same port share its listener
+	routes := map[string][]func(mux *http.ServeMux){}
+	routes[n.healthHttpPort] = append(routes[n.healthHttpPort], monitor.registerHttp)
+	routes[n.metricsHttpPort] = append(routes[n.metricsHttpPort], registerMetricsHttp)
+	routes[n.fhirHttpPort] = append(routes[n.fhirHttpPort], n.registerFhirHttp)
+	routes[n.gatewayHttpPort] = append(routes[n.gatewayHttpPort], n.registerGatewayHttp)
+	endpoints, err := n.listenHttp(routes)
+	if err != nil {
+		lis.Close()
+		return err
+	}
+	var mllpLis net.Listener
+	if n.mllpPort != "" {
+		mllpLis, err = net.Listen("tcp", fmt.Sprintf("%v:%v", n.getIp(), n.mllpPort))
+		if err != nil {
+			lis.Close()
+			for _, v := range endpoints {
+				v.lis.Close()
+			}
+			return NoteClerkErrWrap(err, ErrNoteClerkServerInitializeFailsCreateMllpListener, n.mllpPort)
+		}
+	}
+
+	// A Shutdown which arrived while the server was starting wins; otherwise later Shutdown calls stop this server
+	n.lifecycle.Lock()
+	if n.stopping {
+		n.lifecycle.Unlock()
+		lis.Close()
+		for _, v := range endpoints {
+			v.lis.Close()
+		}
+		if mllpLis != nil {
+			mllpLis.Close()
+		}
+		return nil
+	}
+	n.server = rpcServer
+	n.health = monitor
+	n.httpEndpoints = endpoints
+	n.stopBackground = make(chan struct{})
+	for _, v := range endpoints {
+		go v.serve()
+	}
+	if mllpLis != nil {
+		n.mllpServer = n.serveMllp(mllpLis)
+	}
+	n.lifecycle.Unlock()
+
+	// Expired idempotency keys are purged, note events relayed and the database health checked in the background while
+	// the server runs
+	go purgeExpiredIdempotencyKeys(n.db, time.Hour, n.stopBackground)
+	go n.events.run(n.stopBackground)
+	go monitor.run(n.stopBackground)
+
 	// Serve
 	log.Info("Starting gRPC server.")
-	if err = n.server.Serve(lis); err != nil {
+	if err = rpcServer.Serve(lis); err != nil {
 		return NoteClerkErrWrap(err, ErrNoteClerkServerInitializeFailsInitializingRpcServer)
 	}
 
 	return nil
 }
 
+// Shutdown is a method contracted by the NoteClerkServer interface. It stops the server accepting new connections and
+// waits for in-flight RPCs to finish, causing Initialize to return. If ctx is done before they finish, the remaining
+// connections are closed. The database is closed last. Shutdown may be called more than once, and before Initialize
+// has finished starting the server; every call returns the result of the first.
+// RETURNS: error
+func (n *Server) Shutdown(ctx context.Context) error {
+	n.shutdownOnce.Do(func() {
+		n.lifecycle.Lock()
+		n.stopping = true
+		rpcServer, monitor, endpoints, stopBackground, db := n.server, n.health, n.httpEndpoints, n.stopBackground, n.db
+		mllpServer, events := n.mllpServer, n.events
+		n.lifecycle.Unlock()
+
+		// Tell load balancers to stop routing here before connections start closing
+		if monitor != nil {
+			monitor.drain()
+		}
+		// WatchNotes streams never finish on their own, so end them rather than wait for them
+		if events != nil {
+			events.close()
+		}
+
+		if rpcServer != nil {
+			log.Info("Stopping gRPC server; waiting for in-flight RPCs to finish.")
+			drained := make(chan struct{})
+			go func() {
+				rpcServer.GracefulStop()
+				close(drained)
+			}()
+			select {
+			case <-drained:
+				log.Info("All in-flight RPCs finished.")
+			case <-ctx.Done():
+				rpcServer.Stop()
+				n.shutdownErr = NoteClerkErrWrap(ctx.Err(), ErrNoteClerkServerShutdownFailsDrainBeforeDeadline)
+				log.Warn(n.shutdownErr)
+			}
+		}
+		for _, v := range endpoints {
+			if err := v.server.Shutdown(ctx); err != nil {
+				v.server.Close()
+			}
+		}
+		if mllpServer != nil {
+			if err := mllpServer.Shutdown(ctx); err != nil {
+				log.Warn(NoteClerkErrWrap(err, ErrNoteClerkServerShutdownFailsDrainMllp))
+			}
+		}
+		if stopBackground != nil {
+			close(stopBackground)
+		}
+
+		if db != nil {
+			if err := db.Close(); err != nil {
+				err = NoteClerkErrWrap(err, ErrNoteClerkServerShutdownFailsCloseDb)
+				log.Warn(err)
+				if n.shutdownErr == nil {
+					n.shutdownErr = err
+				}
+			}
+		}
+		log.Info("Server stopped.")
+	})
+	return n.shutdownErr
+}
+
+// httpEndpoint is an HTTP server for the operational endpoints, such as health and metrics, configured on one port.
+type httpEndpoint struct {
+	lis    net.Listener
+	server *http.Server
+}
+
+// listenHttp creates a listener on ServerIp for each configured port, keyed by port, and registers the routes for that
+// port on its server. Endpoints configured on the same port share a server; routes without a port are not served.
+// RETURNS: []*httpEndpoint, error
+func (n *Server) listenHttp(routes map[string][]func(mux *http.ServeMux)) ([]*httpEndpoint, error) {
+	var endpoints []*httpEndpoint
+	for port, registrations := range routes {
+		if port == "" {
+			continue
+		}
+		lis, err := net.Listen("tcp", fmt.Sprintf("%v:%v", n.getIp(), port))
+		if err != nil {
+			for _, v := range endpoints {
+				v.lis.Close()
+			}
+			return nil, NoteClerkErrWrap(err, ErrNoteClerkServerInitializeFailsCreateHttpListener, port)
+		}
+		mux := http.NewServeMux()
+		for _, register := range registrations {
+			register(mux)
+		}
+		endpoints = append(endpoints, &httpEndpoint{lis: lis, server: &http.Server{Handler: mux}})
+		log.Infof("Serving HTTP endpoints on %v.", lis.Addr())
+	}
+	return endpoints, nil
+}
+
+// unaryInterceptors are the interceptors every unary RPC passes through, in order, whether it arrives over gRPC or
+// through the JSON/REST gateway.
+func (n *Server) unaryInterceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{tracingInterceptor, loggingInterceptor, metricsInterceptor,
+		n.validationInterceptor}
+}
+
+// serve handles HTTP requests until Shutdown stops the endpoint.
+func (e *httpEndpoint) serve() {
+	if err := e.server.Serve(e.lis); err != nil && err != http.ErrServerClosed {
+		log.Error(NoteClerkErrWrap(err, ErrNoteClerkServerFailsServeHttp, e.lis.Addr()))
+	}
+}
+
 // constructor populates fields belonging to the Server struct. It also validates the state of the
 // database and configuration files.
 func (n *Server) constructor(config *Config, db RDBMSAccessor) error {
@@ -251,11 +744,69 @@ func (n *Server) constructor(config *Config, db RDBMSAccessor) error {
 	n.port = config.ServerPort
 	n.protocol = config.ServerProtocol
 	n.connAddr = fmt.Sprintf("%v:%v", n.getIp(), n.getPort())
-	n.db = db
+	n.db = instrumentDb(db)
+	dbStats.setSource(db)
+
+	settings, err := newServerSettings(config)
+	if err != nil {
+		return err
+	}
+	n.reloadable.Store(settings)
+
+	eventPollInterval := DefaultEventPollInterval
+	if config.EventPollInterval != "" {
+		interval, err := time.ParseDuration(config.EventPollInterval)
+		if err != nil || interval <= 0 {
+			return NoteClerkErrWrap(err, ErrNoteClerkServerConstructorFailsInvalidEventPollInterval, config.EventPollInterval)
+		}
+		eventPollInterval = interval
+	}
+	var webhook EventPublisher
+	if config.EventWebhookUrl != "" {
+		webhook = newWebhookPublisher(config.EventWebhookUrl, anyWebhookTarget)
+	}
+	n.events = newEventRelay(n.db, eventPollInterval, webhook)
+	n.events.targets = webhookTargetPolicy{allowHttp: config.WebhookAllowHttp,
+		allowPrivate: config.WebhookAllowPrivateTargets}
+	if config.WebhookMaxAttempts > 0 {
+		n.events.retry.maxAttempts = config.WebhookMaxAttempts
+	}
+	if config.WebhookRetryBackoff != "" {
+		backoff, err := time.ParseDuration(config.WebhookRetryBackoff)
+		if err != nil || backoff <= 0 {
+			return NoteClerkErrWrap(err, ErrNoteClerkServerConstructorFailsInvalidWebhookBackoff, config.WebhookRetryBackoff)
+		}
+		n.events.retry.backoff = backoff
+	}
+
+	n.healthCheckInterval = DefaultHealthCheckInterval
+	if config.HealthCheckInterval != "" {
+		interval, err := time.ParseDuration(config.HealthCheckInterval)
+		if err != nil || interval <= 0 {
+			return NoteClerkErrWrap(err, ErrNoteClerkServerConstructorFailsInvalidHealthInterval, config.HealthCheckInterval)
+		}
+		n.healthCheckInterval = interval
+	}
+	n.healthHttpPort = config.HealthHttpPort
+	n.metricsHttpPort = config.MetricsHttpPort
+	n.fhirHttpPort = config.FhirHttpPort
+	n.gatewayHttpPort = config.GatewayHttpPort
+	n.mllpPort = config.MllpPort
 
 	return nil
 }
 
+// reader returns the database scoped to the request, so that reads are traced as part of it and abandoned with it.
+func (n *Server) reader(ctx context.Context) RDBMSAccessor {
+	return n.db.WithContext(ctx)
+}
+
+// writer returns the database scoped to the request for writes. Each write runs in one transaction, so a write
+// abandoned with its request is rolled back, and a client retrying it does not create a second note.
+func (n *Server) writer(ctx context.Context) RDBMSAccessor {
+	return n.db.WithContext(ctx)
+}
+
 func (n *Server) getIp() string {
 	return n.ip
 }
@@ -271,3 +822,10 @@ func (n *Server) getProtocol() string {
 func (n *Server) getConnectionAddr() string {
 	return n.connAddr
 }
+
+func (n *Server) getIdempotencyKeyTtl() time.Duration {
+	if ttl := n.settings().idempotencyKeyTtl; ttl > 0 {
+		return ttl
+	}
+	return DefaultIdempotencyKeyTtl
+}
@@ -118,6 +118,24 @@ func TestNoteClerkServer_CreateNote_WithFragmentsRetainsFragments(t *testing.T)
 	}
 }
 
+func TestNoteClerkServer_CreateNote_FragmentsReferenceNewNoteGuid(t *testing.T) {
+	s := &Server{}
+	s.Initialize(&Config{}, mockDb)
+
+	cnr := &ehrpb.CreateNoteRequest{Note: noted.NewNote()}
+	cnr.Note.Fragments = append(cnr.Note.Fragments, noted.NewNoteFragment())
+
+	res, err := s.CreateNote(context.Background(), cnr)
+	if err != nil {
+		t.Fatalf("Error creating a new note, err %v", err)
+	}
+
+	if res.Note.Fragments[0].GetNoteGuid() != res.Note.GetNoteGuid() {
+		t.Fatalf("Fragment note GUID %v should match the new note GUID %v",
+			res.Note.Fragments[0].GetNoteGuid(), res.Note.GetNoteGuid())
+	}
+}
+
 func TestNoteClerkServer_CreateNote_WithTagsRetainsTags(t *testing.T) {
 	s := &Server{}
 	s.Initialize(&Config{}, mockDb)
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Values of the TracingExporter setting.
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOtlp   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+const tracingServiceName = "noteclerk"
+
+const tracerName = "github.com/geekmdio/noteclerk"
+
+// tracer returns the tracer of the current global tracer provider, which is a no-op until initTracing installs an
+// exporting one. It is looked up on each use, rather than kept, so that a provider installed later takes effect.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// initTracing installs the global tracer provider and W3C trace context propagator described by the configuration.
+// Spans are exported over OTLP/gRPC, written as JSON to a file or stdout for local debugging, or, by default, not
+// exported at all. The returned function flushes buffered spans and must be called before the process exits.
+// RETURNS: func(context.Context) error, error
+func initTracing(config *Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+
+	ratio := config.TracingSampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, NoteClerkErrNew(ErrInitTracingFailsInvalidSampleRatio, config.TracingSampleRatio)
+	}
+
+	var exporter sdktrace.SpanExporter
+	var closeOutput func() error
+	switch strings.ToLower(config.TracingExporter) {
+	case "", TracingExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TracingExporterOtlp:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.TracingOtlpEndpoint)}
+		if config.TracingOtlpInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exp, err := otlptracegrpc.New(context.Background(), opts...)
+		if err != nil {
+			return nil, NoteClerkErrWrap(err, ErrInitTracingFailsCreateExporter, config.TracingExporter)
+		}
+		exporter = exp
+	case TracingExporterStdout:
+		out := os.Stdout
+		if config.TracingFilePath != "" {
+			file, err := os.OpenFile(config.TracingFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				return nil, NoteClerkErrWrap(err, ErrInitTracingFailsOpenFile, config.TracingFilePath)
+			}
+			out, closeOutput = file, file.Close
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(out))
+		if err != nil {
+			return nil, NoteClerkErrWrap(err, ErrInitTracingFailsCreateExporter, config.TracingExporter)
+		}
+		exporter = exp
+	default:
+		return nil, NoteClerkErrNew(ErrInitTracingFailsUnknownExporter, config.TracingExporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", tracingServiceName),
+			attribute.String("service.version", config.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	log.Infof("Exporting traces with the %v exporter.", config.TracingExporter)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeOutput != nil {
+			if closeErr := closeOutput(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// tracingInterceptor continues the trace carried in the incoming gRPC metadata, if any, and wraps each unary RPC in a
+// server span. It runs ahead of the other interceptors so that their work is part of the span. Span statuses carry
+// only the gRPC status code; error messages may quote request content and are left out.
+func tracingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	service, method := splitFullMethod(info.FullMethod)
+	ctx, span := tracer().Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", method),
+		))
+	defer span.End()
+
+	res, err := handler(ctx, req)
+	code := status.Code(err)
+	span.SetAttributes(attribute.Int64("rpc.grpc.status_code", int64(code)))
+	if err != nil {
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+	return res, err
+}
+
+// startQuerySpan starts a client span for a SQL statement. The span is named after the statement's operation, e.g.
+// 'SELECT', and records the parameterized statement; the arguments, which may hold patient data, are never recorded.
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := "QUERY"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return tracer().Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+			attribute.String("db.statement", strings.TrimSpace(query)),
+		))
+}
+
+// endSpan marks the span as failed when err is set, other than for an empty result, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, "query failed")
+	}
+	span.End()
+}
+
+func splitFullMethod(fullMethod string) (service string, method string) {
+	parts := strings.SplitN(strings.TrimPrefix(fullMethod, "/"), "/", 2)
+	if len(parts) != 2 {
+		return "", fullMethod
+	}
+	return parts[0], parts[1]
+}
+
+// metadataCarrier adapts gRPC metadata to the OpenTelemetry TextMapCarrier interface.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// recordSpans installs a tracer provider which records every span in memory, for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+func TestTracingInterceptor_ContinuesIncomingTraceAndParentsQuerySpans(t *testing.T) {
+	recorder := recordSpans(t)
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	md := metadata.Pairs("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	info := &grpc.UnaryServerInfo{FullMethod: "/noteclerk.ClerkService/LookupIcd10Codes"}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, span := startQuerySpan(ctx, "SELECT id FROM note WHERE note_guid = $1")
+		endSpan(span, nil)
+		return nil, status.Error(codes.NotFound, "no such note")
+	}
+	tracingInterceptor(ctx, nil, info, handler)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected a query span and a server span, but recorded %v spans", len(spans))
+	}
+	query, server := spans[0], spans[1]
+	if server.SpanKind() != trace.SpanKindServer || server.Name() != info.FullMethod {
+		t.Fatalf("Expected a server span named %v, but got %v span %v", info.FullMethod, server.SpanKind(), server.Name())
+	}
+	if server.SpanContext().TraceID().String() != traceId {
+		t.Fatalf("Expected the server span to continue trace %v, but it is in trace %v", traceId,
+			server.SpanContext().TraceID())
+	}
+	if query.Name() != "SELECT" || query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatalf("Expected a SELECT span parented by the server span, but got %v with parent %v", query.Name(),
+			query.Parent().SpanID())
+	}
+	if server.Status().Description != codes.NotFound.String() {
+		t.Fatalf("Expected the server span status to carry only the gRPC code, but got %q", server.Status().Description)
+	}
+}
+
+func TestInitTracing_WithUnknownExporter_ReturnsError(t *testing.T) {
+	if _, err := initTracing(&Config{TracingExporter: "carrier-pigeon"}); err == nil {
+		t.Fatalf("An unknown TracingExporter should be rejected.")
+	}
+}
+
+func TestInitTracing_WithStdoutExporterAndFile_WritesSpansOnShutdown(t *testing.T) {
+	previousProvider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previousProvider)
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := initTracing(&Config{TracingExporter: TracingExporterStdout, TracingFilePath: path})
+	if err != nil {
+		t.Fatalf("initTracing failed: %v", err)
+	}
+	_, span := startQuerySpan(context.Background(), "DELETE FROM idempotency_key WHERE expires_at < $1")
+	endSpan(span, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Flushing traces failed: %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read the trace file: %v", err)
+	}
+	if !strings.Contains(string(contents), `"Name":"DELETE"`) {
+		t.Fatalf("Expected the trace file to contain the DELETE span, but got:\n%v", string(contents))
+	}
+}
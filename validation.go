@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/ccda"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/geekmdio/noteclerk/render"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validationInterceptor validates every incoming request before it reaches its handler, and therefore before any
+// RDBMSAccessor call is made. Invalid requests are rejected with codes.InvalidArgument and a BadRequest detail
+// listing every field violation found.
+func (n *Server) validationInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	settings := n.settings()
+	if err := validateRequest(req, settings.limits, settings.icd10); err != nil {
+		loggerFromContext(ctx).Warnf("Rejected an invalid request: %v", err)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// validateRequest checks any of the NoteService or ClerkService requests against the field rules below. Request types
+// without rules are accepted as they are. ICD-10-CM codes are only checked when a code set is loaded.
+// RETURNS: error (a gRPC status carrying BadRequest details), or nil when the request is valid
+func validateRequest(req interface{}, limits ContentLimits, icd10 *Icd10CodeSet) error {
+	v := &validator{limits: limits, icd10: icd10}
+
+	switch r := req.(type) {
+	case *ehrpb.CreateNoteRequest:
+		if v.present("note", r.GetNote() != nil) {
+			v.note("note", r.GetNote(), false)
+			if r.GetNote().GetId() != 0 {
+				v.addViolation("note.id", "must be zero; the id is assigned when the note is created")
+			}
+		}
+	case *ehrpb.UpdateNoteRequest:
+		if v.present("note", r.GetNote() != nil) {
+			v.note("note", r.GetNote(), true)
+			if r.GetId() != r.GetNote().GetId() {
+				v.addViolation("id", "must match note.id")
+			}
+		}
+	case *ehrpb.RetrieveNoteRequest:
+		v.requiredGuid("guid", r.GetGuid())
+	case *ehrpb.DeleteNoteRequest:
+		v.requiredGuid("guid", r.GetGuid())
+	case *ehrpb.SearchNotesRequest:
+		v.optionalGuid("visit_guid", r.GetVisitGuid())
+		v.optionalGuid("author_guid", r.GetAuthorGuid())
+		v.optionalGuid("patient_guid", r.GetPatientGuid())
+	case *ehrpb.SearchNoteFragmentRequest:
+		v.optionalGuid("note_guid", r.GetNoteGuid())
+		v.optionalGuid("visit_guid", r.GetVisitGuid())
+		v.optionalGuid("author_guid", r.GetAuthorGuid())
+		v.optionalGuid("patient_guid", r.GetPatientGuid())
+	case *clerkpb.LookupIcd10CodesRequest:
+		if strings.TrimSpace(r.Query) == "" {
+			v.addViolation("query", "is required")
+		}
+		if r.Limit < 0 || r.Limit > MaxIcd10SearchLimit {
+			v.addViolation("limit", "must be between 0 and %v", MaxIcd10SearchLimit)
+		}
+	case *clerkpb.ExportCcdaRequest:
+		if (r.NoteGuid == "") == (r.VisitGuid == "") {
+			v.addViolation("note_guid", "or visit_guid is required, but not both")
+		}
+		v.optionalGuid("note_guid", r.NoteGuid)
+		v.optionalGuid("visit_guid", r.VisitGuid)
+		switch ccda.DocumentType(r.DocumentType) {
+		case "", ccda.ProgressNote, ccda.ConsultationNote:
+		default:
+			v.addViolation("document_type", "must be %v or %v", ccda.ProgressNote, ccda.ConsultationNote)
+		}
+	case *clerkpb.RenderNoteRequest:
+		v.requiredGuid("note_guid", r.NoteGuid)
+		switch render.Format(r.Format) {
+		case render.Markdown, render.HTML, render.PDF:
+		default:
+			v.addViolation("format", "must be one of %v, %v or %v", render.Markdown, render.HTML, render.PDF)
+		}
+	case *clerkpb.WatchNotesRequest:
+		if r.AfterOffset < 0 {
+			v.addViolation("after_offset", "must not be negative")
+		}
+		for k, t := range r.EventTypes {
+			if !matchesEventTypes(&NoteEvent{Type: t}, EventTypes) {
+				v.addViolation(fmt.Sprintf("event_types[%v]", k), "must be one of %v", strings.Join(EventTypes, ", "))
+			}
+		}
+	case *clerkpb.CreateWebhookSubscriptionRequest:
+		if u, err := url.Parse(r.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.addViolation("url", "must be an http or https URL")
+		}
+		v.optionalGuid("patient_guid", r.PatientGuid)
+		for k, t := range r.NoteTypes {
+			if _, ok := ehrpb.NoteType_value[t]; !ok {
+				v.addViolation(fmt.Sprintf("note_types[%v]", k), "must be a NoteType name")
+			}
+		}
+		for k, t := range r.EventTypes {
+			if !matchesEventTypes(&NoteEvent{Type: t}, EventTypes) {
+				v.addViolation(fmt.Sprintf("event_types[%v]", k), "must be one of %v", strings.Join(EventTypes, ", "))
+			}
+		}
+		if r.AfterOffset != nil && *r.AfterOffset < 0 {
+			v.addViolation("after_offset", "must not be negative")
+		}
+	case *clerkpb.DeleteWebhookSubscriptionRequest:
+		v.requiredGuid("guid", r.Guid)
+	case *clerkpb.ImportNotesRequest:
+		if strings.TrimSpace(r.Records) == "" {
+			v.addViolation("records", "is required")
+		}
+		if r.BatchSize < 0 || r.BatchSize > MaxImportBatchSize {
+			v.addViolation("batch_size", "must be between 0 and %v", MaxImportBatchSize)
+		}
+	case *clerkpb.DeidentifyNotesRequest:
+		if len(r.NoteGuids) == 0 && strings.TrimSpace(r.Records) == "" {
+			v.addViolation("note_guids", "or records is required")
+		}
+		if len(r.NoteGuids) > MaxDeidentifyNoteGuids {
+			v.addViolation("note_guids", "must not name more than %v notes", MaxDeidentifyNoteGuids)
+		}
+		for k, g := range r.NoteGuids {
+			v.requiredGuid(fmt.Sprintf("note_guids[%v]", k), g)
+		}
+	}
+
+	return v.err()
+}
+
+// validator accumulates every problem found with a request so they can be returned to the client at once, rather
+// than one per round trip.
+type validator struct {
+	limits     ContentLimits
+	icd10      *Icd10CodeSet
+	violations []*errdetails.BadRequest_FieldViolation
+}
+
+func (v *validator) addViolation(field string, format string, args ...interface{}) {
+	v.violations = append(v.violations, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// err converts the accumulated violations into an InvalidArgument status with a BadRequest detail.
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+
+	var summary []string
+	for _, fv := range v.violations {
+		summary = append(summary, fmt.Sprintf("%v %v", fv.GetField(), fv.GetDescription()))
+	}
+	msg := noteClerkErrMsg(ErrValidateRequestFailsInvalidFields, len(v.violations), strings.Join(summary, "; "))
+
+	st, err := status.New(codes.InvalidArgument, msg).WithDetails(&errdetails.BadRequest{FieldViolations: v.violations})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	return st.Err()
+}
+
+// note validates a note and each of its fragments. Notes being updated must carry the GUID of the note they replace;
+// new notes are assigned a GUID by the server.
+func (v *validator) note(field string, note *ehrpb.Note, requireGuid bool) {
+	if requireGuid {
+		v.requiredGuid(field+".note_guid", note.GetNoteGuid())
+	} else {
+		v.optionalGuid(field+".note_guid", note.GetNoteGuid())
+	}
+	v.requiredGuid(field+".patient_guid", note.GetPatientGuid())
+	v.requiredGuid(field+".author_guid", note.GetAuthorGuid())
+	v.optionalGuid(field+".visit_guid", note.GetVisitGuid())
+	v.enum(field+".type", int32(note.GetType()), ehrpb.NoteType_name)
+	v.enum(field+".status", int32(note.GetStatus()), ehrpb.RecordStatus_name)
+	v.tags(field+".tags", note.GetTags())
+
+	for k, frag := range note.GetFragments() {
+		fragField := fmt.Sprintf("%v.fragments[%v]", field, k)
+		if !v.present(fragField, frag != nil) {
+			continue
+		}
+		v.noteFragment(fragField, frag)
+		if frag.GetNoteGuid() != "" && frag.GetNoteGuid() != note.GetNoteGuid() {
+			v.addViolation(fragField+".note_guid", "must be empty or match the note_guid of the parent note")
+		}
+	}
+}
+
+// noteFragment validates the fields of a single note fragment.
+func (v *validator) noteFragment(field string, frag *ehrpb.NoteFragment) {
+	v.optionalGuid(field+".note_fragment_guid", frag.GetNoteFragmentGuid())
+	v.optionalGuid(field+".issue_guid", frag.GetIssueGuid())
+	v.enum(field+".topic", int32(frag.GetTopic()), ehrpb.FragmentType_name)
+	v.enum(field+".status", int32(frag.GetStatus()), ehrpb.RecordStatus_name)
+	v.enum(field+".priority", int32(frag.GetPriority()), ehrpb.RecordPriority_name)
+	v.maxLength(field+".content", frag.GetContent(), v.limits.maxFragmentContentLength())
+	v.maxLength(field+".description", frag.GetDescription(), v.limits.maxFragmentDescriptionLength())
+	v.tags(field+".tags", frag.GetTags())
+	v.icd10Code(field, frag)
+}
+
+// icd10Code checks that a fragment's ICD-10-CM code exists and, when a long description is supplied, that it is the
+// description of that code. An empty long description is filled in by the server.
+func (v *validator) icd10Code(field string, frag *ehrpb.NoteFragment) {
+	if v.icd10 == nil || frag.GetIcd_10Code() == "" {
+		return
+	}
+	code, ok := v.icd10.Lookup(frag.GetIcd_10Code())
+	if !ok {
+		v.addViolation(field+".icd_10code", "is not an ICD-10-CM code")
+		return
+	}
+	if strings.TrimSpace(frag.GetIcd_10Long()) != "" && !code.DescriptionMatches(frag.GetIcd_10Long()) {
+		v.addViolation(field+".icd_10long", "does not match the description of icd_10code")
+	}
+}
+
+func (v *validator) tags(field string, tags []string) {
+	for k, tag := range tags {
+		tagField := fmt.Sprintf("%v[%v]", field, k)
+		if strings.TrimSpace(tag) == "" {
+			v.addViolation(tagField, "must not be blank")
+		}
+		v.maxLength(tagField, tag, v.limits.maxTagLength())
+	}
+}
+
+// present records a violation if a required message is missing, and reports whether it is present.
+func (v *validator) present(field string, ok bool) bool {
+	if !ok {
+		v.addViolation(field, "is required")
+	}
+	return ok
+}
+
+func (v *validator) requiredGuid(field string, value string) {
+	if value == "" {
+		v.addViolation(field, "is required")
+		return
+	}
+	v.optionalGuid(field, value)
+}
+
+func (v *validator) optionalGuid(field string, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := uuid.Parse(value); err != nil {
+		v.addViolation(field, "must be a valid GUID")
+	}
+}
+
+func (v *validator) enum(field string, value int32, names map[int32]string) {
+	if _, ok := names[value]; !ok {
+		v.addViolation(field, "has unknown value %v", value)
+	}
+}
+
+// maxLength compares the number of characters, rather than bytes, in value against max.
+func (v *validator) maxLength(field string, value string, max int) {
+	if n := utf8.RuneCountInString(value); n > max {
+		v.addViolation(field, "is %v characters long, which exceeds the limit of %v characters", n, max)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noted"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateRequest_WithValidCreateNoteRequest_ReturnsNil(t *testing.T) {
+	req := &ehrpb.CreateNoteRequest{Note: buildValidNote()}
+
+	if err := validateRequest(req, ContentLimits{}, nil); err != nil {
+		t.Fatalf("A valid note should pass validation, but got %v", err)
+	}
+}
+
+func TestValidateRequest_ReportsEveryViolationAtOnce(t *testing.T) {
+	note := buildValidNote()
+	note.PatientGuid = ""
+	note.AuthorGuid = "not-a-guid"
+	note.Type = ehrpb.NoteType(9999)
+	note.Fragments[0].NoteGuid = uuid.New().String()
+
+	err := validateRequest(&ehrpb.CreateNoteRequest{Note: note}, ContentLimits{}, nil)
+
+	fields := violatedFields(t, err)
+	for _, expected := range []string{"note.patient_guid", "note.author_guid", "note.type", "note.fragments[0].note_guid"} {
+		if !fields[expected] {
+			t.Fatalf("Expected a violation for %v, but violations were %v", expected, fields)
+		}
+	}
+}
+
+func TestValidateRequest_AcceptsContentLongerThanLegacyColumn(t *testing.T) {
+	note := buildValidNote()
+	note.Fragments[0].Content = strings.Repeat("a", 2501)
+
+	if err := validateRequest(&ehrpb.CreateNoteRequest{Note: note}, ContentLimits{}, nil); err != nil {
+		t.Fatalf("Content of 2501 characters should be accepted under the default limits, but got %v", err)
+	}
+}
+
+func TestValidateRequest_RejectsContentOverConfiguredLimit(t *testing.T) {
+	note := buildValidNote()
+	note.Fragments[0].Content = strings.Repeat("a", 11)
+
+	err := validateRequest(&ehrpb.CreateNoteRequest{Note: note}, ContentLimits{MaxFragmentContentLength: 10}, nil)
+
+	if !violatedFields(t, err)["note.fragments[0].content"] {
+		t.Fatalf("Content longer than the configured limit should be rejected, but got %v", err)
+	}
+}
+
+func TestValidateRequest_CountsCharactersNotBytes(t *testing.T) {
+	note := buildValidNote()
+	note.Fragments[0].Description = strings.Repeat("é", 10)
+
+	if err := validateRequest(&ehrpb.CreateNoteRequest{Note: note}, ContentLimits{MaxFragmentDescriptionLength: 10}, nil); err != nil {
+		t.Fatalf("Ten two-byte characters should fit a ten character limit, but got %v", err)
+	}
+}
+
+func TestValidateRequest_RejectsOversizeTagOnFragment(t *testing.T) {
+	note := buildValidNote()
+	note.Fragments[0].Tags = append(note.Fragments[0].Tags, strings.Repeat("t", DefaultMaxTagLength+1))
+
+	err := validateRequest(&ehrpb.CreateNoteRequest{Note: note}, ContentLimits{}, nil)
+
+	if !violatedFields(t, err)["note.fragments[0].tags[0]"] {
+		t.Fatalf("A fragment tag longer than the default limit should be rejected, but got %v", err)
+	}
+}
+
+func TestNoteClerkServer_CreateNote_WithContentOverLimit_ReturnsInvalidArgument(t *testing.T) {
+	s := &Server{}
+	s.Initialize(&Config{MaxFragmentContentLength: 100}, mockDb)
+
+	note := buildValidNote()
+	note.Fragments[0].Content = strings.Repeat("a", 101)
+	info := &grpc.UnaryServerInfo{Server: s, FullMethod: "/ehrpb.NoteService/CreateNote"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.CreateNote(ctx, req.(*ehrpb.CreateNoteRequest))
+	}
+
+	_, err := chainUnaryInterceptors(s.unaryInterceptors(), info, handler)(context.Background(),
+		&ehrpb.CreateNoteRequest{Note: note})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected an InvalidArgument error for oversize content, but got %v", err)
+	}
+}
+
+func TestValidateRequest_UpdateNoteWithMismatchedId_IsRejected(t *testing.T) {
+	note := buildValidNote()
+	note.Id = 3
+
+	err := validateRequest(&ehrpb.UpdateNoteRequest{Id: 4, Note: note}, ContentLimits{}, nil)
+
+	if !violatedFields(t, err)["id"] {
+		t.Fatalf("An update whose id does not match the note id should be rejected, but got %v", err)
+	}
+}
+
+func TestValidateRequest_RetrieveNoteWithMalformedGuid_IsRejected(t *testing.T) {
+	err := validateRequest(&ehrpb.RetrieveNoteRequest{Guid: "1234"}, ContentLimits{}, nil)
+
+	if !violatedFields(t, err)["guid"] {
+		t.Fatalf("A malformed GUID should be rejected, but got %v", err)
+	}
+}
+
+func TestNoteClerkServer_ValidationInterceptor_RejectsBeforeHandler(t *testing.T) {
+	s := &Server{}
+	s.Initialize(&Config{MaxFragmentContentLength: 100}, mockDb)
+
+	note := buildValidNote()
+	note.Fragments[0].Content = strings.Repeat("a", 101)
+
+	handlerCalled := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handlerCalled = true
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/ehrpb.NoteService/CreateNote"}
+
+	_, err := s.validationInterceptor(context.Background(), &ehrpb.CreateNoteRequest{Note: note}, info, handler)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected an InvalidArgument error for oversize content, but got %v", err)
+	}
+
+	if handlerCalled {
+		t.Fatalf("The handler should not be called for an invalid request.")
+	}
+}
+
+func buildValidNote() *ehrpb.Note {
+	nb := &noted.NoteBuilder{}
+	note := nb.Init().
+		SetPatientGuid(uuid.New().String()).
+		SetAuthorGuid(uuid.New().String()).
+		SetVisitGuid(uuid.New().String()).
+		SetType(ehrpb.NoteType_HISTORY_AND_PHYSICAL).
+		Build()
+	note.Tags = append(note.Tags, "tag1")
+	fb := &noted.NoteFragmentBuilder{}
+	frag := fb.InitFromNote(note).
+		SetStatus(ehrpb.RecordStatus_ACTIVE).
+		SetPriority(ehrpb.RecordPriority_HIGH).
+		SetTopic(ehrpb.FragmentType_SUBJECTIVE).
+		SetDescription("Chief complaint").
+		SetContent("Patient reports three days of cough.").
+		Build()
+	note.Fragments = append(note.Fragments, frag)
+	return note
+}
+
+func violatedFields(t *testing.T, err error) map[string]bool {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.InvalidArgument {
+		t.Fatalf("Expected an InvalidArgument status, but got %v", err)
+	}
+
+	fields := make(map[string]bool)
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, fv := range br.GetFieldViolations() {
+				fields[fv.GetField()] = true
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// webhookPublisherName is the name under which the EventWebhookUrl publisher's event cursor is stored.
+const webhookPublisherName = "webhook"
+
+// subscriptionConsumerPrefix begins the names under which webhook subscriptions' event cursors are stored.
+const subscriptionConsumerPrefix = "webhook:"
+
+// subscriptionMetricLabel is the publisher label of the metrics of every webhook subscription, which are counted
+// together so that the number of series does not grow with the number of subscriptions.
+const subscriptionMetricLabel = "webhook_subscription"
+
+// Headers sent with each webhook delivery, alongside the event as a JSON body, so that receivers can route and
+// deduplicate deliveries without parsing them.
+const (
+	EventTypeHeader   = "X-Noteclerk-Event"
+	EventOffsetHeader = "X-Noteclerk-Event-Offset"
+
+	// WebhookSubscriptionHeader carries the GUID of the subscription a delivery was made for.
+	WebhookSubscriptionHeader = "X-Noteclerk-Subscription"
+	// WebhookSignatureHeader carries the signature of deliveries to webhook subscriptions, in the form
+	// 't=<unix seconds>,v1=<hex HMAC-SHA256>'. See SignWebhookPayload.
+	WebhookSignatureHeader = "X-Noteclerk-Signature"
+)
+
+// DefaultEventWebhookTimeout bounds each webhook delivery, including reading the response.
+const DefaultEventWebhookTimeout = 10 * time.Second
+
+// Deliveries to webhook subscriptions are retried with exponential backoff: the first retry waits WebhookRetryBackoff,
+// each one after twice as long as the one before, up to MaxWebhookRetryBackoff. After WebhookMaxAttempts deliveries
+// have failed, the event is recorded as a dead letter and the subscription moves on to its next event.
+const (
+	DefaultWebhookMaxAttempts  = 8
+	DefaultWebhookRetryBackoff = time.Second
+	MaxWebhookRetryBackoff     = 5 * time.Minute
+)
+
+// DefaultWebhookSignatureTolerance is how old a signature VerifyWebhookSignature accepts by default, which limits how
+// long a captured delivery could be replayed.
+const DefaultWebhookSignatureTolerance = 5 * time.Minute
+
+// webhookTargetPolicy is which URLs events may be delivered to. By default only https URLs of public addresses are,
+// so that a webhook subscription cannot be used to reach the services on the server's own network, such as a cloud
+// provider's instance metadata.
+type webhookTargetPolicy struct {
+	allowHttp    bool
+	allowPrivate bool
+}
+
+// anyWebhookTarget is the policy of the EventWebhookUrl publisher, whose URL is configured rather than requested.
+var anyWebhookTarget = webhookTargetPolicy{allowHttp: true, allowPrivate: true}
+
+// privateWebhookNetworks are the loopback, private, shared, link-local (which includes the 169.254.169.254 metadata
+// address), unique local (which includes fd00:ec2::254), unspecified and multicast networks.
+var privateWebhookNetworks = parseNetworks("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+	"169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16", "224.0.0.0/4", "::/128", "::1/128", "fc00::/7", "fe80::/10",
+	"ff00::/8")
+
+// privateWebhookHosts are names which reach the server itself or a cloud provider's instance metadata.
+var privateWebhookHosts = []string{"localhost", "metadata", "metadata.google.internal"}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// violation describes why events may not be delivered to rawUrl, judging by its scheme and host alone; addresses a
+// host name resolves to are checked when connecting. See control.
+// RETURNS: string, empty when rawUrl is allowed
+func (p webhookTargetPolicy) violation(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "must be an http or https URL"
+	}
+	if u.Scheme != "https" && !p.allowHttp {
+		return "must be an https URL"
+	}
+	if p.allowPrivate {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if containsString(privateWebhookHosts, host) || strings.HasSuffix(host, ".localhost") {
+		return "must not be a loopback, private, link-local or metadata address"
+	}
+	if ip := net.ParseIP(host); ip != nil && privateWebhookAddress(ip) {
+		return "must not be a loopback, private, link-local or metadata address"
+	}
+	return ""
+}
+
+// control is the net.Dialer Control function of webhook deliveries. It refuses connections to private addresses
+// unless they are allowed, whatever host name resolved to them.
+// RETURNS: error
+func (p webhookTargetPolicy) control(network string, address string, c syscall.RawConn) error {
+	if p.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || privateWebhookAddress(ip) {
+		return NoteClerkErrNew(ErrWebhookPublisherFailsPrivateAddress, host)
+	}
+	return nil
+}
+
+func privateWebhookAddress(ip net.IP) bool {
+	for _, network := range privateWebhookNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookPublisher is an EventPublisher which POSTs each event, as JSON, to a URL. Any 2xx response accepts the event;
+// anything else, or no response, causes it to be delivered again. Deliveries are signed when there is a secret.
+type webhookPublisher struct {
+	url          string
+	secret       string
+	subscription string
+	client       *http.Client
+}
+
+// newWebhookPublisher returns a publisher delivering events to url, connecting only to the addresses targets allows and
+// following redirects only to the URLs it allows. When private addresses are not allowed, deliveries are made directly
+// rather than through a proxy, so that the address checked is the one connected to.
+// RETURNS: *webhookPublisher
+func newWebhookPublisher(url string, targets webhookTargetPolicy) *webhookPublisher {
+	dialer := &net.Dialer{Timeout: DefaultEventWebhookTimeout, Control: targets.control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if !targets.allowPrivate {
+		transport.Proxy = nil
+	}
+	return &webhookPublisher{url: url, client: &http.Client{
+		Timeout:   DefaultEventWebhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// The redirect itself is then the response, which refuses the delivery
+			if len(via) >= 10 || targets.violation(req.URL.String()) != "" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}}
+}
+
+// Publish is a method contracted by the EventPublisher interface.
+func (w *webhookPublisher) Publish(ctx context.Context, event *NoteEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrWebhookPublisherFailsPost, event.Offset, w.url)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrWebhookPublisherFailsPost, event.Offset, w.url)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventTypeHeader, event.Type)
+	req.Header.Set(EventOffsetHeader, strconv.FormatInt(event.Offset, 10))
+	if w.subscription != "" {
+		req.Header.Set(WebhookSubscriptionHeader, w.subscription)
+	}
+	if w.secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(w.secret, time.Now(), body))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return NoteClerkErrWrap(err, ErrWebhookPublisherFailsPost, event.Offset, w.url)
+	}
+	defer res.Body.Close()
+	// Drain the response so that the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return NoteClerkErrNew(ErrWebhookPublisherFailsStatus, event.Offset, w.url, res.Status)
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the WebhookSignatureHeader value for body, signed with secret at time at. The signature is
+// the hex encoded HMAC-SHA256, keyed with the secret, of the Unix time in seconds, a full stop and the body.
+// RETURNS: string
+func SignWebhookPayload(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return fmt.Sprintf("t=%v,v1=%v", timestamp, hex.EncodeToString(webhookMac(secret, timestamp, body)))
+}
+
+// VerifyWebhookSignature checks that the WebhookSignatureHeader value signature was made for body with secret, no more
+// than tolerance ago. Receivers written in Go can use it to authenticate deliveries.
+// RETURNS: error, or nil when the signature is valid
+func VerifyWebhookSignature(secret string, signature string, body []byte, tolerance time.Duration) error {
+	var timestamp, mac string
+	for _, part := range strings.Split(signature, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return NoteClerkErrNew(ErrVerifyWebhookSignatureFailsMalformed, signature)
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			mac = kv[1]
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	expected, decodeErr := hex.DecodeString(mac)
+	if err != nil || decodeErr != nil || mac == "" {
+		return NoteClerkErrNew(ErrVerifyWebhookSignatureFailsMalformed, signature)
+	}
+
+	signedAt := time.Unix(seconds, 0)
+	if age := time.Since(signedAt); age > tolerance || age < -tolerance {
+		return NoteClerkErrNew(ErrVerifyWebhookSignatureFailsExpired, signedAt.UTC().Format(time.RFC3339), tolerance)
+	}
+	if !hmac.Equal(expected, webhookMac(secret, timestamp, body)) {
+		return NoteClerkErrNew(ErrVerifyWebhookSignatureFailsMismatch)
+	}
+	return nil
+}
+
+func webhookMac(secret string, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// newWebhookSecret returns a random secret for signing the deliveries of a new subscription.
+// RETURNS: string, error
+func newWebhookSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(key), nil
+}
+
+// WebhookSubscription asks for the note events matching its filters to be delivered to Url. Empty filters match every
+// event. Events after AfterOffset are delivered, signed with Secret, which is only returned when the subscription is
+// created.
+type WebhookSubscription struct {
+	Guid        string    `json:"guid"`
+	Url         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	PatientGuid string    `json:"patient_guid,omitempty"`
+	NoteTypes   []string  `json:"note_types,omitempty"`
+	EventTypes  []string  `json:"event_types,omitempty"`
+	AfterOffset int64     `json:"after_offset"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+// Matches reports whether event passes every filter of the subscription.
+func (s *WebhookSubscription) Matches(event *NoteEvent) bool {
+	if s.PatientGuid != "" && s.PatientGuid != event.PatientGuid {
+		return false
+	}
+	if len(s.NoteTypes) > 0 && !containsString(s.NoteTypes, event.NoteType) {
+		return false
+	}
+	return matchesEventTypes(event, s.EventTypes)
+}
+
+// consumer is the name under which the subscription's event cursor is stored.
+func (s *WebhookSubscription) consumer() string {
+	return subscriptionConsumerPrefix + s.Guid
+}
+
+// WebhookDeadLetter is an event which could not be delivered to a subscription.
+type WebhookDeadLetter struct {
+	SubscriptionGuid string
+	Event            *NoteEvent
+	Attempts         int
+	LastError        string
+	FailedAt         time.Time
+}
+
+// webhookRetryPolicy is how many times, and how often, deliveries to webhook subscriptions are attempted.
+type webhookRetryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// delay returns how long to wait after the given number of failed attempts before the next one.
+func (p webhookRetryPolicy) delay(failed int) time.Duration {
+	delay := p.backoff
+	for k := 1; k < failed && delay < MaxWebhookRetryBackoff; k++ {
+		delay *= 2
+	}
+	if delay > MaxWebhookRetryBackoff {
+		return MaxWebhookRetryBackoff
+	}
+	return delay
+}
+
+// subscriptionPublisher is the EventPublisher for a webhook subscription. Events which do not match the subscription
+// are skipped. Deliveries are retried according to the retry policy, and an event which cannot be delivered is
+// recorded as a dead letter, so that it does not hold back the events after it.
+type subscriptionPublisher struct {
+	subscription *WebhookSubscription
+	webhook      *webhookPublisher
+	retry        webhookRetryPolicy
+	db           RDBMSAccessor
+
+	// renew is called before waiting to retry, so that the subscription's event cursor is not claimed by another
+	// server during the wait. It reports whether the cursor is still held.
+	renew func(wait time.Duration) bool
+}
+
+// Publish is a method contracted by the EventPublisher interface.
+func (p *subscriptionPublisher) Publish(ctx context.Context, event *NoteEvent) error {
+	if event.Offset <= p.subscription.AfterOffset || !p.subscription.Matches(event) {
+		return nil
+	}
+
+	var err error
+	attempts := 0
+	for attempts < p.retry.maxAttempts {
+		if attempts > 0 {
+			wait := p.retry.delay(attempts)
+			if !p.renew(wait) {
+				return NoteClerkErrWrap(err, ErrWebhookSubscriptionFailsLostCursor, p.subscription.Guid, event.Offset)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		attempts++
+		if err = p.webhook.Publish(ctx, event); err == nil {
+			return nil
+		}
+		eventPublishFailuresTotal.WithLabelValues(subscriptionMetricLabel).Inc()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	log.Warn(NoteClerkErrWrap(err, ErrWebhookSubscriptionFailsDeliver, p.subscription.Guid, event.Offset, attempts))
+	webhookDeadLettersTotal.Inc()
+	letter := &WebhookDeadLetter{SubscriptionGuid: p.subscription.Guid, Event: event, Attempts: attempts,
+		LastError: err.Error(), FailedAt: time.Now().UTC()}
+	if err := p.db.AddWebhookDeadLetter(letter); err != nil {
+		return NoteClerkErrWrap(err, ErrWebhookSubscriptionFailsRecordDeadLetter, p.subscription.Guid, event.Offset)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
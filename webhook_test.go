@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geekmdio/ehrprotorepo/v1/generated/goproto"
+	"github.com/geekmdio/noteclerk/clerkpb"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// webhookTestReceiver is a local webhook endpoint which records the events delivered to it whose signatures verify
+// with secret, and answers every delivery with code.
+type webhookTestReceiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	secret     string
+	code       int
+	deliveries int
+	received   []*NoteEvent
+}
+
+func newWebhookTestReceiver(code int) *webhookTestReceiver {
+	r := &webhookTestReceiver{code: code}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.deliveries++
+		err := VerifyWebhookSignature(r.secret, req.Header.Get(WebhookSignatureHeader), body,
+			DefaultWebhookSignatureTolerance)
+		e := &NoteEvent{}
+		if err != nil || json.Unmarshal(body, e) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.code == http.StatusOK {
+			r.received = append(r.received, e)
+		}
+		w.WriteHeader(r.code)
+	}))
+	return r
+}
+
+// subscribe creates a subscription delivering to the receiver, which then verifies deliveries with its secret, and
+// returns the subscription as it was stored. The receiver listens on loopback over http, which s is made to allow.
+func (r *webhookTestReceiver) subscribe(t *testing.T, s *Server,
+	req *clerkpb.CreateWebhookSubscriptionRequest) *WebhookSubscription {
+	s.events.targets = anyWebhookTarget
+	req.Url = r.URL
+	res, err := s.CreateWebhookSubscription(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Failed to create a webhook subscription: %v", err)
+	}
+	r.mu.Lock()
+	r.secret = res.Subscription.Secret
+	r.mu.Unlock()
+
+	subs, err := s.reader(context.Background()).WebhookSubscriptions()
+	if err != nil {
+		t.Fatalf("Failed to list the webhook subscriptions: %v", err)
+	}
+	for _, v := range subs {
+		if v.Guid == res.Subscription.Guid {
+			return v
+		}
+	}
+	t.Fatalf("Expected the subscription %v to be stored", res.Subscription.Guid)
+	return nil
+}
+
+func TestWebhookSubscription_DeliversSignedMatchingEvents(t *testing.T) {
+	receiver := newWebhookTestReceiver(http.StatusOK)
+	defer receiver.Close()
+	s, db := newMockDbServer(t)
+	addRenderNote(t, db)
+
+	watched := uuid.New().String()
+	sub := receiver.subscribe(t, s, &clerkpb.CreateWebhookSubscriptionRequest{PatientGuid: watched,
+		NoteTypes: []string{"HISTORY_AND_PHYSICAL"}, EventTypes: []string{EventNoteCreated, EventNoteDeleted}})
+	if sub.Secret == "" || sub.AfterOffset != 2 {
+		t.Fatalf("Expected a secret and only events from now on to be delivered, but got %+v", sub)
+	}
+
+	addRenderNote(t, db)
+	note := &ehrpb.Note{NoteGuid: uuid.New().String(), PatientGuid: watched, AuthorGuid: uuid.New().String(),
+		Type: ehrpb.NoteType_HISTORY_AND_PHYSICAL, Status: ehrpb.RecordStatus_ACTIVE}
+	if _, _, err := db.AddNote(note); err != nil {
+		t.Fatalf("Failed to add a note: %v", err)
+	}
+	addRenderNote(t, db)
+	s.events.poll()
+	s.events.publish(context.Background(), sub.consumer(), s.events.subscriptionPublisher(sub), sub.AfterOffset)
+
+	receiver.mu.Lock()
+	if types := eventTypesOf(receiver.received); len(types) != 1 || types[0] != EventNoteCreated ||
+		receiver.received[0].PatientGuid != watched {
+		t.Fatalf("Expected only the watched patient's NoteCreated, signed, but got %+v", receiver.received)
+	}
+	receiver.mu.Unlock()
+	if offset, _, _ := db.ClaimNoteEventCursor(sub.consumer(), s.events.owner, time.Minute); offset != 8 {
+		t.Fatalf("Expected the cursor to have advanced past the events which were skipped, but it is at %v", offset)
+	}
+
+	list, err := s.ListWebhookSubscriptions(context.Background(), &clerkpb.ListWebhookSubscriptionsRequest{})
+	if err != nil || len(list.Subscriptions) != 1 || list.Subscriptions[0].Guid != sub.Guid ||
+		list.Subscriptions[0].Secret != "" {
+		t.Fatalf("Expected the subscription to be listed without its secret, but got %+v: %v", list, err)
+	}
+	if _, err := s.DeleteWebhookSubscription(context.Background(),
+		&clerkpb.DeleteWebhookSubscriptionRequest{Guid: sub.Guid}); err != nil {
+		t.Fatalf("Failed to delete the subscription: %v", err)
+	}
+	_, err = s.DeleteWebhookSubscription(context.Background(), &clerkpb.DeleteWebhookSubscriptionRequest{Guid: sub.Guid})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound for a subscription already deleted, but got %v", err)
+	}
+}
+
+func TestWebhookSubscription_RecordsDeadLetterAfterRetries(t *testing.T) {
+	receiver := newWebhookTestReceiver(http.StatusInternalServerError)
+	defer receiver.Close()
+	s, db := newMockDbServer(t)
+	s.events.retry = webhookRetryPolicy{maxAttempts: 3, backoff: time.Millisecond}
+
+	sub := receiver.subscribe(t, s, &clerkpb.CreateWebhookSubscriptionRequest{EventTypes: []string{EventNoteSigned}})
+	addRenderNote(t, db)
+	s.events.poll()
+	s.events.publish(context.Background(), sub.consumer(), s.events.subscriptionPublisher(sub), sub.AfterOffset)
+
+	receiver.mu.Lock()
+	deliveries := receiver.deliveries
+	receiver.mu.Unlock()
+	if deliveries != 3 {
+		t.Fatalf("Expected the event to be delivered 3 times, but it was delivered %v times", deliveries)
+	}
+	db.eventsMu.Lock()
+	letters := db.deadLetters
+	db.eventsMu.Unlock()
+	if len(letters) != 1 || letters[0].Event.Type != EventNoteSigned || letters[0].Attempts != 3 ||
+		letters[0].SubscriptionGuid != sub.Guid {
+		t.Fatalf("Expected NoteSigned to be recorded as a dead letter after 3 attempts, but got %+v", letters)
+	}
+	if offset, _, _ := db.ClaimNoteEventCursor(sub.consumer(), s.events.owner, time.Minute); offset != 2 {
+		t.Fatalf("Expected the dead letter not to hold back later events, but the cursor is at %v", offset)
+	}
+}
+
+func TestWebhookSubscription_CountsFailuresUnderOneLabel(t *testing.T) {
+	receiver := newWebhookTestReceiver(http.StatusInternalServerError)
+	defer receiver.Close()
+	s, db := newMockDbServer(t)
+	s.events.retry = webhookRetryPolicy{maxAttempts: 2, backoff: time.Millisecond}
+
+	before := testutil.ToFloat64(eventPublishFailuresTotal.WithLabelValues(subscriptionMetricLabel))
+	sub := receiver.subscribe(t, s, &clerkpb.CreateWebhookSubscriptionRequest{EventTypes: []string{EventNoteSigned}})
+	addRenderNote(t, db)
+	s.events.poll()
+	s.events.publish(context.Background(), sub.consumer(), s.events.subscriptionPublisher(sub), sub.AfterOffset)
+
+	after := testutil.ToFloat64(eventPublishFailuresTotal.WithLabelValues(subscriptionMetricLabel))
+	if failures := after - before; failures != 2 {
+		t.Fatalf("Expected both failed deliveries to be counted as %v, but %v were", subscriptionMetricLabel, failures)
+	}
+	if publisherMetricLabel(sub.consumer()) != subscriptionMetricLabel ||
+		publisherMetricLabel(webhookPublisherName) != webhookPublisherName {
+		t.Fatalf("Expected subscriptions to share one label and the EventWebhookUrl publisher to keep its own")
+	}
+}
+
+func TestWebhookTargetPolicy_Violation(t *testing.T) {
+	tests := []struct {
+		url     string
+		policy  webhookTargetPolicy
+		allowed bool
+	}{
+		{"https://hooks.example.com/notes", webhookTargetPolicy{}, true},
+		{"https://93.184.216.34:8443/notes", webhookTargetPolicy{}, true},
+		{"http://hooks.example.com/notes", webhookTargetPolicy{}, false},
+		{"http://hooks.example.com/notes", webhookTargetPolicy{allowHttp: true}, true},
+		{"ftp://hooks.example.com/notes", anyWebhookTarget, false},
+		{"https://127.0.0.1/notes", webhookTargetPolicy{}, false},
+		{"https://localhost:8443/notes", webhookTargetPolicy{}, false},
+		{"https://10.1.2.3/notes", webhookTargetPolicy{}, false},
+		{"https://192.168.0.10/notes", webhookTargetPolicy{}, false},
+		{"https://169.254.169.254/latest/meta-data/", webhookTargetPolicy{}, false},
+		{"https://metadata.google.internal/computeMetadata/v1/", webhookTargetPolicy{}, false},
+		{"https://[::1]/notes", webhookTargetPolicy{}, false},
+		{"https://[fd00:ec2::254]/notes", webhookTargetPolicy{}, false},
+		{"https://[::ffff:127.0.0.1]/notes", webhookTargetPolicy{}, false},
+		{"https://10.1.2.3/notes", webhookTargetPolicy{allowPrivate: true}, true},
+	}
+	for _, tt := range tests {
+		if violation := tt.policy.violation(tt.url); (violation == "") != tt.allowed {
+			t.Fatalf("Expected %v to be allowed (%v) by %+v, but the violation was '%v'", tt.url, tt.allowed,
+				tt.policy, violation)
+		}
+	}
+}
+
+func TestCreateWebhookSubscription_RefusesHttpAndPrivateTargetsByDefault(t *testing.T) {
+	s, _ := newMockDbServer(t)
+	for _, url := range []string{"http://hooks.example.com/notes", "https://127.0.0.1/notes",
+		"https://169.254.169.254/latest/meta-data/"} {
+		_, err := s.CreateWebhookSubscription(context.Background(), &clerkpb.CreateWebhookSubscriptionRequest{Url: url})
+		if fields := violatedFields(t, err); !fields["url"] {
+			t.Fatalf("Expected %v to be refused, but got %v", url, err)
+		}
+	}
+	subs, err := s.reader(context.Background()).WebhookSubscriptions()
+	if err != nil || len(subs) != 0 {
+		t.Fatalf("Expected no subscription to be stored, but got %+v: %v", subs, err)
+	}
+}
+
+func TestWebhookPublisher_RefusesToConnectToPrivateAddresses(t *testing.T) {
+	receiver := newWebhookTestReceiver(http.StatusOK)
+	defer receiver.Close()
+
+	// The addresses a host name resolves to are checked when connecting, not only literal addresses
+	u, _ := url.Parse(receiver.URL)
+	named := "http://localhost:" + u.Port()
+	for _, target := range []string{receiver.URL, named} {
+		publisher := newWebhookPublisher(target, webhookTargetPolicy{allowHttp: true})
+		if err := publisher.Publish(context.Background(), &NoteEvent{Offset: 1, Type: EventNoteCreated}); err == nil {
+			t.Fatalf("Expected the delivery to %v to be refused", target)
+		}
+	}
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if receiver.deliveries != 0 {
+		t.Fatalf("Expected no connection to be made, but the receiver had %v deliveries", receiver.deliveries)
+	}
+}
+
+func TestWebhookRetryPolicy_BacksOffExponentially(t *testing.T) {
+	p := webhookRetryPolicy{maxAttempts: 20, backoff: time.Second}
+	for failed, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second,
+		12: MaxWebhookRetryBackoff} {
+		if d := p.delay(failed); d != expected {
+			t.Fatalf("Expected a delay of %v after %v failures, but got %v", expected, failed, d)
+		}
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"offset":1}`)
+	signature := SignWebhookPayload("secret", time.Now(), body)
+	if err := VerifyWebhookSignature("secret", signature, body, time.Minute); err != nil {
+		t.Fatalf("Expected a fresh signature to verify, but got %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		body      string
+	}{
+		{"another secret", "other", signature, string(body)},
+		{"altered body", "secret", signature, `{"offset":2}`},
+		{"expired", "secret", SignWebhookPayload("secret", time.Now().Add(-time.Hour), body), string(body)},
+		{"malformed", "secret", "v1=abc", string(body)},
+	}
+	for _, tt := range tests {
+		if err := VerifyWebhookSignature(tt.secret, tt.signature, []byte(tt.body), time.Minute); err == nil {
+			t.Fatalf("%v: expected the signature to be rejected", tt.name)
+		}
+	}
+}
+
+func TestValidateRequest_CreateWebhookSubscription(t *testing.T) {
+	negative := int64(-1)
+	err := validateRequest(&clerkpb.CreateWebhookSubscriptionRequest{Url: "ftp://example.com", PatientGuid: "x",
+		NoteTypes: []string{"LETTER"}, EventTypes: []string{"NoteRead"}, AfterOffset: &negative}, ContentLimits{}, nil)
+
+	fields := violatedFields(t, err)
+	for _, expected := range []string{"url", "patient_guid", "note_types[0]", "event_types[0]", "after_offset"} {
+		if !fields[expected] {
+			t.Fatalf("Expected a violation for %v, but violations were %v", expected, fields)
+		}
+	}
+}